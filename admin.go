@@ -16,17 +16,23 @@ package izigo
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"text/template"
 	"time"
 
 	"reflect"
 
+	"github.com/izi-global/izigo/cache"
 	"github.com/izi-global/izigo/grace"
 	"github.com/izi-global/izigo/logs"
+	"github.com/izi-global/izigo/session"
 	"github.com/izi-global/izigo/toolbox"
 	"github.com/izi-global/izigo/utils"
 )
@@ -62,6 +68,10 @@ func init() {
 	iziAdminApp.Route("/healthcheck", healthcheck)
 	iziAdminApp.Route("/task", taskStatus)
 	iziAdminApp.Route("/listconf", listConf)
+	iziAdminApp.Route("/sessions", sessionBrowser)
+	iziAdminApp.Route("/cache", cacheStatus)
+	iziAdminApp.Route("/cache/keys", cacheKeys)
+	iziAdminApp.Route("/cache/metrics", cacheMetrics)
 	FilterMonitorFunc = func(string, string, time.Duration, string, int) bool { return true }
 }
 
@@ -370,6 +380,230 @@ func taskStatus(rw http.ResponseWriter, req *http.Request) {
 	execTpl(rw, data, tasksTpl, defaultScriptsTpl)
 }
 
+// sessionBrowser is a http.Handler listing and revoking the sessions of a principal.
+// it's in "/sessions" pattern in admin module, the session provider must implement session.IndexedProvider
+// and SessionEnableIndex must be set.
+// The session ids are credentials, the page shows and revokes the sessions by their sessionHandle.
+func sessionBrowser(rw http.ResponseWriter, req *http.Request) {
+	data := make(map[interface{}]interface{})
+	data["Title"] = "Sessions"
+	req.ParseForm()
+	principal := req.Form.Get("principal")
+	data["Principal"] = principal
+
+	if GlobalSessions == nil {
+		data["Message"] = []string{"warning", "sessions are disabled, set SessionOn = true"}
+		execTpl(rw, data, sessionsTpl, defaultScriptsTpl)
+		return
+	}
+
+	if req.Method == "POST" && principal != "" {
+		var err error
+		if handle := req.Form.Get("session"); handle != "" {
+			var infos []*session.SessionInfo
+			// only revoke a session which belongs to the principal
+			if infos, err = GlobalSessions.SessionsOf(principal); err == nil {
+				for _, info := range infos {
+					if sessionHandle(info.SID) == handle {
+						err = GlobalSessions.SessionDestroyByID(info.SID)
+						break
+					}
+				}
+			}
+		} else {
+			_, err = GlobalSessions.SessionDestroyAll(principal)
+		}
+		if err != nil {
+			data["Message"] = []string{"error", template.HTMLEscapeString(err.Error())}
+		} else {
+			http.Redirect(rw, req, "/sessions?principal="+url.QueryEscape(principal), http.StatusSeeOther)
+			return
+		}
+	}
+
+	content := map[string]interface{}{
+		"Fields": []string{"Session", "Created", "Last Seen", "IP", "User Agent", ""},
+	}
+	resultList := new([][]string)
+	if principal != "" {
+		infos, err := GlobalSessions.SessionsOf(principal)
+		if err != nil {
+			data["Message"] = []string{"error", template.HTMLEscapeString(err.Error())}
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].LastSeen.After(infos[j].LastSeen) })
+		for _, info := range infos {
+			// the page is a text/template, the values sent by clients are escaped here
+			*resultList = append(*resultList, []string{
+				sessionHandle(info.SID),
+				info.Created.Format(time.RFC3339),
+				info.LastSeen.Format(time.RFC3339),
+				template.HTMLEscapeString(info.IP),
+				template.HTMLEscapeString(info.UserAgent),
+			})
+		}
+	}
+	content["Data"] = resultList
+	data["Content"] = content
+	execTpl(rw, data, sessionsTpl, defaultScriptsTpl)
+}
+
+// sessionHandle returns the opaque handle of the session sid shown by the admin pages.
+func sessionHandle(sid string) string {
+	sum := sha256.Sum256([]byte(sid))
+	return hex.EncodeToString(sum[:8])
+}
+
+// cacheStatus is a http.Handler listing the counters of the caches created by
+// cache.NewCache, their latency histograms and the counters of the cache loaders.
+// it's in "/cache" pattern in admin module.
+func cacheStatus(rw http.ResponseWriter, req *http.Request) {
+	data := make(map[interface{}]interface{})
+	caches := new([][]string)
+	latency := new([][]string)
+	latencyFields := []string{"Cache", "Operation"}
+	for _, bound := range cache.LatencyBuckets {
+		latencyFields = append(latencyFields, "&le; "+bound.String())
+	}
+	latencyFields = append(latencyFields, "Slower", "Average")
+	for _, ic := range cache.Instruments() {
+		st := ic.Stats()
+		name := template.HTMLEscapeString(ic.Name())
+		if _, ok := cache.Unwrap(ic).(cache.KeyLister); ok {
+			name = `<a href="/cache/keys?name=` + url.QueryEscape(ic.Name()) + `">` + name + `</a>`
+		}
+		*caches = append(*caches, []string{
+			name,
+			template.HTMLEscapeString(ic.Adapter()),
+			fmt.Sprint(st.Hits),
+			fmt.Sprint(st.Misses),
+			hitRatio(st.Hits, st.Misses),
+			fmt.Sprint(st.Puts),
+			fmt.Sprint(st.Deletes),
+			fmt.Sprint(st.Errors),
+		})
+		for _, op := range []string{cache.OpGet, cache.OpPut, cache.OpDelete} {
+			h := st.Latency[op]
+			row := []string{template.HTMLEscapeString(ic.Name()), op}
+			for _, n := range h.Counts {
+				row = append(row, fmt.Sprint(n))
+			}
+			average := "-"
+			if h.Count > 0 {
+				average = (h.Sum / time.Duration(h.Count)).String()
+			}
+			*latency = append(*latency, append(row, average))
+		}
+	}
+
+	loaders := new([][]string)
+	for _, l := range cache.Loaders() {
+		st := l.Stats()
+		*loaders = append(*loaders, []string{
+			template.HTMLEscapeString(l.Name()),
+			fmt.Sprint(st.Hits),
+			fmt.Sprint(st.Misses),
+			fmt.Sprint(st.Stale),
+			fmt.Sprint(st.NegativeHits),
+			fmt.Sprint(st.Loads),
+			fmt.Sprint(st.Coalesced),
+			fmt.Sprint(st.Refreshes),
+			fmt.Sprint(st.Errors),
+			hitRatio(st.Hits+st.Stale+st.NegativeHits, st.Misses),
+		})
+	}
+	data["Content"] = map[string]interface{}{
+		"Caches": map[string]interface{}{
+			"Fields": []string{"Cache", "Adapter", "Hits", "Misses", "Hit Ratio", "Puts", "Deletes", "Errors"},
+			"Data":   caches,
+		},
+		"Latency": map[string]interface{}{
+			"Fields": latencyFields,
+			"Data":   latency,
+		},
+		"Loaders": map[string]interface{}{
+			"Fields": []string{"Loader", "Hits", "Misses", "Stale", "Negative Hits", "Loads", "Coalesced", "Refreshes", "Errors", "Hit Ratio"},
+			"Data":   loaders,
+		},
+	}
+	data["Title"] = "Cache"
+	execTpl(rw, data, cacheTpl, defaultScriptsTpl)
+}
+
+// hitRatio formats the part of the lookups which were hits.
+func hitRatio(hits, misses uint64) string {
+	if hits+misses == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", float64(hits)*100/float64(hits+misses))
+}
+
+// cacheKeysPageSize is the number of keys asked for a page of the key browser.
+const cacheKeysPageSize = 50
+
+// cacheKeys is a http.Handler listing and deleting the keys of a cache created by
+// cache.NewCache, its adapter must implement cache.KeyLister.
+// it's in "/cache/keys" pattern in admin module.
+func cacheKeys(rw http.ResponseWriter, req *http.Request) {
+	data := make(map[interface{}]interface{})
+	req.ParseForm()
+	name, prefix, cursor := req.Form.Get("name"), req.Form.Get("prefix"), req.Form.Get("cursor")
+	data["Title"] = "Cache keys"
+	data["Name"] = name
+	data["Prefix"] = prefix
+
+	ic := cache.LookupInstrument(name)
+	if ic == nil {
+		rw.WriteHeader(http.StatusNotFound)
+		data["Message"] = []string{"error", "unknown cache " + template.HTMLEscapeString(name)}
+		execTpl(rw, data, cacheKeysTpl, defaultScriptsTpl)
+		return
+	}
+	lister, ok := cache.Unwrap(ic).(cache.KeyLister)
+	if !ok {
+		data["Message"] = []string{"warning", "the " + template.HTMLEscapeString(ic.Adapter()) + " adapter cannot list its keys"}
+		execTpl(rw, data, cacheKeysTpl, defaultScriptsTpl)
+		return
+	}
+
+	if req.Method == "POST" {
+		if err := ic.Delete(req.Form.Get("key")); err != nil {
+			data["Message"] = []string{"error", template.HTMLEscapeString(err.Error())}
+		} else {
+			http.Redirect(rw, req, "/cache/keys?name="+url.QueryEscape(name)+"&prefix="+url.QueryEscape(prefix), http.StatusSeeOther)
+			return
+		}
+	}
+
+	keys, next, err := lister.Keys(prefix, cursor, cacheKeysPageSize)
+	if err != nil {
+		data["Message"] = []string{"error", template.HTMLEscapeString(err.Error())}
+	}
+	resultList := new([][]string)
+	for _, k := range keys {
+		ttl := "never"
+		if k.TTL > 0 {
+			ttl = k.TTL.Truncate(time.Second).String()
+		}
+		*resultList = append(*resultList, []string{template.HTMLEscapeString(k.Key), ttl})
+	}
+	if next != "" {
+		data["Next"] = "/cache/keys?name=" + url.QueryEscape(name) + "&prefix=" + url.QueryEscape(prefix) + "&cursor=" + url.QueryEscape(next)
+	}
+	data["Content"] = map[string]interface{}{
+		"Fields": []string{"Key", "TTL", ""},
+		"Data":   resultList,
+	}
+	execTpl(rw, data, cacheKeysTpl, defaultScriptsTpl)
+}
+
+// cacheMetrics is a http.Handler exporting the counters of the caches
+// in the Prometheus text format.
+// it's in "/cache/metrics" pattern in admin module.
+func cacheMetrics(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	cache.WriteMetrics(rw)
+}
+
 func execTpl(rw http.ResponseWriter, data map[interface{}]interface{}, tpls ...string) {
 	tmpl := template.Must(template.New("dashboard").Parse(dashboardTpl))
 	for _, tpl := range tpls {
@@ -380,7 +614,8 @@ func execTpl(rw http.ResponseWriter, data map[interface{}]interface{}, tpls ...s
 
 // adminApp is an http.HandlerFunc map used as iziAdminApp.
 type adminApp struct {
-	routers map[string]http.HandlerFunc
+	routers     map[string]http.HandlerFunc
+	middleWares []MiddleWare
 }
 
 // Route adds http.HandlerFunc to adminApp with url pattern.
@@ -388,6 +623,21 @@ func (admin *adminApp) Route(pattern string, f http.HandlerFunc) {
 	admin.routers[pattern] = f
 }
 
+// AdminMiddleWare adds middlewares wrapping every handler of the admin server,
+// such as an ip filter or an authenticator.
+// The first middleware is the outermost one.
+func AdminMiddleWare(mws ...MiddleWare) {
+	iziAdminApp.middleWares = append(iziAdminApp.middleWares, mws...)
+}
+
+func (admin *adminApp) handler(f http.HandlerFunc) http.Handler {
+	var h http.Handler = f
+	for i := len(admin.middleWares) - 1; i >= 0; i-- {
+		h = admin.middleWares[i](h)
+	}
+	return h
+}
+
 // Run adminApp http server.
 // Its addr is defined in configuration file as adminhttpaddr and adminhttpport.
 func (admin *adminApp) Run() {
@@ -400,7 +650,7 @@ func (admin *adminApp) Run() {
 		addr = fmt.Sprintf("%s:%d", BConfig.Listen.AdminAddr, BConfig.Listen.AdminPort)
 	}
 	for p, f := range admin.routers {
-		http.Handle(p, f)
+		http.Handle(p, admin.handler(f))
 	}
 	logs.Info("Admin server Running on %s", addr)
 
@@ -1,8 +1,17 @@
 package izigo
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/session"
 )
 
 func TestList_01(t *testing.T) {
@@ -73,3 +82,112 @@ func oldMap() map[string]interface{} {
 	m["BConfig.Log.Outputs"] = BConfig.Log.Outputs
 	return m
 }
+
+func TestSessionBrowser(t *testing.T) {
+	old := GlobalSessions
+	defer func() { GlobalSessions = old }()
+	var err error
+	GlobalSessions, err = session.NewManager("memory", &session.ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, EnableIndex: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "<script>alert(1)</script>")
+	sess, _ := GlobalSessions.SessionStart(httptest.NewRecorder(), r)
+	GlobalSessions.SessionBind(sess.SessionID(), "admin-user")
+
+	w := httptest.NewRecorder()
+	sessionBrowser(w, httptest.NewRequest("GET", "/sessions?principal=admin-user", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, sessionHandle(sess.SessionID())) {
+		t.Error("session of the principal is expected to be listed")
+	}
+	if strings.Contains(body, sess.SessionID()) {
+		t.Error("session id is not expected to be shown")
+	}
+	if strings.Contains(body, "<script>alert(1)</script>") {
+		t.Error("user agent is expected to be escaped")
+	}
+
+	// a session of another principal is not revoked
+	other, _ := GlobalSessions.SessionStart(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	GlobalSessions.SessionBind(other.SessionID(), "other-user")
+	form := url.Values{"principal": {"admin-user"}, "session": {sessionHandle(other.SessionID())}}
+	req := httptest.NewRequest("POST", "/sessions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	sessionBrowser(httptest.NewRecorder(), req)
+	if infos, _ := GlobalSessions.SessionsOf("other-user"); len(infos) != 1 {
+		t.Error("session of another principal is not expected to be revoked")
+	}
+
+	form = url.Values{"principal": {"admin-user"}, "session": {sessionHandle(sess.SessionID())}}
+	req = httptest.NewRequest("POST", "/sessions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+	sessionBrowser(w, req)
+	if w.Code != http.StatusSeeOther {
+		t.Errorf("revoke is expected to redirect, found %d", w.Code)
+	}
+	if infos, _ := GlobalSessions.SessionsOf("admin-user"); len(infos) != 0 {
+		t.Errorf("revoked session is not expected to be listed, found %d", len(infos))
+	}
+}
+
+func TestCacheStatus(t *testing.T) {
+	bm, _ := cache.NewCacheV2("memory", `{"interval":60}`)
+	l := cache.NewLoader("<users>", bm)
+	l.GetOrLoad(context.Background(), "diepdt", time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+		return "v", nil
+	})
+	w := httptest.NewRecorder()
+	cacheStatus(w, httptest.NewRequest("GET", "/cache", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "&lt;users&gt;") || strings.Contains(body, "<users>") {
+		t.Error("loader name is expected to be listed and escaped")
+	}
+
+	cache.NewCache("memory", `{"interval":60,"name":"<admin>"}`)
+	w = httptest.NewRecorder()
+	cacheStatus(w, httptest.NewRequest("GET", "/cache", nil))
+	if body = w.Body.String(); !strings.Contains(body, `<a href="/cache/keys?name=%3Cadmin%3E">&lt;admin&gt;</a>`) {
+		t.Error("cache is expected to be listed with a link to its keys")
+	}
+}
+
+func TestCacheKeys(t *testing.T) {
+	bm, _ := cache.NewCache("memory", `{"interval":60,"name":"adminkeys"}`)
+	bm.Put("user:<1>", 1, time.Minute)
+	bm.Put("user:2", 2, 0)
+	bm.Put("page:1", 3, 0)
+
+	w := httptest.NewRecorder()
+	cacheKeys(w, httptest.NewRequest("GET", "/cache/keys?name=adminkeys&prefix=user:", nil))
+	body := w.Body.String()
+	if !strings.Contains(body, "user:&lt;1&gt;") || !strings.Contains(body, "user:2") || strings.Contains(body, "page:1") {
+		t.Errorf("keys of the prefix are expected to be listed and escaped, found %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/cache/keys", strings.NewReader("name=adminkeys&prefix=user:&key=user:2"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	cacheKeys(w, r)
+	if w.Code != http.StatusSeeOther || bm.IsExist("user:2") {
+		t.Errorf("delete is expected to remove the key and redirect, found %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	cacheKeys(w, httptest.NewRequest("GET", "/cache/keys?name=missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown cache is expected to be 404, found %d", w.Code)
+	}
+}
+
+func TestCacheMetrics(t *testing.T) {
+	bm, _ := cache.NewCache("memory", `{"interval":60,"name":"adminmetrics"}`)
+	bm.Get("missing")
+	w := httptest.NewRecorder()
+	cacheMetrics(w, httptest.NewRequest("GET", "/cache/metrics", nil))
+	if !strings.Contains(w.Body.String(), `izigo_cache_misses_total{cache="adminmetrics",adapter="memory"} 1`) {
+		t.Errorf("metrics are expected to count the miss, found %s", w.Body.String())
+	}
+}
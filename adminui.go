@@ -237,6 +237,177 @@ var healthCheckTpl = `
 </table>
 {{end}}`
 
+var sessionsTpl = `{{define "content"}}
+
+<h1>{{.Title}}</h1>
+
+{{if .Message }}
+{{ $messageType := index .Message 0}}
+<p class="message
+{{if eq "error" $messageType}}
+bg-danger
+{{else}}
+bg-warning
+{{end}}
+">
+{{index .Message 1}}
+</p>
+{{end}}
+
+<form class="form-inline" method="GET" action="/sessions">
+<input type="text" class="form-control" name="principal" placeholder="Principal" value="{{html .Principal}}">
+<button type="submit" class="btn btn-default">Search</button>
+</form>
+
+{{if .Principal}}
+<table class="table table-striped table-hover ">
+<thead>
+<tr>
+{{range .Content.Fields}}
+<th>
+{{.}}
+</th>
+{{end}}
+</tr>
+</thead>
+
+<tbody>
+{{$principal := .Principal}}
+{{range $i, $slice := .Content.Data}}
+<tr>
+	{{range $slice}}
+	<td>
+	{{.}}
+	</td>
+	{{end}}
+	<td>
+	<form method="POST" action="/sessions">
+	<input type="hidden" name="principal" value="{{html $principal}}">
+	<input type="hidden" name="session" value="{{index $slice 0}}">
+	<button type="submit" class="btn btn-danger btn-sm">Revoke</button>
+	</form>
+	</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+
+<form method="POST" action="/sessions">
+<input type="hidden" name="principal" value="{{html .Principal}}">
+<button type="submit" class="btn btn-danger">Revoke all sessions</button>
+</form>
+{{end}}
+
+{{end}}`
+
+var cacheTpl = `{{define "content"}}
+
+<h1>{{.Title}}</h1>
+
+<p><a href="/cache/metrics">Metrics</a></p>
+
+<h2>Caches</h2>
+{{template "cacheTable" .Content.Caches}}
+
+<h2>Latency</h2>
+{{template "cacheTable" .Content.Latency}}
+
+<h2>Loaders</h2>
+{{template "cacheTable" .Content.Loaders}}
+
+{{end}}
+
+{{define "cacheTable"}}
+<table class="table table-striped table-hover ">
+<thead>
+<tr>
+{{range .Fields}}
+<th>
+{{.}}
+</th>
+{{end}}
+</tr>
+</thead>
+
+<tbody>
+{{range $i, $slice := .Data}}
+<tr>
+	{{range $slice}}
+	<td>
+	{{.}}
+	</td>
+	{{end}}
+</tr>
+{{end}}
+</tbody>
+</table>
+{{end}}`
+
+var cacheKeysTpl = `{{define "content"}}
+
+<h1>{{.Title}}</h1>
+
+{{if .Message }}
+{{ $messageType := index .Message 0}}
+<p class="message
+{{if eq "error" $messageType}}
+bg-danger
+{{else}}
+bg-warning
+{{end}}
+">
+{{index .Message 1}}
+</p>
+{{end}}
+
+{{if .Content}}
+<form class="form-inline" method="GET" action="/cache/keys">
+<input type="hidden" name="name" value="{{html .Name}}">
+<input type="text" class="form-control" name="prefix" placeholder="Prefix" value="{{html .Prefix}}">
+<button type="submit" class="btn btn-default">Search</button>
+</form>
+
+<table class="table table-striped table-hover ">
+<thead>
+<tr>
+{{range .Content.Fields}}
+<th>
+{{.}}
+</th>
+{{end}}
+</tr>
+</thead>
+
+<tbody>
+{{$name := .Name}}
+{{$prefix := .Prefix}}
+{{range $i, $slice := .Content.Data}}
+<tr>
+	{{range $slice}}
+	<td>
+	{{.}}
+	</td>
+	{{end}}
+	<td>
+	<form method="POST" action="/cache/keys">
+	<input type="hidden" name="name" value="{{html $name}}">
+	<input type="hidden" name="prefix" value="{{html $prefix}}">
+	<input type="hidden" name="key" value="{{index $slice 0}}">
+	<button type="submit" class="btn btn-danger btn-sm">Delete</button>
+	</form>
+	</td>
+</tr>
+{{end}}
+</tbody>
+</table>
+
+{{if .Next}}
+<a href="{{html .Next}}" class="btn btn-default">Next page</a>
+{{end}}
+{{end}}
+
+{{end}}`
+
 // The base dashboardTpl
 var dashboardTpl = `
 <!DOCTYPE html>
@@ -322,6 +493,18 @@ Healthcheck
 <a href="/task" class="dropdown-toggle disabled" data-toggle="dropdown">Tasks</a>
 </li>
 
+<li>
+<a href="/sessions">
+Sessions
+</a>
+</li>
+
+<li>
+<a href="/cache">
+Cache
+</a>
+</li>
+
 <li class="dropdown">
 <a href="#" class="dropdown-toggle disabled" data-toggle="dropdown">Config Status<span class="caret"></span></a>
 <ul class="dropdown-menu" role="menu">
@@ -0,0 +1,619 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BoundedCache Config
+var (
+	DefaultBoundedShards     = 16    // number of shards, rounded up to a power of two
+	DefaultBoundedMaxEntries = 10000 // max number of entries when neither maxEntries nor maxBytes is set
+)
+
+// entryOverhead is the approximate memory used by an entry besides its key and value.
+const entryOverhead = 96
+
+// EvictReason tells why an entry left the bounded cache.
+type EvictReason int
+
+// reasons of the eviction callback.
+const (
+	// EvictCapacity means the entry was evicted to respect maxEntries or maxBytes.
+	EvictCapacity EvictReason = iota
+	// EvictExpired means the entry was removed because it expired.
+	EvictExpired
+)
+
+// EvictFunc is called after an entry left the bounded cache, outside of the cache locks.
+type EvictFunc func(key string, value interface{}, reason EvictReason)
+
+// CacheStats holds the counters of a bounded cache.
+type CacheStats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64
+	Expirations uint64
+	Entries     int
+	Bytes       int64
+}
+
+type boundedEntry struct {
+	key    string
+	val    interface{}
+	size   int64
+	expire time.Time // zero means forever
+
+	// policy bookkeeping
+	elem    *list.Element
+	segment int
+	freq    uint64
+	tick    uint64
+	index   int
+}
+
+func (e *boundedEntry) isExpire(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
+}
+
+type evicted struct {
+	key    string
+	val    interface{}
+	reason EvictReason
+}
+
+type boundedShard struct {
+	sync.Mutex
+	items      map[string]*boundedEntry
+	policy     evictionPolicy
+	bytes      int64
+	maxEntries int
+	maxBytes   int64
+}
+
+// BoundedCache is a sharded memory cache adapter bounded by a max entry count
+// and an approximate max byte size, evicting entries with the LRU, LFU or
+// W-TinyLFU policy. Expired entries are removed on read and every interval.
+//
+// config is like {"shards":16,"maxEntries":10000,"maxBytes":67108864,"policy":"tinylfu","interval":60}
+type BoundedCache struct {
+	hits, misses, evictions, expirations uint64 // first for atomic alignment
+
+	shards  []*boundedShard
+	mask    uint32
+	onEvict atomic.Value
+	stop    chan struct{}
+
+	// SizeOf returns the approximate size of a value in bytes, approxSize when nil.
+	SizeOf func(interface{}) int64
+}
+
+// NewBoundedCache returns a new BoundedCache with the default bounds.
+func NewBoundedCache() Cache {
+	bc := &BoundedCache{}
+	bc.init(0, DefaultBoundedMaxEntries, 0, PolicyLRU)
+	return bc
+}
+
+func (bc *BoundedCache) init(shards, maxEntries int, maxBytes int64, policy string) {
+	if shards <= 0 {
+		shards = DefaultBoundedShards
+	}
+	n := 1
+	for n < shards {
+		n <<= 1
+	}
+	if maxEntries > 0 && maxEntries < n {
+		// each shard holds at least one entry
+		n = 1
+		for n*2 <= maxEntries {
+			n <<= 1
+		}
+	}
+	bc.shards = make([]*boundedShard, n)
+	bc.mask = uint32(n - 1)
+	for i := range bc.shards {
+		s := &boundedShard{items: make(map[string]*boundedEntry)}
+		// the remainder goes to the first shards
+		if maxEntries > 0 {
+			s.maxEntries = maxEntries / n
+			if i < maxEntries%n {
+				s.maxEntries++
+			}
+		}
+		if maxBytes > 0 {
+			s.maxBytes = maxBytes / int64(n)
+			if int64(i) < maxBytes%int64(n) {
+				s.maxBytes++
+			}
+		}
+		s.policy = newPolicy(policy, s.maxEntries)
+		bc.shards[i] = s
+	}
+}
+
+// SetEvictCallback sets the function called when entries are evicted or expire.
+func (bc *BoundedCache) SetEvictCallback(fn EvictFunc) {
+	bc.onEvict.Store(fn)
+}
+
+// Stats returns the counters of the cache.
+func (bc *BoundedCache) Stats() CacheStats {
+	st := CacheStats{
+		Hits:        atomic.LoadUint64(&bc.hits),
+		Misses:      atomic.LoadUint64(&bc.misses),
+		Evictions:   atomic.LoadUint64(&bc.evictions),
+		Expirations: atomic.LoadUint64(&bc.expirations),
+	}
+	for _, s := range bc.shards {
+		s.Lock()
+		st.Entries += len(s.items)
+		st.Bytes += s.bytes
+		s.Unlock()
+	}
+	return st
+}
+
+func (bc *BoundedCache) shard(key string) *boundedShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return bc.shards[h.Sum32()&bc.mask]
+}
+
+func (bc *BoundedCache) sizeOf(key string, val interface{}) int64 {
+	sizeOf := bc.SizeOf
+	if sizeOf == nil {
+		sizeOf = approxSize
+	}
+	return entryOverhead + int64(len(key)) + sizeOf(val)
+}
+
+// notify calls the eviction callback and counts the evictions.
+func (bc *BoundedCache) notify(gone []evicted) {
+	fn, _ := bc.onEvict.Load().(EvictFunc)
+	for _, g := range gone {
+		if g.reason == EvictExpired {
+			atomic.AddUint64(&bc.expirations, 1)
+		} else {
+			atomic.AddUint64(&bc.evictions, 1)
+		}
+		if fn != nil {
+			fn(g.key, g.val, g.reason)
+		}
+	}
+}
+
+// removeEntry removes e from s, the caller must hold the lock.
+func (s *boundedShard) removeEntry(e *boundedEntry) {
+	s.policy.remove(e)
+	delete(s.items, e.key)
+	s.bytes -= e.size
+}
+
+// lookup returns the living entry of key, removing it when it is expired.
+// the caller must hold the lock.
+func (s *boundedShard) lookup(key string, gone *[]evicted) *boundedEntry {
+	e, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if e.isExpire(time.Now()) {
+		s.removeEntry(e)
+		*gone = append(*gone, evicted{e.key, e.val, EvictExpired})
+		return nil
+	}
+	return e
+}
+
+// store sets the value of key and evicts entries until the shard fits its bounds.
+// the caller must hold the lock.
+func (s *boundedShard) store(key string, val interface{}, size int64, expire time.Time, gone *[]evicted) {
+	if e, ok := s.items[key]; ok {
+		s.bytes += size - e.size
+		e.val, e.size, e.expire = val, size, expire
+		s.policy.hit(e)
+	} else {
+		e = &boundedEntry{key: key, val: val, size: size, expire: expire}
+		s.items[key] = e
+		s.bytes += size
+		s.policy.add(e)
+	}
+	for (s.maxEntries > 0 && len(s.items) > s.maxEntries) || (s.maxBytes > 0 && s.bytes > s.maxBytes) {
+		v := s.policy.victim()
+		if v == nil {
+			break
+		}
+		s.removeEntry(v)
+		*gone = append(*gone, evicted{v.key, v.val, EvictCapacity})
+	}
+}
+
+// load returns the value of key.
+func (bc *BoundedCache) load(key string) (interface{}, bool) {
+	s := bc.shard(key)
+	var gone []evicted
+	s.Lock()
+	e := s.lookup(key, &gone)
+	var val interface{}
+	if e != nil {
+		s.policy.hit(e)
+		// store rewrites the entry in place, it is read with the lock held
+		val = e.val
+	}
+	s.Unlock()
+	bc.notify(gone)
+	if e == nil {
+		atomic.AddUint64(&bc.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&bc.hits, 1)
+	return val, true
+}
+
+// errSkip tells modify to leave the entry unchanged.
+var errSkip = errors.New("cache: skip")
+
+// modify sets key to the value returned by fn, with the shard lock held.
+// cur is nil when key does not exist. fn returns errSkip to leave key unchanged.
+func (bc *BoundedCache) modify(key string, fn func(cur *boundedEntry) (interface{}, time.Time, error)) error {
+	s := bc.shard(key)
+	var gone []evicted
+	s.Lock()
+	val, expire, err := fn(s.lookup(key, &gone))
+	if err == nil {
+		s.store(key, val, bc.sizeOf(key, val), expire, &gone)
+	}
+	s.Unlock()
+	bc.notify(gone)
+	if err == errSkip {
+		return nil
+	}
+	return err
+}
+
+func expireAt(lifespan time.Duration) time.Time {
+	if lifespan <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(lifespan)
+}
+
+// Get cache from the bounded cache.
+// if non-existed or expired, return nil.
+func (bc *BoundedCache) Get(name string) interface{} {
+	v, _ := bc.load(name)
+	return v
+}
+
+// GetMulti gets caches from the bounded cache.
+// if non-existed or expired, return nil.
+func (bc *BoundedCache) GetMulti(names []string) []interface{} {
+	rc := make([]interface{}, len(names))
+	for i, name := range names {
+		rc[i] = bc.Get(name)
+	}
+	return rc
+}
+
+// Put cache to the bounded cache.
+// if lifespan is 0, it will be kept until evicted.
+func (bc *BoundedCache) Put(name string, value interface{}, lifespan time.Duration) error {
+	return bc.modify(name, func(*boundedEntry) (interface{}, time.Time, error) {
+		return value, expireAt(lifespan), nil
+	})
+}
+
+// Delete cache in the bounded cache.
+func (bc *BoundedCache) Delete(name string) error {
+	s := bc.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.items[name]
+	if !ok {
+		return errors.New("key not exist")
+	}
+	s.removeEntry(e)
+	return nil
+}
+
+func (bc *BoundedCache) incr(key string, n int64) (int64, error) {
+	var i int64
+	err := bc.modify(key, func(cur *boundedEntry) (interface{}, time.Time, error) {
+		if cur == nil {
+			return nil, time.Time{}, errors.New("key not exist")
+		}
+		val, v, err := incrValue(cur.val, n)
+		i = v
+		return val, cur.expire, err
+	})
+	return i, err
+}
+
+// Incr increase cache counter in the bounded cache.
+// it supports int,int32,int64,uint,uint32,uint64.
+func (bc *BoundedCache) Incr(key string) error {
+	_, err := bc.incr(key, 1)
+	return err
+}
+
+// Decr decrease counter in the bounded cache.
+func (bc *BoundedCache) Decr(key string) error {
+	_, err := bc.incr(key, -1)
+	return err
+}
+
+// IsExist check cache exist in the bounded cache.
+func (bc *BoundedCache) IsExist(name string) bool {
+	s := bc.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.items[name]
+	return ok && !e.isExpire(time.Now())
+}
+
+// ClearAll will delete all cache in the bounded cache.
+func (bc *BoundedCache) ClearAll() error {
+	for _, s := range bc.shards {
+		s.Lock()
+		for _, e := range s.items {
+			s.removeEntry(e)
+		}
+		s.Unlock()
+	}
+	return nil
+}
+
+// StartAndGC configures the bounded cache and removes the expired entries every interval.
+func (bc *BoundedCache) StartAndGC(config string) error {
+	cf := struct {
+		Shards     int    `json:"shards"`
+		MaxEntries int    `json:"maxEntries"`
+		MaxBytes   int64  `json:"maxBytes"`
+		Policy     string `json:"policy"`
+		Interval   *int   `json:"interval"`
+	}{}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &cf); err != nil {
+			return err
+		}
+	}
+	switch cf.Policy {
+	case "":
+		cf.Policy = PolicyLRU
+	case PolicyLRU, PolicyLFU, PolicyTinyLFU:
+	default:
+		return errors.New("cache: unknown eviction policy " + cf.Policy)
+	}
+	if cf.MaxEntries <= 0 && cf.MaxBytes <= 0 {
+		cf.MaxEntries = DefaultBoundedMaxEntries
+	}
+	interval := DefaultEvery
+	if cf.Interval != nil {
+		interval = *cf.Interval
+	}
+	bc.init(cf.Shards, cf.MaxEntries, cf.MaxBytes, cf.Policy)
+	if bc.stop != nil {
+		close(bc.stop)
+		bc.stop = nil
+	}
+	if interval > 0 {
+		bc.stop = make(chan struct{})
+		go bc.vacuum(time.Duration(interval)*time.Second, bc.stop)
+	}
+	return nil
+}
+
+// vacuum removes the expired entries every dur, until stop is closed.
+func (bc *BoundedCache) vacuum(dur time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(dur)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		for _, s := range bc.shards {
+			var gone []evicted
+			now := time.Now()
+			s.Lock()
+			for _, e := range s.items {
+				if e.isExpire(now) {
+					s.removeEntry(e)
+					gone = append(gone, evicted{e.key, e.val, EvictExpired})
+				}
+			}
+			s.Unlock()
+			bc.notify(gone)
+		}
+	}
+}
+
+// approxSize returns the approximate memory used by v in bytes.
+func approxSize(v interface{}) int64 {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(x))
+	case []byte:
+		return int64(len(x))
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, float64, uintptr:
+		return 8
+	}
+	return sizeOfValue(reflect.ValueOf(v), 0)
+}
+
+func sizeOfValue(v reflect.Value, depth int) int64 {
+	if depth > 8 {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 8
+		}
+		return 8 + sizeOfValue(v.Elem(), depth+1)
+	case reflect.String:
+		return 16 + int64(v.Len())
+	case reflect.Slice, reflect.Array:
+		size := int64(24)
+		for i := 0; i < v.Len(); i++ {
+			size += sizeOfValue(v.Index(i), depth+1)
+		}
+		return size
+	case reflect.Map:
+		size := int64(48)
+		for _, k := range v.MapKeys() {
+			size += sizeOfValue(k, depth+1) + sizeOfValue(v.MapIndex(k), depth+1)
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOfValue(v.Field(i), depth+1)
+		}
+		return size
+	}
+	return int64(v.Type().Size())
+}
+
+// BoundedCacheV2 is the CacheV2 of the bounded adapter.
+type BoundedCacheV2 struct {
+	*BoundedCache
+}
+
+// NewBoundedCacheV2 returns a new BoundedCacheV2 with the default bounds.
+func NewBoundedCacheV2() CacheV2 {
+	return &BoundedCacheV2{NewBoundedCache().(*BoundedCache)}
+}
+
+// Get cache from the bounded cache, ErrCacheMiss if non-existed or expired.
+func (bv *BoundedCacheV2) Get(ctx context.Context, name string) (interface{}, error) {
+	if v, ok := bv.load(name); ok {
+		return v, nil
+	}
+	return nil, ErrCacheMiss
+}
+
+// GetMulti gets caches from the bounded cache.
+func (bv *BoundedCacheV2) GetMulti(ctx context.Context, names []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(names))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		values[i], errs[i] = bv.Get(ctx, name)
+	}
+	return values, errs
+}
+
+// Put cache to the bounded cache.
+func (bv *BoundedCacheV2) Put(ctx context.Context, name string, value interface{}, lifespan time.Duration) error {
+	return bv.BoundedCache.Put(name, value, lifespan)
+}
+
+// Delete cache in the bounded cache.
+func (bv *BoundedCacheV2) Delete(ctx context.Context, name string) error {
+	bv.BoundedCache.Delete(name)
+	return nil
+}
+
+// IncrBy adds n to the counter, a missing counter is an int64 kept until evicted.
+func (bv *BoundedCacheV2) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	var i int64
+	err := bv.modify(key, func(cur *boundedEntry) (interface{}, time.Time, error) {
+		if cur == nil {
+			i = n
+			return n, time.Time{}, nil
+		}
+		val, v, err := incrValue(cur.val, n)
+		i = v
+		return val, cur.expire, err
+	})
+	return i, err
+}
+
+// SetNX puts the cache if name does not exist.
+func (bv *BoundedCacheV2) SetNX(ctx context.Context, name string, value interface{}, lifespan time.Duration) (bool, error) {
+	set := false
+	err := bv.modify(name, func(cur *boundedEntry) (interface{}, time.Time, error) {
+		if cur != nil {
+			return nil, time.Time{}, errSkip
+		}
+		set = true
+		return value, expireAt(lifespan), nil
+	})
+	return set, err
+}
+
+// CompareAndSwap puts the cache if its value is deeply equal to old.
+func (bv *BoundedCacheV2) CompareAndSwap(ctx context.Context, name string, old, value interface{}, lifespan time.Duration) (bool, error) {
+	set := false
+	err := bv.modify(name, func(cur *boundedEntry) (interface{}, time.Time, error) {
+		if cur == nil {
+			return nil, time.Time{}, ErrCacheMiss
+		}
+		if !reflect.DeepEqual(cur.val, old) {
+			return nil, time.Time{}, errSkip
+		}
+		set = true
+		return value, expireAt(lifespan), nil
+	})
+	return set, err
+}
+
+// TTL returns the remaining lifespan of the cache.
+func (bv *BoundedCacheV2) TTL(ctx context.Context, name string) (time.Duration, error) {
+	s := bv.shard(name)
+	s.Lock()
+	defer s.Unlock()
+	e, ok := s.items[name]
+	if !ok || e.isExpire(time.Now()) {
+		return 0, ErrCacheMiss
+	}
+	if e.expire.IsZero() {
+		return 0, nil
+	}
+	return time.Until(e.expire), nil
+}
+
+// IsExist check cache exist in the bounded cache.
+func (bv *BoundedCacheV2) IsExist(ctx context.Context, name string) (bool, error) {
+	return bv.BoundedCache.IsExist(name), nil
+}
+
+// ClearAll will delete all cache in the bounded cache.
+func (bv *BoundedCacheV2) ClearAll(ctx context.Context) error {
+	return bv.BoundedCache.ClearAll()
+}
+
+func init() {
+	Register("bounded", NewBoundedCache)
+	RegisterV2("bounded", NewBoundedCacheV2)
+}
@@ -0,0 +1,323 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+	"hash/fnv"
+)
+
+// eviction policies of the bounded cache.
+const (
+	PolicyLRU     = "lru"
+	PolicyLFU     = "lfu"
+	PolicyTinyLFU = "tinylfu"
+)
+
+// evictionPolicy orders the entries of a bounded cache shard.
+// it is called with the shard lock held.
+type evictionPolicy interface {
+	// add records a new entry.
+	add(e *boundedEntry)
+	// hit records an access to e.
+	hit(e *boundedEntry)
+	// remove forgets e.
+	remove(e *boundedEntry)
+	// victim returns the entry to evict, nil when empty.
+	victim() *boundedEntry
+}
+
+func newPolicy(name string, capacity int) evictionPolicy {
+	switch name {
+	case PolicyLFU:
+		return &lfuPolicy{}
+	case PolicyTinyLFU:
+		return newTinyLFU(capacity)
+	}
+	return &lruPolicy{l: list.New()}
+}
+
+// lruPolicy evicts the least recently used entry.
+type lruPolicy struct {
+	l *list.List
+}
+
+func (p *lruPolicy) add(e *boundedEntry) {
+	e.elem = p.l.PushFront(e)
+}
+
+func (p *lruPolicy) hit(e *boundedEntry) {
+	p.l.MoveToFront(e.elem)
+}
+
+func (p *lruPolicy) remove(e *boundedEntry) {
+	p.l.Remove(e.elem)
+}
+
+func (p *lruPolicy) victim() *boundedEntry {
+	if back := p.l.Back(); back != nil {
+		return back.Value.(*boundedEntry)
+	}
+	return nil
+}
+
+// lfuPolicy evicts the least frequently used entry,
+// the least recently used one among the entries of the same frequency.
+type lfuPolicy struct {
+	entries []*boundedEntry
+	tick    uint64
+}
+
+func (p *lfuPolicy) Len() int { return len(p.entries) }
+
+func (p *lfuPolicy) Less(i, j int) bool {
+	a, b := p.entries[i], p.entries[j]
+	if a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	return a.tick < b.tick
+}
+
+func (p *lfuPolicy) Swap(i, j int) {
+	p.entries[i], p.entries[j] = p.entries[j], p.entries[i]
+	p.entries[i].index = i
+	p.entries[j].index = j
+}
+
+func (p *lfuPolicy) Push(x interface{}) {
+	e := x.(*boundedEntry)
+	e.index = len(p.entries)
+	p.entries = append(p.entries, e)
+}
+
+func (p *lfuPolicy) Pop() interface{} {
+	e := p.entries[len(p.entries)-1]
+	p.entries[len(p.entries)-1] = nil
+	p.entries = p.entries[:len(p.entries)-1]
+	return e
+}
+
+func (p *lfuPolicy) add(e *boundedEntry) {
+	p.tick++
+	e.freq, e.tick = 1, p.tick
+	heap.Push(p, e)
+}
+
+func (p *lfuPolicy) hit(e *boundedEntry) {
+	p.tick++
+	e.freq++
+	e.tick = p.tick
+	heap.Fix(p, e.index)
+}
+
+func (p *lfuPolicy) remove(e *boundedEntry) {
+	heap.Remove(p, e.index)
+}
+
+func (p *lfuPolicy) victim() *boundedEntry {
+	if len(p.entries) == 0 {
+		return nil
+	}
+	return p.entries[0]
+}
+
+// segments of the W-TinyLFU policy.
+const (
+	segWindow = iota
+	segProbation
+	segProtected
+)
+
+// tinyLFUPolicy is a W-TinyLFU policy: new entries go to a small LRU window,
+// the entries leaving the window go to the probation segment of the main SLRU
+// and are promoted to the protected segment when they are used again.
+// Under pressure, an entry leaving the window is only kept if it is used more
+// often than the victim of the main segments, according to a count-min sketch.
+type tinyLFUPolicy struct {
+	window, probation, protected *list.List
+	capacity                     int
+	candidate                    *boundedEntry
+	sketch                       *countMinSketch
+}
+
+func newTinyLFU(capacity int) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		capacity:  capacity,
+		sketch:    newCountMinSketch(capacity),
+	}
+}
+
+// caps returns the capacity of the window and of the protected segment.
+// without a max entry count, they follow the number of entries.
+func (p *tinyLFUPolicy) caps() (window, protected int) {
+	total := p.capacity
+	if total <= 0 {
+		total = p.window.Len() + p.probation.Len() + p.protected.Len()
+	}
+	window = total / 100
+	if window < 1 {
+		window = 1
+	}
+	return window, (total - window) * 80 / 100
+}
+
+func (p *tinyLFUPolicy) add(e *boundedEntry) {
+	p.sketch.increment(e.key)
+	e.segment = segWindow
+	e.elem = p.window.PushFront(e)
+	if window, _ := p.caps(); p.window.Len() > window {
+		c := p.window.Back().Value.(*boundedEntry)
+		p.window.Remove(c.elem)
+		c.segment = segProbation
+		c.elem = p.probation.PushFront(c)
+		p.candidate = c
+	}
+}
+
+func (p *tinyLFUPolicy) hit(e *boundedEntry) {
+	p.sketch.increment(e.key)
+	switch e.segment {
+	case segWindow:
+		p.window.MoveToFront(e.elem)
+	case segProtected:
+		p.protected.MoveToFront(e.elem)
+	case segProbation:
+		p.probation.Remove(e.elem)
+		e.segment = segProtected
+		e.elem = p.protected.PushFront(e)
+		if _, protected := p.caps(); p.protected.Len() > protected {
+			d := p.protected.Back().Value.(*boundedEntry)
+			p.protected.Remove(d.elem)
+			d.segment = segProbation
+			d.elem = p.probation.PushFront(d)
+		}
+		if p.candidate == e {
+			p.candidate = nil
+		}
+	}
+}
+
+func (p *tinyLFUPolicy) remove(e *boundedEntry) {
+	switch e.segment {
+	case segWindow:
+		p.window.Remove(e.elem)
+	case segProbation:
+		p.probation.Remove(e.elem)
+	case segProtected:
+		p.protected.Remove(e.elem)
+	}
+	if p.candidate == e {
+		p.candidate = nil
+	}
+}
+
+// mainVictim returns the victim of the main segments other than the candidate.
+func (p *tinyLFUPolicy) mainVictim() *boundedEntry {
+	for _, l := range []*list.List{p.probation, p.protected} {
+		for el := l.Back(); el != nil; el = el.Prev() {
+			if e := el.Value.(*boundedEntry); e != p.candidate {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (p *tinyLFUPolicy) victim() *boundedEntry {
+	v := p.mainVictim()
+	if c := p.candidate; c != nil {
+		if v == nil || p.sketch.estimate(c.key) <= p.sketch.estimate(v.key) {
+			return c
+		}
+		// the candidate is admitted
+		p.candidate = nil
+		return v
+	}
+	if v != nil {
+		return v
+	}
+	if back := p.window.Back(); back != nil {
+		return back.Value.(*boundedEntry)
+	}
+	return nil
+}
+
+// countMinSketch estimates the access frequency of keys with 4 rows of
+// counters saturating at 15, 16 counters per cached entry so that the
+// collisions stay rare. All counters are halved after a sample of
+// 10 times the capacity, so that old accesses are forgotten.
+type countMinSketch struct {
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	sample    int
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	if capacity < 64 {
+		capacity = 64
+	}
+	width := 1
+	for width < 16*capacity {
+		width <<= 1
+	}
+	s := &countMinSketch{mask: uint64(width - 1), sample: 10 * capacity}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) indexes(key string) [4]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	lo, hi := sum, sum>>32|1
+	var idx [4]uint64
+	for i := range idx {
+		idx[i] = (lo + uint64(i)*hi) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < 15 {
+			s.rows[i][j]++
+		}
+	}
+	if s.additions++; s.additions >= s.sample {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	min := uint8(15)
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < min {
+			min = s.rows[i][j]
+		}
+	}
+	return min
+}
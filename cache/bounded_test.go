@@ -0,0 +1,229 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newBounded(t *testing.T, config string) *BoundedCache {
+	bm, err := NewCache("bounded", config)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	return bm.(*BoundedCache)
+}
+
+func TestBoundedCache(t *testing.T) {
+	bm := newBounded(t, `{"maxEntries":100}`)
+	if err := bm.Put("diepdt", 1, 10*time.Second); err != nil {
+		t.Error("set Error", err)
+	}
+	if !bm.IsExist("diepdt") {
+		t.Error("check err")
+	}
+	if v := bm.Get("diepdt"); v.(int) != 1 {
+		t.Error("get err")
+	}
+	if err := bm.Incr("diepdt"); err != nil {
+		t.Error("Incr Error", err)
+	}
+	if err := bm.Decr("diepdt"); err != nil {
+		t.Error("Decr Error", err)
+	}
+	if v := bm.Get("diepdt"); v.(int) != 1 {
+		t.Error("get err")
+	}
+	if err := bm.Delete("diepdt"); err != nil {
+		t.Error("delete err", err)
+	}
+	if bm.IsExist("diepdt") {
+		t.Error("delete err")
+	}
+	if bm.Get("diepdt") != nil {
+		t.Error("get err")
+	}
+
+	// expiry on read
+	bm.Put("short", "v", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if bm.Get("short") != nil {
+		t.Error("expired entry is expected to be removed on read")
+	}
+	st := bm.Stats()
+	if st.Hits != 2 || st.Misses != 2 || st.Expirations != 1 || st.Entries != 0 {
+		t.Errorf("stats are expected to be 2 hits, 2 misses, 1 expiration and 0 entries, found %+v", st)
+	}
+
+	if _, err := NewCache("bounded", `{"policy":"fifo"}`); err == nil {
+		t.Error("unknown policy is expected to fail")
+	}
+}
+
+func TestBoundedEviction(t *testing.T) {
+	for _, policy := range []string{PolicyLRU, PolicyLFU, PolicyTinyLFU} {
+		bm := newBounded(t, fmt.Sprintf(`{"shards":1,"maxEntries":10,"policy":%q}`, policy))
+		var evicted []string
+		bm.SetEvictCallback(func(key string, value interface{}, reason EvictReason) {
+			if reason != EvictCapacity {
+				t.Errorf("%s: eviction reason is expected to be EvictCapacity, found %v", policy, reason)
+			}
+			evicted = append(evicted, key)
+		})
+		for i := 0; i < 10; i++ {
+			bm.Put(fmt.Sprintf("key%d", i), i, 0)
+		}
+		// key0 is the most used one
+		for i := 0; i < 5; i++ {
+			bm.Get("key0")
+		}
+		for i := 10; i < 20; i++ {
+			bm.Put(fmt.Sprintf("key%d", i), i, 0)
+		}
+		st := bm.Stats()
+		if st.Entries != 10 || st.Evictions != 10 || len(evicted) != 10 {
+			t.Errorf("%s: 10 entries and 10 evictions are expected, found %+v %v", policy, st, evicted)
+		}
+		if policy != PolicyLRU && !bm.IsExist("key0") {
+			t.Errorf("%s: the most used entry is expected to be kept, evicted %v", policy, evicted)
+		}
+	}
+
+	// the least recently used entry goes first
+	bm := newBounded(t, `{"shards":1,"maxEntries":3}`)
+	bm.Put("a", 1, 0)
+	bm.Put("b", 2, 0)
+	bm.Put("c", 3, 0)
+	bm.Get("a")
+	bm.Put("d", 4, 0)
+	if bm.IsExist("b") || !bm.IsExist("a") {
+		t.Error("lru: b is expected to be evicted")
+	}
+
+	// the least frequently used entry goes first
+	bm = newBounded(t, `{"shards":1,"maxEntries":3,"policy":"lfu"}`)
+	bm.Put("a", 1, 0)
+	bm.Put("b", 2, 0)
+	bm.Put("c", 3, 0)
+	bm.Get("a")
+	bm.Get("a")
+	bm.Get("b")
+	bm.Get("b")
+	bm.Put("d", 4, 0)
+	if bm.IsExist("c") || !bm.IsExist("a") || !bm.IsExist("b") {
+		t.Error("lfu: c is expected to be evicted")
+	}
+}
+
+func TestBoundedTinyLFUScan(t *testing.T) {
+	bm := newBounded(t, `{"shards":1,"maxEntries":100,"policy":"tinylfu"}`)
+	for i := 0; i < 100; i++ {
+		bm.Put(fmt.Sprintf("hot%d", i), i, 0)
+	}
+	for n := 0; n < 3; n++ {
+		for i := 0; i < 100; i++ {
+			bm.Get(fmt.Sprintf("hot%d", i))
+		}
+	}
+	// a scan of one-hit entries does not flush the hot ones
+	for i := 0; i < 1000; i++ {
+		bm.Put(fmt.Sprintf("scan%d", i), i, 0)
+	}
+	kept := 0
+	for i := 0; i < 100; i++ {
+		if bm.IsExist(fmt.Sprintf("hot%d", i)) {
+			kept++
+		}
+	}
+	if kept < 90 {
+		t.Errorf("tinylfu is expected to keep the hot entries, found %d of 100", kept)
+	}
+}
+
+func TestBoundedBytes(t *testing.T) {
+	bm := newBounded(t, `{"shards":1,"maxBytes":2000}`)
+	value := strings.Repeat("x", 400)
+	for i := 0; i < 10; i++ {
+		bm.Put(fmt.Sprintf("key%d", i), value, 0)
+	}
+	st := bm.Stats()
+	if st.Bytes > 2000 || st.Entries != 4 {
+		t.Errorf("bytes are expected to be bounded to 2000 with 4 entries, found %+v", st)
+	}
+	bm.Put("key9", "small", 0)
+	if st2 := bm.Stats(); st2.Bytes >= st.Bytes {
+		t.Errorf("bytes are expected to follow the replaced value, found %d then %d", st.Bytes, st2.Bytes)
+	}
+}
+
+func TestBoundedConcurrency(t *testing.T) {
+	bm := newBounded(t, `{"maxEntries":1000,"policy":"tinylfu"}`)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("key%d", (i*7+g)%3000)
+				if bm.Get(key) == nil {
+					bm.Put(key, i, time.Minute)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if st := bm.Stats(); st.Entries > 1000 {
+		t.Errorf("entries are expected to be at most 1000, found %d", st.Entries)
+	}
+}
+
+// TestBoundedSameKey is meant for go test -race, Put rewrites the entry read by Get.
+func TestBoundedSameKey(t *testing.T) {
+	bm := newBounded(t, `{"maxEntries":10}`)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				bm.Put("diepdt", g*1000+i, time.Minute)
+			}
+		}(g)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if v := bm.Get("diepdt"); v != nil {
+					_ = v.(int)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v := bm.Get("diepdt"); v == nil {
+		t.Error("value is expected to be kept")
+	}
+}
+
+func TestBoundedCacheV2(t *testing.T) {
+	bm, err := NewCacheV2("bounded", `{"maxEntries":100}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	testCacheV2(t, bm)
+}
@@ -88,6 +88,8 @@ func Register(name string, adapter Instance) {
 // NewCache Create a new cache driver by adapter name and config string.
 // config need to be correct JSON as string: {"interval":360}.
 // it will start gc automatically.
+// a config with a "name" key returns the adapter wrapped in an Instrumented
+// cache of that name, use Unwrap to reach the adapter itself.
 func NewCache(adapterName, config string) (adapter Cache, err error) {
 	instanceFunc, ok := adapters[adapterName]
 	if !ok {
@@ -97,7 +99,10 @@ func NewCache(adapterName, config string) (adapter Cache, err error) {
 	adapter = instanceFunc()
 	err = adapter.StartAndGC(config)
 	if err != nil {
-		adapter = nil
+		return nil, err
 	}
-	return
+	if name := instanceName(config); name != "" {
+		return Instrument(name, adapterName, adapter), nil
+	}
+	return adapter, nil
 }
@@ -0,0 +1,340 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	// ErrCacheMiss is returned by CacheV2 when the key does not exist or is expired.
+	ErrCacheMiss = errors.New("cache: key not found")
+	// ErrNotSupported is returned by CacheV2 when the backend can not do the operation.
+	ErrNotSupported = errors.New("cache: operation not supported by the adapter")
+	// ErrNotInteger is returned by IncrBy when the cached value is not an integer.
+	ErrNotInteger = errors.New("cache: value is not an integer")
+)
+
+// CacheV2 is the context aware version of Cache.
+// Every method reports its failure, so that a miss (ErrCacheMiss),
+// a decoding failure and a broken connection can be told apart.
+// usage:
+//	c, err := cache.NewCacheV2("memory", `{"interval":60}`)
+//	c.Put(ctx, "key", value, 3600 * time.Second)
+//	v, err := c.Get(ctx, "key")
+//	if err == cache.ErrCacheMiss {
+//		// load the value
+//	}
+//
+//	n, err := c.IncrBy(ctx, "counter", 2) // now is 2
+type CacheV2 interface {
+	// get cached value by key, ErrCacheMiss when it does not exist.
+	Get(ctx context.Context, key string) (interface{}, error)
+	// GetMulti is a batch version of Get, with the error of each key.
+	GetMulti(ctx context.Context, keys []string) ([]interface{}, []error)
+	// set cached value with key and expire time, 0 means no expiration.
+	Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error
+	// delete cached value by key, deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+	// add n to the cached integer value, a missing key starts from 0.
+	IncrBy(ctx context.Context, key string, n int64) (int64, error)
+	// set cached value only if the key does not exist, reports whether it was set.
+	SetNX(ctx context.Context, key string, val interface{}, timeout time.Duration) (bool, error)
+	// set cached value only if the current value equals old, reports whether it was set.
+	CompareAndSwap(ctx context.Context, key string, old, val interface{}, timeout time.Duration) (bool, error)
+	// remaining time to live of key, 0 means no expiration.
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	// check if cached value exists or not.
+	IsExist(ctx context.Context, key string) (bool, error)
+	// clear all cache.
+	ClearAll(ctx context.Context) error
+	// start gc routine based on config string settings.
+	StartAndGC(config string) error
+}
+
+// CompareAndDeleter is implemented by the CacheV2 adapters which can delete
+// a key atomically when its value equals old, such as to release a lock.
+type CompareAndDeleter interface {
+	CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error)
+}
+
+// NotAtomic is implemented by the CacheV2 adapters whose SetNX is not atomic
+// with the expiry of the key, such as ssdb, or whose SetNX and CompareAndSwap
+// are a read then a write, such as the caches bridged by FromV1. They can not hold locks.
+type NotAtomic interface {
+	NotAtomic()
+}
+
+// InstanceV2 is a function create a new CacheV2 Instance
+type InstanceV2 func() CacheV2
+
+var adaptersV2 = make(map[string]InstanceV2)
+
+// RegisterV2 makes a CacheV2 adapter available by the adapter name.
+// If RegisterV2 is called twice with the same name or if driver is nil,
+// it panics.
+func RegisterV2(name string, adapter InstanceV2) {
+	if adapter == nil {
+		panic("cache: RegisterV2 adapter is nil")
+	}
+	if _, ok := adaptersV2[name]; ok {
+		panic("cache: RegisterV2 called twice for adapter " + name)
+	}
+	adaptersV2[name] = adapter
+}
+
+// NewCacheV2 Create a new CacheV2 by adapter name and config string.
+// adapters which are only registered with Register are bridged with FromV1.
+// it will start gc automatically.
+func NewCacheV2(adapterName, config string) (CacheV2, error) {
+	if instanceFunc, ok := adaptersV2[adapterName]; ok {
+		adapter := instanceFunc()
+		if err := adapter.StartAndGC(config); err != nil {
+			return nil, err
+		}
+		return adapter, nil
+	}
+	if _, ok := adapters[adapterName]; !ok {
+		return nil, fmt.Errorf("cache: unknown adapter name %q (forgot to import?)", adapterName)
+	}
+	adapter, err := NewCache(adapterName, config)
+	if err != nil {
+		return nil, err
+	}
+	return FromV1(adapter), nil
+}
+
+// FromV1 returns a CacheV2 calling c.
+// A nil value of c is reported as ErrCacheMiss. IncrBy, SetNX and
+// CompareAndSwap are emulated and are not atomic, TTL is not supported.
+func FromV1(c Cache) CacheV2 {
+	if v, ok := c.(*v1Cache); ok {
+		return v.c
+	}
+	return &v2Cache{c: c}
+}
+
+type v2Cache struct {
+	c Cache
+}
+
+func (b *v2Cache) Get(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if v := b.c.Get(key); v != nil {
+		return v, nil
+	}
+	return nil, ErrCacheMiss
+}
+
+func (b *v2Cache) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	if err := ctx.Err(); err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return values, errs
+	}
+	for i, v := range b.c.GetMulti(keys) {
+		if i >= len(keys) {
+			break
+		}
+		values[i] = v
+		if v == nil {
+			errs[i] = ErrCacheMiss
+		}
+	}
+	return values, errs
+}
+
+func (b *v2Cache) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.c.Put(key, val, timeout)
+}
+
+func (b *v2Cache) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !b.c.IsExist(key) {
+		return nil
+	}
+	return b.c.Delete(key)
+}
+
+func (b *v2Cache) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if !b.c.IsExist(key) {
+		return n, b.c.Put(key, int(n), 0)
+	}
+	for ; n > 0; n-- {
+		if err := b.c.Incr(key); err != nil {
+			return 0, err
+		}
+	}
+	for ; n < 0; n++ {
+		if err := b.c.Decr(key); err != nil {
+			return 0, err
+		}
+	}
+	return GetInt64(b.c.Get(key)), nil
+}
+
+// NotAtomic implements NotAtomic, SetNX and CompareAndSwap read the key then put it.
+func (b *v2Cache) NotAtomic() {}
+
+func (b *v2Cache) SetNX(ctx context.Context, key string, val interface{}, timeout time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if b.c.IsExist(key) {
+		return false, nil
+	}
+	return true, b.c.Put(key, val, timeout)
+}
+
+func (b *v2Cache) CompareAndSwap(ctx context.Context, key string, old, val interface{}, timeout time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	v := b.c.Get(key)
+	if v == nil {
+		return false, ErrCacheMiss
+	}
+	if !reflect.DeepEqual(v, old) {
+		return false, nil
+	}
+	return true, b.c.Put(key, val, timeout)
+}
+
+func (b *v2Cache) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return 0, ErrNotSupported
+}
+
+func (b *v2Cache) IsExist(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return b.c.IsExist(key), nil
+}
+
+func (b *v2Cache) ClearAll(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.c.ClearAll()
+}
+
+func (b *v2Cache) StartAndGC(config string) error {
+	return b.c.StartAndGC(config)
+}
+
+// ToV1 returns a Cache calling c with context.Background(),
+// for the code written against Cache. The errors of Get are dropped.
+func ToV1(c CacheV2) Cache {
+	if b, ok := c.(*v2Cache); ok {
+		return b.c
+	}
+	return &v1Cache{c: c}
+}
+
+type v1Cache struct {
+	c CacheV2
+}
+
+func (b *v1Cache) Get(key string) interface{} {
+	v, _ := b.c.Get(context.Background(), key)
+	return v
+}
+
+func (b *v1Cache) GetMulti(keys []string) []interface{} {
+	values, _ := b.c.GetMulti(context.Background(), keys)
+	return values
+}
+
+func (b *v1Cache) Put(key string, val interface{}, timeout time.Duration) error {
+	return b.c.Put(context.Background(), key, val, timeout)
+}
+
+func (b *v1Cache) Delete(key string) error {
+	return b.c.Delete(context.Background(), key)
+}
+
+func (b *v1Cache) Incr(key string) error {
+	_, err := b.c.IncrBy(context.Background(), key, 1)
+	return err
+}
+
+func (b *v1Cache) Decr(key string) error {
+	_, err := b.c.IncrBy(context.Background(), key, -1)
+	return err
+}
+
+func (b *v1Cache) IsExist(key string) bool {
+	ok, _ := b.c.IsExist(context.Background(), key)
+	return ok
+}
+
+func (b *v1Cache) ClearAll() error {
+	return b.c.ClearAll(context.Background())
+}
+
+func (b *v1Cache) StartAndGC(config string) error {
+	return b.c.StartAndGC(config)
+}
+
+// incrValue adds n to the integer v, keeping the type of v.
+func incrValue(v interface{}, n int64) (interface{}, int64, error) {
+	switch i := v.(type) {
+	case int:
+		i += int(n)
+		return i, int64(i), nil
+	case int32:
+		i += int32(n)
+		return i, int64(i), nil
+	case int64:
+		i += n
+		return i, i, nil
+	case uint:
+		if n < 0 && uint64(-n) > uint64(i) {
+			return nil, 0, errors.New("cache: value is less than 0")
+		}
+		i = uint(int64(i) + n)
+		return i, int64(i), nil
+	case uint32:
+		if n < 0 && uint64(-n) > uint64(i) {
+			return nil, 0, errors.New("cache: value is less than 0")
+		}
+		i = uint32(int64(i) + n)
+		return i, int64(i), nil
+	case uint64:
+		if n < 0 && uint64(-n) > i {
+			return nil, 0, errors.New("cache: value is less than 0")
+		}
+		i = uint64(int64(i) + n)
+		return i, int64(i), nil
+	}
+	return nil, 0, ErrNotInteger
+}
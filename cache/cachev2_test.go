@@ -0,0 +1,199 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// testCacheV2 runs the CacheV2 behaviors shared by every adapter.
+func testCacheV2(t *testing.T, bm CacheV2) {
+	ctx := context.Background()
+	if err := bm.ClearAll(ctx); err != nil {
+		t.Fatal("clear all err", err)
+	}
+	if _, err := bm.Get(ctx, "diepdt"); err != ErrCacheMiss {
+		t.Errorf("Get of a missing key is expected to be ErrCacheMiss, found %v", err)
+	}
+	if err := bm.Put(ctx, "diepdt", 1, 10*time.Second); err != nil {
+		t.Error("set Error", err)
+	}
+	if v, err := bm.Get(ctx, "diepdt"); err != nil || v.(int) != 1 {
+		t.Errorf("Get is expected to be 1, found %v %v", v, err)
+	}
+	if ttl, err := bm.TTL(ctx, "diepdt"); err != nil || ttl <= 0 || ttl > 10*time.Second {
+		t.Errorf("TTL is expected to be at most 10s, found %v %v", ttl, err)
+	}
+
+	if n, err := bm.IncrBy(ctx, "diepdt", 5); err != nil || n != 6 {
+		t.Errorf("IncrBy is expected to be 6, found %d %v", n, err)
+	}
+	if n, err := bm.IncrBy(ctx, "diepdt", -2); err != nil || n != 4 {
+		t.Errorf("IncrBy is expected to be 4, found %d %v", n, err)
+	}
+	if v, _ := bm.Get(ctx, "diepdt"); v.(int) != 4 {
+		t.Errorf("IncrBy is expected to keep the int type, found %T %v", v, v)
+	}
+	if n, err := bm.IncrBy(ctx, "counter", 3); err != nil || n != 3 {
+		t.Errorf("IncrBy of a missing key is expected to be 3, found %d %v", n, err)
+	}
+	if ttl, err := bm.TTL(ctx, "counter"); err != nil || ttl != 0 {
+		t.Errorf("TTL of a counter is expected to be 0, found %v %v", ttl, err)
+	}
+	bm.Put(ctx, "name", "diepdt", 0)
+	if _, err := bm.IncrBy(ctx, "name", 1); err != ErrNotInteger {
+		t.Errorf("IncrBy of a string is expected to be ErrNotInteger, found %v", err)
+	}
+
+	if ok, err := bm.SetNX(ctx, "diepdt", 10, 0); err != nil || ok {
+		t.Errorf("SetNX of an existing key is expected to be false, found %v %v", ok, err)
+	}
+	if ok, err := bm.SetNX(ctx, "lock", "owner", time.Second); err != nil || !ok {
+		t.Errorf("SetNX of a missing key is expected to be true, found %v %v", ok, err)
+	}
+	if ok, err := bm.CompareAndSwap(ctx, "lock", "other", "next", 0); err != nil || ok {
+		t.Errorf("CompareAndSwap of another value is expected to be false, found %v %v", ok, err)
+	}
+	if ok, err := bm.CompareAndSwap(ctx, "lock", "owner", "next", 0); err != nil || !ok {
+		t.Errorf("CompareAndSwap is expected to be true, found %v %v", ok, err)
+	}
+	if v, _ := bm.Get(ctx, "lock"); v != "next" {
+		t.Errorf("CompareAndSwap is expected to set next, found %v", v)
+	}
+	if _, err := bm.CompareAndSwap(ctx, "missing", "a", "b", 0); err != ErrCacheMiss {
+		t.Errorf("CompareAndSwap of a missing key is expected to be ErrCacheMiss, found %v", err)
+	}
+
+	values, errs := bm.GetMulti(ctx, []string{"diepdt", "missing", "lock"})
+	if len(values) != 3 || len(errs) != 3 {
+		t.Fatalf("GetMulti is expected to return 3 values, found %d %d", len(values), len(errs))
+	}
+	if values[0].(int) != 4 || errs[0] != nil || errs[1] != ErrCacheMiss || values[2] != "next" {
+		t.Errorf("GetMulti is expected to be [4 miss next], found %v %v", values, errs)
+	}
+
+	if err := bm.Delete(ctx, "diepdt"); err != nil {
+		t.Error("delete err", err)
+	}
+	if err := bm.Delete(ctx, "diepdt"); err != nil {
+		t.Errorf("Delete of a missing key is expected to succeed, found %v", err)
+	}
+	if ok, err := bm.IsExist(ctx, "diepdt"); err != nil || ok {
+		t.Errorf("IsExist of a deleted key is expected to be false, found %v %v", ok, err)
+	}
+
+	if err := bm.Put(ctx, "short", "v", 10*time.Millisecond); err != nil {
+		t.Error("set Error", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := bm.Get(ctx, "short"); err != ErrCacheMiss {
+		t.Errorf("Get of an expired key is expected to be ErrCacheMiss, found %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := bm.Put(canceled, "diepdt", 1, 0); err != nil && err != context.Canceled {
+		t.Errorf("Put with a canceled context is expected to be context.Canceled, found %v", err)
+	}
+
+	if err := bm.ClearAll(ctx); err != nil {
+		t.Error("clear all err", err)
+	}
+	if ok, _ := bm.IsExist(ctx, "lock"); ok {
+		t.Error("ClearAll is expected to remove every key")
+	}
+}
+
+func TestMemoryCacheV2(t *testing.T) {
+	bm, err := NewCacheV2("memory", `{"interval":20}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	testCacheV2(t, bm)
+}
+
+func TestFileCacheV2(t *testing.T) {
+	bm, err := NewCacheV2("file", `{"CachePath":"cachev2","FileSuffix":".bin","DirectoryLevel":2,"EmbedExpiry":0}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	defer os.RemoveAll("cachev2")
+	testCacheV2(t, bm)
+
+	ctx := context.Background()
+	os.MkdirAll("cachev2", os.ModePerm)
+	fv := bm.(*FileCacheV2)
+	FilePutContents(fv.fc.getCacheFileName("broken"), []byte("not gob"))
+	if _, err := bm.Get(ctx, "broken"); err == nil || err == ErrCacheMiss {
+		t.Errorf("Get of a broken file is expected to be a decoding error, found %v", err)
+	}
+}
+
+func TestCacheBridge(t *testing.T) {
+	ctx := context.Background()
+	v1, _ := NewCache("memory", `{"interval":20}`)
+	bm := FromV1(v1)
+	if ToV1(bm) != v1 {
+		t.Error("ToV1 of FromV1 is expected to return the v1 cache")
+	}
+	if _, err := bm.Get(ctx, "diepdt"); err != ErrCacheMiss {
+		t.Errorf("Get of a missing key is expected to be ErrCacheMiss, found %v", err)
+	}
+	if n, err := bm.IncrBy(ctx, "diepdt", 3); err != nil || n != 3 {
+		t.Errorf("IncrBy is expected to be 3, found %d %v", n, err)
+	}
+	if v := v1.Get("diepdt"); v.(int) != 3 {
+		t.Errorf("v1 Get is expected to be 3, found %v", v)
+	}
+	// a missing counter is set at once, whatever n
+	if n, err := bm.IncrBy(ctx, "generation", 1<<40); err != nil || n != 1<<40 {
+		t.Errorf("IncrBy of a missing key is expected to be n, found %d %v", n, err)
+	}
+	if ok, _ := bm.SetNX(ctx, "diepdt", 1, 0); ok {
+		t.Error("SetNX of an existing key is expected to be false")
+	}
+	if _, err := bm.TTL(ctx, "diepdt"); err != ErrNotSupported {
+		t.Errorf("TTL is expected to be ErrNotSupported, found %v", err)
+	}
+
+	v2, _ := NewCacheV2("memory", `{"interval":20}`)
+	c := ToV1(v2)
+	if FromV1(c) != v2 {
+		t.Error("FromV1 of ToV1 is expected to return the v2 cache")
+	}
+	c.Put("diepdt", 1, 0)
+	c.Incr("diepdt")
+	if v := c.Get("diepdt"); v.(int) != 2 {
+		t.Errorf("v1 Get of a v2 cache is expected to be 2, found %v", v)
+	}
+	if v := c.Get("missing"); v != nil {
+		t.Errorf("v1 Get of a missing key is expected to be nil, found %v", v)
+	}
+
+	// adapters without a v2 implementation are bridged
+	Register("v1only", NewMemoryCache)
+	defer delete(adapters, "v1only")
+	if bm, err := NewCacheV2("v1only", `{"interval":20}`); err != nil {
+		t.Error("init err", err)
+	} else if _, ok := bm.(*v2Cache); !ok {
+		t.Errorf("NewCacheV2 of a v1 adapter is expected to be bridged, found %T", bm)
+	}
+	if _, err := NewCacheV2("unknown", ""); err == nil {
+		t.Error("NewCacheV2 of an unknown adapter is expected to fail")
+	}
+}
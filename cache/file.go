@@ -16,22 +16,29 @@ package cache
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
 // FileCacheItem is basic unit of file cache adapter.
 // it contains data and expire time.
+// it is the format of the files written before the file header,
+// which are still read.
 type FileCacheItem struct {
 	Data       interface{}
 	Lastaccess time.Time
@@ -44,14 +51,51 @@ var (
 	FileCacheFileSuffix     = ".bin"      // cache file suffix
 	FileCacheDirectoryLevel = 2           // cache file deep level if auto generated cache files.
 	FileCacheEmbedExpiry    time.Duration // cache expire time, default is no expire forever.
+	FileCacheSerializer     = "gob"       // serializer of the cached values.
+	FileCacheInterval       = 60          // seconds between the expiry sweeps, 0 disables them.
 )
 
+// fileCacheForever is the expiry of the legacy file cache items kept forever.
+const fileCacheForever = (86400 * 365 * 10) * time.Second // ten years
+
+// fileLockStale is the age of a lock or temporary file left by a crashed process.
+const fileLockStale = 10 * time.Second
+
+// fileQuotaLowWater is the part of the quota kept by the cleanup,
+// so that it does not run again on the next put.
+const fileQuotaLowWater = 0.9
+
+// the cache files are fileCacheMagic, the expiry in unix nanoseconds
+// (0 for never), the length of the key and the key, listed by Keys, then the
+// serialized value. The files of fileCacheMagicV1 have no key.
+var (
+	fileCacheMagic   = []byte("IZFC\x02")
+	fileCacheMagicV1 = []byte("IZFC\x01")
+)
+
+// fileCacheHeaderLen is the length of the magic and the expiry.
+const fileCacheHeaderLen = 5 + 8
+
+// fileCacheMaxKey is the longest key stored in a file header,
+// the longer ones are stored without their key.
+const fileCacheMaxKey = 1<<16 - 1
+
 // FileCache is cache adapter for file storage.
+// the files are written to a temporary file renamed into place, so that a crash
+// never leaves a half written item. When MaxBytes or MaxEntries is set, the least
+// recently accessed items are removed once the cache goes over the quota.
 type FileCache struct {
+	bytes    int64 // usage of the cache, first for atomic alignment
+	entries  int64
+	sweeping int32
+
 	CachePath      string
 	FileSuffix     string
 	DirectoryLevel int
 	EmbedExpiry    int
+	Serializer     FileSerializer
+	MaxBytes       int64
+	MaxEntries     int64
 }
 
 // NewFileCache Create new file cache with no config.
@@ -62,10 +106,12 @@ func NewFileCache() Cache {
 }
 
 // StartAndGC will start and begin gc for file cache.
-// the config need to be like {CachePath:"/cache","FileSuffix":".bin","DirectoryLevel":2,"EmbedExpiry":0}
+// the config need to be like {CachePath:"/cache","FileSuffix":".bin","DirectoryLevel":"2","EmbedExpiry":"0",
+// "Serializer":"gob","MaxBytes":"0","MaxEntries":"0","Interval":"60"}
+// Serializer is gob, json, raw or a name given to RegisterFileSerializer.
 func (fc *FileCache) StartAndGC(config string) error {
 
-	var cfg map[string]string
+	cfg := make(map[string]string)
 	json.Unmarshal([]byte(config), &cfg)
 	if _, ok := cfg["CachePath"]; !ok {
 		cfg["CachePath"] = FileCachePath
@@ -79,12 +125,33 @@ func (fc *FileCache) StartAndGC(config string) error {
 	if _, ok := cfg["EmbedExpiry"]; !ok {
 		cfg["EmbedExpiry"] = strconv.FormatInt(int64(FileCacheEmbedExpiry.Seconds()), 10)
 	}
+	if _, ok := cfg["Serializer"]; !ok {
+		cfg["Serializer"] = FileCacheSerializer
+	}
+	if _, ok := cfg["Interval"]; !ok {
+		cfg["Interval"] = strconv.Itoa(FileCacheInterval)
+	}
 	fc.CachePath = cfg["CachePath"]
 	fc.FileSuffix = cfg["FileSuffix"]
 	fc.DirectoryLevel, _ = strconv.Atoi(cfg["DirectoryLevel"])
 	fc.EmbedExpiry, _ = strconv.Atoi(cfg["EmbedExpiry"])
+	fc.MaxBytes, _ = strconv.ParseInt(cfg["MaxBytes"], 10, 64)
+	fc.MaxEntries, _ = strconv.ParseInt(cfg["MaxEntries"], 10, 64)
+	interval, _ := strconv.Atoi(cfg["Interval"])
+	s, ok := fileSerializers[cfg["Serializer"]]
+	if !ok {
+		return fmt.Errorf("cache: unknown file serializer %q", cfg["Serializer"])
+	}
+	fc.Serializer = s
 
 	fc.Init()
+	if fc.hasQuota() {
+		// the usage of the existing files
+		fc.sweep()
+	}
+	if interval > 0 {
+		go fc.vacuum(time.Duration(interval) * time.Second)
+	}
 	return nil
 }
 
@@ -115,19 +182,288 @@ func (fc *FileCache) getCacheFileName(key string) string {
 	return filepath.Join(cachePath, fmt.Sprintf("%s%s", keyMd5, fc.FileSuffix))
 }
 
+func (fc *FileCache) serializer() FileSerializer {
+	if fc.Serializer == nil {
+		return gobSerializer{}
+	}
+	return fc.Serializer
+}
+
+// encode returns the file content of val with key, a zero expire means never.
+func (fc *FileCache) encode(key string, val interface{}, expire time.Time) ([]byte, error) {
+	data, err := fc.serializer().Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) > fileCacheMaxKey {
+		key = ""
+	}
+	buf := make([]byte, fileCacheHeaderLen+2, fileCacheHeaderLen+2+len(key)+len(data))
+	copy(buf, fileCacheMagic)
+	if !expire.IsZero() {
+		binary.BigEndian.PutUint64(buf[len(fileCacheMagic):], uint64(expire.UnixNano()))
+	}
+	binary.BigEndian.PutUint16(buf[fileCacheHeaderLen:], uint16(len(key)))
+	buf = append(buf, key...)
+	return append(buf, data...), nil
+}
+
+// decode returns the value and the expiry of a file content.
+func (fc *FileCache) decode(data []byte) (interface{}, time.Time, error) {
+	n := headerLen(data)
+	if n < 0 {
+		var to FileCacheItem
+		if err := GobDecode(data, &to); err != nil {
+			return nil, time.Time{}, err
+		}
+		return to.Data, legacyExpiry(&to), nil
+	}
+	val, err := fc.serializer().Unmarshal(data[n:])
+	return val, headerExpiry(data), err
+}
+
+// headerLen returns the length of the header starting data, -1 for the
+// legacy files. data must hold the key length of the header.
+func headerLen(data []byte) int {
+	switch {
+	case len(data) < fileCacheHeaderLen:
+		return -1
+	case bytes.HasPrefix(data, fileCacheMagicV1):
+		return fileCacheHeaderLen
+	case bytes.HasPrefix(data, fileCacheMagic) && len(data) >= fileCacheHeaderLen+2:
+		n := fileCacheHeaderLen + 2 + int(binary.BigEndian.Uint16(data[fileCacheHeaderLen:]))
+		if n <= len(data) {
+			return n
+		}
+	}
+	return -1
+}
+
+func headerExpiry(header []byte) time.Time {
+	nano := int64(binary.BigEndian.Uint64(header[len(fileCacheMagic):fileCacheHeaderLen]))
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
+
+func legacyExpiry(to *FileCacheItem) time.Time {
+	if to.Expired.Sub(to.Lastaccess) >= fileCacheForever {
+		return time.Time{}
+	}
+	return to.Expired
+}
+
+// readHeader reads the expiry and the key of a cache file, without decoding
+// its value. The key is "" for the files without one.
+func readHeader(filename string) (time.Time, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	defer f.Close()
+	header := make([]byte, fileCacheHeaderLen+2)
+	if n, _ := io.ReadFull(f, header); n >= fileCacheHeaderLen {
+		header = header[:n]
+		if bytes.HasPrefix(header, fileCacheMagicV1) {
+			return headerExpiry(header), "", nil
+		}
+		if bytes.HasPrefix(header, fileCacheMagic) && n == len(header) {
+			key := make([]byte, binary.BigEndian.Uint16(header[fileCacheHeaderLen:]))
+			if _, err = io.ReadFull(f, key); err == nil {
+				return headerExpiry(header), string(key), nil
+			}
+		}
+	}
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	var to FileCacheItem
+	if err = GobDecode(data, &to); err != nil {
+		return time.Time{}, "", err
+	}
+	return legacyExpiry(&to), "", nil
+}
+
+// read returns the value of key and its expiry, zero for never.
+// ErrCacheMiss if it does not exist or is expired.
+func (fc *FileCache) read(key string) (interface{}, time.Time, error) {
+	filename := fc.getCacheFileName(key)
+	data, err := FileGetContents(filename)
+	if os.IsNotExist(err) {
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	val, expire, err := fc.decode(data)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	now := time.Now()
+	if !expire.IsZero() && expire.Before(now) {
+		return nil, time.Time{}, ErrCacheMiss
+	}
+	if fc.hasQuota() {
+		// the modification time is the access time of the cleanup
+		os.Chtimes(filename, now, now)
+	}
+	return val, expire, nil
+}
+
+// write writes val with key, a zero expire means never.
+func (fc *FileCache) write(key string, val interface{}, expire time.Time) error {
+	data, err := fc.encode(key, val, expire)
+	if err != nil {
+		return err
+	}
+	filename := fc.getCacheFileName(key)
+	oldSize := int64(-1)
+	if info, err := os.Stat(filename); err == nil {
+		oldSize = info.Size()
+	}
+	if err = FilePutContents(filename, data); err != nil {
+		return err
+	}
+	if oldSize < 0 {
+		atomic.AddInt64(&fc.entries, 1)
+		oldSize = 0
+	}
+	atomic.AddInt64(&fc.bytes, int64(len(data))-oldSize)
+	if fc.overQuota(atomic.LoadInt64(&fc.entries), atomic.LoadInt64(&fc.bytes)) {
+		fc.sweep()
+	}
+	return nil
+}
+
+// remove removes a cache file, a missing file is not an error.
+func (fc *FileCache) remove(filename string) error {
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(filename); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	atomic.AddInt64(&fc.entries, -1)
+	atomic.AddInt64(&fc.bytes, -info.Size())
+	return nil
+}
+
+// lock locks key with a lock file next to its cache file, so that the
+// read-modify-write of key is atomic across the processes sharing CachePath.
+// the lock file of a crashed process is removed after fileLockStale.
+func (fc *FileCache) lock(ctx context.Context, key string) (func(), error) {
+	name := fc.getCacheFileName(key) + ".lock"
+	wait := time.Millisecond
+	for {
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(name) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(name); err == nil && time.Since(info.ModTime()) > fileLockStale {
+			os.Remove(name)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		if wait < 10*time.Millisecond {
+			wait *= 2
+		}
+	}
+}
+
+func (fc *FileCache) hasQuota() bool {
+	return fc.MaxBytes > 0 || fc.MaxEntries > 0
+}
+
+func (fc *FileCache) overQuota(entries, size int64) bool {
+	return (fc.MaxEntries > 0 && entries > fc.MaxEntries) || (fc.MaxBytes > 0 && size > fc.MaxBytes)
+}
+
+// vacuum sweeps the cache every interval.
+func (fc *FileCache) vacuum(interval time.Duration) {
+	for {
+		<-time.After(interval)
+		fc.sweep()
+	}
+}
+
+// sweep removes the expired items and the files left by crashed processes, then
+// the least recently accessed items while the cache is over its quota.
+func (fc *FileCache) sweep() {
+	if !atomic.CompareAndSwapInt32(&fc.sweeping, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&fc.sweeping, 0)
+
+	type cacheFile struct {
+		path   string
+		size   int64
+		access time.Time
+	}
+	var (
+		files []cacheFile
+		size  int64
+		now   = time.Now()
+	)
+	filepath.Walk(fc.CachePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if !strings.HasSuffix(path, fc.FileSuffix) {
+			name := info.Name()
+			if (strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".lock")) && now.Sub(info.ModTime()) > fileLockStale {
+				os.Remove(path)
+			}
+			return nil
+		}
+		if expire, _, err := readHeader(path); err == nil && !expire.IsZero() && expire.Before(now) {
+			os.Remove(path)
+			return nil
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), access: info.ModTime()})
+		size += info.Size()
+		return nil
+	})
+
+	if fc.overQuota(int64(len(files)), size) {
+		sort.Slice(files, func(i, j int) bool { return files[i].access.Before(files[j].access) })
+		maxEntries := int64(float64(fc.MaxEntries) * fileQuotaLowWater)
+		maxBytes := int64(float64(fc.MaxBytes) * fileQuotaLowWater)
+		for len(files) > 0 && ((fc.MaxEntries > 0 && int64(len(files)) > maxEntries) || (fc.MaxBytes > 0 && size > maxBytes)) {
+			if err := os.Remove(files[0].path); err == nil || os.IsNotExist(err) {
+				size -= files[0].size
+			}
+			files = files[1:]
+		}
+	}
+	atomic.StoreInt64(&fc.entries, int64(len(files)))
+	atomic.StoreInt64(&fc.bytes, size)
+}
+
 // Get value from file cache.
 // if non-exist or expired, return empty string.
 func (fc *FileCache) Get(key string) interface{} {
-	fileData, err := FileGetContents(fc.getCacheFileName(key))
+	val, _, err := fc.read(key)
 	if err != nil {
 		return ""
 	}
-	var to FileCacheItem
-	GobDecode(fileData, &to)
-	if to.Expired.Before(time.Now()) {
-		return ""
-	}
-	return to.Data
+	return val
 }
 
 // GetMulti gets values from file cache.
@@ -144,68 +480,181 @@ func (fc *FileCache) GetMulti(keys []string) []interface{} {
 // timeout means how long to keep this file, unit of ms.
 // if timeout equals FileCacheEmbedExpiry(default is 0), cache this item forever.
 func (fc *FileCache) Put(key string, val interface{}, timeout time.Duration) error {
-	gob.Register(val)
-
-	item := FileCacheItem{Data: val}
-	if timeout == FileCacheEmbedExpiry {
-		item.Expired = time.Now().Add((86400 * 365 * 10) * time.Second) // ten years
-	} else {
-		item.Expired = time.Now().Add(timeout)
-	}
-	item.Lastaccess = time.Now()
-	data, err := GobEncode(item)
-	if err != nil {
-		return err
+	var expire time.Time
+	if timeout != FileCacheEmbedExpiry {
+		expire = time.Now().Add(timeout)
 	}
-	return FilePutContents(fc.getCacheFileName(key), data)
+	return fc.write(key, val, expire)
 }
 
 // Delete file cache value.
 func (fc *FileCache) Delete(key string) error {
-	filename := fc.getCacheFileName(key)
-	if ok, _ := exists(filename); ok {
-		return os.Remove(filename)
-	}
-	return nil
+	return fc.remove(fc.getCacheFileName(key))
 }
 
 // Incr will increase cached int value.
 // fc value is saving forever unless Delete.
 func (fc *FileCache) Incr(key string) error {
-	data := fc.Get(key)
-	var incr int
-	if reflect.TypeOf(data).Name() != "int" {
-		incr = 0
-	} else {
-		incr = data.(int) + 1
-	}
-	fc.Put(key, incr, FileCacheEmbedExpiry)
-	return nil
+	return fc.add(key, 1)
 }
 
 // Decr will decrease cached int value.
 func (fc *FileCache) Decr(key string) error {
-	data := fc.Get(key)
-	var decr int
-	if reflect.TypeOf(data).Name() != "int" || data.(int)-1 <= 0 {
-		decr = 0
-	} else {
-		decr = data.(int) - 1
-	}
-	fc.Put(key, decr, FileCacheEmbedExpiry)
-	return nil
+	return fc.add(key, -1)
+}
+
+// add adds n to the counter of key under its lock, a value which
+// is not an integer becomes 0, and the counter does not go below 0.
+func (fc *FileCache) add(key string, n int64) error {
+	unlock, err := fc.lock(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	val, i, err := incrFileValue(fc.Get(key), n)
+	if err != nil || i < 0 {
+		val = 0
+	}
+	return fc.write(key, val, time.Time{})
 }
 
-// IsExist check value is exist.
+// IsExist check value is exist and not expired.
 func (fc *FileCache) IsExist(key string) bool {
-	ret, _ := exists(fc.getCacheFileName(key))
-	return ret
+	expire, _, err := readHeader(fc.getCacheFileName(key))
+	return err == nil && (expire.IsZero() || expire.After(time.Now()))
 }
 
-// ClearAll will clean cached files.
-// not implemented.
+// ClearAll removes the cache files in CachePath.
 func (fc *FileCache) ClearAll() error {
-	return nil
+	return fc.clear(context.Background())
+}
+
+func (fc *FileCache) clear(ctx context.Context) error {
+	err := filepath.Walk(fc.CachePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(path, fc.FileSuffix) {
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	atomic.StoreInt64(&fc.entries, 0)
+	atomic.StoreInt64(&fc.bytes, 0)
+	return err
+}
+
+// incrFileValue adds n to the integer v, the json and raw serializers
+// read the integers back as json.Number and []byte.
+func incrFileValue(v interface{}, n int64) (interface{}, int64, error) {
+	switch c := v.(type) {
+	case json.Number:
+		i, err := c.Int64()
+		if err != nil {
+			return nil, 0, ErrNotInteger
+		}
+		return i + n, i + n, nil
+	case []byte:
+		i, err := strconv.ParseInt(string(c), 10, 64)
+		if err != nil {
+			return nil, 0, ErrNotInteger
+		}
+		return []byte(strconv.FormatInt(i+n, 10)), i + n, nil
+	case string:
+		i, err := strconv.ParseInt(c, 10, 64)
+		if err != nil {
+			return nil, 0, ErrNotInteger
+		}
+		return strconv.FormatInt(i+n, 10), i + n, nil
+	}
+	return incrValue(v, n)
+}
+
+// FileSerializer encodes the values of the file cache.
+type FileSerializer interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+var fileSerializers = map[string]FileSerializer{
+	"gob":  gobSerializer{},
+	"json": jsonSerializer{},
+	"raw":  rawSerializer{},
+}
+
+// RegisterFileSerializer makes a file cache serializer available by the name
+// of the Serializer config. If it is called twice with the same name or if
+// serializer is nil, it panics.
+func RegisterFileSerializer(name string, serializer FileSerializer) {
+	if serializer == nil {
+		panic("cache: Register file serializer is nil")
+	}
+	if _, ok := fileSerializers[name]; ok {
+		panic("cache: Register called twice for file serializer " + name)
+	}
+	fileSerializers[name] = serializer
+}
+
+// gobSerializer keeps the type of the values, which are registered with gob.Register.
+type gobSerializer struct{}
+
+type gobItem struct {
+	Data interface{}
+}
+
+func (gobSerializer) Marshal(v interface{}) ([]byte, error) {
+	if v != nil {
+		gob.Register(v)
+	}
+	return GobEncode(gobItem{Data: v})
+}
+
+func (gobSerializer) Unmarshal(data []byte) (interface{}, error) {
+	var to gobItem
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&to)
+	return to.Data, err
+}
+
+// jsonSerializer reads the values back as the types of encoding/json,
+// with the numbers as json.Number.
+type jsonSerializer struct{}
+
+func (jsonSerializer) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonSerializer) Unmarshal(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// rawSerializer stores string, []byte and integers as they are,
+// and reads them back as []byte.
+type rawSerializer struct{}
+
+func (rawSerializer) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	case int, int32, int64, uint, uint32, uint64:
+		return []byte(fmt.Sprint(b)), nil
+	}
+	return nil, errors.New("cache: raw serializer only supports string, []byte and integers")
+}
+
+func (rawSerializer) Unmarshal(data []byte) (interface{}, error) {
+	return data, nil
 }
 
 // check file exist.
@@ -227,9 +676,31 @@ func FileGetContents(filename string) (data []byte, e error) {
 }
 
 // FilePutContents Put bytes to file.
-// if non-exist, create this file.
+// the bytes are written to a temporary file renamed to filename,
+// so that filename is never read half written.
 func FilePutContents(filename string, content []byte) error {
-	return ioutil.WriteFile(filename, content, os.ModePerm)
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
 }
 
 // GobEncode Gob encodes file cache item.
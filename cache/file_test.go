@@ -0,0 +1,200 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestFileCache(t *testing.T, path, config string) *FileCache {
+	os.RemoveAll(path)
+	bm, err := NewCache("file", `{"CachePath":"`+path+`","FileSuffix":".bin","DirectoryLevel":"1","Interval":"0"`+config+`}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	return bm.(*FileCache)
+}
+
+// cacheFiles returns the names of the files in path.
+func cacheFiles(path string) []string {
+	var names []string
+	filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			names = append(names, info.Name())
+		}
+		return nil
+	})
+	return names
+}
+
+func TestFilePutContents(t *testing.T) {
+	os.MkdirAll("cacheatomic", os.ModePerm)
+	defer os.RemoveAll("cacheatomic")
+	filename := filepath.Join("cacheatomic", "item.bin")
+	for _, content := range []string{"first", "second"} {
+		if err := FilePutContents(filename, []byte(content)); err != nil {
+			t.Fatal("put err", err)
+		}
+		if data, _ := ioutil.ReadFile(filename); string(data) != content {
+			t.Errorf("file is expected to be %s, found %s", content, data)
+		}
+	}
+	if names := cacheFiles("cacheatomic"); len(names) != 1 {
+		t.Errorf("temporary files are expected to be renamed, found %v", names)
+	}
+}
+
+func TestFileCacheSerializers(t *testing.T) {
+	defer os.RemoveAll("cacheserializer")
+	fc := newTestFileCache(t, "cacheserializer", `,"Serializer":"json"`)
+	fc.Put("user", map[string]interface{}{"name": "diepdt", "age": 30}, time.Hour)
+	v, ok := fc.Get("user").(map[string]interface{})
+	if !ok || v["name"] != "diepdt" || v["age"] != json.Number("30") {
+		t.Errorf("json value is expected to be read back, found %#v", fc.Get("user"))
+	}
+	fc.Put("counter", 1, 0)
+	fc.Incr("counter")
+	if v := fc.Get("counter"); v != json.Number("2") {
+		t.Errorf("json counter is expected to be 2, found %#v", v)
+	}
+
+	fc = newTestFileCache(t, "cacheserializer", `,"Serializer":"raw"`)
+	fc.Put("page", "<html>", time.Hour)
+	if v, _ := fc.Get("page").([]byte); string(v) != "<html>" {
+		t.Errorf("raw value is expected to be read back as bytes, found %#v", fc.Get("page"))
+	}
+	if err := fc.Put("user", struct{}{}, time.Hour); err == nil {
+		t.Error("raw serializer is expected to reject a struct")
+	}
+	fv := &FileCacheV2{fc: fc}
+	for i := 0; i < 2; i++ {
+		fv.IncrBy(context.Background(), "counter", 5)
+	}
+	if v, _ := fc.Get("counter").([]byte); string(v) != "10" {
+		t.Errorf("raw counter is expected to be 10, found %#v", fc.Get("counter"))
+	}
+
+	if _, err := NewCache("file", `{"CachePath":"cacheserializer","Serializer":"xml"}`); err == nil {
+		t.Error("unknown serializer is expected to fail")
+	}
+}
+
+func TestFileCacheLegacyItem(t *testing.T) {
+	defer os.RemoveAll("cachelegacy")
+	fc := newTestFileCache(t, "cachelegacy", "")
+	now := time.Now()
+	data, _ := GobEncode(FileCacheItem{Data: "old", Lastaccess: now, Expired: now.Add(fileCacheForever)})
+	FilePutContents(fc.getCacheFileName("legacy"), data)
+	if v := fc.Get("legacy"); v != "old" {
+		t.Errorf("legacy item is expected to be read, found %v", v)
+	}
+	if ttl, _ := (&FileCacheV2{fc: fc}).TTL(context.Background(), "legacy"); ttl != 0 {
+		t.Errorf("legacy item kept forever is expected to have no TTL, found %v", ttl)
+	}
+
+	// the first header had no key
+	v1, _ := gobSerializer{}.Marshal("first")
+	FilePutContents(fc.getCacheFileName("v1"), append(append([]byte("IZFC\x01"), make([]byte, 8)...), v1...))
+	if v := fc.Get("v1"); v != "first" {
+		t.Errorf("item of the first header is expected to be read, found %v", v)
+	}
+}
+
+func TestFileCacheConcurrentIncr(t *testing.T) {
+	defer os.RemoveAll("cachelock")
+	fc := newTestFileCache(t, "cachelock", "")
+	// two caches sharing the directory, like two processes
+	other := newTestFileCache(t, "cachelock", "")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(bm Cache) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				bm.Incr("counter")
+			}
+		}([]Cache{fc, other}[i%2])
+	}
+	wg.Wait()
+	// the first Incr of a missing counter sets it to 0
+	if v := fc.Get("counter"); v != 199 {
+		t.Errorf("counter is expected to be 199, found %v", v)
+	}
+	for _, name := range cacheFiles("cachelock") {
+		if filepath.Ext(name) != ".bin" {
+			t.Errorf("lock files are expected to be removed, found %s", name)
+		}
+	}
+}
+
+func TestFileCacheQuota(t *testing.T) {
+	defer os.RemoveAll("cachequota")
+	fc := newTestFileCache(t, "cachequota", `,"MaxEntries":"10"`)
+	past := time.Now().Add(-time.Hour)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key%d", i)
+		fc.Put(key, i, time.Hour)
+		// older access times for the first keys
+		os.Chtimes(fc.getCacheFileName(key), past, past.Add(time.Duration(i)*time.Second))
+	}
+	// key0 is read, so key1 is the least recently accessed
+	fc.Get("key0")
+	fc.Put("key10", 10, time.Hour)
+	if n := len(cacheFiles("cachequota")); n != 9 {
+		t.Errorf("cache is expected to be cleaned to 9 entries, found %d", n)
+	}
+	if !fc.IsExist("key0") || !fc.IsExist("key10") {
+		t.Error("recently accessed keys are expected to be kept")
+	}
+	if fc.IsExist("key1") || fc.IsExist("key2") {
+		t.Error("least recently accessed keys are expected to be removed")
+	}
+
+	fc = newTestFileCache(t, "cachequota", `,"MaxBytes":"1000"`)
+	for i := 0; i < 20; i++ {
+		fc.Put(fmt.Sprintf("key%d", i), string(make([]byte, 100)), time.Hour)
+	}
+	if size := atomic.LoadInt64(&fc.bytes); size > 1000 {
+		t.Errorf("cache is expected to be at most 1000 bytes, found %d", size)
+	}
+}
+
+func TestFileCacheSweep(t *testing.T) {
+	defer os.RemoveAll("cachesweep")
+	fc := newTestFileCache(t, "cachesweep", "")
+	fc.Put("short", "value", 10*time.Millisecond)
+	fc.Put("long", "value", time.Hour)
+	stale := fc.getCacheFileName("crashed") + ".lock"
+	ioutil.WriteFile(stale, nil, 0644)
+	old := time.Now().Add(-time.Minute)
+	os.Chtimes(stale, old, old)
+	time.Sleep(20 * time.Millisecond)
+	fc.sweep()
+	if names := cacheFiles("cachesweep"); len(names) != 1 {
+		t.Errorf("expired items and stale locks are expected to be removed, found %v", names)
+	}
+	if !fc.IsExist("long") {
+		t.Error("living item is expected to be kept")
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// FileCacheV2 is the CacheV2 of the file adapter.
+// IncrBy, SetNX, CompareAndSwap and CompareAndDelete lock the key with a lock file,
+// so they are atomic across the processes sharing CachePath.
+type FileCacheV2 struct {
+	fc *FileCache
+}
+
+// NewFileCacheV2 Create new file cache with no config.
+// the level and expiry need set in method StartAndGC as config string.
+func NewFileCacheV2() CacheV2 {
+	return &FileCacheV2{fc: &FileCache{}}
+}
+
+// read returns the living value of key and its expiry.
+func (fv *FileCacheV2) read(ctx context.Context, key string) (interface{}, time.Time, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, time.Time{}, err
+	}
+	return fv.fc.read(key)
+}
+
+func (fv *FileCacheV2) write(ctx context.Context, key string, val interface{}, expire time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fv.fc.write(key, val, expire)
+}
+
+// expiryOf returns the expiry of timeout, zero for 0 which means never.
+func expiryOf(timeout time.Duration) time.Time {
+	if timeout == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// Get value from file cache, ErrCacheMiss if non-exist or expired.
+func (fv *FileCacheV2) Get(ctx context.Context, key string) (interface{}, error) {
+	val, _, err := fv.read(ctx, key)
+	return val, err
+}
+
+// GetMulti gets values from file cache.
+func (fv *FileCacheV2) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		values[i], errs[i] = fv.Get(ctx, key)
+	}
+	return values, errs
+}
+
+// Put value into file cache.
+// if timeout is 0, cache this item forever.
+func (fv *FileCacheV2) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	return fv.write(ctx, key, val, expiryOf(timeout))
+}
+
+// Delete file cache value.
+func (fv *FileCacheV2) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fv.fc.Delete(key)
+}
+
+// IncrBy adds n to the cached integer value.
+// a missing counter is an int64 kept forever.
+func (fv *FileCacheV2) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	unlock, err := fv.fc.lock(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	data, expire, err := fv.read(ctx, key)
+	if err == ErrCacheMiss {
+		return n, fv.write(ctx, key, n, time.Time{})
+	}
+	if err != nil {
+		return 0, err
+	}
+	val, i, err := incrFileValue(data, n)
+	if err != nil {
+		return 0, err
+	}
+	return i, fv.write(ctx, key, val, expire)
+}
+
+// SetNX puts value into file cache if key does not exist.
+func (fv *FileCacheV2) SetNX(ctx context.Context, key string, val interface{}, timeout time.Duration) (bool, error) {
+	unlock, err := fv.fc.lock(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	_, _, err = fv.read(ctx, key)
+	if err == nil {
+		return false, nil
+	}
+	if err != ErrCacheMiss {
+		return false, err
+	}
+	return true, fv.write(ctx, key, val, expiryOf(timeout))
+}
+
+// CompareAndSwap puts value into file cache if the cached value is deeply equal to old.
+func (fv *FileCacheV2) CompareAndSwap(ctx context.Context, key string, old, val interface{}, timeout time.Duration) (bool, error) {
+	unlock, err := fv.fc.lock(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	data, _, err := fv.read(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if !reflect.DeepEqual(data, old) {
+		return false, nil
+	}
+	return true, fv.write(ctx, key, val, expiryOf(timeout))
+}
+
+// CompareAndDelete deletes the file cache value if it is deeply equal to old.
+func (fv *FileCacheV2) CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error) {
+	unlock, err := fv.fc.lock(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+	data, _, err := fv.read(ctx, key)
+	if err == ErrCacheMiss || (err == nil && !reflect.DeepEqual(data, old)) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, fv.fc.Delete(key)
+}
+
+// TTL returns the remaining time of the file cache value.
+func (fv *FileCacheV2) TTL(ctx context.Context, key string) (time.Duration, error) {
+	_, expire, err := fv.read(ctx, key)
+	if err != nil || expire.IsZero() {
+		return 0, err
+	}
+	return time.Until(expire), nil
+}
+
+// IsExist check value is exist and not expired.
+func (fv *FileCacheV2) IsExist(ctx context.Context, key string) (bool, error) {
+	_, _, err := fv.read(ctx, key)
+	if err == ErrCacheMiss {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ClearAll removes the cache files in CachePath.
+func (fv *FileCacheV2) ClearAll(ctx context.Context) error {
+	return fv.fc.clear(ctx)
+}
+
+// StartAndGC will start and begin gc for file cache.
+// the config is the one of FileCache.StartAndGC.
+func (fv *FileCacheV2) StartAndGC(config string) error {
+	return fv.fc.StartAndGC(config)
+}
+
+func init() {
+	RegisterV2("file", NewFileCacheV2)
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// KeyInfo is a key listed by a KeyLister.
+type KeyInfo struct {
+	Key string
+	// TTL is the time left before the key expires, 0 if it never expires.
+	TTL time.Duration
+}
+
+// KeyLister is implemented by the adapters which can enumerate their keys,
+// the memory, file and redis ones.
+// usage:
+//	lister, ok := cache.Unwrap(bm).(cache.KeyLister)
+//	keys, next, err := lister.Keys("user:", "", 50)
+//	// the next page, until next is ""
+//	keys, next, err = lister.Keys("user:", next, 50)
+type KeyLister interface {
+	// Keys returns about count keys starting with prefix from cursor, "" for
+	// the first page, and the cursor of the next page, "" after the last one.
+	Keys(prefix, cursor string, count int) ([]KeyInfo, string, error)
+}
+
+// pageKeys returns the page of keys after cursor, keys being the cursor of
+// the sorted listings.
+func pageKeys(keys []KeyInfo, cursor string, count int) ([]KeyInfo, string) {
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	start := sort.Search(len(keys), func(i int) bool { return keys[i].Key > cursor })
+	keys = keys[start:]
+	if count <= 0 || len(keys) <= count {
+		return keys, ""
+	}
+	return keys[:count], keys[count-1].Key
+}
+
+// ttlOf returns the TTL of a key expiring at expire, 0 for never.
+func ttlOf(expire time.Time, now time.Time) time.Duration {
+	if expire.IsZero() {
+		return 0
+	}
+	return expire.Sub(now)
+}
+
+// Keys lists the keys of the memory cache.
+func (bc *MemoryCache) Keys(prefix, cursor string, count int) ([]KeyInfo, string, error) {
+	now := time.Now()
+	bc.RLock()
+	keys := make([]KeyInfo, 0, len(bc.items))
+	for key, item := range bc.items {
+		if !strings.HasPrefix(key, prefix) || item.isExpire() {
+			continue
+		}
+		var expire time.Time
+		if item.lifespan > 0 {
+			expire = item.createdTime.Add(item.lifespan)
+		}
+		keys = append(keys, KeyInfo{Key: key, TTL: ttlOf(expire, now)})
+	}
+	bc.RUnlock()
+	keys, next := pageKeys(keys, cursor, count)
+	return keys, next, nil
+}
+
+// Keys lists the keys of the memory cache.
+func (mc *MemoryCacheV2) Keys(prefix, cursor string, count int) ([]KeyInfo, string, error) {
+	return mc.bc.Keys(prefix, cursor, count)
+}
+
+// Keys lists the keys of the file cache, the files written before the keys
+// were stored in them are not listed.
+func (fc *FileCache) Keys(prefix, cursor string, count int) ([]KeyInfo, string, error) {
+	now := time.Now()
+	var keys []KeyInfo
+	err := filepath.Walk(fc.CachePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, fc.FileSuffix) || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		expire, key, err := readHeader(path)
+		if err != nil || key == "" || !strings.HasPrefix(key, prefix) || (!expire.IsZero() && expire.Before(now)) {
+			return nil
+		}
+		keys = append(keys, KeyInfo{Key: key, TTL: ttlOf(expire, now)})
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	keys, next := pageKeys(keys, cursor, count)
+	return keys, next, nil
+}
+
+// Keys lists the keys of the file cache.
+func (fv *FileCacheV2) Keys(prefix, cursor string, count int) ([]KeyInfo, string, error) {
+	return fv.fc.Keys(prefix, cursor, count)
+}
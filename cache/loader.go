@@ -0,0 +1,327 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/izi-global/izigo/logs"
+)
+
+// ErrNotFound is returned by a LoaderFunc when the value does not exist,
+// the Loader caches it for NegativeTTL.
+var ErrNotFound = errors.New("cache: not found")
+
+// Loader defaults
+var (
+	DefaultLoaderNegativeTTL    = 10 * time.Second
+	DefaultLoaderRefreshTimeout = 30 * time.Second
+)
+
+// LoaderFunc loads the value of key, such as from the database.
+type LoaderFunc func(ctx context.Context, key string) (interface{}, error)
+
+// LoaderStats holds the counters of a Loader.
+type LoaderStats struct {
+	Hits         uint64 // fresh values read from the cache
+	Misses       uint64 // values missing from the cache
+	Stale        uint64 // expired values served while they are refreshed
+	NegativeHits uint64 // ErrNotFound read from the cache
+	Loads        uint64 // loader calls for the misses
+	Coalesced    uint64 // misses waiting for the loader call of another one
+	Refreshes    uint64 // background loader calls
+	Errors       uint64 // loader calls which failed, and values which could not be stored
+}
+
+// Loader reads values from a cache and loads the missing ones, with one loader
+// call at a time per key. The values are stored as gob so that every adapter
+// can keep them, the types of the values must be registered with gob.Register.
+// usage:
+//	loader := cache.NewLoader("users", bm)
+//	v, err := loader.GetOrLoad(ctx, "user:1", time.Minute, func(ctx context.Context, key string) (interface{}, error) {
+//		user, err := findUser(1)
+//		if err == orm.ErrNoRows {
+//			return nil, cache.ErrNotFound
+//		}
+//		return user, err
+//	})
+type Loader struct {
+	stats LoaderStats // first for atomic alignment
+
+	// StaleTTL is how long an expired value is served while it is refreshed in background.
+	StaleTTL time.Duration
+	// NegativeTTL is how long ErrNotFound is cached, 0 disables it.
+	NegativeTTL time.Duration
+	// Beta scales the early refresh of the values close to their expiry,
+	// which happens sooner for the values slow to load. 0 disables it.
+	Beta float64
+	// RefreshTimeout bounds the loader calls, which run in background
+	// so that a caller giving up does not fail the other ones.
+	RefreshTimeout time.Duration
+
+	name  string
+	c     CacheV2
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+type loadCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// loaderEntry is the cached form of a loaded value.
+type loaderEntry struct {
+	Value    interface{}
+	NotFound bool
+	Expire   int64 // unix nano of the expiry, 0 for never
+	Delta    int64 // nanoseconds spent by the loader
+}
+
+var (
+	loadersLock sync.Mutex
+	loaders     = make(map[string]*Loader)
+)
+
+// NewLoader returns a Loader over c, listed by Loaders under name.
+// Cache adapters are used through FromV1.
+func NewLoader(name string, c CacheV2) *Loader {
+	l := &Loader{
+		NegativeTTL:    DefaultLoaderNegativeTTL,
+		Beta:           1,
+		RefreshTimeout: DefaultLoaderRefreshTimeout,
+		name:           name,
+		c:              c,
+		calls:          make(map[string]*loadCall),
+	}
+	loadersLock.Lock()
+	loaders[name] = l
+	loadersLock.Unlock()
+	return l
+}
+
+// Loaders returns the loaders sorted by name, for the monitoring.
+func Loaders() []*Loader {
+	loadersLock.Lock()
+	defer loadersLock.Unlock()
+	list := make([]*Loader, 0, len(loaders))
+	for _, l := range loaders {
+		list = append(list, l)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// Name returns the name of the loader.
+func (l *Loader) Name() string {
+	return l.name
+}
+
+// Stats returns the counters of the loader.
+func (l *Loader) Stats() LoaderStats {
+	return LoaderStats{
+		Hits:         atomic.LoadUint64(&l.stats.Hits),
+		Misses:       atomic.LoadUint64(&l.stats.Misses),
+		Stale:        atomic.LoadUint64(&l.stats.Stale),
+		NegativeHits: atomic.LoadUint64(&l.stats.NegativeHits),
+		Loads:        atomic.LoadUint64(&l.stats.Loads),
+		Coalesced:    atomic.LoadUint64(&l.stats.Coalesced),
+		Refreshes:    atomic.LoadUint64(&l.stats.Refreshes),
+		Errors:       atomic.LoadUint64(&l.stats.Errors),
+	}
+}
+
+// GetOrLoad returns the value of key from the cache, or from fn which is called
+// once for the concurrent misses of key, with the context of the first one.
+// A value close to its expiry, or expired for less than StaleTTL, is returned
+// while fn refreshes it in background.
+func (l *Loader) GetOrLoad(ctx context.Context, key string, ttl time.Duration, fn LoaderFunc) (interface{}, error) {
+	if e, ok := l.get(ctx, key); ok {
+		now := time.Now().UnixNano()
+		switch {
+		case e.Expire == 0 || now < e.Expire:
+			atomic.AddUint64(&l.stats.Hits, 1)
+			if l.early(e, now) {
+				l.refresh(key, ttl, fn)
+			}
+		case now < e.Expire+int64(l.StaleTTL):
+			atomic.AddUint64(&l.stats.Stale, 1)
+			l.refresh(key, ttl, fn)
+		default:
+			return l.load(ctx, key, ttl, fn)
+		}
+		if e.NotFound {
+			atomic.AddUint64(&l.stats.NegativeHits, 1)
+			return nil, ErrNotFound
+		}
+		return e.Value, nil
+	}
+	return l.load(ctx, key, ttl, fn)
+}
+
+// Delete removes key from the cache, the next GetOrLoad loads it again.
+func (l *Loader) Delete(ctx context.Context, key string) error {
+	return l.c.Delete(ctx, key)
+}
+
+// early tells whether to refresh a fresh value, with a probability
+// growing as it gets close to its expiry.
+func (l *Loader) early(e *loaderEntry, now int64) bool {
+	if l.Beta <= 0 || e.Expire == 0 || e.Delta <= 0 {
+		return false
+	}
+	return float64(now)-float64(e.Delta)*l.Beta*math.Log(rand.Float64()) >= float64(e.Expire)
+}
+
+func (l *Loader) get(ctx context.Context, key string) (*loaderEntry, bool) {
+	v, err := l.c.Get(ctx, key)
+	if err != nil {
+		return nil, false
+	}
+	var e loaderEntry
+	if err = gobDecodeValue(v, &e); err != nil {
+		return nil, false
+	}
+	return &e, true
+}
+
+func (l *Loader) put(ctx context.Context, key string, e *loaderEntry, ttl time.Duration) error {
+	data, err := gobEncodeValue(e)
+	if err != nil {
+		return err
+	}
+	return l.c.Put(ctx, key, data, ttl)
+}
+
+// store puts e like put, counting and logging the failures
+// such as a value type not registered with gob.
+func (l *Loader) store(ctx context.Context, key string, e *loaderEntry, ttl time.Duration) {
+	if err := l.put(ctx, key, e, ttl); err != nil {
+		atomic.AddUint64(&l.stats.Errors, 1)
+		logs.Error("cache: loader %s can not store %q: %v", l.name, key, err)
+	}
+}
+
+// gobEncodeValue encodes the envelope e as a string, which every adapter can store.
+// The type of its value must be registered with gob.Register by the caller.
+func gobEncodeValue(e interface{}) (string, error) {
+	data, err := GobEncode(e)
+	return string(data), err
+}
+
+// gobDecodeValue decodes the envelope read by gobEncodeValue into e.
+func gobDecodeValue(v, e interface{}) error {
+	var data []byte
+	switch b := v.(type) {
+	case string:
+		data = []byte(b)
+	case []byte:
+		data = b
+	default:
+		return fmt.Errorf("cache: can not decode %T", v)
+	}
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(e)
+}
+
+// call returns the loader call of key, and whether the caller has to run it.
+func (l *Loader) call(key string) (*loadCall, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c, ok := l.calls[key]; ok {
+		return c, false
+	}
+	c := &loadCall{done: make(chan struct{})}
+	l.calls[key] = c
+	return c, true
+}
+
+// run calls fn and caches its result.
+func (l *Loader) run(ctx context.Context, c *loadCall, key string, ttl time.Duration, fn LoaderFunc) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.val, c.err = nil, fmt.Errorf("cache: loader of %q panics: %v", key, r)
+			atomic.AddUint64(&l.stats.Errors, 1)
+		}
+		l.mu.Lock()
+		delete(l.calls, key)
+		l.mu.Unlock()
+		close(c.done)
+	}()
+	start := time.Now()
+	c.val, c.err = fn(ctx, key)
+	e := &loaderEntry{Value: c.val, Delta: int64(time.Since(start))}
+	switch {
+	case c.err == ErrNotFound && l.NegativeTTL > 0:
+		e.Value, e.NotFound = nil, true
+		e.Expire = time.Now().Add(l.NegativeTTL).UnixNano()
+		l.store(ctx, key, e, l.NegativeTTL)
+	case c.err != nil:
+		atomic.AddUint64(&l.stats.Errors, 1)
+	default:
+		hard := ttl
+		if ttl > 0 {
+			e.Expire = time.Now().Add(ttl).UnixNano()
+			hard += l.StaleTTL
+		}
+		l.store(ctx, key, e, hard)
+	}
+}
+
+// load starts the loader call of a miss, or joins the running call of key,
+// and waits for it until ctx is done.
+func (l *Loader) load(ctx context.Context, key string, ttl time.Duration, fn LoaderFunc) (interface{}, error) {
+	atomic.AddUint64(&l.stats.Misses, 1)
+	c, leader := l.call(key)
+	if leader {
+		atomic.AddUint64(&l.stats.Loads, 1)
+		go l.detach(c, key, ttl, fn)
+	} else {
+		atomic.AddUint64(&l.stats.Coalesced, 1)
+	}
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return c.val, c.err
+}
+
+// refresh calls fn in background, unless a call of key is running.
+func (l *Loader) refresh(key string, ttl time.Duration, fn LoaderFunc) {
+	c, leader := l.call(key)
+	if !leader {
+		return
+	}
+	atomic.AddUint64(&l.stats.Refreshes, 1)
+	go l.detach(c, key, ttl, fn)
+}
+
+// detach runs the call of key on a context of its own, bounded by RefreshTimeout.
+func (l *Loader) detach(c *loadCall, key string, ttl time.Duration, fn LoaderFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.RefreshTimeout)
+	defer cancel()
+	l.run(ctx, c, key, ttl, fn)
+}
@@ -0,0 +1,266 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLoader(t *testing.T, name string) *Loader {
+	bm, err := NewCacheV2("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	return NewLoader(name, bm)
+}
+
+func TestLoaderCoalescing(t *testing.T) {
+	l := newTestLoader(t, "coalescing")
+	var calls int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value of " + key, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := l.GetOrLoad(context.Background(), "diepdt", time.Minute, fn)
+			if err != nil || v != "value of diepdt" {
+				t.Errorf("GetOrLoad is expected to be the loaded value, found %v %v", v, err)
+			}
+		}()
+	}
+	// let the goroutines wait for the first call
+	for atomic.LoadUint64(&l.stats.Coalesced)+atomic.LoadUint64(&l.stats.Loads) < 50 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("loader is expected to be called once, found %d", calls)
+	}
+	if v, _ := l.GetOrLoad(context.Background(), "diepdt", time.Minute, fn); v != "value of diepdt" {
+		t.Errorf("value is expected to be cached, found %v", v)
+	}
+	st := l.Stats()
+	if st.Loads != 1 || st.Coalesced != 49 || st.Misses != 50 || st.Hits != 1 {
+		t.Errorf("stats are expected to be 1 load, 49 coalesced, 50 misses and 1 hit, found %+v", st)
+	}
+}
+
+func TestLoaderErrors(t *testing.T) {
+	l := newTestLoader(t, "errors")
+	ctx := context.Background()
+	var calls int32
+	notFound := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, ErrNotFound
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := l.GetOrLoad(ctx, "missing", time.Minute, notFound); err != ErrNotFound {
+			t.Errorf("GetOrLoad is expected to be ErrNotFound, found %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("ErrNotFound is expected to be cached, found %d calls", calls)
+	}
+	if st := l.Stats(); st.NegativeHits != 2 {
+		t.Errorf("negative hits are expected to be 2, found %d", st.NegativeHits)
+	}
+
+	broken := errors.New("database is down")
+	calls = 0
+	failing := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, broken
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := l.GetOrLoad(ctx, "broken", time.Minute, failing); err != broken {
+			t.Errorf("GetOrLoad is expected to return the loader error, found %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("errors are not expected to be cached, found %d calls", calls)
+	}
+
+	panicking := func(ctx context.Context, key string) (interface{}, error) {
+		panic("boom")
+	}
+	if _, err := l.GetOrLoad(ctx, "panic", time.Minute, panicking); err == nil {
+		t.Error("a panicking loader is expected to return an error")
+	}
+	if st := l.Stats(); st.Errors != 3 {
+		t.Errorf("errors are expected to be 3, found %d", st.Errors)
+	}
+}
+
+func TestLoaderStale(t *testing.T) {
+	l := newTestLoader(t, "stale")
+	l.StaleTTL = time.Minute
+	l.Beta = 0
+	ctx := context.Background()
+	var version int32
+	refreshed := make(chan struct{}, 1)
+	fn := func(ctx context.Context, key string) (interface{}, error) {
+		v := atomic.AddInt32(&version, 1)
+		if v > 1 {
+			refreshed <- struct{}{}
+		}
+		return int(v), nil
+	}
+	if v, _ := l.GetOrLoad(ctx, "diepdt", 20*time.Millisecond, fn); v != 1 {
+		t.Errorf("first value is expected to be 1, found %v", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := l.GetOrLoad(ctx, "diepdt", 20*time.Millisecond, fn); v != 1 {
+		t.Errorf("stale value is expected to be served, found %v", v)
+	}
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("stale value is expected to be refreshed in background")
+	}
+	// wait for the refreshed value to be stored
+	for i := 0; i < 100; i++ {
+		if v, _ := l.GetOrLoad(ctx, "diepdt", time.Minute, fn); v == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v, _ := l.GetOrLoad(ctx, "diepdt", time.Minute, fn); v != 2 {
+		t.Errorf("refreshed value is expected to be 2, found %v", v)
+	}
+	if st := l.Stats(); st.Stale < 1 || st.Refreshes != 1 {
+		t.Errorf("stats are expected to count the stale read and the refresh, found %+v", st)
+	}
+}
+
+func TestLoaderEarlyRefresh(t *testing.T) {
+	l := newTestLoader(t, "early")
+	now := time.Now().UnixNano()
+	slow := &loaderEntry{Expire: now + int64(time.Millisecond), Delta: int64(time.Second)}
+	fresh := &loaderEntry{Expire: now + int64(time.Hour), Delta: int64(time.Millisecond)}
+	early := 0
+	for i := 0; i < 100; i++ {
+		if l.early(slow, now) {
+			early++
+		}
+		if l.early(fresh, now) {
+			t.Fatal("a value far from its expiry is not expected to be refreshed")
+		}
+	}
+	if early < 90 {
+		t.Errorf("a slow value close to its expiry is expected to be refreshed, found %d of 100", early)
+	}
+	l.Beta = 0
+	if l.early(slow, now) {
+		t.Error("early refresh is expected to be disabled by Beta 0")
+	}
+}
+
+func TestLoaderCanceled(t *testing.T) {
+	l := newTestLoader(t, "canceled")
+	release := make(chan struct{})
+	defer close(release)
+	fn := func(ctx context.Context, key string) (interface{}, error) {
+		<-release
+		return "v", nil
+	}
+	go l.GetOrLoad(context.Background(), "diepdt", time.Minute, fn)
+	for atomic.LoadUint64(&l.stats.Loads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.GetOrLoad(ctx, "diepdt", time.Minute, fn); err != context.DeadlineExceeded {
+		t.Errorf("waiting is expected to stop with the context, found %v", err)
+	}
+	found := false
+	for _, loader := range Loaders() {
+		found = found || loader == l
+	}
+	if !found {
+		t.Error("loader is expected to be listed by Loaders")
+	}
+}
+
+// the call started by a caller which gives up keeps running for the other callers
+func TestLoaderLeaderCanceled(t *testing.T) {
+	l := newTestLoader(t, "leader")
+	release := make(chan struct{})
+	fn := func(ctx context.Context, key string) (interface{}, error) {
+		select {
+		case <-release:
+			return "v", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := l.GetOrLoad(ctx, "diepdt", time.Minute, fn)
+		done <- err
+	}()
+	for atomic.LoadUint64(&l.stats.Loads) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go func() {
+		for atomic.LoadUint64(&l.stats.Coalesced) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+		<-done
+		close(release)
+	}()
+	if v, err := l.GetOrLoad(context.Background(), "diepdt", time.Minute, fn); err != nil || v != "v" {
+		t.Errorf("waiting caller is expected to get v, found %v %v", v, err)
+	}
+}
+
+type unregisteredUser struct {
+	Name string
+}
+
+func TestLoaderUnregisteredType(t *testing.T) {
+	l := newTestLoader(t, "unregistered")
+	var calls int32
+	fn := func(ctx context.Context, key string) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return unregisteredUser{Name: "diepdt"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		v, err := l.GetOrLoad(context.Background(), "user", time.Minute, fn)
+		if err != nil || v != (unregisteredUser{Name: "diepdt"}) {
+			t.Errorf("GetOrLoad is expected to be the loaded value, found %v %v", v, err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("value which can not be stored is expected to be loaded again, found %d calls", calls)
+	}
+	if st := l.Stats(); st.Errors != 2 {
+		t.Errorf("errors are expected to be 2, found %d", st.Errors)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"time"
+
+	"github.com/izi-global/izigo/cache"
+)
+
+// released is the value of a lock released by a cache which can not delete it
+// atomically, it is kept for releasedTTL and can be acquired again.
+const (
+	released    = "released"
+	releasedTTL = time.Second
+)
+
+type cacheBackend struct {
+	c cache.CacheV2
+}
+
+// FromCache returns the Backend of a cache adapter, with SetNX to acquire the locks
+// and CompareAndSwap to refresh them. The adapters implementing
+// cache.CompareAndDeleter (memory, file and redis) delete the released locks,
+// the other ones (memcache) swap them to a released value.
+// memcache rounds ttl up to seconds. The adapters implementing cache.NotAtomic, ssdb
+// and the caches bridged by cache.FromV1 such as tiered, are rejected, all the
+// operations of their Backend return ErrNotAtomic.
+func FromCache(c cache.CacheV2) Backend {
+	if _, ok := c.(cache.NotAtomic); ok {
+		return notAtomicBackend{}
+	}
+	return &cacheBackend{c: c}
+}
+
+func (b *cacheBackend) Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	ok, err := b.c.SetNX(ctx, key, token, ttl)
+	if ok || err != nil {
+		return ok, err
+	}
+	if _, deleter := b.c.(cache.CompareAndDeleter); deleter {
+		return false, nil
+	}
+	ok, err = b.c.CompareAndSwap(ctx, key, released, token, ttl)
+	if err == cache.ErrCacheMiss {
+		// expired since SetNX, acquired by the next attempt
+		return false, nil
+	}
+	return ok, err
+}
+
+func (b *cacheBackend) Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	ok, err := b.c.CompareAndSwap(ctx, key, token, token, ttl)
+	if err == cache.ErrCacheMiss {
+		return false, nil
+	}
+	return ok, err
+}
+
+func (b *cacheBackend) Release(ctx context.Context, key, token string) (bool, error) {
+	if d, ok := b.c.(cache.CompareAndDeleter); ok {
+		return d.CompareAndDelete(ctx, key, token)
+	}
+	ok, err := b.c.CompareAndSwap(ctx, key, token, released, releasedTTL)
+	if err == cache.ErrCacheMiss {
+		return false, nil
+	}
+	return ok, err
+}
+
+// notAtomicBackend is the Backend of a cache.NotAtomic adapter.
+type notAtomicBackend struct{}
+
+func (notAtomicBackend) Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return false, ErrNotAtomic
+}
+
+func (notAtomicBackend) Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	return false, ErrNotAtomic
+}
+
+func (notAtomicBackend) Release(ctx context.Context, key, token string) (bool, error) {
+	return false, ErrNotAtomic
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Fake is an in-process Backend for the tests.
+type Fake struct {
+	mu    sync.Mutex
+	locks map[string]fakeLock
+	// Now is the clock of the expiries, time.Now by default.
+	Now func() time.Time
+}
+
+type fakeLock struct {
+	token  string
+	expire time.Time
+}
+
+// NewFake returns an empty Fake.
+func NewFake() *Fake {
+	return &Fake{locks: make(map[string]fakeLock), Now: time.Now}
+}
+
+// holder returns the token of the living lock of key.
+func (f *Fake) holder(key string) string {
+	l, ok := f.locks[key]
+	if !ok || (!l.expire.IsZero() && !f.Now().Before(l.expire)) {
+		return ""
+	}
+	return l.token
+}
+
+func (f *Fake) expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return f.Now().Add(ttl)
+}
+
+// Acquire sets key to token if key is not held.
+func (f *Fake) Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holder(key) != "" {
+		return false, nil
+	}
+	f.locks[key] = fakeLock{token: token, expire: f.expiry(ttl)}
+	return true, nil
+}
+
+// Refresh extends key if it holds token.
+func (f *Fake) Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holder(key) != token {
+		return false, nil
+	}
+	f.locks[key] = fakeLock{token: token, expire: f.expiry(ttl)}
+	return true, nil
+}
+
+// Release deletes key if it holds token.
+func (f *Fake) Release(ctx context.Context, key, token string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.holder(key) != token {
+		return false, nil
+	}
+	delete(f.locks, key)
+	return true, nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lock for distributed locks and semaphores
+//
+// the locks are keys of a cache adapter holding the random token of their
+// owner, so that only the owner can refresh or release them.
+//
+// Usage:
+// import(
+//   _ "github.com/izi-global/izigo/cache/redis"
+//   "github.com/izi-global/izigo/cache"
+//   "github.com/izi-global/izigo/cache/lock"
+// )
+//
+//  bm, err := cache.NewCacheV2("redis", `{"conn":"127.0.0.1:6379"}`)
+//  locker := lock.New(lock.FromCache(bm))
+//
+//  l, err := locker.Lock(ctx, "migration", time.Minute)
+//  if err != nil {
+//  	return err
+//  }
+//  defer l.Unlock(ctx)
+//
+//  more docs http://go.izi.asia/docs/module/cache.md
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotAcquired is returned by TryLock and TryAcquire when the lock is held by another owner.
+	ErrNotAcquired = errors.New("lock: not acquired")
+	// ErrNotHeld is returned by Refresh and Unlock when the lock has expired or has another owner.
+	ErrNotHeld = errors.New("lock: not held")
+	// ErrNotAtomic is returned by the Backend of a cache adapter which can not hold locks.
+	ErrNotAtomic = errors.New("lock: cache adapter is not atomic")
+)
+
+// DefaultRetryInterval is the delay between the attempts of Lock and Acquire.
+var DefaultRetryInterval = 100 * time.Millisecond
+
+// Backend stores the locks, each operation must be atomic.
+type Backend interface {
+	// set key to token for ttl if key does not exist, reports whether it was set.
+	Acquire(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// extend key to ttl if it holds token, reports whether it was extended.
+	Refresh(ctx context.Context, key, token string, ttl time.Duration) (bool, error)
+	// delete key if it holds token, reports whether it was deleted.
+	Release(ctx context.Context, key, token string) (bool, error)
+}
+
+// Locker takes the locks and the semaphores of a Backend.
+type Locker struct {
+	// RetryInterval is the delay between the attempts of Lock and Acquire.
+	RetryInterval time.Duration
+
+	b Backend
+}
+
+// New returns a Locker over b.
+func New(b Backend) *Locker {
+	return &Locker{RetryInterval: DefaultRetryInterval, b: b}
+}
+
+// Lock is a lock or a semaphore permit held by its owner until it expires or is unlocked.
+type Lock struct {
+	l     *Locker
+	name  string
+	key   string
+	token string
+}
+
+// Name returns the name of the lock or the semaphore.
+func (lk *Lock) Name() string {
+	return lk.name
+}
+
+// Token returns the owner token of the lock.
+func (lk *Lock) Token() string {
+	return lk.token
+}
+
+// Refresh extends the lock to ttl, ErrNotHeld if it has been lost.
+func (lk *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	ok, err := lk.l.b.Refresh(ctx, lk.key, lk.token, ttl)
+	if err == nil && !ok {
+		err = ErrNotHeld
+	}
+	return err
+}
+
+// Unlock releases the lock, ErrNotHeld if it has been lost.
+func (lk *Lock) Unlock(ctx context.Context) error {
+	ok, err := lk.l.b.Release(ctx, lk.key, lk.token)
+	if err == nil && !ok {
+		err = ErrNotHeld
+	}
+	return err
+}
+
+// TryLock takes the lock name for ttl, ErrNotAcquired if another owner holds it.
+func (l *Locker) TryLock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return l.try(ctx, name, "lock:"+name, ttl)
+}
+
+// Lock takes the lock name for ttl, waiting until it is released or ctx is done.
+func (l *Locker) Lock(ctx context.Context, name string, ttl time.Duration) (*Lock, error) {
+	return l.retry(ctx, func() (*Lock, error) {
+		return l.TryLock(ctx, name, ttl)
+	})
+}
+
+// TryAcquire takes one of the n permits of the semaphore name for ttl,
+// ErrNotAcquired if they are all held.
+func (l *Locker) TryAcquire(ctx context.Context, name string, n int, ttl time.Duration) (*Lock, error) {
+	if n <= 0 {
+		return nil, errors.New("lock: the semaphore needs at least one permit")
+	}
+	// the permits are tried from a random one, to spread the attempts
+	start := mrand.Intn(n)
+	for i := 0; i < n; i++ {
+		slot := strconv.Itoa((start + i) % n)
+		lk, err := l.try(ctx, name, "sem:"+name+":"+slot, ttl)
+		if err != ErrNotAcquired {
+			return lk, err
+		}
+	}
+	return nil, ErrNotAcquired
+}
+
+// Acquire takes one of the n permits of the semaphore name for ttl,
+// waiting until one is released or ctx is done.
+func (l *Locker) Acquire(ctx context.Context, name string, n int, ttl time.Duration) (*Lock, error) {
+	return l.retry(ctx, func() (*Lock, error) {
+		return l.TryAcquire(ctx, name, n, ttl)
+	})
+}
+
+func (l *Locker) try(ctx context.Context, name, key string, ttl time.Duration) (*Lock, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := l.b.Acquire(ctx, key, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotAcquired
+	}
+	return &Lock{l: l, name: name, key: key, token: token}, nil
+}
+
+func (l *Locker) retry(ctx context.Context, try func() (*Lock, error)) (*Lock, error) {
+	for {
+		lk, err := try()
+		if err != ErrNotAcquired {
+			return lk, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(l.RetryInterval):
+		}
+	}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
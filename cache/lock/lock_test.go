@@ -0,0 +1,180 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/izi-global/izigo/cache"
+)
+
+func testLocker(t *testing.T, b Backend) {
+	ctx := context.Background()
+	locker := New(b)
+	locker.RetryInterval = time.Millisecond
+
+	l, err := locker.TryLock(ctx, "migration", time.Minute)
+	if err != nil {
+		t.Fatal("lock err", err)
+	}
+	if _, err = locker.TryLock(ctx, "migration", time.Minute); err != ErrNotAcquired {
+		t.Errorf("held lock is expected to be ErrNotAcquired, found %v", err)
+	}
+	if err = l.Refresh(ctx, time.Minute); err != nil {
+		t.Error("refresh err", err)
+	}
+	// a lock can only be released by its owner
+	other := &Lock{l: locker, name: l.name, key: l.key, token: "other"}
+	if err = other.Unlock(ctx); err != ErrNotHeld {
+		t.Errorf("unlock of another owner is expected to be ErrNotHeld, found %v", err)
+	}
+	if err = l.Unlock(ctx); err != nil {
+		t.Error("unlock err", err)
+	}
+	if err = l.Unlock(ctx); err != ErrNotHeld {
+		t.Errorf("second unlock is expected to be ErrNotHeld, found %v", err)
+	}
+	if err = l.Refresh(ctx, time.Minute); err != ErrNotHeld {
+		t.Errorf("refresh of a released lock is expected to be ErrNotHeld, found %v", err)
+	}
+
+	// mutual exclusion
+	var holders, max int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := locker.Lock(ctx, "job", time.Minute)
+			if err != nil {
+				t.Error("lock err", err)
+				return
+			}
+			if n := atomic.AddInt32(&holders, 1); n > atomic.LoadInt32(&max) {
+				atomic.StoreInt32(&max, n)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			l.Unlock(ctx)
+		}()
+	}
+	wg.Wait()
+	if max != 1 {
+		t.Errorf("lock is expected to have one holder at a time, found %d", max)
+	}
+
+	// semaphore
+	permits := make([]*Lock, 0, 3)
+	for i := 0; i < 3; i++ {
+		p, err := locker.TryAcquire(ctx, "workers", 3, time.Minute)
+		if err != nil {
+			t.Fatal("acquire err", err)
+		}
+		permits = append(permits, p)
+	}
+	if _, err = locker.TryAcquire(ctx, "workers", 3, time.Minute); err != ErrNotAcquired {
+		t.Errorf("semaphore is expected to have 3 permits, found %v", err)
+	}
+	wait, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err = locker.Acquire(wait, "workers", 3, time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("Acquire is expected to wait for the context, found %v", err)
+	}
+	permits[0].Unlock(ctx)
+	if _, err = locker.Acquire(ctx, "workers", 3, time.Minute); err != nil {
+		t.Errorf("released permit is expected to be acquired, found %v", err)
+	}
+}
+
+func TestFake(t *testing.T) {
+	testLocker(t, NewFake())
+
+	// expiry
+	ctx := context.Background()
+	fake := NewFake()
+	now := time.Now()
+	fake.Now = func() time.Time { return now }
+	locker := New(fake)
+	l, _ := locker.TryLock(ctx, "migration", time.Minute)
+	now = now.Add(2 * time.Minute)
+	if _, err := locker.TryLock(ctx, "migration", time.Minute); err != nil {
+		t.Errorf("expired lock is expected to be acquired, found %v", err)
+	}
+	if err := l.Unlock(ctx); err != ErrNotHeld {
+		t.Errorf("unlock of an expired lock is expected to be ErrNotHeld, found %v", err)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	bm, err := cache.NewCacheV2("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	testLocker(t, FromCache(bm))
+}
+
+func TestFileCache(t *testing.T) {
+	bm, err := cache.NewCacheV2("file", `{"CachePath":"cachelock","FileSuffix":".bin","DirectoryLevel":"1","Interval":"0"}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	defer os.RemoveAll("cachelock")
+	testLocker(t, FromCache(bm))
+}
+
+// the bounded cache has no CompareAndDelete, its locks are released with a value
+func TestReleasedValue(t *testing.T) {
+	bm, err := cache.NewCacheV2("bounded", `{"maxEntries":100}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	testLocker(t, FromCache(bm))
+	if v, _ := bm.Get(context.Background(), "lock:migration"); v != released {
+		t.Errorf("released lock is expected to hold the released value, found %v", v)
+	}
+}
+
+// notAtomicCache is a cache which can not hold locks, as ssdb
+type notAtomicCache struct {
+	cache.CacheV2
+}
+
+func (c *notAtomicCache) NotAtomic() {}
+
+func TestNotAtomic(t *testing.T) {
+	bm, err := cache.NewCacheV2("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	locker := New(FromCache(&notAtomicCache{bm}))
+	if _, err := locker.Lock(context.Background(), "migration", time.Minute); err != ErrNotAtomic {
+		t.Errorf("lock on a not atomic cache is expected to be ErrNotAtomic, found %v", err)
+	}
+
+	// SetNX of a v1 cache is IsExist then Put
+	v1, err := cache.NewCache("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	locker = New(FromCache(cache.FromV1(v1)))
+	if _, err := locker.TryLock(context.Background(), "migration", time.Minute); err != ErrNotAtomic {
+		t.Errorf("lock on a v1 cache is expected to be ErrNotAtomic, found %v", err)
+	}
+}
@@ -17,6 +17,7 @@ package memcache
 import (
 	_ "github.com/bradfitz/gomemcache/memcache"
 
+	"context"
 	"strconv"
 	"testing"
 	"time"
@@ -106,3 +107,49 @@ func TestMemcacheCache(t *testing.T) {
 		t.Error("clear all err")
 	}
 }
+
+func TestMemcacheCacheV2(t *testing.T) {
+	bm, err := cache.NewCacheV2("memcache", `{"conn": "127.0.0.1:11211"}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	ctx := context.Background()
+	bm.Delete(ctx, "diepdt")
+	if _, err = bm.Get(ctx, "diepdt"); err != cache.ErrCacheMiss {
+		t.Errorf("Get of a missing key is expected to be ErrCacheMiss, found %v", err)
+	}
+	if n, err := bm.IncrBy(ctx, "diepdt", 5); err != nil || n != 5 {
+		t.Errorf("IncrBy is expected to be 5, found %d %v", n, err)
+	}
+	if n, err := bm.IncrBy(ctx, "diepdt", -2); err != nil || n != 3 {
+		t.Errorf("IncrBy is expected to be 3, found %d %v", n, err)
+	}
+	if ok, err := bm.SetNX(ctx, "diepdt", "v", time.Second); err != nil || ok {
+		t.Errorf("SetNX of an existing key is expected to be false, found %v %v", ok, err)
+	}
+	if ok, err := bm.CompareAndSwap(ctx, "diepdt", "3", "next", 10*time.Second); err != nil || !ok {
+		t.Errorf("CompareAndSwap is expected to be true, found %v %v", ok, err)
+	}
+	if v, _ := bm.Get(ctx, "diepdt"); string(v.([]byte)) != "next" {
+		t.Errorf("CompareAndSwap is expected to set next, found %v", v)
+	}
+	if _, err = bm.TTL(ctx, "diepdt"); err != cache.ErrNotSupported {
+		t.Errorf("TTL is expected to be ErrNotSupported, found %v", err)
+	}
+	if err = bm.ClearAll(ctx); err != nil {
+		t.Error("clear all err", err)
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	for timeout, want := range map[time.Duration]int32{
+		0:                       0,
+		500 * time.Millisecond:  1,
+		time.Second:             1,
+		1500 * time.Millisecond: 2,
+	} {
+		if got := expiration(timeout); got != want {
+			t.Errorf("expiration of %v is expected to be %d, found %d", timeout, want, got)
+		}
+	}
+}
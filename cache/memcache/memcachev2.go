@@ -0,0 +1,249 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+
+	"github.com/izi-global/izigo/cache"
+)
+
+// CacheV2 is the CacheV2 of the Memcache adapter.
+// the values are read back as []byte, TTL is not supported by memcache
+// and counters can not go below 0.
+type CacheV2 struct {
+	rc *Cache
+}
+
+// NewMemCacheV2 create new memcache adapter.
+func NewMemCacheV2() cache.CacheV2 {
+	return &CacheV2{rc: &Cache{}}
+}
+
+// client returns the memcache client if ctx is not done.
+func (cv *CacheV2) client(ctx context.Context) (*memcache.Client, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cv.rc.conn == nil {
+		if err := cv.rc.connectInit(); err != nil {
+			return nil, err
+		}
+	}
+	return cv.rc.conn, nil
+}
+
+// convert turns the memcache errors into the cache ones.
+func convert(err error) error {
+	if err == memcache.ErrCacheMiss {
+		return cache.ErrCacheMiss
+	}
+	return err
+}
+
+// value returns val as bytes, memcache only stores string and []byte.
+func value(val interface{}) ([]byte, error) {
+	switch v := val.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, errors.New("val only support string and []byte")
+}
+
+// expiration returns timeout in seconds, rounded up since 0 never expires.
+func expiration(timeout time.Duration) int32 {
+	if timeout <= 0 {
+		return 0
+	}
+	return int32((timeout + time.Second - 1) / time.Second)
+}
+
+// Get get value from memcache, cache.ErrCacheMiss if it does not exist.
+func (cv *CacheV2) Get(ctx context.Context, key string) (interface{}, error) {
+	c, err := cv.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	item, err := c.Get(key)
+	if err != nil {
+		return nil, convert(err)
+	}
+	return item.Value, nil
+}
+
+// GetMulti get value from memcache.
+func (cv *CacheV2) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	c, err := cv.client(ctx)
+	var items map[string]*memcache.Item
+	if err == nil {
+		items, err = c.GetMulti(keys)
+	}
+	for i, key := range keys {
+		if err != nil {
+			errs[i] = err
+		} else if item, ok := items[key]; ok {
+			values[i] = item.Value
+		} else {
+			errs[i] = cache.ErrCacheMiss
+		}
+	}
+	return values, errs
+}
+
+// Put put value to memcache.
+func (cv *CacheV2) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	c, err := cv.client(ctx)
+	if err != nil {
+		return err
+	}
+	v, err := value(val)
+	if err != nil {
+		return err
+	}
+	return c.Set(&memcache.Item{Key: key, Value: v, Expiration: expiration(timeout)})
+}
+
+// Delete delete value in memcache.
+func (cv *CacheV2) Delete(ctx context.Context, key string) error {
+	c, err := cv.client(ctx)
+	if err != nil {
+		return err
+	}
+	if err = c.Delete(key); err == memcache.ErrCacheMiss {
+		return nil
+	}
+	return err
+}
+
+// IncrBy adds n to the counter, a missing counter is created.
+func (cv *CacheV2) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	c, err := cv.client(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		var v uint64
+		if n < 0 {
+			v, err = c.Decrement(key, uint64(-n))
+		} else {
+			v, err = c.Increment(key, uint64(n))
+		}
+		if err != memcache.ErrCacheMiss {
+			return int64(v), err
+		}
+		if n < 0 {
+			n = 0
+		}
+		err = c.Add(&memcache.Item{Key: key, Value: []byte(strconv.FormatInt(n, 10))})
+		if err != memcache.ErrNotStored {
+			return n, err
+		}
+		// the counter was created meanwhile
+	}
+}
+
+// SetNX put value to memcache if key does not exist.
+func (cv *CacheV2) SetNX(ctx context.Context, key string, val interface{}, timeout time.Duration) (bool, error) {
+	c, err := cv.client(ctx)
+	if err != nil {
+		return false, err
+	}
+	v, err := value(val)
+	if err != nil {
+		return false, err
+	}
+	err = c.Add(&memcache.Item{Key: key, Value: v, Expiration: expiration(timeout)})
+	if err == memcache.ErrNotStored {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CompareAndSwap put value to memcache if its value is old.
+func (cv *CacheV2) CompareAndSwap(ctx context.Context, key string, old, val interface{}, timeout time.Duration) (bool, error) {
+	c, err := cv.client(ctx)
+	if err != nil {
+		return false, err
+	}
+	o, err := value(old)
+	if err != nil {
+		return false, err
+	}
+	v, err := value(val)
+	if err != nil {
+		return false, err
+	}
+	item, err := c.Get(key)
+	if err != nil {
+		return false, convert(err)
+	}
+	if !bytes.Equal(item.Value, o) {
+		return false, nil
+	}
+	item.Value = v
+	item.Expiration = expiration(timeout)
+	switch err = c.CompareAndSwap(item); err {
+	case nil:
+		return true, nil
+	case memcache.ErrCASConflict:
+		return false, nil
+	case memcache.ErrNotStored:
+		return false, cache.ErrCacheMiss
+	}
+	return false, err
+}
+
+// TTL is not supported by memcache.
+func (cv *CacheV2) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return 0, cache.ErrNotSupported
+}
+
+// IsExist check value exists in memcache.
+func (cv *CacheV2) IsExist(ctx context.Context, key string) (bool, error) {
+	_, err := cv.Get(ctx, key)
+	if err == cache.ErrCacheMiss {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ClearAll clear all cached in memcache.
+func (cv *CacheV2) ClearAll(ctx context.Context) error {
+	c, err := cv.client(ctx)
+	if err != nil {
+		return err
+	}
+	return c.FlushAll()
+}
+
+// StartAndGC start memcache adapter.
+// config string is like {"conn":"connection info"}.
+func (cv *CacheV2) StartAndGC(config string) error {
+	return cv.rc.StartAndGC(config)
+}
+
+func init() {
+	cache.RegisterV2("memcache", NewMemCacheV2)
+}
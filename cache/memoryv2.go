@@ -0,0 +1,163 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// MemoryCacheV2 is the CacheV2 of the memory adapter.
+type MemoryCacheV2 struct {
+	bc *MemoryCache
+}
+
+// NewMemoryCacheV2 returns a new MemoryCacheV2.
+func NewMemoryCacheV2() CacheV2 {
+	return &MemoryCacheV2{bc: &MemoryCache{items: make(map[string]*MemoryItem)}}
+}
+
+// item returns the living item of name, the caller must hold the lock.
+func (mc *MemoryCacheV2) item(name string) (*MemoryItem, bool) {
+	itm, ok := mc.bc.items[name]
+	if !ok || itm.isExpire() {
+		return nil, false
+	}
+	return itm, true
+}
+
+// Get cache from memory, ErrCacheMiss if non-existed or expired.
+func (mc *MemoryCacheV2) Get(ctx context.Context, name string) (interface{}, error) {
+	mc.bc.RLock()
+	defer mc.bc.RUnlock()
+	if itm, ok := mc.item(name); ok {
+		return itm.val, nil
+	}
+	return nil, ErrCacheMiss
+}
+
+// GetMulti gets caches from memory.
+func (mc *MemoryCacheV2) GetMulti(ctx context.Context, names []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(names))
+	errs := make([]error, len(names))
+	for i, name := range names {
+		values[i], errs[i] = mc.Get(ctx, name)
+	}
+	return values, errs
+}
+
+// Put cache to memory.
+// if lifespan is 0, it will be forever till restart.
+func (mc *MemoryCacheV2) Put(ctx context.Context, name string, value interface{}, lifespan time.Duration) error {
+	return mc.bc.Put(name, value, lifespan)
+}
+
+// Delete cache in memory.
+func (mc *MemoryCacheV2) Delete(ctx context.Context, name string) error {
+	mc.bc.Lock()
+	defer mc.bc.Unlock()
+	delete(mc.bc.items, name)
+	return nil
+}
+
+// IncrBy adds n to the cache counter in memory.
+// it supports int,int32,int64,uint,uint32,uint64, a missing counter is an int64 kept forever.
+func (mc *MemoryCacheV2) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	mc.bc.Lock()
+	defer mc.bc.Unlock()
+	itm, ok := mc.item(key)
+	if !ok {
+		mc.bc.items[key] = &MemoryItem{val: n, createdTime: time.Now()}
+		return n, nil
+	}
+	val, i, err := incrValue(itm.val, n)
+	if err != nil {
+		return 0, err
+	}
+	itm.val = val
+	return i, nil
+}
+
+// SetNX puts the cache to memory if name does not exist.
+func (mc *MemoryCacheV2) SetNX(ctx context.Context, name string, value interface{}, lifespan time.Duration) (bool, error) {
+	mc.bc.Lock()
+	defer mc.bc.Unlock()
+	if _, ok := mc.item(name); ok {
+		return false, nil
+	}
+	mc.bc.items[name] = &MemoryItem{val: value, createdTime: time.Now(), lifespan: lifespan}
+	return true, nil
+}
+
+// CompareAndSwap puts the cache to memory if its value is deeply equal to old.
+func (mc *MemoryCacheV2) CompareAndSwap(ctx context.Context, name string, old, value interface{}, lifespan time.Duration) (bool, error) {
+	mc.bc.Lock()
+	defer mc.bc.Unlock()
+	itm, ok := mc.item(name)
+	if !ok {
+		return false, ErrCacheMiss
+	}
+	if !reflect.DeepEqual(itm.val, old) {
+		return false, nil
+	}
+	mc.bc.items[name] = &MemoryItem{val: value, createdTime: time.Now(), lifespan: lifespan}
+	return true, nil
+}
+
+// CompareAndDelete deletes the cache in memory if its value is deeply equal to old.
+func (mc *MemoryCacheV2) CompareAndDelete(ctx context.Context, name string, old interface{}) (bool, error) {
+	mc.bc.Lock()
+	defer mc.bc.Unlock()
+	itm, ok := mc.item(name)
+	if !ok || !reflect.DeepEqual(itm.val, old) {
+		return false, nil
+	}
+	delete(mc.bc.items, name)
+	return true, nil
+}
+
+// TTL returns the remaining lifespan of the cache in memory.
+func (mc *MemoryCacheV2) TTL(ctx context.Context, name string) (time.Duration, error) {
+	mc.bc.RLock()
+	defer mc.bc.RUnlock()
+	itm, ok := mc.item(name)
+	if !ok {
+		return 0, ErrCacheMiss
+	}
+	if itm.lifespan == 0 {
+		return 0, nil
+	}
+	return itm.lifespan - time.Since(itm.createdTime), nil
+}
+
+// IsExist check cache exist in memory.
+func (mc *MemoryCacheV2) IsExist(ctx context.Context, name string) (bool, error) {
+	return mc.bc.IsExist(name), nil
+}
+
+// ClearAll will delete all cache in memory.
+func (mc *MemoryCacheV2) ClearAll(ctx context.Context) error {
+	return mc.bc.ClearAll()
+}
+
+// StartAndGC start memory cache. it will check expiration in every clock time.
+func (mc *MemoryCacheV2) StartAndGC(config string) error {
+	return mc.bc.StartAndGC(config)
+}
+
+func init() {
+	RegisterV2("memory", NewMemoryCacheV2)
+}
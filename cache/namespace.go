@@ -0,0 +1,159 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Namespace is a logical part of a cache, which can be flushed on its own.
+// Its keys are prefixed with its name and its generation counter,
+// Flush increments the counter so that the previous keys are not read anymore.
+// A Namespace is a CacheV2, and can be used by Tagged and Loader.
+// usage:
+//	users := cache.NewNamespace(bm, "users")
+//	users.Put(ctx, "1", user, time.Hour)
+//	users.Flush(ctx)
+type Namespace struct {
+	c    CacheV2
+	name string
+}
+
+// NewNamespace returns the namespace name of c.
+func NewNamespace(c CacheV2, name string) *Namespace {
+	return &Namespace{c: c, name: name}
+}
+
+// Name returns the name of the namespace.
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// prefix returns the prefix of the keys of the current generation.
+func (ns *Namespace) prefix(ctx context.Context) (string, error) {
+	gens, err := generations(ctx, ns.c, []string{namespaceKeyPrefix + ns.name})
+	if err != nil {
+		return "", err
+	}
+	return ns.name + ":" + strconv.FormatInt(gens[0], 10) + ":", nil
+}
+
+// Flush invalidates all the values of the namespace. They are not deleted,
+// they stay in the cache until they expire or are evicted.
+func (ns *Namespace) Flush(ctx context.Context) error {
+	_, err := ns.c.IncrBy(ctx, namespaceKeyPrefix+ns.name, 1)
+	return err
+}
+
+// Get get value of key in the namespace.
+func (ns *Namespace) Get(ctx context.Context, key string) (interface{}, error) {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ns.c.Get(ctx, p+key)
+}
+
+// GetMulti gets the values of keys in the namespace.
+func (ns *Namespace) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		errs := make([]error, len(keys))
+		for i := range errs {
+			errs[i] = err
+		}
+		return make([]interface{}, len(keys)), errs
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = p + key
+	}
+	return ns.c.GetMulti(ctx, prefixed)
+}
+
+// Put puts value of key in the namespace.
+func (ns *Namespace) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return ns.c.Put(ctx, p+key, val, timeout)
+}
+
+// Delete deletes value of key in the namespace.
+func (ns *Namespace) Delete(ctx context.Context, key string) error {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		return err
+	}
+	return ns.c.Delete(ctx, p+key)
+}
+
+// IncrBy adds n to the counter of key in the namespace.
+func (ns *Namespace) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return ns.c.IncrBy(ctx, p+key, n)
+}
+
+// SetNX puts value of key in the namespace if it does not exist.
+func (ns *Namespace) SetNX(ctx context.Context, key string, val interface{}, timeout time.Duration) (bool, error) {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return ns.c.SetNX(ctx, p+key, val, timeout)
+}
+
+// CompareAndSwap replaces value of key in the namespace if it equals old.
+func (ns *Namespace) CompareAndSwap(ctx context.Context, key string, old, val interface{}, timeout time.Duration) (bool, error) {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return ns.c.CompareAndSwap(ctx, p+key, old, val, timeout)
+}
+
+// TTL returns the time to live of key in the namespace.
+func (ns *Namespace) TTL(ctx context.Context, key string) (time.Duration, error) {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return ns.c.TTL(ctx, p+key)
+}
+
+// IsExist checks if key exists in the namespace.
+func (ns *Namespace) IsExist(ctx context.Context, key string) (bool, error) {
+	p, err := ns.prefix(ctx)
+	if err != nil {
+		return false, err
+	}
+	return ns.c.IsExist(ctx, p+key)
+}
+
+// ClearAll flushes the namespace, the other keys of the cache are kept.
+func (ns *Namespace) ClearAll(ctx context.Context) error {
+	return ns.Flush(ctx)
+}
+
+// StartAndGC does nothing, the cache of the namespace is already started.
+func (ns *Namespace) StartAndGC(config string) error {
+	return nil
+}
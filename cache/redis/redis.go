@@ -34,6 +34,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -44,6 +45,8 @@ import (
 var (
 	// DefaultKey the collection name of redis for cache adapter.
 	DefaultKey = "izicacheRedis"
+	// ScanCount is the number of keys asked to each SCAN of ClearAll.
+	ScanCount = 1000
 )
 
 // Cache is Redis cache adapter.
@@ -135,21 +138,79 @@ func (rc *Cache) Decr(key string) error {
 }
 
 // ClearAll clean all cache in redis. delete this redis collection.
+// the keys are scanned incrementally, so that redis is not blocked by a large collection.
 func (rc *Cache) ClearAll() error {
 	c := rc.p.Get()
 	defer c.Close()
-	cachedKeys, err := redis.Strings(c.Do("KEYS", rc.key+":*"))
+	cursor := 0
+	for {
+		reply, err := redis.Values(c.Do("SCAN", cursor, "MATCH", rc.key+":*", "COUNT", ScanCount))
+		if err != nil {
+			return err
+		}
+		var cachedKeys []string
+		if _, err = redis.Scan(reply, &cursor, &cachedKeys); err != nil {
+			return err
+		}
+		if len(cachedKeys) > 0 {
+			if _, err = c.Do("DEL", redis.Args{}.AddFlat(cachedKeys)...); err != nil {
+				return err
+			}
+		}
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
+
+// Keys lists the keys of the collection with SCAN, the cursor being the one of
+// redis. count is a hint of SCAN, a page may have more or less keys.
+func (rc *Cache) Keys(prefix, cursor string, count int) ([]cache.KeyInfo, string, error) {
+	c := rc.p.Get()
+	defer c.Close()
+	if cursor == "" {
+		cursor = "0"
+	}
+	if count <= 0 {
+		count = ScanCount
+	}
+	reply, err := redis.Values(c.Do("SCAN", cursor, "MATCH", globEscaper.Replace(rc.associate(prefix))+"*", "COUNT", count))
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	for _, str := range cachedKeys {
-		if _, err = c.Do("DEL", str); err != nil {
-			return err
+	var cachedKeys []string
+	if _, err = redis.Scan(reply, &cursor, &cachedKeys); err != nil {
+		return nil, "", err
+	}
+	if cursor == "0" {
+		cursor = ""
+	}
+	for _, key := range cachedKeys {
+		c.Send("PTTL", key)
+	}
+	c.Flush()
+	keys := make([]cache.KeyInfo, 0, len(cachedKeys))
+	for _, key := range cachedKeys {
+		ttl, err := redis.Int64(c.Receive())
+		if err != nil {
+			return nil, "", err
+		}
+		// -2 is a key deleted since the SCAN
+		if ttl == -2 {
+			continue
 		}
+		info := cache.KeyInfo{Key: strings.TrimPrefix(key, rc.key+":")}
+		if ttl > 0 {
+			info.TTL = time.Duration(ttl) * time.Millisecond
+		}
+		keys = append(keys, info)
 	}
-	return err
+	return keys, cursor, nil
 }
 
+// globEscaper escapes the special characters of the SCAN patterns.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
 // StartAndGC start redis cache adapter.
 // config is like {"key":"collection key","conn":"connection info","dbNum":"0"}
 // the cache item in redis are stored forever,
@@ -15,6 +15,7 @@
 package redis
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -104,3 +105,88 @@ func TestRedisCache(t *testing.T) {
 		t.Error("clear all err")
 	}
 }
+
+func TestRedisCacheV2(t *testing.T) {
+	bm, err := cache.NewCacheV2("redis", `{"conn": "127.0.0.1:6379"}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	ctx := context.Background()
+	bm.Delete(ctx, "diepdt")
+	if _, err = bm.Get(ctx, "diepdt"); err != cache.ErrCacheMiss {
+		t.Errorf("Get of a missing key is expected to be ErrCacheMiss, found %v", err)
+	}
+	if n, err := bm.IncrBy(ctx, "diepdt", 5); err != nil || n != 5 {
+		t.Errorf("IncrBy is expected to be 5, found %d %v", n, err)
+	}
+	if ttl, err := bm.TTL(ctx, "diepdt"); err != nil || ttl != 0 {
+		t.Errorf("TTL of a counter is expected to be 0, found %v %v", ttl, err)
+	}
+	if ok, err := bm.SetNX(ctx, "diepdt", "v", time.Second); err != nil || ok {
+		t.Errorf("SetNX of an existing key is expected to be false, found %v %v", ok, err)
+	}
+	if ok, err := bm.CompareAndSwap(ctx, "diepdt", "5", "next", 10*time.Second); err != nil || !ok {
+		t.Errorf("CompareAndSwap is expected to be true, found %v %v", ok, err)
+	}
+	if v, _ := redis.String(bm.Get(ctx, "diepdt")); v != "next" {
+		t.Errorf("CompareAndSwap is expected to set next, found %v", v)
+	}
+	if ttl, err := bm.TTL(ctx, "diepdt"); err != nil || ttl <= 0 {
+		t.Errorf("TTL is expected to be positive, found %v %v", ttl, err)
+	}
+	_, errs := bm.GetMulti(ctx, []string{"diepdt", "missing"})
+	if errs[0] != nil || errs[1] != cache.ErrCacheMiss {
+		t.Errorf("GetMulti errors are expected to be [nil miss], found %v", errs)
+	}
+	if err = bm.ClearAll(ctx); err != nil {
+		t.Error("clear all err", err)
+	}
+}
+
+func TestRedisCompareAndDelete(t *testing.T) {
+	bm, err := cache.NewCacheV2("redis", `{"conn": "127.0.0.1:6379"}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	ctx := context.Background()
+	bm.Put(ctx, "lock", "owner", time.Minute)
+	d := bm.(cache.CompareAndDeleter)
+	if ok, err := d.CompareAndDelete(ctx, "lock", "other"); ok || err != nil {
+		t.Errorf("CompareAndDelete of another value is expected to be false, found %v %v", ok, err)
+	}
+	if ok, err := d.CompareAndDelete(ctx, "lock", "owner"); !ok || err != nil {
+		t.Errorf("CompareAndDelete is expected to be true, found %v %v", ok, err)
+	}
+	if ok, _ := bm.IsExist(ctx, "lock"); ok {
+		t.Error("CompareAndDelete is expected to delete the key")
+	}
+}
+
+func TestRedisKeys(t *testing.T) {
+	bm, err := cache.NewCache("redis", `{"conn": "127.0.0.1:6379","key":"izicacheKeys"}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	defer bm.ClearAll()
+	bm.Put("user:1", 1, time.Minute)
+	bm.Put("user:2", 2, 0)
+	bm.Put("page:*", 3, time.Minute)
+	lister := bm.(cache.KeyLister)
+	found := make(map[string]time.Duration)
+	cursor := ""
+	for {
+		keys, next, err := lister.Keys("user:", cursor, 1)
+		if err != nil {
+			t.Fatal("keys err", err)
+		}
+		for _, k := range keys {
+			found[k.Key] = k.TTL
+		}
+		if cursor = next; cursor == "" {
+			break
+		}
+	}
+	if len(found) != 2 || found["user:1"] <= 0 || found["user:2"] != 0 {
+		t.Errorf("Keys is expected to list user:1 and user:2 with their TTL, found %v", found)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/izi-global/izigo/cache"
+)
+
+// cadScript deletes KEYS[1] if its value is ARGV[1].
+var cadScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// casScript sets KEYS[1] to ARGV[2] if its value is ARGV[1], with ARGV[3] milliseconds of expiry.
+var casScript = redis.NewScript(1, `
+local v = redis.call("GET", KEYS[1])
+if not v then
+	return -1
+end
+if v ~= ARGV[1] then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// CacheV2 is the CacheV2 of the Redis adapter.
+// the values are read back as []byte, as redis stores them.
+type CacheV2 struct {
+	rc *Cache
+}
+
+// NewRedisCacheV2 create new redis cache with default collection name.
+func NewRedisCacheV2() cache.CacheV2 {
+	return &CacheV2{rc: &Cache{key: DefaultKey}}
+}
+
+// do runs the redis command if ctx is not done, args[0] must be the key name.
+func (cv *CacheV2) do(ctx context.Context, commandName string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return cv.rc.do(commandName, args...)
+}
+
+// Get cache from redis, cache.ErrCacheMiss if it does not exist.
+func (cv *CacheV2) Get(ctx context.Context, key string) (interface{}, error) {
+	v, err := cv.do(ctx, "GET", key)
+	if err == nil && v == nil {
+		return nil, cache.ErrCacheMiss
+	}
+	return v, err
+}
+
+// GetMulti get cache from redis.
+func (cv *CacheV2) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	fail := func(err error) ([]interface{}, []error) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return values, errs
+	}
+	if len(keys) == 0 {
+		return values, errs
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+	c := cv.rc.p.Get()
+	defer c.Close()
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = cv.rc.associate(key)
+	}
+	replies, err := redis.Values(c.Do("MGET", args...))
+	if err != nil {
+		return fail(err)
+	}
+	for i := range keys {
+		if i < len(replies) && replies[i] != nil {
+			values[i] = replies[i]
+		} else {
+			errs[i] = cache.ErrCacheMiss
+		}
+	}
+	return values, errs
+}
+
+// Put put cache to redis, a timeout of 0 keeps it forever.
+func (cv *CacheV2) Put(ctx context.Context, key string, val interface{}, timeout time.Duration) error {
+	var err error
+	if timeout > 0 {
+		_, err = cv.do(ctx, "SET", key, val, "PX", int64(timeout/time.Millisecond))
+	} else {
+		_, err = cv.do(ctx, "SET", key, val)
+	}
+	return err
+}
+
+// Delete delete cache in redis.
+func (cv *CacheV2) Delete(ctx context.Context, key string) error {
+	_, err := cv.do(ctx, "DEL", key)
+	return err
+}
+
+// IncrBy increase counter in redis by n.
+func (cv *CacheV2) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return redis.Int64(cv.do(ctx, "INCRBY", key, n))
+}
+
+// SetNX put cache to redis if key does not exist.
+func (cv *CacheV2) SetNX(ctx context.Context, key string, val interface{}, timeout time.Duration) (bool, error) {
+	var (
+		v   interface{}
+		err error
+	)
+	if timeout > 0 {
+		v, err = cv.do(ctx, "SET", key, val, "NX", "PX", int64(timeout/time.Millisecond))
+	} else {
+		v, err = cv.do(ctx, "SET", key, val, "NX")
+	}
+	return v != nil, err
+}
+
+// CompareAndSwap put cache to redis if its value is old, compared as redis strings.
+func (cv *CacheV2) CompareAndSwap(ctx context.Context, key string, old, val interface{}, timeout time.Duration) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	c := cv.rc.p.Get()
+	defer c.Close()
+	swapped, err := redis.Int(casScript.Do(c, cv.rc.associate(key), old, val, int64(timeout/time.Millisecond)))
+	if err != nil {
+		return false, err
+	}
+	if swapped < 0 {
+		return false, cache.ErrCacheMiss
+	}
+	return swapped == 1, nil
+}
+
+// CompareAndDelete deletes key if its value is old, atomically with a lua script.
+func (cv *CacheV2) CompareAndDelete(ctx context.Context, key string, old interface{}) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	c := cv.rc.p.Get()
+	defer c.Close()
+	deleted, err := redis.Int(cadScript.Do(c, cv.rc.associate(key), old))
+	return deleted == 1, err
+}
+
+// TTL returns the remaining time to live of key in redis.
+func (cv *CacheV2) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := redis.Int64(cv.do(ctx, "PTTL", key))
+	switch {
+	case err != nil:
+		return 0, err
+	case ms == -2:
+		return 0, cache.ErrCacheMiss
+	case ms < 0:
+		return 0, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// IsExist check cache's existence in redis.
+func (cv *CacheV2) IsExist(ctx context.Context, key string) (bool, error) {
+	return redis.Bool(cv.do(ctx, "EXISTS", key))
+}
+
+// ClearAll clean all cache in redis. delete this redis collection.
+func (cv *CacheV2) ClearAll(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cv.rc.ClearAll()
+}
+
+// StartAndGC start redis cache adapter.
+// config is like {"key":"collection key","conn":"connection info","dbNum":"0"}
+func (cv *CacheV2) StartAndGC(config string) error {
+	return cv.rc.StartAndGC(config)
+}
+
+func init() {
+	cache.RegisterV2("redis", NewRedisCacheV2)
+}
+
+// Keys lists the keys of the collection with SCAN.
+func (cv *CacheV2) Keys(prefix, cursor string, count int) ([]cache.KeyInfo, string, error) {
+	return cv.rc.Keys(prefix, cursor, count)
+}
@@ -0,0 +1,213 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssdb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/izi-global/izigo/cache"
+)
+
+// CacheV2 is the CacheV2 of the SSDB adapter.
+// values are strings, SetNX with a timeout sets the expiry after the value
+// and CompareAndSwap is not supported by ssdb, so it can not hold the locks of cache/lock.
+type CacheV2 struct {
+	rc *Cache
+}
+
+// NewSsdbCacheV2 create new ssdb adapter.
+func NewSsdbCacheV2() cache.CacheV2 {
+	return &CacheV2{rc: &Cache{}}
+}
+
+// NotAtomic implements cache.NotAtomic, SetNX and expire are two commands.
+func (cv *CacheV2) NotAtomic() {}
+
+// seconds returns timeout in seconds, rounded up since 0 never expires.
+func seconds(timeout time.Duration) int {
+	if timeout <= 0 {
+		return 0
+	}
+	return int((timeout + time.Second - 1) / time.Second)
+}
+
+// do runs the ssdb command if ctx is not done and checks the response status.
+func (cv *CacheV2) do(ctx context.Context, args ...interface{}) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if cv.rc.conn == nil {
+		if err := cv.rc.connectInit(); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := cv.rc.conn.Do(args...)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) == 0 {
+		return nil, errors.New("bad response")
+	}
+	switch resp[0] {
+	case "ok":
+		return resp, nil
+	case "not_found":
+		return nil, cache.ErrCacheMiss
+	}
+	return nil, errors.New("ssdb: " + resp[0])
+}
+
+// Get get value from ssdb, cache.ErrCacheMiss if it does not exist.
+func (cv *CacheV2) Get(ctx context.Context, key string) (interface{}, error) {
+	resp, err := cv.do(ctx, "get", key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 2 {
+		return nil, errors.New("bad response")
+	}
+	return resp[1], nil
+}
+
+// GetMulti get value from ssdb.
+func (cv *CacheV2) GetMulti(ctx context.Context, keys []string) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	resp, err := cv.do(ctx, "multi_get", keys)
+	found := make(map[string]string)
+	for i := 1; err == nil && i+1 < len(resp); i += 2 {
+		found[resp[i]] = resp[i+1]
+	}
+	for i, key := range keys {
+		if err != nil {
+			errs[i] = err
+		} else if v, ok := found[key]; ok {
+			values[i] = v
+		} else {
+			errs[i] = cache.ErrCacheMiss
+		}
+	}
+	return values, errs
+}
+
+// Put put value to ssdb. only support string.
+func (cv *CacheV2) Put(ctx context.Context, key string, value interface{}, timeout time.Duration) error {
+	v, ok := value.(string)
+	if !ok {
+		return errors.New("value must string")
+	}
+	var err error
+	if ttl := seconds(timeout); ttl > 0 {
+		_, err = cv.do(ctx, "setx", key, v, ttl)
+	} else {
+		_, err = cv.do(ctx, "set", key, v)
+	}
+	return err
+}
+
+// Delete delete value in ssdb.
+func (cv *CacheV2) Delete(ctx context.Context, key string) error {
+	_, err := cv.do(ctx, "del", key)
+	return err
+}
+
+// IncrBy adds n to the counter.
+func (cv *CacheV2) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	resp, err := cv.do(ctx, "incr", key, n)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 2 {
+		return 0, errors.New("bad response")
+	}
+	return strconv.ParseInt(resp[1], 10, 64)
+}
+
+// SetNX put value to ssdb if key does not exist.
+func (cv *CacheV2) SetNX(ctx context.Context, key string, value interface{}, timeout time.Duration) (bool, error) {
+	v, ok := value.(string)
+	if !ok {
+		return false, errors.New("value must string")
+	}
+	resp, err := cv.do(ctx, "setnx", key, v)
+	if err != nil || len(resp) != 2 || resp[1] != "1" {
+		return false, err
+	}
+	if ttl := seconds(timeout); ttl > 0 {
+		_, err = cv.do(ctx, "expire", key, ttl)
+	}
+	return true, err
+}
+
+// CompareAndSwap is not supported by ssdb.
+func (cv *CacheV2) CompareAndSwap(ctx context.Context, key string, old, value interface{}, timeout time.Duration) (bool, error) {
+	return false, cache.ErrNotSupported
+}
+
+// TTL returns the remaining time to live of key in ssdb.
+func (cv *CacheV2) TTL(ctx context.Context, key string) (time.Duration, error) {
+	resp, err := cv.do(ctx, "ttl", key)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 2 {
+		return 0, errors.New("bad response")
+	}
+	ttl, err := strconv.ParseInt(resp[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if ttl >= 0 {
+		return time.Duration(ttl) * time.Second, nil
+	}
+	// -1 for the keys without expiry and the missing ones
+	if ok, err := cv.IsExist(ctx, key); err != nil || !ok {
+		if err == nil {
+			err = cache.ErrCacheMiss
+		}
+		return 0, err
+	}
+	return 0, nil
+}
+
+// IsExist check value exists in ssdb.
+func (cv *CacheV2) IsExist(ctx context.Context, key string) (bool, error) {
+	resp, err := cv.do(ctx, "exists", key)
+	if err != nil {
+		return false, err
+	}
+	return len(resp) == 2 && resp[1] == "1", nil
+}
+
+// ClearAll clear all cached in ssdb.
+func (cv *CacheV2) ClearAll(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cv.rc.ClearAll()
+}
+
+// StartAndGC start ssdb adapter.
+// config string is like {"conn":"connection info"}.
+func (cv *CacheV2) StartAndGC(config string) error {
+	return cv.rc.StartAndGC(config)
+}
+
+func init() {
+	cache.RegisterV2("ssdb", NewSsdbCacheV2)
+}
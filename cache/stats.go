@@ -0,0 +1,364 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histograms of the caches.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// the operations timed by the latency histograms
+const (
+	OpGet    = "get"    // Get, GetMulti and IsExist
+	OpPut    = "put"    // Put, Incr and Decr
+	OpDelete = "delete" // Delete and ClearAll
+)
+
+var operations = []string{OpGet, OpPut, OpDelete}
+
+// Histogram is a latency histogram. Counts[i] is the number of operations
+// which took at most LatencyBuckets[i], the last one counts the slower ones.
+type Histogram struct {
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// InstrumentStats holds the counters of an Instrumented cache.
+type InstrumentStats struct {
+	Hits    uint64 // values found by Get, GetMulti and IsExist
+	Misses  uint64 // values missing
+	Puts    uint64 // Put, Incr and Decr calls
+	Deletes uint64 // Delete and ClearAll calls
+	Errors  uint64 // calls which returned an error
+	Latency map[string]Histogram
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    int64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return d <= LatencyBuckets[i] })
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddUint64(&h.count, 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	s := Histogram{Counts: make([]uint64, len(h.counts)), Count: atomic.LoadUint64(&h.count), Sum: time.Duration(atomic.LoadInt64(&h.sum))}
+	for i := range h.counts {
+		s.Counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return s
+}
+
+// Instrumented counts the operations of a cache adapter and times them.
+// NewCache returns the adapters wrapped in it when their config has a "name"
+// key, the other ones are returned as they are. Use Unwrap to reach the
+// adapter, Keys and Close are forwarded to it.
+// A Get returning nil, or the empty string of the file adapter, is a miss.
+type Instrumented struct {
+	hits    uint64 // first for atomic alignment
+	misses  uint64
+	puts    uint64
+	deletes uint64
+	errors  uint64
+
+	name    string
+	adapter string
+	c       Cache
+	latency map[string]*histogram
+}
+
+var (
+	instrumentsLock sync.Mutex
+	instruments     = make(map[string]*Instrumented)
+)
+
+// Instrument returns c counted under name, listed by Instruments until it is closed.
+// A cache instrumented again under the name of another one takes its place.
+func Instrument(name, adapter string, c Cache) *Instrumented {
+	ic := &Instrumented{name: name, adapter: adapter, c: c, latency: make(map[string]*histogram, len(operations))}
+	for _, op := range operations {
+		ic.latency[op] = &histogram{counts: make([]uint64, len(LatencyBuckets)+1)}
+	}
+	instrumentsLock.Lock()
+	instruments[name] = ic
+	instrumentsLock.Unlock()
+	return ic
+}
+
+// Instruments returns the instrumented caches sorted by name, for the monitoring.
+func Instruments() []*Instrumented {
+	instrumentsLock.Lock()
+	defer instrumentsLock.Unlock()
+	list := make([]*Instrumented, 0, len(instruments))
+	for _, ic := range instruments {
+		list = append(list, ic)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].name < list[j].name })
+	return list
+}
+
+// LookupInstrument returns the instrumented cache named name, nil if there is none.
+func LookupInstrument(name string) *Instrumented {
+	instrumentsLock.Lock()
+	defer instrumentsLock.Unlock()
+	return instruments[name]
+}
+
+// Unwrap returns the adapter of an Instrumented cache, c otherwise.
+func Unwrap(c Cache) Cache {
+	if ic, ok := c.(*Instrumented); ok {
+		return ic.c
+	}
+	return c
+}
+
+// instanceName reads the "name" key of a config, "" if there is none.
+func instanceName(config string) string {
+	var cf map[string]interface{}
+	json.Unmarshal([]byte(config), &cf)
+	name, _ := cf["name"].(string)
+	return name
+}
+
+// Name returns the name of the cache.
+func (ic *Instrumented) Name() string {
+	return ic.name
+}
+
+// Adapter returns the adapter name of the cache.
+func (ic *Instrumented) Adapter() string {
+	return ic.adapter
+}
+
+// Unwrap returns the cache adapter.
+func (ic *Instrumented) Unwrap() Cache {
+	return ic.c
+}
+
+// Stats returns the counters and the latency histograms of the cache.
+func (ic *Instrumented) Stats() InstrumentStats {
+	st := InstrumentStats{
+		Hits:    atomic.LoadUint64(&ic.hits),
+		Misses:  atomic.LoadUint64(&ic.misses),
+		Puts:    atomic.LoadUint64(&ic.puts),
+		Deletes: atomic.LoadUint64(&ic.deletes),
+		Errors:  atomic.LoadUint64(&ic.errors),
+		Latency: make(map[string]Histogram, len(ic.latency)),
+	}
+	for op, h := range ic.latency {
+		st.Latency[op] = h.snapshot()
+	}
+	return st
+}
+
+func (ic *Instrumented) done(op string, start time.Time, counter *uint64, err error) error {
+	ic.latency[op].observe(time.Since(start))
+	atomic.AddUint64(counter, 1)
+	if err != nil {
+		atomic.AddUint64(&ic.errors, 1)
+	}
+	return err
+}
+
+func (ic *Instrumented) hit(v interface{}) {
+	if s, ok := v.(string); v == nil || (ok && s == "") {
+		atomic.AddUint64(&ic.misses, 1)
+	} else {
+		atomic.AddUint64(&ic.hits, 1)
+	}
+}
+
+// Get returns the value of key.
+func (ic *Instrumented) Get(key string) interface{} {
+	start := time.Now()
+	v := ic.c.Get(key)
+	ic.latency[OpGet].observe(time.Since(start))
+	ic.hit(v)
+	return v
+}
+
+// GetMulti returns the values of keys.
+func (ic *Instrumented) GetMulti(keys []string) []interface{} {
+	start := time.Now()
+	values := ic.c.GetMulti(keys)
+	ic.latency[OpGet].observe(time.Since(start))
+	for _, v := range values {
+		ic.hit(v)
+	}
+	return values
+}
+
+// Put puts val with key.
+func (ic *Instrumented) Put(key string, val interface{}, timeout time.Duration) error {
+	start := time.Now()
+	return ic.done(OpPut, start, &ic.puts, ic.c.Put(key, val, timeout))
+}
+
+// Delete deletes the value of key.
+func (ic *Instrumented) Delete(key string) error {
+	start := time.Now()
+	return ic.done(OpDelete, start, &ic.deletes, ic.c.Delete(key))
+}
+
+// Incr increments the counter of key.
+func (ic *Instrumented) Incr(key string) error {
+	start := time.Now()
+	return ic.done(OpPut, start, &ic.puts, ic.c.Incr(key))
+}
+
+// Decr decrements the counter of key.
+func (ic *Instrumented) Decr(key string) error {
+	start := time.Now()
+	return ic.done(OpPut, start, &ic.puts, ic.c.Decr(key))
+}
+
+// IsExist checks if key exists.
+func (ic *Instrumented) IsExist(key string) bool {
+	start := time.Now()
+	ok := ic.c.IsExist(key)
+	ic.latency[OpGet].observe(time.Since(start))
+	if ok {
+		atomic.AddUint64(&ic.hits, 1)
+	} else {
+		atomic.AddUint64(&ic.misses, 1)
+	}
+	return ok
+}
+
+// ClearAll clears the cache.
+func (ic *Instrumented) ClearAll() error {
+	start := time.Now()
+	return ic.done(OpDelete, start, &ic.deletes, ic.c.ClearAll())
+}
+
+// StartAndGC starts the adapter.
+func (ic *Instrumented) StartAndGC(config string) error {
+	return ic.c.StartAndGC(config)
+}
+
+// Keys lists the keys of the adapter, if it is a KeyLister.
+func (ic *Instrumented) Keys(prefix, cursor string, count int) ([]KeyInfo, string, error) {
+	lister, ok := ic.c.(KeyLister)
+	if !ok {
+		return nil, "", ErrNotSupported
+	}
+	return lister.Keys(prefix, cursor, count)
+}
+
+// Close removes the cache from Instruments, and closes the adapter if it has a Close method.
+func (ic *Instrumented) Close() error {
+	instrumentsLock.Lock()
+	if instruments[ic.name] == ic {
+		delete(instruments, ic.name)
+	}
+	instrumentsLock.Unlock()
+	if closer, ok := ic.c.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// WriteMetrics writes the counters of the instrumented caches and of the
+// loaders in the Prometheus text format.
+func WriteMetrics(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	list := Instruments()
+	counters := []struct {
+		name, help string
+		value      func(InstrumentStats) uint64
+	}{
+		{"hits", "Values found in the cache.", func(st InstrumentStats) uint64 { return st.Hits }},
+		{"misses", "Values missing from the cache.", func(st InstrumentStats) uint64 { return st.Misses }},
+		{"puts", "Values put in the cache.", func(st InstrumentStats) uint64 { return st.Puts }},
+		{"deletes", "Values deleted from the cache.", func(st InstrumentStats) uint64 { return st.Deletes }},
+		{"errors", "Cache operations which failed.", func(st InstrumentStats) uint64 { return st.Errors }},
+	}
+	stats := make([]InstrumentStats, len(list))
+	for i, ic := range list {
+		stats[i] = ic.Stats()
+	}
+	for _, c := range counters {
+		fmt.Fprintf(bw, "# HELP izigo_cache_%s_total %s\n# TYPE izigo_cache_%s_total counter\n", c.name, c.help, c.name)
+		for i, ic := range list {
+			fmt.Fprintf(bw, "izigo_cache_%s_total{cache=%s,adapter=%s} %d\n", c.name, quoteLabel(ic.name), quoteLabel(ic.adapter), c.value(stats[i]))
+		}
+	}
+	fmt.Fprint(bw, "# HELP izigo_cache_operation_duration_seconds Latency of the cache operations.\n# TYPE izigo_cache_operation_duration_seconds histogram\n")
+	for i, ic := range list {
+		labels := "cache=" + quoteLabel(ic.name) + ",adapter=" + quoteLabel(ic.adapter)
+		for _, op := range operations {
+			h := stats[i].Latency[op]
+			var cumulative uint64
+			for b, bound := range LatencyBuckets {
+				cumulative += h.Counts[b]
+				fmt.Fprintf(bw, "izigo_cache_operation_duration_seconds_bucket{%s,op=%q,le=%q} %d\n", labels, op, strconv.FormatFloat(bound.Seconds(), 'g', -1, 64), cumulative)
+			}
+			fmt.Fprintf(bw, "izigo_cache_operation_duration_seconds_bucket{%s,op=%q,le=\"+Inf\"} %d\n", labels, op, h.Count)
+			fmt.Fprintf(bw, "izigo_cache_operation_duration_seconds_sum{%s,op=%q} %s\n", labels, op, strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+			fmt.Fprintf(bw, "izigo_cache_operation_duration_seconds_count{%s,op=%q} %d\n", labels, op, h.Count)
+		}
+	}
+	loaders := Loaders()
+	if len(loaders) > 0 {
+		fmt.Fprint(bw, "# HELP izigo_cache_loader_events_total Events of the cache loaders.\n# TYPE izigo_cache_loader_events_total counter\n")
+	}
+	for _, l := range loaders {
+		st := l.Stats()
+		for _, e := range []struct {
+			name  string
+			value uint64
+		}{
+			{"hit", st.Hits}, {"miss", st.Misses}, {"stale", st.Stale}, {"negative_hit", st.NegativeHits},
+			{"load", st.Loads}, {"coalesced", st.Coalesced}, {"refresh", st.Refreshes}, {"error", st.Errors},
+		} {
+			fmt.Fprintf(bw, "izigo_cache_loader_events_total{loader=%s,event=%q} %d\n", quoteLabel(l.Name()), e.name, e.value)
+		}
+	}
+	return bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// quoteLabel quotes a label value of the Prometheus text format.
+func quoteLabel(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumented(t *testing.T) {
+	bm, err := NewCache("memory", `{"interval":60,"name":"stats"}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	ic, ok := bm.(*Instrumented)
+	if !ok || ic.Name() != "stats" || ic.Adapter() != "memory" {
+		t.Fatalf("NewCache is expected to return an Instrumented cache named stats, found %T", bm)
+	}
+	if _, ok = Unwrap(bm).(*MemoryCache); !ok {
+		t.Error("Unwrap is expected to return the adapter")
+	}
+	bm.Put("diepdt", 1, time.Minute)
+	bm.Get("diepdt")
+	bm.Get("missing")
+	bm.GetMulti([]string{"diepdt", "missing"})
+	bm.Incr("missing")
+	bm.Delete("diepdt")
+
+	st := ic.Stats()
+	if st.Hits != 2 || st.Misses != 2 || st.Puts != 2 || st.Deletes != 1 || st.Errors != 1 {
+		t.Errorf("counters are expected to be 2 2 2 1 1, found %d %d %d %d %d", st.Hits, st.Misses, st.Puts, st.Deletes, st.Errors)
+	}
+	if h := st.Latency[OpGet]; h.Count != 3 || len(h.Counts) != len(LatencyBuckets)+1 {
+		t.Errorf("get histogram is expected to count 3 operations, found %d", h.Count)
+	}
+
+	var buf bytes.Buffer
+	if err = WriteMetrics(&buf); err != nil {
+		t.Fatal("metrics err", err)
+	}
+	for _, line := range []string{
+		`izigo_cache_hits_total{cache="stats",adapter="memory"} 2`,
+		`izigo_cache_errors_total{cache="stats",adapter="memory"} 1`,
+		`izigo_cache_operation_duration_seconds_count{cache="stats",adapter="memory",op="get"} 3`,
+		`izigo_cache_operation_duration_seconds_bucket{cache="stats",adapter="memory",op="put",le="+Inf"} 2`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("metrics are expected to contain %s", line)
+		}
+	}
+
+	// a cache of the same name takes the place of the first one
+	other, _ := NewCache("memory", `{"interval":60,"name":"stats"}`)
+	if LookupInstrument("stats") != other {
+		t.Error("second cache is expected to replace the first one")
+	}
+	ic.Close()
+	if LookupInstrument("stats") != other {
+		t.Error("closing the replaced cache is not expected to remove the second one")
+	}
+	other.(*Instrumented).Close()
+	if LookupInstrument("stats") != nil {
+		t.Error("closed cache is expected to be removed")
+	}
+}
+
+func TestNotInstrumented(t *testing.T) {
+	bm, err := NewCache("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	if _, ok := bm.(*MemoryCache); !ok {
+		t.Errorf("cache without a name is expected to be the adapter, found %T", bm)
+	}
+}
+
+func testKeys(t *testing.T, bm Cache) {
+	bm.Put("user:1", 1, time.Minute)
+	bm.Put("user:2", 2, 0)
+	bm.Put("user:3", 3, time.Minute)
+	bm.Put("page:1", 4, time.Minute)
+	lister, ok := bm.(KeyLister)
+	if !ok {
+		t.Fatalf("%T is expected to be a KeyLister", bm)
+	}
+	keys, next, err := lister.Keys("user:", "", 2)
+	if err != nil || len(keys) != 2 || keys[0].Key != "user:1" || keys[1].Key != "user:2" || next != "user:2" {
+		t.Fatalf("first page is expected to be user:1 user:2, found %v %s %v", keys, next, err)
+	}
+	if keys[0].TTL <= 0 || keys[0].TTL > time.Minute || keys[1].TTL != 0 {
+		t.Errorf("TTLs are expected to be a minute and 0, found %v %v", keys[0].TTL, keys[1].TTL)
+	}
+	keys, next, _ = lister.Keys("user:", next, 2)
+	if len(keys) != 1 || keys[0].Key != "user:3" || next != "" {
+		t.Errorf("last page is expected to be user:3, found %v %s", keys, next)
+	}
+}
+
+func TestMemoryKeys(t *testing.T) {
+	bm, err := NewCache("memory", `{"interval":60,"name":"keys"}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	testKeys(t, bm)
+}
+
+func TestFileKeys(t *testing.T) {
+	defer os.RemoveAll("cachekeys")
+	testKeys(t, newTestFileCache(t, "cachekeys", ""))
+}
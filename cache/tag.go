@@ -0,0 +1,141 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// the keys of the generation counters
+const (
+	tagKeyPrefix       = "_tag:"
+	namespaceKeyPrefix = "_ns:"
+)
+
+// Tagged attaches tags to the cached values, so that all the values of a tag
+// are invalidated at once. Every tag has a generation counter in the cache,
+// a value is stored with the generations of its tags and is a miss as soon
+// as one of them has been incremented by InvalidateTag. It works with every
+// adapter, the values being stored as gob like the ones of Loader.
+// usage:
+//	tc := cache.NewTagged(bm)
+//	tc.Put(ctx, "page:/products/42", page, time.Hour, "product:42", "products")
+//	tc.InvalidateTag(ctx, "product:42")
+//	_, err := tc.Get(ctx, "page:/products/42") // cache.ErrCacheMiss
+type Tagged struct {
+	c CacheV2
+}
+
+// taggedEntry is the cached form of a tagged value.
+type taggedEntry struct {
+	Value interface{}
+	Tags  []string
+	Gens  []int64
+}
+
+// NewTagged returns a Tagged over c.
+func NewTagged(c CacheV2) *Tagged {
+	return &Tagged{c: c}
+}
+
+// Get returns the value of key, ErrCacheMiss if it is missing
+// or if one of its tags has been invalidated since it was put.
+func (t *Tagged) Get(ctx context.Context, key string) (interface{}, error) {
+	v, err := t.c.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var e taggedEntry
+	if err = gobDecodeValue(v, &e); err != nil {
+		return nil, err
+	}
+	if len(e.Tags) > 0 {
+		gens, err := generations(ctx, t.c, tagKeys(e.Tags))
+		if err != nil {
+			return nil, err
+		}
+		for i, gen := range gens {
+			if gen != e.Gens[i] {
+				return nil, ErrCacheMiss
+			}
+		}
+	}
+	return e.Value, nil
+}
+
+// Put puts val with key and tags, 0 timeout means no expiration.
+func (t *Tagged) Put(ctx context.Context, key string, val interface{}, timeout time.Duration, tags ...string) error {
+	e := &taggedEntry{Value: val, Tags: tags}
+	if len(tags) > 0 {
+		gens, err := generations(ctx, t.c, tagKeys(tags))
+		if err != nil {
+			return err
+		}
+		e.Gens = gens
+	}
+	data, err := gobEncodeValue(e)
+	if err != nil {
+		return err
+	}
+	return t.c.Put(ctx, key, data, timeout)
+}
+
+// Delete deletes the value of key.
+func (t *Tagged) Delete(ctx context.Context, key string) error {
+	return t.c.Delete(ctx, key)
+}
+
+// InvalidateTag invalidates the values of the tags. The invalidated values are
+// not deleted, they stay in the cache until they expire or are evicted.
+func (t *Tagged) InvalidateTag(ctx context.Context, tags ...string) error {
+	for _, key := range tagKeys(tags) {
+		if _, err := t.c.IncrBy(ctx, key, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func tagKeys(tags []string) []string {
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = tagKeyPrefix + tag
+	}
+	return keys
+}
+
+// generations returns the generation counters of keys. A missing counter starts
+// from the current time, so that a counter lost by the cache does not go back
+// to a generation already given.
+func generations(ctx context.Context, c CacheV2, keys []string) ([]int64, error) {
+	vals, errs := c.GetMulti(ctx, keys)
+	gens := make([]int64, len(keys))
+	for i, key := range keys {
+		switch errs[i] {
+		case nil:
+			gens[i] = GetInt64(vals[i])
+		case ErrCacheMiss:
+			gen, err := c.IncrBy(ctx, key, time.Now().UnixNano())
+			if err != nil {
+				return nil, err
+			}
+			gens[i] = gen
+		default:
+			return nil, errs[i]
+		}
+	}
+	return gens, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func testTagged(t *testing.T, bm CacheV2) {
+	ctx := context.Background()
+	tc := NewTagged(bm)
+	if err := tc.Put(ctx, "page:42", "product 42", time.Hour, "product:42", "products"); err != nil {
+		t.Fatal("set Error", err)
+	}
+	tc.Put(ctx, "page:43", "product 43", time.Hour, "product:43", "products")
+	tc.Put(ctx, "home", "home", time.Hour)
+	if v, err := tc.Get(ctx, "page:42"); err != nil || v != "product 42" {
+		t.Errorf("Get is expected to be product 42, found %v %v", v, err)
+	}
+
+	if err := tc.InvalidateTag(ctx, "product:42"); err != nil {
+		t.Error("invalidate err", err)
+	}
+	if _, err := tc.Get(ctx, "page:42"); err != ErrCacheMiss {
+		t.Errorf("invalidated value is expected to be ErrCacheMiss, found %v", err)
+	}
+	if v, err := tc.Get(ctx, "page:43"); err != nil || v != "product 43" {
+		t.Errorf("value of another tag is expected to be kept, found %v %v", v, err)
+	}
+
+	// a value put after the invalidation is read
+	tc.Put(ctx, "page:42", "new product 42", time.Hour, "product:42", "products")
+	if v, err := tc.Get(ctx, "page:42"); err != nil || v != "new product 42" {
+		t.Errorf("Get is expected to be new product 42, found %v %v", v, err)
+	}
+
+	tc.InvalidateTag(ctx, "products")
+	for _, key := range []string{"page:42", "page:43"} {
+		if _, err := tc.Get(ctx, key); err != ErrCacheMiss {
+			t.Errorf("%s is expected to be invalidated by its tag, found %v", key, err)
+		}
+	}
+	if v, err := tc.Get(ctx, "home"); err != nil || v != "home" {
+		t.Errorf("untagged value is expected to be kept, found %v %v", v, err)
+	}
+
+	// a lost generation counter does not revive the invalidated values
+	tc.Put(ctx, "page:44", "product 44", time.Hour, "product:44")
+	bm.Delete(ctx, tagKeyPrefix+"product:44")
+	if _, err := tc.Get(ctx, "page:44"); err != ErrCacheMiss {
+		t.Errorf("value of a lost tag is expected to be ErrCacheMiss, found %v", err)
+	}
+}
+
+func TestTaggedMemoryCache(t *testing.T) {
+	bm, err := NewCacheV2("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	testTagged(t, bm)
+}
+
+func TestTaggedFileCache(t *testing.T) {
+	bm, err := NewCacheV2("file", `{"CachePath":"cachetag","FileSuffix":".bin","DirectoryLevel":2,"EmbedExpiry":0}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	defer os.RemoveAll("cachetag")
+	testTagged(t, bm)
+}
+
+func TestTaggedV1Bridge(t *testing.T) {
+	bm, err := NewCache("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	testTagged(t, FromV1(bm))
+}
+
+func TestNamespace(t *testing.T) {
+	ctx := context.Background()
+	bm, err := NewCacheV2("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	testCacheV2(t, NewNamespace(bm, "test"))
+
+	users := NewNamespace(bm, "users")
+	pages := NewNamespace(bm, "pages")
+	users.Put(ctx, "diepdt", "user", time.Hour)
+	pages.Put(ctx, "diepdt", "page", time.Hour)
+	if v, _ := users.Get(ctx, "diepdt"); v != "user" {
+		t.Errorf("namespaces are expected to have their own keys, found %v", v)
+	}
+	if err = users.Flush(ctx); err != nil {
+		t.Error("flush err", err)
+	}
+	if ok, _ := users.IsExist(ctx, "diepdt"); ok {
+		t.Error("flushed namespace is not expected to have keys")
+	}
+	if v, _ := pages.Get(ctx, "diepdt"); v != "page" {
+		t.Errorf("other namespaces are expected to be kept by Flush, found %v", v)
+	}
+	if vv, errs := pages.GetMulti(ctx, []string{"diepdt", "missing"}); vv[0] != "page" || errs[1] != ErrCacheMiss {
+		t.Errorf("GetMulti is expected to be [page <nil>], found %v %v", vv, errs)
+	}
+
+	// tags inside a namespace
+	tc := NewTagged(pages)
+	tc.Put(ctx, "page:42", "product 42", time.Hour, "product:42")
+	pages.Flush(ctx)
+	if _, err = tc.Get(ctx, "page:42"); err != ErrCacheMiss {
+		t.Errorf("tagged value is expected to be flushed with its namespace, found %v", err)
+	}
+}
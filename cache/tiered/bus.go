@@ -0,0 +1,156 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tiered
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// operations of the invalidation messages.
+const (
+	OpDelete = "del"
+	OpClear  = "clear"
+)
+
+// Message asks the other nodes to evict a key, or everything, from their L1.
+type Message struct {
+	Origin string `json:"origin"`
+	Op     string `json:"op"`
+	Key    string `json:"key,omitempty"`
+}
+
+// Bus broadcasts the invalidation messages between the nodes sharing a L2.
+type Bus interface {
+	// Publish sends msg to every subscriber, including the sender.
+	Publish(msg Message) error
+	// Subscribe calls fn with every message published after it returns,
+	// until the returned cancel function is called.
+	Subscribe(fn func(Message)) (cancel func(), err error)
+	// Close releases the bus.
+	Close() error
+}
+
+// BusInstance creates a Bus from a config string.
+type BusInstance func(config string) (Bus, error)
+
+var buses = make(map[string]BusInstance)
+
+// RegisterBus makes a Bus available by the name.
+// If RegisterBus is called twice with the same name or if bus is nil,
+// it panics.
+func RegisterBus(name string, bus BusInstance) {
+	if bus == nil {
+		panic("tiered: RegisterBus bus is nil")
+	}
+	if _, ok := buses[name]; ok {
+		panic("tiered: RegisterBus called twice for bus " + name)
+	}
+	buses[name] = bus
+}
+
+// NewBus creates a Bus by name and config string.
+func NewBus(name, config string) (Bus, error) {
+	instance, ok := buses[name]
+	if !ok {
+		return nil, fmt.Errorf("tiered: unknown bus name %q (forgot to import?)", name)
+	}
+	return instance(config)
+}
+
+// MemoryBus is an in-process Bus, for the tests and the caches of a single process.
+type MemoryBus struct {
+	mu          sync.RWMutex
+	subscribers map[*func(Message)]bool
+}
+
+// NewMemoryBus returns a new MemoryBus.
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subscribers: make(map[*func(Message)]bool)}
+}
+
+// Publish calls the subscribers synchronously.
+func (b *MemoryBus) Publish(msg Message) error {
+	b.mu.RLock()
+	subscribers := make([]*func(Message), 0, len(b.subscribers))
+	for fn := range b.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	b.mu.RUnlock()
+	for _, fn := range subscribers {
+		(*fn)(msg)
+	}
+	return nil
+}
+
+// Subscribe adds fn to the subscribers.
+func (b *MemoryBus) Subscribe(fn func(Message)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[&fn] = true
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, &fn)
+	}, nil
+}
+
+// Close removes every subscriber.
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = make(map[*func(Message)]bool)
+	return nil
+}
+
+// sharedBus is a MemoryBus shared by the caches, which is never closed.
+type sharedBus struct {
+	*MemoryBus
+}
+
+func (sharedBus) Close() error {
+	return nil
+}
+
+var (
+	memoryBusesLock sync.Mutex
+	memoryBuses     = make(map[string]*MemoryBus)
+)
+
+// sharedMemoryBus returns the MemoryBus of the channel named in config,
+// like {"channel":"izicache"}, so that the caches of a process can share it.
+func sharedMemoryBus(config string) (Bus, error) {
+	var cf struct {
+		Channel string `json:"channel"`
+	}
+	if config != "" {
+		if err := json.Unmarshal([]byte(config), &cf); err != nil {
+			return nil, err
+		}
+	}
+	memoryBusesLock.Lock()
+	defer memoryBusesLock.Unlock()
+	b, ok := memoryBuses[cf.Channel]
+	if !ok {
+		b = NewMemoryBus()
+		memoryBuses[cf.Channel] = b
+	}
+	return sharedBus{b}, nil
+}
+
+func init() {
+	RegisterBus("memory", sharedMemoryBus)
+}
@@ -0,0 +1,238 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package redis for the invalidation bus of the tiered cache
+//
+// depend on github.com/gomodule/redigo/redis
+//
+// go install github.com/gomodule/redigo/redis
+//
+// Usage:
+// import(
+//   _ "github.com/izi-global/izigo/cache/tiered/redis"
+// )
+//
+//  the tiered cache config has "bus":"redis","busConfig":{"conn":"127.0.0.1:6379","channel":"izicache"}
+//
+//  more docs http://go.izi.asia/docs/module/cache.md
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/izi-global/izigo/cache/tiered"
+	"github.com/izi-global/izigo/logs"
+)
+
+var (
+	// DefaultChannel is the redis channel of the invalidation messages.
+	DefaultChannel = "izicacheTiered"
+	// RetryInterval is the delay before subscribing again after a connection error.
+	RetryInterval = time.Second
+)
+
+// Bus is the redis pub/sub bus of the tiered cache.
+// the messages published while the subscription is reconnecting are lost,
+// so the L1 TTL bounds how long a stale value can be read.
+type Bus struct {
+	p        *redis.Pool
+	channel  string
+	conninfo string
+	password string
+	dbNum    int
+
+	mu   sync.Mutex
+	subs map[*subscription]bool
+}
+
+type subscription struct {
+	fn   func(tiered.Message)
+	done chan struct{}
+	conn redis.PubSubConn
+	once sync.Once
+}
+
+// NewBus creates a redis bus from a config string like
+// {"conn":"127.0.0.1:6379","channel":"izicache","password":"","dbNum":"0"}
+func NewBus(config string) (tiered.Bus, error) {
+	var cf map[string]string
+	if err := json.Unmarshal([]byte(config), &cf); err != nil {
+		return nil, err
+	}
+	if cf["conn"] == "" {
+		return nil, errors.New("config has no conn key")
+	}
+	b := &Bus{
+		conninfo: cf["conn"],
+		channel:  cf["channel"],
+		password: cf["password"],
+		subs:     make(map[*subscription]bool),
+	}
+	if b.channel == "" {
+		b.channel = DefaultChannel
+	}
+	if cf["dbNum"] != "" {
+		b.dbNum, _ = strconv.Atoi(cf["dbNum"])
+	}
+	b.p = &redis.Pool{
+		MaxIdle:     3,
+		IdleTimeout: 180 * time.Second,
+		Dial:        b.dial,
+	}
+	c := b.p.Get()
+	defer c.Close()
+	if err := c.Err(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Bus) dial() (redis.Conn, error) {
+	c, err := redis.Dial("tcp", b.conninfo)
+	if err != nil {
+		return nil, err
+	}
+	if b.password != "" {
+		if _, err := c.Do("AUTH", b.password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if _, err := c.Do("SELECT", b.dbNum); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Publish publishes msg on the channel.
+func (b *Bus) Publish(msg tiered.Message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c := b.p.Get()
+	defer c.Close()
+	_, err = c.Do("PUBLISH", b.channel, payload)
+	return err
+}
+
+// Subscribe calls fn with the messages of the channel, from a goroutine
+// which subscribes again after the connection errors.
+func (b *Bus) Subscribe(fn func(tiered.Message)) (func(), error) {
+	c, err := b.dial()
+	if err != nil {
+		return nil, err
+	}
+	s := &subscription{fn: fn, done: make(chan struct{}), conn: redis.PubSubConn{Conn: c}}
+	if err = s.conn.Subscribe(b.channel); err != nil {
+		c.Close()
+		return nil, err
+	}
+	b.mu.Lock()
+	b.subs[s] = true
+	b.mu.Unlock()
+	go b.receive(s)
+	return func() { b.cancel(s) }, nil
+}
+
+func (b *Bus) cancel(s *subscription) {
+	s.once.Do(func() {
+		close(s.done)
+		b.mu.Lock()
+		delete(b.subs, s)
+		conn := s.conn
+		b.mu.Unlock()
+		conn.Unsubscribe()
+		conn.Close()
+	})
+}
+
+func (b *Bus) receive(s *subscription) {
+	for {
+		b.mu.Lock()
+		conn := s.conn
+		b.mu.Unlock()
+		switch v := conn.Receive().(type) {
+		case redis.Message:
+			var msg tiered.Message
+			if err := json.Unmarshal(v.Data, &msg); err != nil {
+				logs.Error("tiered: bad invalidation message: %v", err)
+				continue
+			}
+			s.fn(msg)
+		case error:
+			conn.Close()
+			if !b.resubscribe(s) {
+				return
+			}
+		}
+	}
+}
+
+// resubscribe replaces the connection of s, until it succeeds or s is cancelled.
+func (b *Bus) resubscribe(s *subscription) bool {
+	for {
+		select {
+		case <-s.done:
+			return false
+		case <-time.After(RetryInterval):
+		}
+		c, err := b.dial()
+		if err != nil {
+			logs.Error("tiered: can not subscribe to %s: %v", b.channel, err)
+			continue
+		}
+		conn := redis.PubSubConn{Conn: c}
+		if err = conn.Subscribe(b.channel); err != nil {
+			c.Close()
+			continue
+		}
+		b.mu.Lock()
+		select {
+		case <-s.done:
+			b.mu.Unlock()
+			c.Close()
+			return false
+		default:
+		}
+		s.conn = conn
+		b.mu.Unlock()
+		return true
+	}
+}
+
+// Close cancels the subscriptions and closes the connection pool.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	subs := make([]*subscription, 0, len(b.subs))
+	for s := range b.subs {
+		subs = append(subs, s)
+	}
+	b.mu.Unlock()
+	for _, s := range subs {
+		b.cancel(s)
+	}
+	return b.p.Close()
+}
+
+func init() {
+	tiered.RegisterBus("redis", NewBus)
+}
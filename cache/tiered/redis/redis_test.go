@@ -0,0 +1,51 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/izi-global/izigo/cache/tiered"
+)
+
+func TestRedisBus(t *testing.T) {
+	bus, err := tiered.NewBus("redis", `{"conn":"127.0.0.1:6379","channel":"izicacheTest"}`)
+	if err != nil {
+		t.Skip("redis is not available:", err)
+	}
+	defer bus.Close()
+
+	received := make(chan tiered.Message, 1)
+	cancel, err := bus.Subscribe(func(msg tiered.Message) { received <- msg })
+	if err != nil {
+		t.Fatal("subscribe err", err)
+	}
+	// the subscription is asynchronous on the server side
+	time.Sleep(100 * time.Millisecond)
+	sent := tiered.Message{Origin: "node", Op: tiered.OpDelete, Key: "diepdt"}
+	if err = bus.Publish(sent); err != nil {
+		t.Fatal("publish err", err)
+	}
+	select {
+	case msg := <-received:
+		if msg != sent {
+			t.Errorf("message is expected to be %v, found %v", sent, msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("message is expected to be received")
+	}
+	cancel()
+}
@@ -0,0 +1,311 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tiered for cache provider
+//
+// a two tier cache: a local L1, such as the bounded memory cache, in front of
+// a shared L2, such as redis. The L1 of the other nodes is invalidated through a Bus.
+//
+// Usage:
+// import(
+//   _ "github.com/izi-global/izigo/cache/redis"
+//   _ "github.com/izi-global/izigo/cache/tiered"
+//   _ "github.com/izi-global/izigo/cache/tiered/redis"
+//   "github.com/izi-global/izigo/cache"
+// )
+//
+//  bm, err := cache.NewCache("tiered", `{
+//  	"l1":"bounded","l1Config":{"maxEntries":10000},"l1TTL":30,
+//  	"l2":"redis","l2Config":{"conn":"127.0.0.1:6379"},
+//  	"policy":"write-through",
+//  	"bus":"redis","busConfig":{"conn":"127.0.0.1:6379","channel":"izicache"}}`)
+//
+//  more docs http://go.izi.asia/docs/module/cache.md
+package tiered
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/logs"
+)
+
+// write policies of the tiered cache.
+const (
+	// WriteThrough writes the value into L2 then L1.
+	WriteThrough = "write-through"
+	// WriteAround writes the value into L2 and evicts it from L1,
+	// the next read populates L1.
+	WriteAround = "write-around"
+)
+
+// DefaultL1TTL is the max time a value is kept in L1.
+var DefaultL1TTL = 60 * time.Second
+
+// Cache is the tiered cache adapter.
+type Cache struct {
+	L1, L2 cache.Cache
+	// L1TTL is the max time a value is kept in L1, DefaultL1TTL if it is not greater than 0,
+	// so that a value read from L2 does not outlive its L2 timeout in L1 for long.
+	L1TTL time.Duration
+	// Policy is WriteThrough or WriteAround.
+	Policy string
+
+	node        string
+	bus         Bus
+	ownBus      bool
+	unsubscribe func()
+}
+
+// NewTieredCache create new tiered cache, which is configured by StartAndGC.
+func NewTieredCache() cache.Cache {
+	return &Cache{L1TTL: DefaultL1TTL, Policy: WriteThrough, node: newNode()}
+}
+
+// New composes l1 and l2, the L1 of the caches subscribed to bus are
+// invalidated when a key is written or deleted. bus can be nil.
+func New(l1, l2 cache.Cache, bus Bus) (*Cache, error) {
+	tc := &Cache{L1: l1, L2: l2, L1TTL: DefaultL1TTL, Policy: WriteThrough, node: newNode()}
+	if err := tc.listen(bus); err != nil {
+		return nil, err
+	}
+	return tc, nil
+}
+
+func newNode() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (tc *Cache) listen(bus Bus) error {
+	if bus == nil {
+		return nil
+	}
+	unsubscribe, err := bus.Subscribe(tc.receive)
+	if err != nil {
+		return err
+	}
+	tc.bus, tc.unsubscribe = bus, unsubscribe
+	return nil
+}
+
+// receive evicts from L1 the keys changed by the other nodes.
+func (tc *Cache) receive(msg Message) {
+	if msg.Origin == tc.node {
+		return
+	}
+	switch msg.Op {
+	case OpDelete:
+		tc.L1.Delete(msg.Key)
+	case OpClear:
+		tc.L1.ClearAll()
+	}
+}
+
+// invalidate asks the other nodes to evict key from their L1.
+func (tc *Cache) invalidate(op, key string) {
+	if tc.bus == nil {
+		return
+	}
+	if err := tc.bus.Publish(Message{Origin: tc.node, Op: op, Key: key}); err != nil {
+		logs.Error("tiered: can not publish the invalidation of %q: %v", key, err)
+	}
+}
+
+// l1Timeout returns the timeout of a value kept in L1, timeout being the L2
+// timeout of the value, 0 when it is read from L2 and unknown.
+func (tc *Cache) l1Timeout(timeout time.Duration) time.Duration {
+	ttl := tc.L1TTL
+	if ttl <= 0 {
+		ttl = DefaultL1TTL
+	}
+	if timeout <= 0 || timeout > ttl {
+		return ttl
+	}
+	return timeout
+}
+
+// Get cache from L1, or from L2 which populates L1.
+func (tc *Cache) Get(key string) interface{} {
+	if v := tc.L1.Get(key); v != nil {
+		return v
+	}
+	v := tc.L2.Get(key)
+	if v != nil {
+		tc.L1.Put(key, v, tc.l1Timeout(0))
+	}
+	return v
+}
+
+// GetMulti gets caches from L1, and the missing ones from L2.
+func (tc *Cache) GetMulti(keys []string) []interface{} {
+	values := tc.L1.GetMulti(keys)
+	if len(values) != len(keys) {
+		values = make([]interface{}, len(keys))
+	}
+	var missing []string
+	var indexes []int
+	for i, v := range values {
+		if v == nil {
+			missing = append(missing, keys[i])
+			indexes = append(indexes, i)
+		}
+	}
+	if len(missing) == 0 {
+		return values
+	}
+	for j, v := range tc.L2.GetMulti(missing) {
+		if j >= len(indexes) {
+			break
+		}
+		if v != nil {
+			values[indexes[j]] = v
+			tc.L1.Put(missing[j], v, tc.l1Timeout(0))
+		}
+	}
+	return values
+}
+
+// Put puts cache into L2, and into L1 or out of it according to Policy.
+func (tc *Cache) Put(key string, val interface{}, timeout time.Duration) error {
+	if err := tc.L2.Put(key, val, timeout); err != nil {
+		return err
+	}
+	if tc.Policy == WriteAround {
+		tc.L1.Delete(key)
+	} else {
+		tc.L1.Put(key, val, tc.l1Timeout(timeout))
+	}
+	tc.invalidate(OpDelete, key)
+	return nil
+}
+
+// Delete deletes cache from both tiers.
+func (tc *Cache) Delete(key string) error {
+	tc.L1.Delete(key)
+	err := tc.L2.Delete(key)
+	tc.invalidate(OpDelete, key)
+	return err
+}
+
+// Incr increases the counter in L2.
+func (tc *Cache) Incr(key string) error {
+	err := tc.L2.Incr(key)
+	tc.L1.Delete(key)
+	tc.invalidate(OpDelete, key)
+	return err
+}
+
+// Decr decreases the counter in L2.
+func (tc *Cache) Decr(key string) error {
+	err := tc.L2.Decr(key)
+	tc.L1.Delete(key)
+	tc.invalidate(OpDelete, key)
+	return err
+}
+
+// IsExist checks cache exist in L1 or L2.
+func (tc *Cache) IsExist(key string) bool {
+	return tc.L1.IsExist(key) || tc.L2.IsExist(key)
+}
+
+// ClearAll clears both tiers.
+func (tc *Cache) ClearAll() error {
+	tc.L1.ClearAll()
+	err := tc.L2.ClearAll()
+	tc.invalidate(OpClear, "")
+	return err
+}
+
+// Close stops the invalidations, and closes the bus created by StartAndGC.
+func (tc *Cache) Close() error {
+	if tc.bus == nil {
+		return nil
+	}
+	tc.unsubscribe()
+	bus := tc.bus
+	tc.bus = nil
+	if tc.ownBus {
+		return bus.Close()
+	}
+	return nil
+}
+
+// StartAndGC creates the tiers and the bus.
+// config is like {"l1":"bounded","l1Config":{},"l1TTL":60,"l2":"redis","l2Config":{"conn":":6379"},
+// "policy":"write-through","bus":"redis","busConfig":{"conn":":6379","channel":"izicache"}}
+func (tc *Cache) StartAndGC(config string) error {
+	var cf struct {
+		L1        string          `json:"l1"`
+		L1Config  json.RawMessage `json:"l1Config"`
+		L1TTL     *int            `json:"l1TTL"`
+		L2        string          `json:"l2"`
+		L2Config  json.RawMessage `json:"l2Config"`
+		Policy    string          `json:"policy"`
+		Bus       string          `json:"bus"`
+		BusConfig json.RawMessage `json:"busConfig"`
+	}
+	if err := json.Unmarshal([]byte(config), &cf); err != nil {
+		return err
+	}
+	if cf.L1 == "" {
+		cf.L1 = "bounded"
+	}
+	if cf.L2 == "" {
+		return errors.New("tiered: config has no l2 key")
+	}
+	switch cf.Policy {
+	case "":
+	case WriteThrough, WriteAround:
+		tc.Policy = cf.Policy
+	default:
+		return fmt.Errorf("tiered: unknown write policy %q", cf.Policy)
+	}
+	if cf.L1TTL != nil {
+		if *cf.L1TTL <= 0 {
+			return errors.New("tiered: l1TTL must be greater than 0")
+		}
+		tc.L1TTL = time.Duration(*cf.L1TTL) * time.Second
+	}
+	var err error
+	if tc.L1, err = cache.NewCache(cf.L1, string(cf.L1Config)); err != nil {
+		return err
+	}
+	if tc.L2, err = cache.NewCache(cf.L2, string(cf.L2Config)); err != nil {
+		return err
+	}
+	if cf.Bus == "" {
+		return nil
+	}
+	bus, err := NewBus(cf.Bus, string(cf.BusConfig))
+	if err != nil {
+		return err
+	}
+	if err = tc.listen(bus); err != nil {
+		bus.Close()
+		return err
+	}
+	tc.ownBus = true
+	return nil
+}
+
+func init() {
+	cache.Register("tiered", NewTieredCache)
+}
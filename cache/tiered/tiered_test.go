@@ -0,0 +1,198 @@
+// Copyright 2018 IZI Global
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tiered
+
+import (
+	"testing"
+	"time"
+
+	"github.com/izi-global/izigo/cache"
+)
+
+func newTiers(t *testing.T) (l1, l2 cache.Cache) {
+	l1, err := cache.NewCache("bounded", `{"maxEntries":100}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	l2, err = cache.NewCache("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	return l1, l2
+}
+
+func TestTieredCache(t *testing.T) {
+	l1, l2 := newTiers(t)
+	tc, err := New(l1, l2, nil)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+
+	// read-through
+	l2.Put("diepdt", "remote", 0)
+	if v := tc.Get("diepdt"); v != "remote" {
+		t.Errorf("Get is expected to read L2, found %v", v)
+	}
+	if v := l1.Get("diepdt"); v != "remote" {
+		t.Errorf("L1 is expected to be populated by Get, found %v", v)
+	}
+	if vv := tc.GetMulti([]string{"diepdt", "missing"}); vv[0] != "remote" || vv[1] != nil {
+		t.Errorf("GetMulti is expected to be [remote <nil>], found %v", vv)
+	}
+
+	// write-through
+	if err = tc.Put("name", "value", time.Hour); err != nil {
+		t.Error("set Error", err)
+	}
+	if l1.Get("name") != "value" || l2.Get("name") != "value" {
+		t.Error("write-through is expected to write both tiers")
+	}
+
+	// write-around
+	tc.Policy = WriteAround
+	if err = tc.Put("name", "other", time.Hour); err != nil {
+		t.Error("set Error", err)
+	}
+	if l1.IsExist("name") || l2.Get("name") != "other" {
+		t.Error("write-around is expected to write L2 and evict L1")
+	}
+
+	// counters live in L2
+	tc.Put("counter", 1, 0)
+	tc.Get("counter")
+	if err = tc.Incr("counter"); err != nil {
+		t.Error("Incr Error", err)
+	}
+	if v := tc.Get("counter"); v.(int) != 2 {
+		t.Errorf("counter is expected to be 2, found %v", v)
+	}
+
+	if err = tc.Delete("name"); err != nil {
+		t.Error("delete err", err)
+	}
+	if tc.IsExist("name") {
+		t.Error("delete err")
+	}
+	if err = tc.ClearAll(); err != nil {
+		t.Error("clear all err", err)
+	}
+	if tc.IsExist("diepdt") || tc.IsExist("counter") {
+		t.Error("clear all err")
+	}
+}
+
+func TestTieredL1TTL(t *testing.T) {
+	l1, l2 := newTiers(t)
+	tc, _ := New(l1, l2, nil)
+	tc.L1TTL = 20 * time.Millisecond
+	tc.Put("diepdt", "value", time.Hour)
+	time.Sleep(40 * time.Millisecond)
+	if l1.IsExist("diepdt") {
+		t.Error("L1 value is expected to expire after L1TTL")
+	}
+	if v := tc.Get("diepdt"); v != "value" {
+		t.Errorf("value is expected to be read from L2, found %v", v)
+	}
+}
+
+// a value read from L2 does not stay in L1 forever without L1TTL
+func TestTieredNoL1TTL(t *testing.T) {
+	defer func(ttl time.Duration) { DefaultL1TTL = ttl }(DefaultL1TTL)
+	DefaultL1TTL = 20 * time.Millisecond
+	l1, l2 := newTiers(t)
+	tc, _ := New(l1, l2, nil)
+	tc.L1TTL = 0
+	l2.Put("diepdt", "value", 10*time.Millisecond)
+	l2.Put("other", "value", 10*time.Millisecond)
+	if v := tc.Get("diepdt"); v != "value" {
+		t.Errorf("value is expected to be read from L2, found %v", v)
+	}
+	tc.GetMulti([]string{"other"})
+	time.Sleep(40 * time.Millisecond)
+	if l1.IsExist("diepdt") || l1.IsExist("other") {
+		t.Error("value read from L2 is expected to expire from L1")
+	}
+	if v := tc.Get("diepdt"); v != nil {
+		t.Errorf("value expired in L2 is expected to be missing, found %v", v)
+	}
+}
+
+func TestTieredInvalidation(t *testing.T) {
+	bus := NewMemoryBus()
+	_, shared := newTiers(t)
+	l1a, _ := newTiers(t)
+	l1b, _ := newTiers(t)
+	a, _ := New(l1a, shared, bus)
+	b, _ := New(l1b, shared, bus)
+
+	a.Put("diepdt", "first", 0)
+	if v := b.Get("diepdt"); v != "first" {
+		t.Errorf("node b is expected to read first, found %v", v)
+	}
+	a.Put("diepdt", "second", 0)
+	if v := b.Get("diepdt"); v != "second" {
+		t.Errorf("node b is expected to be invalidated by the put of node a, found %v", v)
+	}
+	b.Delete("diepdt")
+	if l1a.IsExist("diepdt") {
+		t.Error("node a is expected to be invalidated by the delete of node b")
+	}
+	a.Put("other", "value", 0)
+	b.Get("other")
+	a.ClearAll()
+	if l1b.IsExist("other") {
+		t.Error("node b is expected to be cleared by node a")
+	}
+
+	// a closed cache is not invalidated anymore
+	b.Close()
+	b.Get("other")
+	shared.Put("other", "value", 0)
+	b.Get("other")
+	a.Delete("other")
+	if !l1b.IsExist("other") {
+		t.Error("closed node is not expected to receive invalidations")
+	}
+}
+
+func TestTieredConfig(t *testing.T) {
+	config := `{"l1":"bounded","l1Config":{"maxEntries":10},"l1TTL":1,"l2":"memory","policy":"write-around","bus":"memory","busConfig":{"channel":"test"}}`
+	a, err := cache.NewCache("tiered", config)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	b, err := cache.NewCache("tiered", config)
+	if err != nil {
+		t.Fatal("init err", err)
+	}
+	tc := a.(*Cache)
+	if tc.Policy != WriteAround || tc.L1TTL != time.Second {
+		t.Errorf("config is expected to set the policy and the L1 TTL, found %s %v", tc.Policy, tc.L1TTL)
+	}
+	// the tiers of a and b are distinct, only the bus is shared
+	b.(*Cache).L1.Put("diepdt", "stale", 0)
+	a.Delete("diepdt")
+	if b.(*Cache).L1.IsExist("diepdt") {
+		t.Error("node b is expected to be invalidated through the shared memory bus")
+	}
+	tc.Close()
+	b.(*Cache).Close()
+
+	for _, config := range []string{`{"l1":"memory"}`, `{"l2":"memory","policy":"write-back"}`, `{"l2":"memory","bus":"unknown"}`, `{"l2":"memory","l1TTL":0}`} {
+		if _, err = cache.NewCache("tiered", config); err == nil {
+			t.Errorf("config %s is expected to fail", config)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"github.com/izi-global/izigo/logs"
 	"github.com/izi-global/izigo/session"
 	"github.com/izi-global/izigo/utils"
+	"github.com/izi-global/izigo/utils/keyring"
 )
 
 // Config is the main struct for BConfig
@@ -39,6 +40,7 @@ type Config struct {
 	RecoverFunc         func(*context.Context)
 	CopyRequestBody     bool
 	EnableGzip          bool
+	EnableETag          bool // answer the conditional GET of the dynamic responses, see context.IZIGoOutput.Body
 	MaxMemory           int64
 	EnableErrorsShow    bool
 	EnableErrorsRender  bool
@@ -69,7 +71,8 @@ type Listen struct {
 	AdminAddr         string
 	AdminPort         int
 	EnableFcgi        bool
-	EnableStdIo       bool // EnableStdIo works with EnableFcgi Use FCGI via standard I/O
+	EnableStdIo       bool     // EnableStdIo works with EnableFcgi Use FCGI via standard I/O
+	TrustedProxies    []string // CIDRs of the proxies whose Forwarded/X-Forwarded-* headers are trusted, separated by ; in app.conf
 }
 
 // WebConfig holds web related config
@@ -78,6 +81,7 @@ type WebConfig struct {
 	EnableDocs             bool
 	FlashName              string
 	FlashSeparator         string
+	FlashInSession         bool
 	DirectoryIndex         bool
 	StaticDir              map[string]string
 	StaticExtensionsToGzip []string
@@ -87,6 +91,10 @@ type WebConfig struct {
 	EnableXSRF             bool
 	XSRFKey                string
 	XSRFExpire             int
+	XSRFSameSite           string // SameSite of the xsrf cookie: Lax, Strict, None or empty
+	XSRFSecure             bool
+	XSRFHTTPOnly           bool
+	SecretKeys             []string // secrets of the Keyring, the first one is the primary key
 	Session                SessionConfig
 }
 
@@ -103,7 +111,17 @@ type SessionConfig struct {
 	SessionDisableHTTPOnly       bool // used to allow for cross domain cookies/javascript cookies.
 	SessionEnableSidInHTTPHeader bool // enable store/get the sessionId into/from http headers
 	SessionNameInHTTPHeader      string
-	SessionEnableSidInURLQuery   bool // enable get the sessionId from Url Query params
+	SessionEnableSidInURLQuery   bool   // enable get the sessionId from Url Query params
+	SessionCookieSameSite        string // SameSite of the session cookie: Lax, Strict, None or empty
+	SessionCookiePartitioned     bool   // set the Partitioned attribute (CHIPS), requires a Secure cookie
+	SessionEnableLock            bool   // serialize the concurrent requests of a session
+	SessionLockTimeout           int64  // seconds to wait for the session lock
+	SessionDirtyTracking         bool   // write the session back only when it was modified
+	SessionIdleTimeout           int64  // seconds of inactivity after which a session expires, 0 disables it
+	SessionAbsoluteTimeout       int64  // seconds after its creation a session expires, 0 disables it
+	SessionRollingCookie         bool   // refresh the expiry of the session cookie on every request
+	SessionEnableIndex           bool   // record the info of the sessions to list and revoke them by user
+	SessionSeenInterval          int64  // seconds between two writes of the info of a session, default 60
 }
 
 // LogConfig holds Log related config
@@ -124,6 +142,8 @@ var (
 	AppPath string
 	// GlobalSessions is the instance for the session manager
 	GlobalSessions *session.Manager
+	// Keyring signs and encrypts cookies, it is built from WebConfig.SecretKeys
+	Keyring *keyring.Keyring
 
 	// appConfigPath is the path to the config files
 	appConfigPath string
@@ -204,35 +224,38 @@ func newBConfig() *Config {
 		RecoverFunc:         recoverPanic,
 		CopyRequestBody:     false,
 		EnableGzip:          false,
+		EnableETag:          false,
 		MaxMemory:           1 << 26, //64MB
 		EnableErrorsShow:    true,
 		EnableErrorsRender:  true,
 		Listen: Listen{
-			Graceful:      false,
-			ServerTimeOut: 0,
-			ListenTCP4:    false,
-			EnableHTTP:    true,
-			AutoTLS:       false,
-			Domains:       []string{},
-			TLSCacheDir:   ".",
-			HTTPAddr:      "",
-			HTTPPort:      8080,
-			EnableHTTPS:   false,
-			HTTPSAddr:     "",
-			HTTPSPort:     10443,
-			HTTPSCertFile: "",
-			HTTPSKeyFile:  "",
-			EnableAdmin:   false,
-			AdminAddr:     "",
-			AdminPort:     8088,
-			EnableFcgi:    false,
-			EnableStdIo:   false,
+			Graceful:       false,
+			ServerTimeOut:  0,
+			ListenTCP4:     false,
+			EnableHTTP:     true,
+			AutoTLS:        false,
+			Domains:        []string{},
+			TLSCacheDir:    ".",
+			HTTPAddr:       "",
+			HTTPPort:       8080,
+			EnableHTTPS:    false,
+			HTTPSAddr:      "",
+			HTTPSPort:      10443,
+			HTTPSCertFile:  "",
+			HTTPSKeyFile:   "",
+			EnableAdmin:    false,
+			AdminAddr:      "",
+			AdminPort:      8088,
+			EnableFcgi:     false,
+			EnableStdIo:    false,
+			TrustedProxies: []string{},
 		},
 		WebConfig: WebConfig{
 			AutoRender:             true,
 			EnableDocs:             false,
 			FlashName:              "IZIGO_FLASH",
 			FlashSeparator:         "IZIGOFLASH",
+			FlashInSession:         false,
 			DirectoryIndex:         false,
 			StaticDir:              map[string]string{"/static": "static"},
 			StaticExtensionsToGzip: []string{".css", ".js"},
@@ -242,6 +265,10 @@ func newBConfig() *Config {
 			EnableXSRF:             false,
 			XSRFKey:                "izigoxsrf",
 			XSRFExpire:             0,
+			XSRFSameSite:           "",
+			XSRFSecure:             false,
+			XSRFHTTPOnly:           false,
+			SecretKeys:             []string{},
 			Session: SessionConfig{
 				SessionOn:                    false,
 				SessionProvider:              "memory",
@@ -255,6 +282,16 @@ func newBConfig() *Config {
 				SessionEnableSidInHTTPHeader: false, // enable store/get the sessionId into/from http headers
 				SessionNameInHTTPHeader:      "IZIGosessionid",
 				SessionEnableSidInURLQuery:   false, // enable get the sessionId from Url Query params
+				SessionCookieSameSite:        "",
+				SessionCookiePartitioned:     false,
+				SessionEnableLock:            false,
+				SessionLockTimeout:           10,
+				SessionDirtyTracking:         false,
+				SessionIdleTimeout:           0,
+				SessionAbsoluteTimeout:       0,
+				SessionRollingCookie:         false,
+				SessionEnableIndex:           false,
+				SessionSeenInterval:          60,
 			},
 		},
 		Log: LogConfig{
@@ -317,6 +354,20 @@ func assignConfig(ac config.Configer) error {
 		}
 	}
 
+	if tp := ac.Strings("TrustedProxies"); len(tp) > 0 {
+		proxies := []string{}
+		for _, cidr := range tp {
+			if cidr = strings.TrimSpace(cidr); cidr != "" {
+				proxies = append(proxies, cidr)
+			}
+		}
+		BConfig.Listen.TrustedProxies = proxies
+	}
+
+	if sk := ac.Strings("SecretKeys"); len(sk) > 0 {
+		BConfig.WebConfig.SecretKeys = sk
+	}
+
 	if lo := ac.String("LogOutputs"); lo != "" {
 		// if lo is not nil or empty
 		// means user has set his own LogOutputs
@@ -115,6 +115,7 @@ func TestAssignConfig_03(t *testing.T) {
 	ac.Set("RunMode", "online")
 	ac.Set("StaticDir", "download:down download2:down2")
 	ac.Set("StaticExtensionsToGzip", ".css,.js,.html,.jpg,.png")
+	ac.Set("TrustedProxies", "10.0.0.0/8; 192.168.0.1")
 	assignConfig(ac)
 
 	t.Logf("%#v", BConfig)
@@ -135,4 +136,7 @@ func TestAssignConfig_03(t *testing.T) {
 	if len(BConfig.WebConfig.StaticExtensionsToGzip) != 5 {
 		t.FailNow()
 	}
+	if proxies := BConfig.Listen.TrustedProxies; len(proxies) != 2 || proxies[1] != "192.168.0.1" {
+		t.Errorf("TrustedProxies is expected to be [10.0.0.0/8 192.168.0.1], found %v", proxies)
+	}
 }
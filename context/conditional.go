@@ -0,0 +1,174 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WeakETag returns the weak ETag of content, as computed by Body when EnableETag is set.
+func WeakETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ETag sets the ETag header of the response, quoting etag if it is not.
+// A weak ETag is given with its W/ prefix, such as W/"v42".
+func (output *IZIGoOutput) ETag(etag string) {
+	if !strings.HasSuffix(etag, `"`) {
+		etag = `"` + etag + `"`
+	}
+	output.Header("ETag", etag)
+}
+
+// LastModified sets the Last-Modified header of the response.
+func (output *IZIGoOutput) LastModified(modified time.Time) {
+	output.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+}
+
+// CheckPreconditions evaluates the If-Match, If-Unmodified-Since, If-None-Match and
+// If-Modified-Since headers of the request against the current etag and modification
+// time of the resource, either may be empty. It answers 412 Precondition Failed, or
+// 304 Not Modified to GET and HEAD, and returns false when the request must stop.
+// Call it before changing the resource for the optimistic concurrency of unsafe methods:
+//	if !c.Ctx.CheckPreconditions(article.ETag(), article.Updated) {
+//		return
+//	}
+func (ctx *Context) CheckPreconditions(etag string, modified time.Time) bool {
+	switch preconditionStatus(ctx.Request, etag, modified) {
+	case http.StatusNotModified:
+		ctx.Output.notModified(etag, modified)
+		return false
+	case http.StatusPreconditionFailed:
+		ctx.Output.SetStatus(http.StatusPreconditionFailed)
+		ctx.Output.Body(nil)
+		return false
+	}
+	return true
+}
+
+// conditionalBody evaluates the conditional GET of a response with content,
+// and reports whether a 304 or a 412 has been sent instead of it.
+func (output *IZIGoOutput) conditionalBody(content []byte) bool {
+	method := output.Context.Request.Method
+	if (method != http.MethodGet && method != http.MethodHead) || (output.Status != 0 && (output.Status < 200 || output.Status > 299)) {
+		return false
+	}
+	header := output.Context.ResponseWriter.Header()
+	etag := header.Get("ETag")
+	if etag == "" {
+		etag = WeakETag(content)
+		header.Set("ETag", etag)
+	}
+	var modified time.Time
+	if lm := header.Get("Last-Modified"); lm != "" {
+		modified, _ = http.ParseTime(lm)
+	}
+	switch preconditionStatus(output.Context.Request, etag, modified) {
+	case http.StatusNotModified:
+		output.notModified(etag, modified)
+		return true
+	case http.StatusPreconditionFailed:
+		output.Status = 0
+		header.Del("Content-Type")
+		output.Context.ResponseWriter.WriteHeader(http.StatusPreconditionFailed)
+		return true
+	}
+	return false
+}
+
+// notModified sends 304 Not Modified with the validators and without a body.
+func (output *IZIGoOutput) notModified(etag string, modified time.Time) {
+	header := output.Context.ResponseWriter.Header()
+	for _, h := range []string{"Content-Type", "Content-Length", "Content-Encoding"} {
+		header.Del(h)
+	}
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+	if !modified.IsZero() && header.Get("Last-Modified") == "" {
+		output.LastModified(modified)
+	}
+	output.Status = 0
+	output.Context.ResponseWriter.WriteHeader(http.StatusNotModified)
+}
+
+// preconditionStatus evaluates the preconditions in the order of RFC 7232 section 6,
+// it returns 304, 412 or 0 when the request goes on.
+func preconditionStatus(r *http.Request, etag string, modified time.Time) int {
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !matchETags(im, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !modified.IsZero() {
+		if t, err := http.ParseTime(ius); err == nil && modified.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if matchETags(inm, etag, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && safe && !modified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !modified.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// matchETags checks etag against a list of entity tags, "*" matching any current
+// etag. The weak comparison ignores the W/ prefixes, the strong one fails on them.
+func matchETags(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	if !weak && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for list = strings.TrimSpace(list); list != ""; {
+		if list[0] == ',' {
+			list = strings.TrimSpace(list[1:])
+			continue
+		}
+		if list[0] == '*' {
+			return true
+		}
+		candidate := list
+		isWeak := strings.HasPrefix(candidate, "W/")
+		candidate = strings.TrimPrefix(candidate, "W/")
+		if len(candidate) < 2 || candidate[0] != '"' {
+			return false
+		}
+		end := strings.IndexByte(candidate[1:], '"')
+		if end < 0 {
+			return false
+		}
+		candidate, list = candidate[:end+2], strings.TrimSpace(candidate[end+2:])
+		if candidate == etag && (weak || !isWeak) {
+			return true
+		}
+	}
+	return false
+}
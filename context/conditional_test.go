@@ -0,0 +1,120 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newConditionalContext(method string, header ...string) (*Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, "/articles/1", nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	ctx := NewContext()
+	ctx.Reset(w, r)
+	ctx.Output.EnableETag = true
+	return ctx, w
+}
+
+func TestBodyETag(t *testing.T) {
+	ctx, w := newConditionalContext("GET")
+	ctx.Output.Body([]byte("hello"))
+	etag := w.Header().Get("ETag")
+	if etag != WeakETag([]byte("hello")) || w.Body.String() != "hello" {
+		t.Fatalf("body is expected to be sent with its weak ETag, found %s %s", etag, w.Body.String())
+	}
+
+	ctx, w = newConditionalContext("GET", "If-None-Match", `"other", `+etag)
+	ctx.Output.Header("Content-Type", "text/plain")
+	ctx.Output.Body([]byte("hello"))
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != etag || w.Header().Get("Content-Type") != "" {
+		t.Errorf("matching If-None-Match is expected to get 304 without a body, found %d %s", w.Code, w.Body.String())
+	}
+
+	ctx, w = newConditionalContext("GET", "If-None-Match", etag)
+	ctx.Output.Body([]byte("changed"))
+	if w.Code != http.StatusOK || w.Body.String() != "changed" {
+		t.Errorf("changed body is expected to be sent, found %d", w.Code)
+	}
+
+	ctx, w = newConditionalContext("GET", "If-None-Match", etag)
+	ctx.Output.SetStatus(http.StatusNotFound)
+	ctx.Output.Body([]byte("hello"))
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Errorf("error responses are not expected to get an ETag, found %d", w.Code)
+	}
+
+	ctx, w = newConditionalContext("GET", "If-None-Match", etag)
+	ctx.Output.EnableETag = false
+	ctx.Output.Body([]byte("hello"))
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != "" {
+		t.Errorf("conditional GET is expected to be opt-in, found %d", w.Code)
+	}
+}
+
+func TestBodyLastModified(t *testing.T) {
+	modified := time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC)
+	ctx, w := newConditionalContext("GET", "If-Modified-Since", modified.Format(http.TimeFormat))
+	ctx.Output.ETag("v1")
+	ctx.Output.LastModified(modified)
+	ctx.Output.Body([]byte("hello"))
+	if w.Code != http.StatusNotModified || w.Header().Get("ETag") != `"v1"` {
+		t.Errorf("unmodified resource is expected to get 304 with the controller ETag, found %d %s", w.Code, w.Header().Get("ETag"))
+	}
+
+	ctx, w = newConditionalContext("GET", "If-Modified-Since", modified.Add(-time.Hour).Format(http.TimeFormat))
+	ctx.Output.LastModified(modified)
+	ctx.Output.Body([]byte("hello"))
+	if w.Code != http.StatusOK {
+		t.Errorf("modified resource is expected to be sent, found %d", w.Code)
+	}
+}
+
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2018, 5, 1, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		method string
+		header []string
+		etag   string
+		ok     bool
+		status int
+	}{
+		{"PUT", []string{"If-Match", `"v1"`}, `"v1"`, true, http.StatusOK},
+		{"PUT", []string{"If-Match", `"v0", "v1"`}, `"v1"`, true, http.StatusOK},
+		{"PUT", []string{"If-Match", `"v0"`}, `"v1"`, false, http.StatusPreconditionFailed},
+		{"PUT", []string{"If-Match", `W/"v1"`}, `W/"v1"`, false, http.StatusPreconditionFailed},
+		{"PUT", []string{"If-Match", "*"}, `"v1"`, true, http.StatusOK},
+		{"PUT", []string{"If-Match", "*"}, "", false, http.StatusPreconditionFailed},
+		{"DELETE", []string{"If-Unmodified-Since", modified.Format(http.TimeFormat)}, "", true, http.StatusOK},
+		{"DELETE", []string{"If-Unmodified-Since", modified.Add(-time.Second).Format(http.TimeFormat)}, "", false, http.StatusPreconditionFailed},
+		{"POST", []string{"If-None-Match", "*"}, `"v1"`, false, http.StatusPreconditionFailed},
+		{"POST", []string{"If-None-Match", "*"}, "", true, http.StatusOK},
+		{"GET", []string{"If-None-Match", `W/"v1"`}, `"v1"`, false, http.StatusNotModified},
+		{"GET", []string{"If-Modified-Since", modified.Format(http.TimeFormat)}, "", false, http.StatusNotModified},
+	}
+	for i, c := range cases {
+		ctx, w := newConditionalContext(c.method, c.header...)
+		ctx.Output.EnableETag = false
+		ok := ctx.CheckPreconditions(c.etag, modified)
+		if ok != c.ok || w.Code != c.status {
+			t.Errorf("case %d: CheckPreconditions is expected to be %v %d, found %v %d", i, c.ok, c.status, ok, w.Code)
+		}
+	}
+}
@@ -24,6 +24,7 @@ package context
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha1"
 	"encoding/base64"
@@ -36,6 +37,8 @@ import (
 	"time"
 
 	"github.com/izi-global/izigo/utils"
+	"github.com/izi-global/izigo/utils/cookie"
+	"github.com/izi-global/izigo/utils/keyring"
 )
 
 // NewContext return the Context with Input and Output
@@ -98,7 +101,14 @@ func (ctx *Context) SetCookie(name string, value string, others ...interface{})
 	ctx.Output.Cookie(name, value, others...)
 }
 
+// SetCookieWithOptions Set cookie with typed attributes for response.
+// It's alias of IZIGoOutput.CookieWithOptions.
+func (ctx *Context) SetCookieWithOptions(name, value string, opts *cookie.Options) error {
+	return ctx.Output.CookieWithOptions(name, value, opts)
+}
+
 // GetSecureCookie Get secure cookie from request by a given key.
+// The cookie is verified with a single secret, see GetSignedCookie to rotate it.
 func (ctx *Context) GetSecureCookie(Secret, key string) (string, bool) {
 	val := ctx.Input.Cookie(key)
 	if val == "" {
@@ -126,6 +136,7 @@ func (ctx *Context) GetSecureCookie(Secret, key string) (string, bool) {
 }
 
 // SetSecureCookie Set Secure cookie for response.
+// The cookie is signed with a single secret, see SetSignedCookie to rotate it.
 func (ctx *Context) SetSecureCookie(Secret, name, value string, others ...interface{}) {
 	vs := base64.URLEncoding.EncodeToString([]byte(value))
 	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
@@ -136,6 +147,64 @@ func (ctx *Context) SetSecureCookie(Secret, name, value string, others ...interf
 	ctx.Output.Cookie(name, cookie, others...)
 }
 
+// GetSignedCookie Get cookie signed by SetSignedCookie from request by a given key.
+// The signature may be made by any key of kr, so it survives key rotation.
+// The cookies set by SetSecureCookie are rejected, moving to the signed cookies
+// invalidates them once.
+func (ctx *Context) GetSignedCookie(kr *keyring.Keyring, key string) (string, bool) {
+	val := ctx.Input.Cookie(key)
+	if val == "" || kr == nil {
+		return "", false
+	}
+	i := strings.LastIndexByte(val, '|')
+	if i < 0 {
+		return "", false
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(val[i+1:])
+	if err != nil || !kr.Verify([]byte(key+"|"+val[:i]), sig) {
+		return "", false
+	}
+	parts := strings.SplitN(val[:i], "|", 2)
+	if len(parts) != 2 {
+		return "", false
+	}
+	res, err := base64.URLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", false
+	}
+	return string(res), true
+}
+
+// SetSignedCookie Set cookie signed with the primary key of kr for response.
+// The value is visible to the client, the signature is bound to the cookie name.
+func (ctx *Context) SetSignedCookie(kr *keyring.Keyring, name, value string, others ...interface{}) {
+	vs := base64.URLEncoding.EncodeToString([]byte(value))
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	payload := vs + "|" + timestamp
+	sig := base64.RawURLEncoding.EncodeToString(kr.Sign([]byte(name + "|" + payload)))
+	ctx.Output.Cookie(name, payload+"|"+sig, others...)
+}
+
+// GetEncryptedCookie Get cookie encrypted by SetEncryptedCookie from request by a given key.
+// The cookie may be produced by any key of kr, so it survives key rotation.
+func (ctx *Context) GetEncryptedCookie(kr *keyring.Keyring, key string) (string, bool) {
+	val := ctx.Input.Cookie(key)
+	if val == "" || kr == nil {
+		return "", false
+	}
+	res, err := kr.DecodeValue(key, val, 0)
+	if err != nil {
+		return "", false
+	}
+	return res, true
+}
+
+// SetEncryptedCookie Set cookie encrypted with the primary key of kr for response.
+// The value is hidden from the client and bound to the cookie name.
+func (ctx *Context) SetEncryptedCookie(kr *keyring.Keyring, name, value string, others ...interface{}) {
+	ctx.Output.Cookie(name, kr.EncodeValue(name, value), others...)
+}
+
 // XSRFToken creates a xsrf token string and returns.
 func (ctx *Context) XSRFToken(key string, expire int64) string {
 	if ctx._xsrfToken == "" {
@@ -149,6 +218,24 @@ func (ctx *Context) XSRFToken(key string, expire int64) string {
 	return ctx._xsrfToken
 }
 
+// XSRFTokenWithKeyring creates a xsrf token string and returns.
+// The token cookie is encrypted with kr and set with opts, it is rejected
+// once older than opts.MaxAge seconds. opts may be nil for a session cookie.
+func (ctx *Context) XSRFTokenWithKeyring(kr *keyring.Keyring, opts *cookie.Options) string {
+	if ctx._xsrfToken == "" {
+		if opts == nil {
+			opts = &cookie.Options{}
+		}
+		token, err := kr.DecodeValue("_xsrf", ctx.Input.Cookie("_xsrf"), opts.MaxAge)
+		if err != nil || token == "" {
+			token = string(utils.RandomCreateBytes(32))
+			ctx.SetEncryptedCookie(kr, "_xsrf", token, opts)
+		}
+		ctx._xsrfToken = token
+	}
+	return ctx._xsrfToken
+}
+
 // CheckXSRFCookie checks xsrf token in this request is valid or not.
 // the token can provided in request header "X-Xsrftoken" and "X-CsrfToken"
 // or in form field value named as "_xsrf".
@@ -193,18 +280,37 @@ type Response struct {
 	http.ResponseWriter
 	Started bool
 	Status  int
+
+	beforeWrite []func()
 }
 
 func (r *Response) reset(rw http.ResponseWriter) {
 	r.ResponseWriter = rw
 	r.Status = 0
 	r.Started = false
+	r.beforeWrite = nil
+}
+
+// BeforeWrite registers fn to be called once before the status or the body
+// of the response is written, such as to set headers depending on the handler.
+func (r *Response) BeforeWrite(fn func()) {
+	r.beforeWrite = append(r.beforeWrite, fn)
+}
+
+// start calls the functions registered by BeforeWrite.
+func (r *Response) start() {
+	fns := r.beforeWrite
+	r.beforeWrite = nil
+	for _, fn := range fns {
+		fn()
+	}
 }
 
 // Write writes the data to the connection as part of an HTTP reply,
 // and sets `started` to true.
 // started means the response has sent out.
 func (r *Response) Write(p []byte) (int, error) {
+	r.start()
 	r.Started = true
 	return r.ResponseWriter.Write(p)
 }
@@ -216,6 +322,7 @@ func (r *Response) WriteHeader(code int) {
 		//prevent multiple response.WriteHeader calls
 		return
 	}
+	r.start()
 	r.Status = code
 	r.Started = true
 	r.ResponseWriter.WriteHeader(code)
@@ -232,6 +339,7 @@ func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 
 // Flush http.Flusher
 func (r *Response) Flush() {
+	r.start()
 	if f, ok := r.ResponseWriter.(http.Flusher); ok {
 		f.Flush()
 	}
@@ -244,3 +352,44 @@ func (r *Response) CloseNotify() <-chan bool {
 	}
 	return nil
 }
+
+// Capture records the status code and body written to the response from now on,
+// while still sending them to the client.
+// It is used by filters which store responses, such as caches.
+func (r *Response) Capture() *CapturedResponse {
+	if c, ok := r.ResponseWriter.(*CapturedResponse); ok {
+		return c
+	}
+	c := &CapturedResponse{ResponseWriter: r.ResponseWriter}
+	r.ResponseWriter = c
+	return c
+}
+
+// CapturedResponse is a http.ResponseWriter which keeps a copy of the response.
+type CapturedResponse struct {
+	http.ResponseWriter
+	Status int
+	Body   bytes.Buffer
+}
+
+// WriteHeader records the status code and sends it.
+func (c *CapturedResponse) WriteHeader(code int) {
+	c.Status = code
+	c.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the data and sends it.
+func (c *CapturedResponse) Write(p []byte) (int, error) {
+	if c.Status == 0 {
+		c.Status = http.StatusOK
+	}
+	c.Body.Write(p)
+	return c.ResponseWriter.Write(p)
+}
+
+// Flush http.Flusher
+func (c *CapturedResponse) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -18,6 +18,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+
+	"github.com/izi-global/izigo/utils/cookie"
+	"github.com/izi-global/izigo/utils/keyring"
 )
 
 func TestXsrfReset_01(t *testing.T) {
@@ -45,3 +48,74 @@ func TestXsrfReset_01(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestXsrfKeyRotation(t *testing.T) {
+	old, _ := keyring.New("old")
+	rotated, _ := old.Rotate("new")
+
+	w := httptest.NewRecorder()
+	c := NewContext()
+	c.Reset(w, &http.Request{Header: http.Header{}})
+	token := c.XSRFTokenWithKeyring(old, &cookie.Options{MaxAge: 3600})
+
+	r := &http.Request{Header: http.Header{"Cookie": w.HeaderMap["Set-Cookie"]}}
+	c.Reset(httptest.NewRecorder(), r)
+	if c.XSRFTokenWithKeyring(rotated, &cookie.Options{MaxAge: 3600}) != token {
+		t.Error("xsrf cookie of the old key is expected to be valid after rotation")
+	}
+	c.Reset(httptest.NewRecorder(), r)
+	if v, ok := c.GetEncryptedCookie(rotated, "_xsrf"); !ok || v != token {
+		t.Errorf("encrypted cookie is expected to be %q, found %q", token, v)
+	}
+}
+
+func TestSignedCookieKeyRotation(t *testing.T) {
+	old, _ := keyring.New("old")
+	rotated, _ := old.Rotate("new")
+
+	w := httptest.NewRecorder()
+	c := NewContext()
+	c.Reset(w, &http.Request{Header: http.Header{}})
+	c.SetSignedCookie(old, "user", "diepdt|admin")
+	c.SetSecureCookie("old", "legacy", "diepdt")
+
+	r := &http.Request{Header: http.Header{"Cookie": w.HeaderMap["Set-Cookie"]}}
+	c.Reset(httptest.NewRecorder(), r)
+	if v, ok := c.GetSignedCookie(rotated, "user"); !ok || v != "diepdt|admin" {
+		t.Errorf("signed cookie of the old key is expected to be diepdt|admin, found %q", v)
+	}
+	if _, ok := c.GetSignedCookie(rotated, "legacy"); ok {
+		t.Error("secure cookie is not expected to be a valid signed cookie")
+	}
+	other, _ := keyring.New("other")
+	if _, ok := c.GetSignedCookie(other, "user"); ok {
+		t.Error("signed cookie is expected to be rejected by an other keyring")
+	}
+
+	// the signature is bound to the cookie name
+	for _, ck := range (&http.Response{Header: w.Header()}).Cookies() {
+		if ck.Name == "user" {
+			r = &http.Request{Header: http.Header{"Cookie": {"admin=" + ck.Value}}}
+		}
+	}
+	c.Reset(httptest.NewRecorder(), r)
+	if _, ok := c.GetSignedCookie(rotated, "admin"); ok {
+		t.Error("signed cookie is expected to be rejected under an other name")
+	}
+}
+
+func TestCookieOptions(t *testing.T) {
+	w := httptest.NewRecorder()
+	c := NewContext()
+	c.Reset(w, &http.Request{Header: http.Header{}})
+	c.SetCookie("legacy", "v", 0, "/", "", true, true)
+	c.SetCookie("theme", "dark", &cookie.Options{HTTPOnly: true, SameSite: cookie.SameSiteStrict})
+	if err := c.SetCookieWithOptions("__Secure-id", "v", &cookie.Options{}); err != cookie.ErrSecureRequired {
+		t.Errorf("insecure __Secure- cookie is expected to fail, found %v", err)
+	}
+	got := w.HeaderMap["Set-Cookie"]
+	want := []string{"legacy=v; Path=/; Secure; HttpOnly", "theme=dark; Path=/; HttpOnly; SameSite=Strict"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("cookies are expected to be %q, found %q", want, got)
+	}
+}
@@ -94,9 +94,10 @@ func (input *IZIGoInput) Site() string {
 }
 
 // Scheme returns request scheme as "http" or "https".
+// The forwarded scheme is only used if the request comes from a trusted proxy.
 func (input *IZIGoInput) Scheme() string {
-	if scheme := input.Header("X-Forwarded-Proto"); scheme != "" {
-		return scheme
+	if hop := input.clientHop(); hop != nil && hop.Proto != "" {
+		return hop.Proto
 	}
 	if input.Context.Request.URL.Scheme != "" {
 		return input.Context.Request.URL.Scheme
@@ -114,8 +115,12 @@ func (input *IZIGoInput) Domain() string {
 }
 
 // Host returns host name.
+// The forwarded host is only used if the request comes from a trusted proxy.
 // if no host info in request, return localhost.
 func (input *IZIGoInput) Host() string {
+	if hop := input.clientHop(); hop != nil && hop.Host != "" {
+		return stripPort(hop.Host)
+	}
 	if input.Context.Request.Host != "" {
 		if hostPart, _, err := net.SplitHostPort(input.Context.Request.Host); err == nil {
 			return hostPart
@@ -125,6 +130,32 @@ func (input *IZIGoInput) Host() string {
 	return "localhost"
 }
 
+// HostPort returns host name and port, the default port of Scheme if the host has none.
+// The forwarded host is only used if the request comes from a trusted proxy.
+func (input *IZIGoInput) HostPort() string {
+	host := input.Context.Request.Host
+	if hop := input.clientHop(); hop != nil && hop.Host != "" {
+		host = hop.Host
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return JoinDefaultPort(host, input.Scheme())
+}
+
+// JoinDefaultPort returns host with the default port of scheme, 443 for https and 80
+// otherwise, if it has no port.
+func JoinDefaultPort(host, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	port := "80"
+	if strings.EqualFold(scheme, "https") {
+		port = "443"
+	}
+	return net.JoinHostPort(stripPort(host), port)
+}
+
 // Method returns http request method.
 func (input *IZIGoInput) Method() string {
 	return input.Context.Request.Method
@@ -211,24 +242,18 @@ func (input *IZIGoInput) AcceptsYAML() bool {
 }
 
 // IP returns request client ip.
-// if in proxy, return first proxy id.
-// if error, return RemoteAddr.
+// if the request comes from a trusted proxy, the Forwarded or X-Forwarded-For
+// chain is walked right-to-left and the first untrusted address is returned.
+// otherwise, return the ip of RemoteAddr.
 func (input *IZIGoInput) IP() string {
-	ips := input.Proxy()
-	if len(ips) > 0 && ips[0] != "" {
-		rip, _, err := net.SplitHostPort(ips[0])
-		if err != nil {
-			rip = ips[0]
-		}
-		return rip
-	}
-	if ip, _, err := net.SplitHostPort(input.Context.Request.RemoteAddr); err == nil {
-		return ip
+	if hop := input.clientHop(); hop != nil && net.ParseIP(hop.For) != nil {
+		return hop.For
 	}
-	return input.Context.Request.RemoteAddr
+	return input.remoteIP()
 }
 
 // Proxy returns proxy client ips slice.
+// The values are taken from X-Forwarded-For as sent, they are not verified.
 func (input *IZIGoInput) Proxy() []string {
 	if ips := input.Header("X-Forwarded-For"); ips != "" {
 		return strings.Split(ips, ",")
@@ -205,3 +205,78 @@ func TestParams(t *testing.T) {
 	}
 
 }
+
+func TestTrustedProxies(t *testing.T) {
+	defer SetTrustedProxies(nil)
+	newInput := func(remoteAddr string, headers map[string]string) *IZIGoInput {
+		r, _ := http.NewRequest("GET", "http://app.example.com/", nil)
+		r.RemoteAddr = remoteAddr
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		ctx := NewContext()
+		ctx.Reset(httptest.NewRecorder(), r)
+		return ctx.Input
+	}
+
+	spoofed := map[string]string{
+		"X-Forwarded-For":   "1.2.3.4",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "evil.com",
+	}
+	input := newInput("203.0.113.9:5000", spoofed)
+	if ip := input.IP(); ip != "203.0.113.9" {
+		t.Fatalf("untrusted X-Forwarded-For should be ignored, got %s", ip)
+	}
+	if scheme := input.Scheme(); scheme != "http" {
+		t.Fatalf("untrusted X-Forwarded-Proto should be ignored, got %s", scheme)
+	}
+	if host := input.Host(); host != "app.example.com" {
+		t.Fatalf("untrusted X-Forwarded-Host should be ignored, got %s", host)
+	}
+	if host := input.HostPort(); host != "app.example.com:80" {
+		t.Fatalf("HostPort should have the default port of http, got %s", host)
+	}
+
+	if err := SetTrustedProxies([]string{"10.0.0.0/8", "2001:db8::/32"}); err != nil {
+		t.Fatal(err)
+	}
+	input = newInput("10.0.0.1:5000", map[string]string{
+		"X-Forwarded-For":   "6.6.6.6, 198.51.100.7, 10.0.0.2",
+		"X-Forwarded-Proto": "https",
+		"X-Forwarded-Host":  "www.example.com:443",
+	})
+	if ip := input.IP(); ip != "198.51.100.7" {
+		t.Fatalf("IP should be the first untrusted hop, got %s", ip)
+	}
+	if !input.IsSecure() {
+		t.Fatal("X-Forwarded-Proto from a trusted proxy should be used")
+	}
+	if host := input.Host(); host != "www.example.com" {
+		t.Fatalf("X-Forwarded-Host from a trusted proxy should be used, got %s", host)
+	}
+	if host := input.HostPort(); host != "www.example.com:443" {
+		t.Fatalf("HostPort should keep the forwarded port, got %s", host)
+	}
+
+	input = newInput("[2001:db8::1]:5000", map[string]string{
+		"Forwarded":       `for=192.0.2.60;proto=https;host=shop.example.com, for="[2001:db8::2]:4711"`,
+		"X-Forwarded-For": "6.6.6.6",
+	})
+	if ip := input.IP(); ip != "192.0.2.60" {
+		t.Fatalf("Forwarded should take precedence, got %s", ip)
+	}
+	if scheme := input.Scheme(); scheme != "https" {
+		t.Fatalf("Forwarded proto should be used, got %s", scheme)
+	}
+	if host := input.Host(); host != "shop.example.com" {
+		t.Fatalf("Forwarded host should be used, got %s", host)
+	}
+	if host := input.HostPort(); host != "shop.example.com:443" {
+		t.Fatalf("HostPort should have the default port of https, got %s", host)
+	}
+
+	if err := SetTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Fatal("invalid trusted proxy should return error")
+	}
+}
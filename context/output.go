@@ -31,6 +31,8 @@ import (
 	"strings"
 	"time"
 	"gopkg.in/yaml.v2"
+
+	"github.com/izi-global/izigo/utils/cookie"
 )
 
 // IZIGoOutput does work for sending response header.
@@ -38,6 +40,8 @@ type IZIGoOutput struct {
 	Context    *Context
 	Status     int
 	EnableGzip bool
+	// EnableETag answers the conditional GET and HEAD requests, see Body.
+	EnableETag bool
 }
 
 // NewOutput returns new IZIGoOutput.
@@ -50,6 +54,7 @@ func NewOutput() *IZIGoOutput {
 func (output *IZIGoOutput) Reset(ctx *Context) {
 	output.Context = ctx
 	output.Status = 0
+	output.EnableETag = false
 }
 
 // Header sets response header item string via given key.
@@ -59,8 +64,15 @@ func (output *IZIGoOutput) Header(key, val string) {
 
 // Body sets response body content.
 // if EnableGzip, compress content string.
+// if EnableETag, the successful responses to GET and HEAD get the weak ETag of
+// content unless the ETag header is set, and 304 Not Modified is sent instead
+// of content when If-None-Match or If-Modified-Since, against the Last-Modified
+// header, match it.
 // it sends out response body directly.
 func (output *IZIGoOutput) Body(content []byte) error {
+	if output.EnableETag && output.conditionalBody(content) {
+		return nil
+	}
 	var encoding string
 	var buf = &bytes.Buffer{}
 	if output.EnableGzip {
@@ -86,9 +98,21 @@ func (output *IZIGoOutput) Body(content []byte) error {
 
 // Cookie sets cookie value via given key.
 // others are ordered as cookie's max age time, path,domain, secure and httponly.
+// others can also be a single *cookie.Options, see CookieWithOptions.
 func (output *IZIGoOutput) Cookie(name string, value string, others ...interface{}) {
+	if len(others) == 1 {
+		switch opts := others[0].(type) {
+		case *cookie.Options:
+			output.CookieWithOptions(name, value, opts)
+			return
+		case cookie.Options:
+			output.CookieWithOptions(name, value, &opts)
+			return
+		}
+	}
+
 	var b bytes.Buffer
-	fmt.Fprintf(&b, "%s=%s", sanitizeName(name), sanitizeValue(value))
+	fmt.Fprintf(&b, "%s=%s", cookie.SanitizeName(name), cookie.SanitizeValue(value))
 
 	//fix cookie not work in IE
 	if len(others) > 0 {
@@ -118,7 +142,7 @@ func (output *IZIGoOutput) Cookie(name string, value string, others ...interface
 	// default "/"
 	if len(others) > 1 {
 		if v, ok := others[1].(string); ok && len(v) > 0 {
-			fmt.Fprintf(&b, "; Path=%s", sanitizeValue(v))
+			fmt.Fprintf(&b, "; Path=%s", cookie.SanitizeValue(v))
 		}
 	} else {
 		fmt.Fprintf(&b, "; Path=%s", "/")
@@ -127,7 +151,7 @@ func (output *IZIGoOutput) Cookie(name string, value string, others ...interface
 	// default empty
 	if len(others) > 2 {
 		if v, ok := others[2].(string); ok && len(v) > 0 {
-			fmt.Fprintf(&b, "; Domain=%s", sanitizeValue(v))
+			fmt.Fprintf(&b, "; Domain=%s", cookie.SanitizeValue(v))
 		}
 	}
 
@@ -157,16 +181,12 @@ func (output *IZIGoOutput) Cookie(name string, value string, others ...interface
 	output.Context.ResponseWriter.Header().Add("Set-Cookie", b.String())
 }
 
-var cookieNameSanitizer = strings.NewReplacer("\n", "-", "\r", "-")
-
-func sanitizeName(n string) string {
-	return cookieNameSanitizer.Replace(n)
-}
-
-var cookieValueSanitizer = strings.NewReplacer("\n", " ", "\r", " ", ";", " ")
-
-func sanitizeValue(v string) string {
-	return cookieValueSanitizer.Replace(v)
+// CookieWithOptions sets cookie value via given key with typed attributes,
+// such as SameSite and Partitioned. opts may be nil for a session cookie on "/".
+// The cookie is not set if it breaks the __Secure-/__Host- prefix rules
+// or sets SameSite=None or Partitioned without Secure.
+func (output *IZIGoOutput) CookieWithOptions(name, value string, opts *cookie.Options) error {
+	return cookie.Set(output.Context.ResponseWriter, name, value, opts)
 }
 
 func jsonRenderer(value interface{}) Renderer {
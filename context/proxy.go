@@ -0,0 +1,194 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	trustedProxiesLock sync.RWMutex
+	trustedProxies     []*net.IPNet
+)
+
+// SetTrustedProxies sets the proxies whose forwarding headers
+// (Forwarded, X-Forwarded-For, X-Forwarded-Proto and X-Forwarded-Host) are trusted.
+// Each entry is a CIDR such as 10.0.0.0/8 or a single IPv4/IPv6 address.
+// When no proxy is trusted the forwarding headers are ignored.
+func SetTrustedProxies(cidrs []string) error {
+	nets, err := ParseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+	trustedProxiesLock.Lock()
+	trustedProxies = nets
+	trustedProxiesLock.Unlock()
+	return nil
+}
+
+// IsTrustedProxy returns whether ip belongs to one of the trusted proxies.
+func IsTrustedProxy(ip string) bool {
+	trustedProxiesLock.RLock()
+	defer trustedProxiesLock.RUnlock()
+	return ContainsIP(trustedProxies, ip)
+}
+
+// ParseCIDRs parses a list of CIDRs or single addresses.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: c}
+			}
+			if ip.To4() != nil {
+				c += "/32"
+			} else {
+				c += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ContainsIP returns whether ip belongs to one of nets.
+func ContainsIP(nets []*net.IPNet, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHop is one element of the Forwarded header, or the
+// equivalent values of the X-Forwarded-* headers.
+type forwardedHop struct {
+	For   string
+	Proto string
+	Host  string
+}
+
+// forwardedHops returns the hops added by the proxies, the nearest proxy last.
+// The RFC 7239 Forwarded header takes precedence over X-Forwarded-For.
+func (input *IZIGoInput) forwardedHops() []forwardedHop {
+	if fwd := input.Context.Request.Header["Forwarded"]; len(fwd) > 0 {
+		return parseForwarded(strings.Join(fwd, ","))
+	}
+	xff := input.Header("X-Forwarded-For")
+	if xff == "" {
+		return nil
+	}
+	// X-Forwarded-Proto and X-Forwarded-Host are set by the nearest proxy
+	proto := strings.ToLower(lastValue(input.Header("X-Forwarded-Proto")))
+	host := lastValue(input.Header("X-Forwarded-Host"))
+	parts := strings.Split(xff, ",")
+	hops := make([]forwardedHop, len(parts))
+	for i, p := range parts {
+		hops[i] = forwardedHop{For: stripPort(strings.TrimSpace(p)), Proto: proto, Host: host}
+	}
+	return hops
+}
+
+// clientHop walks the forwarded chain right-to-left and returns the hop
+// describing the first untrusted address. It returns nil when the peer
+// is not a trusted proxy or no forwarding header is present.
+func (input *IZIGoInput) clientHop() *forwardedHop {
+	if !IsTrustedProxy(input.remoteIP()) {
+		return nil
+	}
+	hops := input.forwardedHops()
+	if len(hops) == 0 {
+		return nil
+	}
+	for i := len(hops) - 1; i > 0; i-- {
+		if !IsTrustedProxy(hops[i].For) {
+			return &hops[i]
+		}
+	}
+	return &hops[0]
+}
+
+// ClientIP returns the client address of r as IZIGoInput.IP does,
+// for code which has no Context such as the session manager.
+func ClientIP(r *http.Request) string {
+	input := &IZIGoInput{Context: &Context{Request: r}}
+	return input.IP()
+}
+
+func (input *IZIGoInput) remoteIP() string {
+	if ip, _, err := net.SplitHostPort(input.Context.Request.RemoteAddr); err == nil {
+		return ip
+	}
+	return input.Context.Request.RemoteAddr
+}
+
+// parseForwarded parses the Forwarded header value as defined in RFC 7239.
+func parseForwarded(value string) []forwardedHop {
+	var hops []forwardedHop
+	for _, element := range strings.Split(value, ",") {
+		var hop forwardedHop
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			switch strings.ToLower(kv[0]) {
+			case "for":
+				hop.For = stripPort(v)
+			case "proto":
+				hop.Proto = strings.ToLower(v)
+			case "host":
+				hop.Host = v
+			}
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// stripPort removes the port and the IPv6 brackets from a node,
+// such as "192.0.2.43:47011" or "[2001:db8:cafe::17]:4711".
+func stripPort(node string) string {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+}
+
+func lastValue(v string) string {
+	if i := strings.LastIndex(v, ","); i >= 0 {
+		v = v[i+1:]
+	}
+	return strings.TrimSpace(v)
+}
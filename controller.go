@@ -30,6 +30,7 @@ import (
 	"github.com/izi-global/izigo/context"
 	"github.com/izi-global/izigo/context/param"
 	"github.com/izi-global/izigo/session"
+	"github.com/izi-global/izigo/utils/cookie"
 )
 
 //commonly used mime-types
@@ -628,9 +629,34 @@ func (c *Controller) SessionRegenerateID() {
 	c.Ctx.Input.CruSession = c.CruSession
 }
 
+// ChangeSessionPrivilege regenerates the session id after a login, a logout
+// or a change of role, and binds the session to principal,
+// see session.Manager.ChangePrivilege.
+func (c *Controller) ChangeSessionPrivilege(principal string) error {
+	if c.CruSession != nil {
+		c.CruSession.SessionRelease(c.Ctx.ResponseWriter)
+	}
+	st, err := GlobalSessions.ChangePrivilege(c.Ctx.ResponseWriter, c.Ctx.Request, principal)
+	if st != nil {
+		c.CruSession = st
+		c.Ctx.Input.CruSession = st
+	}
+	return err
+}
+
+// BindSession associates the current session with principal, typically the id
+// of the user after a login, see session.Manager.SessionBind.
+func (c *Controller) BindSession(principal string) error {
+	if c.CruSession == nil {
+		c.StartSession()
+	}
+	return GlobalSessions.SessionBind(c.CruSession.SessionID(), principal)
+}
+
 // DestroySession cleans session data and session cookie.
 func (c *Controller) DestroySession() {
 	c.Ctx.Input.CruSession.Flush()
+	session.Discard(c.Ctx.Input.CruSession)
 	c.Ctx.Input.CruSession = nil
 	GlobalSessions.SessionDestroy(c.Ctx.ResponseWriter, c.Ctx.Request)
 }
@@ -650,18 +676,58 @@ func (c *Controller) SetSecureCookie(Secret, name, value string, others ...inter
 	c.Ctx.SetSecureCookie(Secret, name, value, others...)
 }
 
+// GetSignedCookie returns the value of a cookie set by SetSignedCookie,
+// verified with any key of the application Keyring.
+func (c *Controller) GetSignedCookie(key string) (string, bool) {
+	return c.Ctx.GetSignedCookie(CookieKeyring(), key)
+}
+
+// SetSignedCookie puts value into cookie after signed with the primary key of the application Keyring.
+func (c *Controller) SetSignedCookie(name, value string, others ...interface{}) {
+	c.Ctx.SetSignedCookie(CookieKeyring(), name, value, others...)
+}
+
+// SetCookieWithOptions puts value into cookie with typed attributes such as SameSite.
+func (c *Controller) SetCookieWithOptions(name, value string, opts *cookie.Options) error {
+	return c.Ctx.SetCookieWithOptions(name, value, opts)
+}
+
+// GetEncryptedCookie returns the value of a cookie set by SetEncryptedCookie.
+func (c *Controller) GetEncryptedCookie(key string) (string, bool) {
+	return c.Ctx.GetEncryptedCookie(CookieKeyring(), key)
+}
+
+// SetEncryptedCookie puts value into cookie after encrypted with the application Keyring.
+func (c *Controller) SetEncryptedCookie(name, value string, others ...interface{}) {
+	c.Ctx.SetEncryptedCookie(CookieKeyring(), name, value, others...)
+}
+
 // XSRFToken creates a CSRF token string and returns.
+// The token cookie is encrypted with the application Keyring,
+// or with XSRFKey when no SecretKeys are configured.
 func (c *Controller) XSRFToken() string {
 	if c._xsrfToken == "" {
 		expire := int64(BConfig.WebConfig.XSRFExpire)
 		if c.XSRFExpire > 0 {
 			expire = int64(c.XSRFExpire)
 		}
-		c._xsrfToken = c.Ctx.XSRFToken(BConfig.WebConfig.XSRFKey, expire)
+		c._xsrfToken = c.Ctx.XSRFTokenWithKeyring(CookieKeyring(), xsrfCookieOptions(expire))
 	}
 	return c._xsrfToken
 }
 
+// xsrfCookieOptions returns the attributes of the xsrf cookie,
+// they are checked by registerXSRFCookie on start.
+func xsrfCookieOptions(expire int64) *cookie.Options {
+	sameSite, _ := cookie.ParseSameSite(BConfig.WebConfig.XSRFSameSite)
+	return &cookie.Options{
+		MaxAge:   expire,
+		Secure:   BConfig.WebConfig.XSRFSecure,
+		HTTPOnly: BConfig.WebConfig.XSRFHTTPOnly,
+		SameSite: sameSite,
+	}
+}
+
 // CheckXSRFCookie checks xsrf token in this request is valid or not.
 // the token can provided in request header "X-Xsrftoken" and "X-CsrfToken"
 // or in form field value named as "_xsrf".
@@ -15,96 +15,179 @@
 package izigo
 
 import (
+	"bytes"
+	"encoding/gob"
 	"fmt"
-	"net/url"
 	"strings"
+
+	"github.com/izi-global/izigo/logs"
 )
 
+func init() {
+	// common payloads, such as validation errors, other types must be registered with gob.Register
+	gob.Register(map[string]string{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
 // FlashData is a tools to maintain data when using across request.
+//
+// Data holds the last string message of each category, as used by the templates.
+// Messages holds every message of each category, with any payload which gob
+// can encode, such as a map of validation errors.
+//
+// The messages are kept in the session when FlashInSession is set and
+// sessions are on, in a cookie encrypted with the application Keyring otherwise.
 type FlashData struct {
-	Data map[string]string
+	Data     map[string]string
+	Messages map[string][]interface{}
 }
 
 // NewFlash return a new empty FlashData struct.
 func NewFlash() *FlashData {
 	return &FlashData{
-		Data: make(map[string]string),
+		Data:     make(map[string]string),
+		Messages: make(map[string][]interface{}),
 	}
 }
 
-// Set message to flash
+// Set message to flash, it replaces the messages of the category key.
 func (fd *FlashData) Set(key string, msg string, args ...interface{}) {
-	if len(args) == 0 {
-		fd.Data[key] = msg
-	} else {
-		fd.Data[key] = fmt.Sprintf(msg, args...)
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
 	}
+	fd.Data[key] = msg
+	fd.Messages[key] = []interface{}{msg}
+}
+
+// Add appends payload to the messages of category.
+// String payloads are also the message of category in Data.
+func (fd *FlashData) Add(category string, payload interface{}) {
+	if msg, ok := payload.(string); ok {
+		fd.Data[category] = msg
+	}
+	fd.Messages[category] = append(fd.Messages[category], payload)
+}
+
+// Get returns the messages of category.
+func (fd *FlashData) Get(category string) []interface{} {
+	return fd.Messages[category]
 }
 
 // Success writes success message to flash.
 func (fd *FlashData) Success(msg string, args ...interface{}) {
-	if len(args) == 0 {
-		fd.Data["success"] = msg
-	} else {
-		fd.Data["success"] = fmt.Sprintf(msg, args...)
-	}
+	fd.Set("success", msg, args...)
 }
 
 // Notice writes notice message to flash.
 func (fd *FlashData) Notice(msg string, args ...interface{}) {
-	if len(args) == 0 {
-		fd.Data["notice"] = msg
-	} else {
-		fd.Data["notice"] = fmt.Sprintf(msg, args...)
-	}
+	fd.Set("notice", msg, args...)
 }
 
 // Warning writes warning message to flash.
 func (fd *FlashData) Warning(msg string, args ...interface{}) {
-	if len(args) == 0 {
-		fd.Data["warning"] = msg
-	} else {
-		fd.Data["warning"] = fmt.Sprintf(msg, args...)
-	}
+	fd.Set("warning", msg, args...)
 }
 
 // Error writes error message to flash.
 func (fd *FlashData) Error(msg string, args ...interface{}) {
-	if len(args) == 0 {
-		fd.Data["error"] = msg
-	} else {
-		fd.Data["error"] = fmt.Sprintf(msg, args...)
-	}
+	fd.Set("error", msg, args...)
+}
+
+// flashPayload is the encoded form of FlashData.
+type flashPayload struct {
+	Data     map[string]string
+	Messages map[string][]interface{}
+}
+
+// flashInSession returns whether the flash messages are kept in the session.
+func flashInSession(c *Controller) bool {
+	return BConfig.WebConfig.FlashInSession && BConfig.WebConfig.Session.SessionOn &&
+		GlobalSessions != nil && c.StartSession() != nil
 }
 
 // Store does the saving operation of flash data.
-// the data are encoded and saved in cookie.
+// the data are kept in the session or in a cookie encrypted with the application Keyring.
 func (fd *FlashData) Store(c *Controller) {
 	c.Data["flash"] = fd.Data
-	var flashValue string
-	for key, value := range fd.Data {
-		flashValue += "\x00" + key + "\x23" + BConfig.WebConfig.FlashSeparator + "\x23" + value + "\x00"
+	c.Data["flashMessages"] = fd.Messages
+	fd.save(c)
+}
+
+// Keep keeps the messages read by ReadFromRequest for the next request,
+// such as when the current request redirects again.
+func (fd *FlashData) Keep(c *Controller) {
+	fd.save(c)
+}
+
+func (fd *FlashData) save(c *Controller) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&flashPayload{Data: fd.Data, Messages: fd.Messages}); err != nil {
+		logs.Error("flash: can not encode the messages: %v", err)
+		return
 	}
-	c.Ctx.SetCookie(BConfig.WebConfig.FlashName, url.QueryEscape(flashValue), 0, "/")
+	if flashInSession(c) {
+		c.SetSession(BConfig.WebConfig.FlashName, buf.Bytes())
+		return
+	}
+	c.Ctx.SetEncryptedCookie(CookieKeyring(), BConfig.WebConfig.FlashName, buf.String(), 0, "/")
 }
 
-// ReadFromRequest parsed flash data from encoded values in cookie.
+// ReadFromRequest reads the flash data of the previous request and removes it,
+// so that the messages are shown once.
 func ReadFromRequest(c *Controller) *FlashData {
+	return readFlash(c, true)
+}
+
+// PeekFlash reads the flash data of the previous request without removing it.
+func PeekFlash(c *Controller) *FlashData {
+	return readFlash(c, false)
+}
+
+func readFlash(c *Controller, remove bool) *FlashData {
 	flash := NewFlash()
-	if cookie, err := c.Ctx.Request.Cookie(BConfig.WebConfig.FlashName); err == nil {
-		v, _ := url.QueryUnescape(cookie.Value)
-		vals := strings.Split(v, "\x00")
-		for _, v := range vals {
-			if len(v) > 0 {
-				kv := strings.Split(v, "\x23"+BConfig.WebConfig.FlashSeparator+"\x23")
-				if len(kv) == 2 {
-					flash.Data[kv[0]] = kv[1]
-				}
+	if flashInSession(c) {
+		if b, ok := c.GetSession(BConfig.WebConfig.FlashName).([]byte); ok {
+			flash.decode(b)
+			if remove {
+				c.DelSession(BConfig.WebConfig.FlashName)
 			}
 		}
-		//read one time then delete it
-		c.Ctx.SetCookie(BConfig.WebConfig.FlashName, "", -1, "/")
+	} else if _, err := c.Ctx.Request.Cookie(BConfig.WebConfig.FlashName); err == nil {
+		v, _ := c.Ctx.GetEncryptedCookie(CookieKeyring(), BConfig.WebConfig.FlashName)
+		flash.decode([]byte(v))
+		if remove {
+			//read one time then delete it
+			c.Ctx.SetCookie(BConfig.WebConfig.FlashName, "", -1, "/")
+		}
 	}
 	c.Data["flash"] = flash.Data
+	c.Data["flashMessages"] = flash.Messages
 	return flash
 }
+
+func (fd *FlashData) decode(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	var p flashPayload
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&p); err == nil {
+		for k, v := range p.Data {
+			fd.Data[k] = v
+		}
+		for k, v := range p.Messages {
+			fd.Messages[k] = v
+		}
+		return
+	}
+	// messages stored by a previous version, separated by FlashSeparator
+	for _, v := range strings.Split(string(b), "\x00") {
+		if len(v) > 0 {
+			kv := strings.Split(v, "\x23"+BConfig.WebConfig.FlashSeparator+"\x23")
+			if len(kv) == 2 {
+				fd.Data[kv[0]] = kv[1]
+				fd.Messages[kv[0]] = []interface{}{kv[1]}
+			}
+		}
+	}
+}
@@ -19,6 +19,8 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+
+	"github.com/izi-global/izigo/session"
 )
 
 type TestFlashController struct {
@@ -33,6 +35,51 @@ func (t *TestFlashController) TestWriteFlash() {
 	t.ServeJSON(true)
 }
 
+func (t *TestFlashController) TestReadFlash() {
+	flash := ReadFromRequest(&t.Controller)
+	t.Ctx.WriteString(flash.Data["notice"])
+}
+
+func (t *TestFlashController) TestWriteMessages() {
+	flash := NewFlash()
+	flash.Add("error", "first")
+	flash.Add("error", "second")
+	flash.Add("form", map[string]string{"name": "Name is required"})
+	flash.Store(&t.Controller)
+	t.Ctx.WriteString("ok")
+}
+
+func (t *TestFlashController) TestReadMessages() {
+	var flash *FlashData
+	if t.GetString("peek") != "" {
+		flash = PeekFlash(&t.Controller)
+	} else {
+		flash = ReadFromRequest(&t.Controller)
+	}
+	if t.GetString("keep") != "" {
+		flash.Keep(&t.Controller)
+	}
+	var out []string
+	for _, m := range flash.Get("error") {
+		out = append(out, m.(string))
+	}
+	for _, m := range flash.Get("form") {
+		out = append(out, m.(map[string]string)["name"])
+	}
+	t.Ctx.WriteString(strings.Join(out, ","))
+}
+
+func flashCookie(w *httptest.ResponseRecorder) string {
+	// the last cookie wins, as Keep sets the cookie again after its deletion
+	var cookie string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == BConfig.WebConfig.FlashName {
+			cookie = c.Name + "=" + c.Value
+		}
+	}
+	return cookie
+}
+
 func TestFlashHeader(t *testing.T) {
 	// create fake GET request
 	r, _ := http.NewRequest("GET", "/", nil)
@@ -46,9 +93,106 @@ func TestFlashHeader(t *testing.T) {
 	// get the Set-Cookie value
 	sc := w.Header().Get("Set-Cookie")
 	// match for the expected header
-	res := strings.Contains(sc, "IZIGO_FLASH=%00notice%23IZIGOFLASH%23TestFlashString%00")
+	res := strings.HasPrefix(sc, "IZIGO_FLASH=") && !strings.Contains(sc, "TestFlashString")
 	// validate the assertion
 	if !res {
 		t.Errorf("TestFlashHeader() unable to validate flash message")
 	}
+
+	// the encrypted cookie is read back by the next request
+	r, _ = http.NewRequest("GET", "/read", nil)
+	r.Header.Set("Cookie", strings.SplitN(sc, ";", 2)[0])
+	handler.Add("/read", &TestFlashController{}, "get:TestReadFlash")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Body.String() != "TestFlashString" {
+		t.Errorf("flash message is expected to be read back, found %q", w.Body.String())
+	}
+}
+
+func TestFlashTampered(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/read", nil)
+	r.Header.Set("Cookie", "IZIGO_FLASH=%00notice%23IZIGOFLASH%23Forged%00")
+	w := httptest.NewRecorder()
+	handler := NewControllerRegister()
+	handler.Add("/read", &TestFlashController{}, "get:TestReadFlash")
+	handler.ServeHTTP(w, r)
+	if w.Body.String() != "" {
+		t.Errorf("unencrypted flash cookie should be ignored, found %q", w.Body.String())
+	}
+}
+
+func TestFlashMessages(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.Add("/write", &TestFlashController{}, "get:TestWriteMessages")
+	handler.Add("/read", &TestFlashController{}, "get:TestReadMessages")
+	const expected = "first,second,Name is required"
+
+	r, _ := http.NewRequest("GET", "/write", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	cookie := flashCookie(w)
+	if cookie == "" {
+		t.Fatal("flash cookie is expected to be set")
+	}
+
+	for _, query := range []string{"?peek=1", "?keep=1", ""} {
+		r, _ = http.NewRequest("GET", "/read"+query, nil)
+		r.Header.Set("Cookie", cookie)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Body.String() != expected {
+			t.Errorf("flash messages are expected to be %q with %q, found %q", expected, query, w.Body.String())
+		}
+		deleted := strings.Contains(w.Header().Get("Set-Cookie"), "Max-Age=0")
+		if deleted != (query != "?peek=1") {
+			t.Errorf("flash cookie deletion is expected to be %v with %q, found %v", !deleted, query, deleted)
+		}
+		if query == "?keep=1" {
+			if kept := flashCookie(w); kept == "" || strings.HasSuffix(kept, "=") {
+				t.Errorf("flash cookie is expected to be kept, found %q", kept)
+			} else {
+				cookie = kept
+			}
+		}
+	}
+}
+
+func TestFlashInSession(t *testing.T) {
+	oldSessions, oldConf := GlobalSessions, BConfig.WebConfig
+	defer func() { GlobalSessions, BConfig.WebConfig = oldSessions, oldConf }()
+	var err error
+	GlobalSessions, err = session.NewManager("memory", &session.ManagerConfig{CookieName: "gosessionid", EnableSetCookie: true, Gclifetime: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	BConfig.WebConfig.Session.SessionOn = true
+	BConfig.WebConfig.FlashInSession = true
+
+	handler := NewControllerRegister()
+	handler.Add("/write", &TestFlashController{}, "get:TestWriteMessages")
+	handler.Add("/read", &TestFlashController{}, "get:TestReadMessages")
+
+	r, _ := http.NewRequest("GET", "/write", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if flashCookie(w) != "" {
+		t.Errorf("flash cookie is expected to be empty when the messages are kept in the session")
+	}
+	var sid string
+	for _, c := range w.Result().Cookies() {
+		if c.Name == "gosessionid" {
+			sid = c.Name + "=" + c.Value
+		}
+	}
+
+	for i, expected := range []string{"first,second,Name is required", ""} {
+		r, _ = http.NewRequest("GET", "/read", nil)
+		r.Header.Set("Cookie", sid)
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Body.String() != expected {
+			t.Errorf("flash messages of read %d are expected to be %q, found %q", i, expected, w.Body.String())
+		}
+	}
 }
@@ -5,10 +5,14 @@ import (
 	"mime"
 	"net/http"
 	"path/filepath"
+	"sync"
 
 	"github.com/izi-global/izigo/context"
 	"github.com/izi-global/izigo/logs"
 	"github.com/izi-global/izigo/session"
+	"github.com/izi-global/izigo/utils"
+	"github.com/izi-global/izigo/utils/cookie"
+	"github.com/izi-global/izigo/utils/keyring"
 )
 
 //
@@ -43,6 +47,56 @@ func registerDefaultErrorHandler() error {
 	return nil
 }
 
+func registerKeyring() error {
+	if len(BConfig.WebConfig.SecretKeys) == 0 {
+		return nil
+	}
+	kr, err := keyring.New(BConfig.WebConfig.SecretKeys...)
+	if err != nil {
+		return err
+	}
+	Keyring = kr
+	return nil
+}
+
+var xsrfKeyring struct {
+	sync.Mutex
+	secret string
+	kr     *keyring.Keyring
+}
+
+// CookieKeyring returns Keyring, or a keyring made of XSRFKey
+// when no SecretKeys are configured.
+func CookieKeyring() *keyring.Keyring {
+	if Keyring != nil {
+		return Keyring
+	}
+	xsrfKeyring.Lock()
+	defer xsrfKeyring.Unlock()
+	if xsrfKeyring.kr == nil || xsrfKeyring.secret != BConfig.WebConfig.XSRFKey {
+		kr, err := keyring.New(BConfig.WebConfig.XSRFKey)
+		if err != nil {
+			logs.Warn("SecretKeys and XSRFKey are empty, cookies are encrypted with a random key until restart")
+			kr, _ = keyring.New(string(utils.RandomCreateBytes(32)))
+		}
+		xsrfKeyring.secret = BConfig.WebConfig.XSRFKey
+		xsrfKeyring.kr = kr
+	}
+	return xsrfKeyring.kr
+}
+
+func registerXSRFCookie() error {
+	if !BConfig.WebConfig.EnableXSRF {
+		return nil
+	}
+	sameSite, err := cookie.ParseSameSite(BConfig.WebConfig.XSRFSameSite)
+	if err != nil {
+		return err
+	}
+	opts := &cookie.Options{Secure: BConfig.WebConfig.XSRFSecure, SameSite: sameSite}
+	return opts.Validate("_xsrf")
+}
+
 func registerSession() error {
 	if BConfig.WebConfig.Session.SessionOn {
 		var err error
@@ -60,11 +114,23 @@ func registerSession() error {
 			conf.EnableSidInHTTPHeader = BConfig.WebConfig.Session.SessionEnableSidInHTTPHeader
 			conf.SessionNameInHTTPHeader = BConfig.WebConfig.Session.SessionNameInHTTPHeader
 			conf.EnableSidInURLQuery = BConfig.WebConfig.Session.SessionEnableSidInURLQuery
+			conf.SameSite = BConfig.WebConfig.Session.SessionCookieSameSite
+			conf.Partitioned = BConfig.WebConfig.Session.SessionCookiePartitioned
+			conf.EnableLock = BConfig.WebConfig.Session.SessionEnableLock
+			conf.LockTimeout = BConfig.WebConfig.Session.SessionLockTimeout
+			conf.EnableDirtyTracking = BConfig.WebConfig.Session.SessionDirtyTracking
+			conf.IdleTimeout = BConfig.WebConfig.Session.SessionIdleTimeout
+			conf.AbsoluteTimeout = BConfig.WebConfig.Session.SessionAbsoluteTimeout
+			conf.RollingCookie = BConfig.WebConfig.Session.SessionRollingCookie
+			conf.EnableIndex = BConfig.WebConfig.Session.SessionEnableIndex
+			conf.SeenInterval = BConfig.WebConfig.Session.SessionSeenInterval
 		} else {
 			if err = json.Unmarshal([]byte(sessionConfig), conf); err != nil {
 				return err
 			}
 		}
+		conf.Keyring = Keyring
+		conf.ClientIP = context.ClientIP
 		if GlobalSessions, err = session.NewManager(BConfig.WebConfig.Session.SessionProvider, conf); err != nil {
 			return err
 		}
@@ -91,6 +157,10 @@ func registerAdmin() error {
 	return nil
 }
 
+func registerTrustedProxies() error {
+	return context.SetTrustedProxies(BConfig.Listen.TrustedProxies)
+}
+
 func registerGzip() error {
 	if BConfig.EnableGzip {
 		context.InitGzip(
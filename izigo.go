@@ -90,10 +90,13 @@ func initBeforeHTTPRun() {
 	AddAPPStartHook(
 		registerMime,
 		registerDefaultErrorHandler,
+		registerKeyring,
+		registerXSRFCookie,
 		registerSession,
 		registerTemplate,
 		registerAdmin,
 		registerGzip,
+		registerTrustedProxies,
 	)
 
 	for _, hk := range hooks {
@@ -342,12 +342,18 @@ func (d *dbBase) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Lo
 	sep = fmt.Sprintf("%s = ? AND %s", Q, Q)
 	wheres := strings.Join(whereCols, sep)
 
+	// the soft deleted rows are not read
+	alive := ""
+	if fi := mi.fields.softDelete; fi != nil {
+		alive = "AND " + aliveSQL(fi, Q, "") + " "
+	}
+
 	forUpdate := ""
 	if isForUpdate {
 		forUpdate = "FOR UPDATE"
 	}
 
-	query := fmt.Sprintf("SELECT %s%s%s FROM %s%s%s WHERE %s%s%s = ? %s", Q, sels, Q, Q, mi.table, Q, Q, wheres, Q, forUpdate)
+	query := fmt.Sprintf("SELECT %s%s%s FROM %s%s%s WHERE %s%s%s = ? %s%s", Q, sels, Q, Q, mi.table, Q, Q, wheres, Q, alive, forUpdate)
 
 	refs := make([]interface{}, colsNum)
 	for i := range refs {
@@ -676,14 +682,8 @@ func (d *dbBase) Delete(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.
 		if err != nil {
 			return 0, err
 		}
+		// the auto pk is reset by Ormer.Delete, after the AfterDelete hook
 		if num > 0 {
-			if mi.fields.pk.auto {
-				if mi.fields.pk.fieldType&IsPositiveIntegerField > 0 {
-					ind.FieldByIndex(mi.fields.pk.fieldIndex).SetUint(0)
-				} else {
-					ind.FieldByIndex(mi.fields.pk.fieldIndex).SetInt(0)
-				}
-			}
 			err := d.deleteRels(q, mi, args, tz)
 			if err != nil {
 				return num, err
@@ -713,6 +713,7 @@ func (d *dbBase) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Con
 	}
 
 	tables := newDbTables(mi, d.ins)
+	tables.unscoped = !qs.scoped()
 	if qs != nil {
 		tables.parseRelated(qs.related, qs.relDepth)
 	}
@@ -800,6 +801,7 @@ func (d *dbBase) deleteRels(q dbQuerier, mi *modelInfo, args []interface{}, tz *
 // delete table-related records.
 func (d *dbBase) DeleteBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (int64, error) {
 	tables := newDbTables(mi, d.ins)
+	tables.unscoped = !qs.scoped()
 	tables.skipEnd = true
 
 	if qs != nil {
@@ -949,6 +951,7 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 	sels := fmt.Sprintf("T0.%s%s%s", Q, strings.Join(tCols, sep), Q)
 
 	tables := newDbTables(mi, d.ins)
+	tables.unscoped = !qs.scoped()
 	tables.parseRelated(qs.related, qs.relDepth)
 
 	where, args := tables.getCondSQL(cond, false, tz)
@@ -1094,6 +1097,7 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 // excute count sql and return count result int64.
 func (d *dbBase) Count(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location) (cnt int64, err error) {
 	tables := newDbTables(mi, d.ins)
+	tables.unscoped = !qs.scoped()
 	tables.parseRelated(qs.related, qs.relDepth)
 
 	where, args := tables.getCondSQL(cond, false, tz)
@@ -1588,6 +1592,7 @@ func (d *dbBase) ReadValues(q dbQuerier, qs *querySet, mi *modelInfo, cond *Cond
 	}
 
 	tables := newDbTables(mi, d.ins)
+	tables.unscoped = !qs.scoped()
 
 	var (
 		cols  []string
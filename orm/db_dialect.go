@@ -0,0 +1,88 @@
+// Copyright 2015 TiDB Author. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Dialect exposes the SQL dialect of a registered database alias to the
+// packages which use GetDB without models, such as the sqldb session provider.
+type Dialect struct {
+	Driver DriverType
+	base   dbBaser
+}
+
+// GetDialect returns the Dialect of a registered database alias.
+// Use "default" as alias name if you not set.
+func GetDialect(aliasNames ...string) (*Dialect, error) {
+	name := "default"
+	if len(aliasNames) > 0 {
+		name = aliasNames[0]
+	}
+	al, ok := dataBaseCache.get(name)
+	if !ok {
+		return nil, fmt.Errorf("DataBase of alias name `%s` not found", name)
+	}
+	return &Dialect{Driver: al.Driver, base: al.DbBaser}, nil
+}
+
+// Quote quotes a table, index or column name.
+// Oracle names are not quoted, so that they stay case insensitive.
+func (d *Dialect) Quote(name string) string {
+	if d.Driver == DROracle {
+		return name
+	}
+	q := d.base.TableQuote()
+	return q + name + q
+}
+
+// ColumnType returns the column type of a field type as named in the orm,
+// such as "string", "string-text", "int64" or "time.Time".
+// size fills the size of types such as varchar(%d).
+func (d *Dialect) ColumnType(typ string, size ...interface{}) string {
+	t := d.base.DbTypes()[typ]
+	if strings.Contains(t, "%d") {
+		t = fmt.Sprintf(t, size...)
+	}
+	return t
+}
+
+// ReplaceMarks replaces the ? placeholders of query by the ones of the dialect.
+func (d *Dialect) ReplaceMarks(query string) string {
+	d.base.ReplaceMarks(&query)
+	return query
+}
+
+// TableExists returns whether table exists in db.
+func (d *Dialect) TableExists(db *sql.DB, table string) (bool, error) {
+	tables, err := d.base.GetTables(db)
+	if err != nil {
+		return false, err
+	}
+	for t := range tables {
+		if strings.EqualFold(t, table) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// IndexExists returns whether the index name of table exists in db.
+func (d *Dialect) IndexExists(db *sql.DB, table, name string) bool {
+	return d.base.IndexExists(db, table, name)
+}
@@ -40,6 +40,8 @@ type dbTables struct {
 	mi      *modelInfo
 	base    dbBaser
 	skipEnd bool
+	// unscoped keeps the soft deleted rows of the joined tables.
+	unscoped bool
 }
 
 // set table info to collection.
@@ -135,7 +137,8 @@ func (t *dbTables) parseRelated(rels []string, depth int) {
 				names = append(names, fi.name)
 				mmi = fi.relModelInfo
 
-				if fi.null || t.skipEnd {
+				// a soft deleted relation is left empty instead of dropping the row
+				if fi.null || t.skipEnd || mmi.fields.softDelete != nil && !t.unscoped {
 					inner = false
 				}
 
@@ -204,8 +207,13 @@ func (t *dbTables) getJoinSQL() (join string) {
 			}
 		}
 
-		join += fmt.Sprintf("%s%s%s %s ON %s.%s%s%s = %s.%s%s%s ", Q, table, Q, t2,
-			t2, Q, c2, Q, t1, Q, c1, Q)
+		alive := ""
+		if sfi := jt.mi.fields.softDelete; sfi != nil && !t.unscoped {
+			alive = " AND " + aliveSQL(sfi, Q, t2+".")
+		}
+
+		join += fmt.Sprintf("%s%s%s %s ON %s.%s%s%s = %s.%s%s%s%s ", Q, table, Q, t2,
+			t2, Q, c2, Q, t1, Q, c1, Q, alive)
 	}
 	return
 }
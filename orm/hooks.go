@@ -0,0 +1,146 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"context"
+	"reflect"
+)
+
+// The model hooks are detected by RegisterModel on the pointer to the model struct.
+// They receive the Ormer running the operation, so that they can query within its
+// transaction, and the context given to BeginTx, context.Background() outside of a
+// transaction. A hook returning an error aborts the operation with that error, the
+// changes made before an After hook failed are kept: within a transaction the caller
+// decides whether to roll it back.
+//
+// Only Ormer.Read, ReadForUpdate, ReadOrCreate, Insert, Update and Delete call the hooks.
+// The bulk operations skip them: Ormer.InsertMulti, InsertOrUpdate and LoadRelated,
+// QuerySeter.Update, Delete, One, All, Values and PrepareInsert, QueryM2Mer and RawSeter.
+//
+//	func (u *User) BeforeInsert(ctx context.Context, o orm.Ormer) error {
+//		u.Created = time.Now()
+//		u.Slug = slugify(u.Name)
+//		return nil
+//	}
+//
+//	func (u *User) AfterDelete(ctx context.Context, o orm.Ormer) error {
+//		_, err := o.Insert(&AuditLog{Action: "delete", UserId: u.Id})
+//		return err
+//	}
+
+// BeforeInserter is called by Ormer.Insert before the model is inserted.
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context, o Ormer) error
+}
+
+// AfterInserter is called by Ormer.Insert after the model is inserted, its auto pk is set.
+type AfterInserter interface {
+	AfterInsert(ctx context.Context, o Ormer) error
+}
+
+// BeforeUpdater is called by Ormer.Update before the model is updated.
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context, o Ormer) error
+}
+
+// AfterUpdater is called by Ormer.Update after the model is updated.
+type AfterUpdater interface {
+	AfterUpdate(ctx context.Context, o Ormer) error
+}
+
+// BeforeDeleter is called by Ormer.Delete before the model is deleted.
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context, o Ormer) error
+}
+
+// AfterDeleter is called by Ormer.Delete after the model is deleted, before its auto pk is reset.
+// The pk is reset even if AfterDelete returns an error, the row being deleted.
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context, o Ormer) error
+}
+
+// AfterReader is called by Ormer.Read after the model is read.
+type AfterReader interface {
+	AfterRead(ctx context.Context, o Ormer) error
+}
+
+// modelHook is a set of the hooks of a model.
+type modelHook uint8
+
+const (
+	hookBeforeInsert modelHook = 1 << iota
+	hookAfterInsert
+	hookBeforeUpdate
+	hookAfterUpdate
+	hookBeforeDelete
+	hookAfterDelete
+	hookAfterRead
+)
+
+var hookTypes = map[modelHook]reflect.Type{
+	hookBeforeInsert: reflect.TypeOf((*BeforeInserter)(nil)).Elem(),
+	hookAfterInsert:  reflect.TypeOf((*AfterInserter)(nil)).Elem(),
+	hookBeforeUpdate: reflect.TypeOf((*BeforeUpdater)(nil)).Elem(),
+	hookAfterUpdate:  reflect.TypeOf((*AfterUpdater)(nil)).Elem(),
+	hookBeforeDelete: reflect.TypeOf((*BeforeDeleter)(nil)).Elem(),
+	hookAfterDelete:  reflect.TypeOf((*AfterDeleter)(nil)).Elem(),
+	hookAfterRead:    reflect.TypeOf((*AfterReader)(nil)).Elem(),
+}
+
+// modelHooks returns the hooks implemented by the pointer type typ.
+func modelHooks(typ reflect.Type) modelHook {
+	var hooks modelHook
+	for h, iface := range hookTypes {
+		if typ.Implements(iface) {
+			hooks |= h
+		}
+	}
+	return hooks
+}
+
+// context returns the context of the hooks.
+func (o *orm) context() context.Context {
+	if o.ctx != nil {
+		return o.ctx
+	}
+	return context.Background()
+}
+
+// hook calls the hook h of md if its model has it.
+func (o *orm) hook(mi *modelInfo, h modelHook, md interface{}) error {
+	if mi.hooks&h == 0 {
+		return nil
+	}
+	ctx := o.context()
+	var err error
+	switch h {
+	case hookBeforeInsert:
+		err = md.(BeforeInserter).BeforeInsert(ctx, o)
+	case hookAfterInsert:
+		err = md.(AfterInserter).AfterInsert(ctx, o)
+	case hookBeforeUpdate:
+		err = md.(BeforeUpdater).BeforeUpdate(ctx, o)
+	case hookAfterUpdate:
+		err = md.(AfterUpdater).AfterUpdate(ctx, o)
+	case hookBeforeDelete:
+		err = md.(BeforeDeleter).BeforeDelete(ctx, o)
+	case hookAfterDelete:
+		err = md.(AfterDeleter).AfterDelete(ctx, o)
+	case hookAfterRead:
+		err = md.(AfterReader).AfterRead(ctx, o)
+	}
+	return err
+}
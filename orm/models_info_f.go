@@ -26,6 +26,7 @@ var errSkipField = errors.New("skip field")
 // field info collection
 type fields struct {
 	pk            *fieldInfo
+	softDelete    *fieldInfo
 	columns       map[string]*fieldInfo
 	fields        map[string]*fieldInfo
 	fieldsLow     map[string]*fieldInfo
@@ -136,6 +137,7 @@ type fieldInfo struct {
 	decimals            int
 	isFielder           bool // implement Fielder interface
 	onDelete            string
+	softDelete          bool // marks the rows deleted instead of removing them
 	description         string
 }
 
@@ -427,6 +429,27 @@ checkType:
 		fi.index = false
 	}
 
+	if attrs["soft_delete"] {
+		switch fieldType {
+		case TypeBooleanField:
+		case TypeDateField, TypeDateTimeField:
+			if fi.autoNow || fi.autoNowAdd {
+				err = fmt.Errorf("soft_delete can not be set with auto_now or auto_now_add")
+				goto end
+			}
+			fi.null = true
+		default:
+			err = fmt.Errorf("soft_delete only allow bool and time.Time fields")
+			goto end
+		}
+		if fi.pk || fi.unique {
+			err = fmt.Errorf("soft_delete can not be set on a pk or unique field")
+			goto end
+		}
+		fi.softDelete = true
+		fi.index = true
+	}
+
 	// can not set default for these type
 	if fi.auto || fi.pk || fi.unique || fieldType == TypeTimeField || fieldType == TypeDateField || fieldType == TypeDateTimeField {
 		initial.Clear()
@@ -32,6 +32,7 @@ type modelInfo struct {
 	addrField reflect.Value //store the original struct value
 	uniques   []string
 	isThrough bool
+	hooks     modelHook
 }
 
 // new model info
@@ -42,6 +43,7 @@ func newModelInfo(val reflect.Value) (mi *modelInfo) {
 	mi.addrField = val
 	mi.name = ind.Type().Name()
 	mi.fullName = getFullName(ind.Type())
+	mi.hooks = modelHooks(reflect.PtrTo(ind.Type()))
 	addModelFields(mi, ind, "", []int{})
 	return
 }
@@ -91,6 +93,14 @@ func addModelFields(mi *modelInfo, ind reflect.Value, mName string, index []int)
 				mi.fields.pk = fi
 			}
 		}
+		if fi.softDelete {
+			if mi.fields.softDelete != nil {
+				err = fmt.Errorf("one model must have one soft_delete field only")
+				break
+			} else {
+				mi.fields.softDelete = fi
+			}
+		}
 	}
 
 	if err != nil {
@@ -15,6 +15,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -411,6 +412,69 @@ type PtrPk struct {
 	Positive bool
 }
 
+// Hook records the calls of its model hooks in Calls, and fails the one named by Fail.
+type Hook struct {
+	ID    int
+	Name  string          `orm:"size(30)"`
+	Slug  string          `orm:"size(30)"`
+	Calls []string        `orm:"-"`
+	Fail  string          `orm:"-"`
+	Ctx   context.Context `orm:"-"`
+}
+
+func (h *Hook) call(ctx context.Context, name string) error {
+	h.Calls = append(h.Calls, name)
+	h.Ctx = ctx
+	if h.Fail == name {
+		return fmt.Errorf("%s failed", name)
+	}
+	return nil
+}
+
+func (h *Hook) BeforeInsert(ctx context.Context, o Ormer) error {
+	h.Slug = strings.ToLower(h.Name)
+	return h.call(ctx, "BeforeInsert")
+}
+
+func (h *Hook) AfterInsert(ctx context.Context, o Ormer) error {
+	return h.call(ctx, fmt.Sprintf("AfterInsert %d", h.ID))
+}
+
+func (h *Hook) BeforeUpdate(ctx context.Context, o Ormer) error {
+	h.Slug = strings.ToLower(h.Name)
+	return h.call(ctx, "BeforeUpdate")
+}
+
+func (h *Hook) AfterUpdate(ctx context.Context, o Ormer) error {
+	return h.call(ctx, "AfterUpdate")
+}
+
+func (h *Hook) BeforeDelete(ctx context.Context, o Ormer) error {
+	return h.call(ctx, "BeforeDelete")
+}
+
+func (h *Hook) AfterDelete(ctx context.Context, o Ormer) error {
+	return h.call(ctx, fmt.Sprintf("AfterDelete %d", h.ID))
+}
+
+func (h *Hook) AfterRead(ctx context.Context, o Ormer) error {
+	return h.call(ctx, "AfterRead")
+}
+
+// SoftUser is soft deleted at a time, SoftPost with a bool.
+type SoftUser struct {
+	ID      int
+	Name    string     `orm:"size(30)"`
+	Deleted *time.Time `orm:"soft_delete"`
+}
+
+type SoftPost struct {
+	ID     int
+	Title  string    `orm:"size(30)"`
+	User   *SoftUser `orm:"rel(fk)"`
+	Hidden bool      `orm:"soft_delete"`
+}
+
 var DBARGS = struct {
 	Driver string
 	Source string
@@ -94,6 +94,7 @@ type orm struct {
 	alias *alias
 	db    dbQuerier
 	isTx  bool
+	ctx   context.Context // context of the transaction, given to the model hooks
 }
 
 var _ Ormer = new(orm)
@@ -125,13 +126,19 @@ func (o *orm) getFieldInfo(mi *modelInfo, name string) *fieldInfo {
 // read data to model
 func (o *orm) Read(md interface{}, cols ...string) error {
 	mi, ind := o.getMiInd(md, true)
-	return o.alias.DbBaser.Read(o.db, mi, ind, o.alias.TZ, cols, false)
+	if err := o.alias.DbBaser.Read(o.db, mi, ind, o.alias.TZ, cols, false); err != nil {
+		return err
+	}
+	return o.hook(mi, hookAfterRead, md)
 }
 
 // read data to model, like Read(), but use "SELECT FOR UPDATE" form
 func (o *orm) ReadForUpdate(md interface{}, cols ...string) error {
 	mi, ind := o.getMiInd(md, true)
-	return o.alias.DbBaser.Read(o.db, mi, ind, o.alias.TZ, cols, true)
+	if err := o.alias.DbBaser.Read(o.db, mi, ind, o.alias.TZ, cols, true); err != nil {
+		return err
+	}
+	return o.hook(mi, hookAfterRead, md)
 }
 
 // Try to read a row from the database, or insert one if it doesn't exist
@@ -144,6 +151,9 @@ func (o *orm) ReadOrCreate(md interface{}, col1 string, cols ...string) (bool, i
 		id, err := o.Insert(md)
 		return (err == nil), id, err
 	}
+	if err == nil {
+		err = o.hook(mi, hookAfterRead, md)
+	}
 
 	id, vid := int64(0), ind.FieldByIndex(mi.fields.pk.fieldIndex)
 	if mi.fields.pk.fieldType&IsPositiveIntegerField > 0 {
@@ -160,6 +170,9 @@ func (o *orm) ReadOrCreate(md interface{}, col1 string, cols ...string) (bool, i
 // insert model data to database
 func (o *orm) Insert(md interface{}) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
+	if err := o.hook(mi, hookBeforeInsert, md); err != nil {
+		return 0, err
+	}
 	id, err := o.alias.DbBaser.Insert(o.db, mi, ind, o.alias.TZ)
 	if err != nil {
 		return id, err
@@ -167,7 +180,7 @@ func (o *orm) Insert(md interface{}) (int64, error) {
 
 	o.setPk(mi, ind, id)
 
-	return id, nil
+	return id, o.hook(mi, hookAfterInsert, md)
 }
 
 // set auto pk field
@@ -233,21 +246,39 @@ func (o *orm) InsertOrUpdate(md interface{}, colConflitAndArgs ...string) (int64
 // cols set the columns those want to update.
 func (o *orm) Update(md interface{}, cols ...string) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
-	return o.alias.DbBaser.Update(o.db, mi, ind, o.alias.TZ, cols)
+	if err := o.hook(mi, hookBeforeUpdate, md); err != nil {
+		return 0, err
+	}
+	num, err := o.alias.DbBaser.Update(o.db, mi, ind, o.alias.TZ, cols)
+	if err != nil {
+		return num, err
+	}
+	return num, o.hook(mi, hookAfterUpdate, md)
 }
 
 // delete model in database
 // cols shows the delete conditions values read from. default is pk
 func (o *orm) Delete(md interface{}, cols ...string) (int64, error) {
 	mi, ind := o.getMiInd(md, true)
+	if err := o.hook(mi, hookBeforeDelete, md); err != nil {
+		return 0, err
+	}
+	if mi.fields.softDelete != nil {
+		num, err := o.softDelete(mi, ind, cols)
+		if err != nil {
+			return num, err
+		}
+		return num, o.hook(mi, hookAfterDelete, md)
+	}
 	num, err := o.alias.DbBaser.Delete(o.db, mi, ind, o.alias.TZ, cols)
 	if err != nil {
 		return num, err
 	}
+	err = o.hook(mi, hookAfterDelete, md)
 	if num > 0 {
 		o.setPk(mi, ind, 0)
 	}
-	return num, nil
+	return num, err
 }
 
 // create a models to models queryer
@@ -474,6 +505,7 @@ func (o *orm) BeginTx(ctx context.Context, opts *sql.TxOptions) error {
 		return err
 	}
 	o.isTx = true
+	o.ctx = ctx
 	if Debug {
 		o.db.(*dbQueryLog).SetDB(tx)
 	} else {
@@ -490,6 +522,7 @@ func (o *orm) Commit() error {
 	err := o.db.(txEnder).Commit()
 	if err == nil {
 		o.isTx = false
+		o.ctx = nil
 		o.Using(o.alias.Name)
 	} else if err == sql.ErrTxDone {
 		return ErrTxDone
@@ -505,6 +538,7 @@ func (o *orm) Rollback() error {
 	err := o.db.(txEnder).Rollback()
 	if err == nil {
 		o.isTx = false
+		o.ctx = nil
 		o.Using(o.alias.Name)
 	} else if err == sql.ErrTxDone {
 		return ErrTxDone
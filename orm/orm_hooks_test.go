@@ -0,0 +1,84 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// bootTestModels registers models only and creates their tables, so that a test
+// does not depend on TestSyncDb and TestRegisterModels of orm_test.go, which run
+// after it. The test cleans the model cache when it ends for them.
+func bootTestModels(t *testing.T, models ...interface{}) Ormer {
+	modelCache.clean()
+	RegisterModel(models...)
+	throwFailNow(t, RunSyncdb("default", true, Debug))
+	return NewOrm()
+}
+
+func TestHooks(t *testing.T) {
+	o := bootTestModels(t, new(Hook))
+	defer modelCache.clean()
+
+	h := &Hook{Name: "Hello"}
+	id, err := o.Insert(h)
+	throwFail(t, err)
+	throwFail(t, AssertIs(h.Slug, "hello"))
+	throwFail(t, AssertIs(strings.Join(h.Calls, ","), fmt.Sprintf("BeforeInsert,AfterInsert %d", id)))
+
+	r := &Hook{ID: h.ID}
+	throwFail(t, o.Read(r))
+	throwFail(t, AssertIs(r.Slug, "hello"))
+	throwFail(t, AssertIs(strings.Join(r.Calls, ","), "AfterRead"))
+
+	// a Before hook error aborts the operation
+	r.Name, r.Fail = "World", "BeforeUpdate"
+	num, err := o.Update(r)
+	throwFail(t, AssertIs(err != nil && num == 0, true))
+	r = &Hook{ID: h.ID}
+	throwFail(t, o.Read(r))
+	throwFail(t, AssertIs(r.Name, "Hello"))
+
+	// an After hook error leaves the transaction to the caller
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "tx")
+	tx := NewOrm()
+	throwFail(t, tx.BeginTx(ctx, nil))
+	failed := &Hook{Name: "Rollback", Fail: fmt.Sprintf("AfterInsert %d", id+1)}
+	_, err = tx.Insert(failed)
+	throwFail(t, AssertIs(err != nil, true))
+	throwFail(t, AssertIs(failed.Ctx.Value(key{}), "tx"))
+	throwFail(t, AssertIs(tx.QueryTable("hook").Filter("name", "Rollback").Exist(), true))
+	throwFail(t, tx.Rollback())
+	throwFail(t, AssertIs(o.QueryTable("hook").Filter("name", "Rollback").Exist(), false))
+
+	num, err = o.Delete(r)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(strings.Join(r.Calls, ","), fmt.Sprintf("AfterRead,BeforeDelete,AfterDelete %d", id)))
+	throwFail(t, AssertIs(r.ID, 0))
+
+	// an AfterDelete error still resets the pk of the deleted row
+	d := &Hook{Name: "Deleted"}
+	id, err = o.Insert(d)
+	throwFail(t, err)
+	d.Fail = fmt.Sprintf("AfterDelete %d", id)
+	num, err = o.Delete(d)
+	throwFail(t, AssertIs(err != nil && num == 1, true))
+	throwFail(t, AssertIs(d.ID, 0))
+}
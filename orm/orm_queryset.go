@@ -16,6 +16,7 @@ package orm
 
 import (
 	"fmt"
+	"time"
 )
 
 type colValue struct {
@@ -65,6 +66,7 @@ type querySet struct {
 	orders    []string
 	distinct  bool
 	forupdate bool
+	scope     int
 	orm       *orm
 }
 
@@ -134,6 +136,18 @@ func (o querySet) ForUpdate() QuerySeter {
 	return &o
 }
 
+// query the soft deleted rows too.
+func (o querySet) Unscoped() QuerySeter {
+	o.scope = scopeUnscoped
+	return &o
+}
+
+// query the soft deleted rows only.
+func (o querySet) OnlyDeleted() QuerySeter {
+	o.scope = scopeOnlyDeleted
+	return &o
+}
+
 // set relation model to query together.
 // it will query relation models and assign to parent model.
 func (o querySet) RelatedSel(params ...interface{}) QuerySeter {
@@ -167,23 +181,31 @@ func (o querySet) GetCond() *Condition {
 
 // return QuerySeter execution result number
 func (o *querySet) Count() (int64, error) {
-	return o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.scopedCond(), o.orm.alias.TZ)
 }
 
 // check result empty or not after QuerySeter executed
 func (o *querySet) Exist() bool {
-	cnt, _ := o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	cnt, _ := o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.scopedCond(), o.orm.alias.TZ)
 	return cnt > 0
 }
 
 // execute update with parameters
 func (o *querySet) Update(values Params) (int64, error) {
-	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.cond, values, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.scopedCond(), values, o.orm.alias.TZ)
 }
 
-// execute delete
+// execute delete, the rows of a soft deleted model are marked deleted unless it is unscoped
 func (o *querySet) Delete() (int64, error) {
-	return o.orm.alias.DbBaser.DeleteBatch(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	if o.mi.fields.softDelete != nil && o.scope == scopeAlive {
+		return o.markDeleted(time.Now())
+	}
+	return o.orm.alias.DbBaser.DeleteBatch(o.orm.db, o, o.mi, o.scopedCond(), o.orm.alias.TZ)
+}
+
+// restore the soft deleted rows
+func (o *querySet) Restore() (int64, error) {
+	return o.restore()
 }
 
 // return a insert queryer.
@@ -198,7 +220,7 @@ func (o *querySet) PrepareInsert() (Inserter, error) {
 // query all data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) All(container interface{}, cols ...string) (int64, error) {
-	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.scopedCond(), container, o.orm.alias.TZ, cols)
 	if num == 0 {
 		return 0, ErrNoRows
 	}
@@ -209,7 +231,7 @@ func (o *querySet) All(container interface{}, cols ...string) (int64, error) {
 // cols means the columns when querying.
 func (o *querySet) One(container interface{}, cols ...string) error {
 	o.limit = 1
-	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.scopedCond(), container, o.orm.alias.TZ, cols)
 	if err != nil {
 		return err
 	}
@@ -227,19 +249,19 @@ func (o *querySet) One(container interface{}, cols ...string) error {
 // expres means condition expression.
 // it converts data to []map[column]value.
 func (o *querySet) Values(results *[]Params, exprs ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.scopedCond(), exprs, results, o.orm.alias.TZ)
 }
 
 // query all data and map to [][]interface
 // it converts data to [][column_index]value
 func (o *querySet) ValuesList(results *[]ParamsList, exprs ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.scopedCond(), exprs, results, o.orm.alias.TZ)
 }
 
 // query all data and map to []interface.
 // it's designed for one row record set, auto change to []value, not [][column]value.
 func (o *querySet) ValuesFlat(result *ParamsList, expr string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, []string{expr}, result, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.scopedCond(), []string{expr}, result, o.orm.alias.TZ)
 }
 
 // query all rows into map[string]interface with specify key and value column name.
@@ -0,0 +1,109 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"testing"
+)
+
+func TestSoftDelete(t *testing.T) {
+	o := bootTestModels(t, new(SoftUser), new(SoftPost), new(Hook))
+	defer modelCache.clean()
+
+	one, two := &SoftUser{Name: "one"}, &SoftUser{Name: "two"}
+	for _, u := range []*SoftUser{one, two} {
+		_, err := o.Insert(u)
+		throwFail(t, err)
+	}
+	for _, p := range []*SoftPost{{Title: "a", User: one}, {Title: "b", User: two}, {Title: "c", User: one}} {
+		_, err := o.Insert(p)
+		throwFail(t, err)
+	}
+
+	num, err := o.Delete(two)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(two.Deleted != nil && two.ID != 0, true))
+	throwFail(t, AssertIs(o.Read(&SoftUser{ID: two.ID}), ErrNoRows))
+
+	users := o.QueryTable("soft_user")
+	num, err = users.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = users.Unscoped().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	var deleted SoftUser
+	throwFail(t, users.OnlyDeleted().One(&deleted))
+	throwFail(t, AssertIs(deleted.Name, "two"))
+	throwFail(t, AssertIs(deleted.Deleted != nil, true))
+
+	// the joins skip the deleted users
+	posts := o.QueryTable("soft_post")
+	var list []*SoftPost
+	num, err = posts.RelatedSel().OrderBy("id").All(&list)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 3))
+	throwFail(t, AssertIs(list[0].User.Name, "one"))
+	throwFail(t, AssertIs(list[1].User.Name, ""))
+	throwFail(t, AssertIs(posts.Filter("user__name", "two").Exist(), false))
+	throwFail(t, AssertIs(posts.Unscoped().Filter("user__name", "two").Exist(), true))
+
+	num, err = posts.Filter("user", one).Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = posts.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = posts.Restore()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = posts.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 3))
+
+	num, err = users.Filter("id", two.ID).Restore()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	restored := &SoftUser{ID: two.ID}
+	throwFail(t, o.Read(restored))
+	throwFail(t, AssertIs(restored.Deleted == nil, true))
+
+	// unscoped deletes remove the rows
+	num, err = posts.Unscoped().Filter("user", two).Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = posts.Unscoped().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+
+	// the on_delete cascade of the posts is not applied to a soft deleted user,
+	// only to a removed one
+	num, err = o.Delete(one)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = posts.Unscoped().Filter("user", one.ID).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = users.Unscoped().Filter("id", one.ID).Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = posts.Unscoped().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+
+	_, err = o.QueryTable("hook").Restore()
+	throwFail(t, AssertIs(err != nil, true))
+}
@@ -197,6 +197,8 @@ func TestSyncDb(t *testing.T) {
 	RegisterModel(new(IntegerPk))
 	RegisterModel(new(UintPk))
 	RegisterModel(new(PtrPk))
+	RegisterModel(new(Hook))
+	RegisterModel(new(SoftUser), new(SoftPost))
 
 	err := RunSyncdb("default", true, Debug)
 	throwFail(t, err)
@@ -221,6 +223,8 @@ func TestRegisterModels(t *testing.T) {
 	RegisterModel(new(IntegerPk))
 	RegisterModel(new(UintPk))
 	RegisterModel(new(PtrPk))
+	RegisterModel(new(Hook))
+	RegisterModel(new(SoftUser), new(SoftPost))
 
 	BootStrap()
 
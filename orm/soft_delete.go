@@ -0,0 +1,151 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package orm
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// The rows of a model with a soft_delete field, a bool or a nullable time.Time, are
+// marked deleted instead of being removed by Ormer.Delete and QuerySeter.Delete.
+// Ormer.Read, the QuerySeter and the joins of RelatedSel and the filters on relations
+// skip the deleted rows, a relation selected by RelatedSel to a deleted row is left
+// empty. QuerySeter.Unscoped and OnlyDeleted change the rows seen by a QuerySeter,
+// QuerySeter.Restore brings the deleted rows back.
+//
+// The rows related to a soft deleted row are left as they are, so that it can be restored
+// with them: the on_delete of the relations, such as cascade or set_null, only applies
+// when the row is removed by an unscoped QuerySeter.Delete.
+//
+//	type Post struct {
+//		Id      int
+//		Title   string
+//		Deleted *time.Time `orm:"soft_delete"`
+//	}
+//
+//	o.Delete(&Post{Id: 1})                                       // sets Deleted
+//	o.QueryTable("post").OnlyDeleted().Filter("id", 1).Restore() // clears Deleted
+//	o.QueryTable("post").Unscoped().Filter("id", 1).Delete()     // removes the row
+
+// query scopes of a soft deleted model
+const (
+	scopeAlive = iota
+	scopeUnscoped
+	scopeOnlyDeleted
+)
+
+// scoped reports whether the query skips the soft deleted rows of the joined tables.
+func (o *querySet) scoped() bool {
+	return o != nil && o.scope == scopeAlive
+}
+
+// scopedCond returns the condition of the query restricted to the rows of its scope.
+func (o *querySet) scopedCond() *Condition {
+	fi := o.mi.fields.softDelete
+	if fi == nil || o.scope == scopeUnscoped {
+		return o.cond
+	}
+	deleted := o.scope == scopeOnlyDeleted
+	cond := NewCondition()
+	if fi.fieldType == TypeBooleanField {
+		cond = cond.And(fi.name, deleted)
+	} else {
+		cond = cond.And(fi.name+ExprSep+"isnull", !deleted)
+	}
+	if o.cond != nil && !o.cond.IsEmpty() {
+		cond = cond.AndCond(o.cond)
+	}
+	return cond
+}
+
+// markDeleted sets the soft_delete field of the rows of the query, to now for a time field.
+func (o *querySet) markDeleted(now time.Time) (int64, error) {
+	fi := o.mi.fields.softDelete
+	var value interface{} = true
+	if fi.fieldType != TypeBooleanField {
+		value = getFlatParams(fi, []interface{}{now}, o.orm.alias.TZ)[0]
+	}
+	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.scopedCond(), Params{fi.name: value}, o.orm.alias.TZ)
+}
+
+// softDelete marks the row of ind deleted, matched by the pk or by cols as dbBase.Delete does.
+func (o *orm) softDelete(mi *modelInfo, ind reflect.Value, cols []string) (int64, error) {
+	if len(cols) == 0 {
+		if _, _, ok := getExistPk(mi, ind); !ok {
+			return 0, ErrMissPK
+		}
+		cols = []string{mi.fields.pk.name}
+	}
+	qs := newQuerySet(o, mi).(*querySet)
+	qs.cond = NewCondition()
+	for _, col := range cols {
+		fi := o.getFieldInfo(mi, col)
+		qs.cond = qs.cond.And(fi.name, ind.FieldByIndex(fi.fieldIndex).Interface())
+	}
+	now := time.Now()
+	num, err := qs.markDeleted(now)
+	if err == nil && num > 0 {
+		setDeleted(mi.fields.softDelete, ind, now)
+	}
+	return num, err
+}
+
+// setDeleted sets the soft_delete field fi of ind as markDeleted did in the table.
+func setDeleted(fi *fieldInfo, ind reflect.Value, now time.Time) {
+	field := ind.FieldByIndex(fi.fieldIndex)
+	typ := field.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	var value reflect.Value
+	if fi.fieldType == TypeBooleanField {
+		value = reflect.ValueOf(true).Convert(typ)
+	} else {
+		value = reflect.ValueOf(now).Convert(typ)
+	}
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(typ)
+		ptr.Elem().Set(value)
+		value = ptr
+	}
+	field.Set(value)
+}
+
+// restore clears the soft_delete field of the deleted rows of the query.
+func (o *querySet) restore() (int64, error) {
+	fi := o.mi.fields.softDelete
+	if fi == nil {
+		return 0, fmt.Errorf("<QuerySeter.Restore> model `%s` has no soft_delete field", o.mi.fullName)
+	}
+	var value interface{}
+	if fi.fieldType == TypeBooleanField {
+		value = false
+	}
+	qs := *o
+	qs.scope = scopeOnlyDeleted
+	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, &qs, o.mi, qs.scopedCond(), Params{fi.name: value}, o.orm.alias.TZ)
+}
+
+// aliveSQL returns the SQL condition of the rows of a table not soft deleted by fi,
+// prefix being the alias of the table with its dot.
+func aliveSQL(fi *fieldInfo, Q, prefix string) string {
+	col := prefix + Q + fi.column + Q
+	if fi.fieldType == TypeBooleanField {
+		return "NOT " + col
+	}
+	return col + " IS NULL"
+}
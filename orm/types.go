@@ -75,6 +75,8 @@ type Ormer interface {
 	//	num, err = Ormer.Update(&user, "Langs", "Extra")
 	Update(md interface{}, cols ...string) (int64, error)
 	// delete model in database
+	// a model with a soft_delete field is marked deleted and keeps its pk,
+	// the on_delete of its relations applies once the row is removed
 	Delete(md interface{}, cols ...string) (int64, error)
 	// load related models to md model.
 	// args are limit, offset int and order string.
@@ -206,6 +208,15 @@ type QuerySeter interface {
 	// for example:
 	//  o.QueryTable("user").Filter("uid", uid).ForUpdate().All(&users)
 	ForUpdate() QuerySeter
+	// query the soft deleted rows too, Delete removes them from the table.
+	// for example:
+	//	qs.Unscoped().Filter("id", 1).One(&post)
+	//	num, err = qs.Unscoped().Filter("deleted__lt", monthAgo).Delete()
+	Unscoped() QuerySeter
+	// query the soft deleted rows only, Delete removes them from the table.
+	// for example:
+	//	num, err = qs.OnlyDeleted().Count()
+	OnlyDeleted() QuerySeter
 	// return QuerySeter execution result number
 	// for example:
 	//	num, err = qs.Filter("profile__age__gt", 28).Count()
@@ -226,7 +237,12 @@ type QuerySeter interface {
 	//for example:
 	//	num ,err = qs.Filter("user_name__in", "testing1", "testing2").Delete()
 	// 	//delete two user  who's name is testing1 or testing2
+	// the rows of a model with a soft_delete field are marked deleted
 	Delete() (int64, error)
+	// restore the soft deleted rows, the model must have a soft_delete field
+	// for example:
+	//	num, err = qs.Filter("id", 1).Restore()
+	Restore() (int64, error)
 	// return a insert queryer.
 	// it can be used in times.
 	// example:
@@ -0,0 +1,390 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package csrf provides a filter protecting routes against cross-site request forgery.
+// Unlike EnableXSRF it runs per route or namespace, and supports AJAX and JSON APIs.
+// Usage:
+//	import(
+//		"github.com/izi-global/izigo"
+//		"github.com/izi-global/izigo/plugins/csrf"
+//	)
+//
+//	func main(){
+//		// stateless double-submit cookie for a single page app,
+//		// the app sends the "_csrf" cookie back in the X-CSRF-Token header
+//		izigo.InsertFilter("/api/*", izigo.BeforeRouter, csrf.New(nil).FilterFunc())
+//
+//		// synchronizer token stored in the session, for server rendered forms
+//		ns := izigo.NewNamespace("/account",
+//			izigo.NSBefore(csrf.New(&csrf.Options{Mode: csrf.ModeSession}).FilterFunc()),
+//		)
+//		izigo.AddNamespace(ns)
+//		izigo.Run()
+//	}
+//
+// In templates, {{csrf_field .}} writes the hidden input of the form,
+// and {{.CSRFToken}} the token itself, for a meta tag read by scripts.
+//
+// Unsafe methods (all but GET, HEAD, OPTIONS and TRACE) must send the token
+// in a header of Options.HeaderNames or in the form field Options.FieldName.
+// Their Origin header, or Referer when Origin is absent, must match the site
+// or one of Options.TrustedOrigins.
+//
+// Requests authenticated by a bearer token are exempted by default,
+// as browsers never send such a token on their own, see Options.Exempt.
+//
+// Failures are reported through the 403 error handler. The reason is set in
+// the X-CSRF-Reason response header and in the "CSRFReason" data of the context,
+// so that an error controller can show it.
+package csrf
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/context"
+	"github.com/izi-global/izigo/logs"
+	"github.com/izi-global/izigo/utils/cookie"
+	"github.com/izi-global/izigo/utils/keyring"
+)
+
+// Mode is the way tokens are stored.
+type Mode int
+
+const (
+	// ModeDoubleSubmit stores the token in a signed cookie,
+	// the request must send the cookie value back. It is stateless.
+	ModeDoubleSubmit Mode = iota
+	// ModeSession stores the token in the session, and sends a
+	// differently masked token on every request.
+	ModeSession
+)
+
+// Reasons of failures.
+const (
+	ReasonMissingToken = "missing_token"
+	ReasonInvalidToken = "invalid_token"
+	ReasonBadOrigin    = "bad_origin"
+	ReasonNoSession    = "no_session"
+)
+
+const (
+	// ReasonHeader is the response header carrying the reason of a failure.
+	ReasonHeader = "X-CSRF-Reason"
+	// ReasonKey is the context data key of the reason of a failure.
+	ReasonKey = "CSRFReason"
+	// TokenKey is the context data key of the token.
+	TokenKey = "CSRFToken"
+	// FieldNameKey is the context data key of the form field name.
+	FieldNameKey = "CSRFFieldName"
+
+	tokenLen = 32
+)
+
+var errNoSession = errors.New("csrf: session is not started")
+
+// Options represents the csrf settings.
+type Options struct {
+	Mode Mode
+	// Name of the double-submit cookie, default "_csrf".
+	CookieName string
+	// Attributes of the double-submit cookie, default SameSite=Lax on "/".
+	// It is not HttpOnly so that scripts can read it.
+	Cookie *cookie.Options
+	// Keyring signing the double-submit cookie, default izigo.CookieKeyring().
+	Keyring *keyring.Keyring
+	// Session key of the synchronizer token, default "_csrf".
+	SessionKey string
+	// Request headers carrying the token, default X-CSRF-Token, X-Xsrftoken and X-Csrftoken.
+	HeaderNames []string
+	// Form field carrying the token, default "_csrf".
+	FieldName string
+	// Origins allowed besides the site itself, such as "https://app.izi.asia".
+	TrustedOrigins []string
+	// Disable the Origin and Referer verification.
+	SkipOriginCheck bool
+	// Exempt returns whether the request is not checked.
+	// Default exempts requests with a bearer Authorization header.
+	Exempt func(ctx *context.Context) bool
+}
+
+// CSRF checks the tokens and origins of requests.
+type CSRF struct {
+	opts    Options
+	origins map[string]bool
+}
+
+// New returns a CSRF with opts, which may be nil to use the defaults.
+func New(opts *Options) *CSRF {
+	c := &CSRF{origins: make(map[string]bool)}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.CookieName == "" {
+		c.opts.CookieName = "_csrf"
+	}
+	if c.opts.Cookie == nil {
+		c.opts.Cookie = &cookie.Options{SameSite: cookie.SameSiteLax}
+	}
+	if c.opts.SessionKey == "" {
+		c.opts.SessionKey = "_csrf"
+	}
+	if len(c.opts.HeaderNames) == 0 {
+		c.opts.HeaderNames = []string{"X-CSRF-Token", "X-Xsrftoken", "X-Csrftoken"}
+	}
+	if c.opts.FieldName == "" {
+		c.opts.FieldName = "_csrf"
+	}
+	if c.opts.Exempt == nil {
+		c.opts.Exempt = ExemptBearer
+	}
+	for _, o := range c.opts.TrustedOrigins {
+		o = strings.TrimSuffix(o, "/")
+		if u, err := url.Parse(o); err == nil && u.Host != "" {
+			o = originKey(u)
+		}
+		c.origins[strings.ToLower(o)] = true
+	}
+	return c
+}
+
+// ExemptBearer exempts requests authenticated by a bearer token.
+func ExemptBearer(ctx *context.Context) bool {
+	auth := ctx.Input.Header("Authorization")
+	return len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ")
+}
+
+// FilterFunc returns the izigo filter, insert it at izigo.BeforeRouter
+// or use it as a namespace before filter.
+func (c *CSRF) FilterFunc() izigo.FilterFunc {
+	return func(ctx *context.Context) {
+		if !safeMethod(ctx.Input.Method()) {
+			if c.opts.Exempt(ctx) {
+				return
+			}
+			if reason := c.check(ctx); reason != "" {
+				fail(ctx, reason)
+				return
+			}
+		}
+		token, err := c.Token(ctx)
+		if err != nil {
+			fail(ctx, ReasonNoSession)
+			return
+		}
+		ctx.Input.SetData(TokenKey, token)
+		ctx.Input.SetData(FieldNameKey, c.opts.FieldName)
+	}
+}
+
+// Token returns the token to send with the next unsafe request,
+// creating the cookie or the session value if needed.
+func (c *CSRF) Token(ctx *context.Context) (string, error) {
+	if token, ok := ctx.Input.GetData(TokenKey).(string); ok {
+		return token, nil
+	}
+	if c.opts.Mode == ModeSession {
+		if ctx.Input.CruSession == nil {
+			return "", errNoSession
+		}
+		raw := c.sessionToken(ctx)
+		if raw == nil {
+			raw = randomToken()
+			if err := ctx.Input.CruSession.Set(c.opts.SessionKey, encode(raw)); err != nil {
+				return "", err
+			}
+		}
+		return mask(raw), nil
+	}
+	if v := ctx.Input.Cookie(c.opts.CookieName); c.validCookie(v) {
+		return v, nil
+	}
+	raw := randomToken()
+	v := encode(raw) + "." + encode(c.keyring().Sign(raw))
+	if err := ctx.Output.CookieWithOptions(c.opts.CookieName, v, c.opts.Cookie); err != nil {
+		return "", err
+	}
+	return v, nil
+}
+
+func (c *CSRF) check(ctx *context.Context) string {
+	if !c.opts.SkipOriginCheck && !c.validOrigin(ctx) {
+		return ReasonBadOrigin
+	}
+	submitted := c.submitted(ctx)
+	if submitted == "" {
+		return ReasonMissingToken
+	}
+	if c.opts.Mode == ModeSession {
+		if ctx.Input.CruSession == nil {
+			return ReasonNoSession
+		}
+		raw := c.sessionToken(ctx)
+		if raw == nil || subtle.ConstantTimeCompare(unmask(submitted), raw) != 1 {
+			return ReasonInvalidToken
+		}
+		return ""
+	}
+	v := ctx.Input.Cookie(c.opts.CookieName)
+	if !c.validCookie(v) || subtle.ConstantTimeCompare([]byte(submitted), []byte(v)) != 1 {
+		return ReasonInvalidToken
+	}
+	return ""
+}
+
+func (c *CSRF) submitted(ctx *context.Context) string {
+	for _, h := range c.opts.HeaderNames {
+		if v := ctx.Input.Header(h); v != "" {
+			return v
+		}
+	}
+	return ctx.Input.Query(c.opts.FieldName)
+}
+
+func (c *CSRF) sessionToken(ctx *context.Context) []byte {
+	v, ok := ctx.Input.CruSession.Get(c.opts.SessionKey).(string)
+	if !ok {
+		return nil
+	}
+	raw, err := decode(v)
+	if err != nil || len(raw) != tokenLen {
+		return nil
+	}
+	return raw
+}
+
+func (c *CSRF) validCookie(v string) bool {
+	parts := strings.SplitN(v, ".", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	raw, err := decode(parts[0])
+	if err != nil || len(raw) != tokenLen {
+		return false
+	}
+	sig, err := decode(parts[1])
+	return err == nil && c.keyring().Verify(raw, sig)
+}
+
+func (c *CSRF) keyring() *keyring.Keyring {
+	if c.opts.Keyring != nil {
+		return c.opts.Keyring
+	}
+	return izigo.CookieKeyring()
+}
+
+// validOrigin compares the scheme, host and port of the Origin header, or of the
+// Referer when Origin is absent, with the site and the trusted origins. A missing
+// port is the default one of the scheme.
+// Requests without both headers pass, the token still protects them.
+func (c *CSRF) validOrigin(ctx *context.Context) bool {
+	origin := ctx.Input.Header("Origin")
+	if origin == "" || origin == "null" {
+		origin = ctx.Input.Refer()
+	}
+	if origin == "" {
+		return ctx.Input.Header("Origin") != "null"
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	origin = strings.ToLower(originKey(u))
+	if origin == strings.ToLower(ctx.Input.Scheme()+"://"+ctx.Input.HostPort()) {
+		return true
+	}
+	return c.origins[origin]
+}
+
+// originKey returns the scheme and host of u with the default port of the scheme
+// if it has none, such as "https://app.izi.asia:443".
+func originKey(u *url.URL) string {
+	return u.Scheme + "://" + context.JoinDefaultPort(u.Host, u.Scheme)
+}
+
+// TemplateField returns the hidden input of the token, it is registered
+// as the template function csrf_field:
+//	<form method="post">{{csrf_field .}}</form>
+func TemplateField(data map[interface{}]interface{}) template.HTML {
+	token, _ := data[TokenKey].(string)
+	name, _ := data[FieldNameKey].(string)
+	if token == "" {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(name) +
+		`" value="` + template.HTMLEscapeString(token) + `" />`)
+}
+
+func init() {
+	izigo.AddFuncMap("csrf_field", TemplateField)
+}
+
+func fail(ctx *context.Context, reason string) {
+	logs.Warn("csrf: %s %s %s from %s", reason, ctx.Input.Method(), ctx.Input.URI(), ctx.Input.IP())
+	ctx.Output.Header(ReasonHeader, reason)
+	ctx.Input.SetData(ReasonKey, reason)
+	izigo.Exception(http.StatusForbidden, ctx)
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+func randomToken() []byte {
+	b := make([]byte, tokenLen)
+	rand.Read(b)
+	return b
+}
+
+// mask xors the token with a random pad, so that the token sent in pages
+// differs on every response and can not be recovered by compression attacks.
+func mask(raw []byte) string {
+	b := make([]byte, 2*tokenLen)
+	rand.Read(b[:tokenLen])
+	for i := 0; i < tokenLen; i++ {
+		b[tokenLen+i] = raw[i] ^ b[i]
+	}
+	return encode(b)
+}
+
+func unmask(token string) []byte {
+	b, err := decode(token)
+	if err != nil || len(b) != 2*tokenLen {
+		return nil
+	}
+	raw := make([]byte, tokenLen)
+	for i := 0; i < tokenLen; i++ {
+		raw[i] = b[tokenLen+i] ^ b[i]
+	}
+	return raw
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,156 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/context"
+	"github.com/izi-global/izigo/session"
+)
+
+func newHandler(c *CSRF, manager *session.Manager) *izigo.ControllerRegister {
+	handler := izigo.NewControllerRegister()
+	if manager != nil {
+		handler.InsertFilter("*", izigo.BeforeStatic, func(ctx *context.Context) {
+			ctx.Input.CruSession, _ = manager.SessionStart(ctx.ResponseWriter, ctx.Request)
+		})
+		handler.InsertFilter("*", izigo.FinishRouter, func(ctx *context.Context) {
+			ctx.Input.CruSession.SessionRelease(ctx.ResponseWriter)
+		}, false)
+	}
+	handler.InsertFilter("*", izigo.BeforeRouter, c.FilterFunc())
+	handler.Any("/form", func(ctx *context.Context) {
+		ctx.WriteString(string(TemplateField(ctx.Input.Data())))
+	})
+	return handler
+}
+
+func serve(handler http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestDoubleSubmit(t *testing.T) {
+	handler := newHandler(New(nil), nil)
+
+	w := serve(handler, httptest.NewRequest("GET", "http://izi.asia/form", nil))
+	setCookie := w.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(setCookie, "_csrf=") || !strings.Contains(setCookie, "SameSite=Lax") {
+		t.Fatalf("csrf cookie is expected to be set, found %q", setCookie)
+	}
+	cookie := strings.SplitN(setCookie, ";", 2)[0]
+	token := strings.TrimPrefix(cookie, "_csrf=")
+	if !strings.Contains(w.Body.String(), `name="_csrf" value="`+token+`"`) {
+		t.Errorf("csrf_field is expected to contain the token, found %q", w.Body.String())
+	}
+
+	post := func(header, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://izi.asia/form", strings.NewReader("{}"))
+		r.Header.Set("Cookie", cookie)
+		if header != "" {
+			r.Header.Set("X-CSRF-Token", header)
+		}
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return serve(handler, r)
+	}
+	if w := post(token, "http://izi.asia"); w.Code != 200 {
+		t.Errorf("valid token is expected to pass, found %d", w.Code)
+	}
+	cases := map[string][2]string{
+		ReasonMissingToken: {"", ""},
+		ReasonInvalidToken: {token + "x", ""},
+		ReasonBadOrigin:    {token, "http://evil.com"},
+	}
+	for reason, c := range cases {
+		w := post(c[0], c[1])
+		if w.Code != 403 || w.Header().Get(ReasonHeader) != reason {
+			t.Errorf("%s: status code is expected to be 403, found %d %q", reason, w.Code, w.Header().Get(ReasonHeader))
+		}
+	}
+
+	// the port is compared, the default one of the scheme when it is missing
+	if w := post(token, "http://izi.asia:8080"); w.Code != 403 || w.Header().Get(ReasonHeader) != ReasonBadOrigin {
+		t.Errorf("origin on another port is expected to fail, found %d", w.Code)
+	}
+	if w := post(token, "http://izi.asia:80"); w.Code != 200 {
+		t.Errorf("origin on the default port is expected to pass, found %d", w.Code)
+	}
+
+	// a forged cookie is not signed
+	r := httptest.NewRequest("POST", "http://izi.asia/form", nil)
+	r.Header.Set("Cookie", "_csrf=abc.def")
+	r.Header.Set("X-CSRF-Token", "abc.def")
+	if w := serve(handler, r); w.Code != 403 {
+		t.Errorf("unsigned cookie is expected to fail, found %d", w.Code)
+	}
+}
+
+func TestSessionToken(t *testing.T) {
+	manager, err := session.NewManager("memory", &session.ManagerConfig{CookieName: "sid", EnableSetCookie: true, Gclifetime: 3600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newHandler(New(&Options{Mode: ModeSession, TrustedOrigins: []string{"https://app.izi.asia"}}), manager)
+
+	w := serve(handler, httptest.NewRequest("GET", "http://izi.asia/form", nil))
+	sid := strings.SplitN(w.Header().Get("Set-Cookie"), ";", 2)[0]
+	body := w.Body.String()
+	token := body[strings.Index(body, `value="`)+7 : strings.LastIndex(body, `"`)]
+
+	r := httptest.NewRequest("GET", "http://izi.asia/form", nil)
+	r.Header.Set("Cookie", sid)
+	if next := serve(handler, r).Body.String(); next == body {
+		t.Error("session token is expected to be masked differently on every response")
+	}
+
+	form := url.Values{"_csrf": {token}}
+	r = httptest.NewRequest("POST", "http://izi.asia/form", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Cookie", sid)
+	r.Header.Set("Origin", "https://app.izi.asia")
+	if w := serve(handler, r); w.Code != 200 {
+		t.Errorf("form token of the session is expected to pass, found %d %s", w.Code, w.Header().Get(ReasonHeader))
+	}
+
+	// the token of another session is rejected
+	r = httptest.NewRequest("POST", "http://izi.asia/form", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if w := serve(handler, r); w.Code != 403 || w.Header().Get(ReasonHeader) != ReasonInvalidToken {
+		t.Errorf("token of another session is expected to fail, found %d", w.Code)
+	}
+}
+
+func TestExemptBearer(t *testing.T) {
+	handler := newHandler(New(nil), nil)
+	r := httptest.NewRequest("DELETE", "http://izi.asia/form", nil)
+	r.Header.Set("Authorization", "Bearer abc")
+	if w := serve(handler, r); w.Code != 200 {
+		t.Errorf("bearer token request is expected to be exempted, found %d", w.Code)
+	}
+	r = httptest.NewRequest("DELETE", "http://izi.asia/form", nil)
+	r.Header.Set("Authorization", "Basic YTpi")
+	if w := serve(handler, r); w.Code != 403 {
+		t.Errorf("basic auth request is expected to be checked, found %d", w.Code)
+	}
+}
@@ -0,0 +1,442 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package httpcache provides filters caching the GET and HEAD responses.
+// Usage:
+//	import(
+//		"github.com/izi-global/izigo"
+//		"github.com/izi-global/izigo/cache"
+//		"github.com/izi-global/izigo/plugins/httpcache"
+//	)
+//
+//	func main(){
+//		bm, _ := cache.NewCache("memory", `{"interval":60}`)
+//		hc := httpcache.New(bm, nil)
+//		hc.Register("/products/*", 5 * time.Minute)
+//		// routes with a 0 TTL only store the responses of the controllers calling Cacheable
+//		hc.Register("/api/*", 0)
+//		izigo.Run()
+//	}
+//
+//	func (c *ProductController) Get() {
+//		httpcache.Cacheable(c.Ctx, time.Minute, "product:" + c.Ctx.Input.Param(":id"))
+//		...
+//	}
+//
+//	hc.PurgeTag("product:42")  // the responses tagged product:42
+//	hc.Purge("/products/42")    // every variant of the url
+//
+// The responses are keyed by the scheme, host and normalised url and the request
+// headers of Options.Vary. They are served with an ETag, and a request whose
+// If-None-Match matches it gets 304 Not Modified. The Cache-Control directives
+// no-store, no-cache, max-age and only-if-cached of the requests, and no-store,
+// no-cache, private, public, max-age and s-maxage of the responses are honoured.
+// Responses setting cookies, with a Content-Security-Policy nonce, with an
+// uncacheable status or varying on other headers are not stored, nor are the
+// per-request headers of Options.SkipHeaders. The requests with an Authorization header or a session
+// cookie are neither served nor stored, unless the response is public or has
+// s-maxage.
+package httpcache
+
+import (
+	goctx "context"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/context"
+)
+
+const (
+	// HeaderStatus is set to HIT on the responses served from the cache, MISS otherwise.
+	HeaderStatus = "X-Cache"
+
+	dataPending = "httpcache.pending"
+	dataPolicy  = "httpcache.policy"
+	urlTag      = "url:"
+)
+
+// cacheable are the status codes stored, as the cacheable by default ones of RFC 7231.
+var cacheable = map[int]bool{200: true, 203: true, 204: true, 300: true, 301: true, 404: true, 405: true, 410: true, 414: true, 501: true}
+
+// DefaultSkipHeaders are the response headers which are not stored, as they
+// belong to a single request or connection.
+var DefaultSkipHeaders = []string{
+	HeaderStatus, "Age", "Date", "Set-Cookie", "Server-Timing", "X-Request-Id", "X-Correlation-Id",
+	"Connection", "Keep-Alive", "Transfer-Encoding", "Trailer", "Upgrade",
+}
+
+// Options represents the response cache settings.
+type Options struct {
+	// Request headers which are part of the key, default Accept-Encoding.
+	Vary []string
+	// Prefix of the cache keys, default "httpcache:".
+	Prefix string
+	// Cookie of the sessions, default izigo.BConfig.WebConfig.Session.SessionName.
+	SessionCookie string
+	// Response headers which are not stored, default DefaultSkipHeaders.
+	SkipHeaders []string
+}
+
+// record is the value stored in the cache.
+type record struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Stored time.Time
+	// Shared is set on the public or s-maxage responses, served to the requests with credentials.
+	Shared bool
+}
+
+type pending struct {
+	key         string
+	url         string
+	ttl         time.Duration
+	credentials bool
+	capture     *context.CapturedResponse
+}
+
+// policy is the opt-in of a controller.
+type policy struct {
+	ttl  time.Duration
+	set  bool
+	tags []string
+}
+
+// Cache stores responses in a cache.Cache adapter.
+type Cache struct {
+	tc   *cache.Tagged
+	opts Options
+	skip map[string]bool
+}
+
+func init() {
+	gob.Register(record{})
+}
+
+// New returns a Cache storing responses in bm.
+// opts may be nil to use the defaults.
+func New(bm cache.Cache, opts *Options) *Cache {
+	c := &Cache{tc: cache.NewTagged(cache.FromV1(bm))}
+	if opts != nil {
+		c.opts = *opts
+	}
+	if c.opts.Vary == nil {
+		c.opts.Vary = []string{"Accept-Encoding"}
+	}
+	if c.opts.Prefix == "" {
+		c.opts.Prefix = "httpcache:"
+	}
+	for i, h := range c.opts.Vary {
+		c.opts.Vary[i] = http.CanonicalHeaderKey(h)
+	}
+	if c.opts.SkipHeaders == nil {
+		c.opts.SkipHeaders = DefaultSkipHeaders
+	}
+	c.skip = make(map[string]bool, len(c.opts.SkipHeaders))
+	for _, h := range c.opts.SkipHeaders {
+		c.skip[http.CanonicalHeaderKey(h)] = true
+	}
+	return c
+}
+
+// Register inserts the Before and After filters for pattern into izigo.IZIApp.
+// The responses are kept for ttl, a 0 ttl stores only the responses of the
+// controllers calling Cacheable.
+func (c *Cache) Register(pattern string, ttl time.Duration) {
+	izigo.InsertFilter(pattern, izigo.BeforeRouter, c.Before(ttl))
+	izigo.InsertFilter(pattern, izigo.FinishRouter, c.After(), false)
+}
+
+// Cacheable opts the response of ctx in, kept for ttl with tags.
+// It overrides the ttl of the route, 0 disables the cache of the response.
+func Cacheable(ctx *context.Context, ttl time.Duration, tags ...string) {
+	p := policyOf(ctx)
+	p.ttl, p.set = ttl, true
+	p.tags = append(p.tags, tags...)
+}
+
+// Tag adds tags to the response of ctx, to purge it with PurgeTag.
+func Tag(ctx *context.Context, tags ...string) {
+	p := policyOf(ctx)
+	p.tags = append(p.tags, tags...)
+}
+
+func policyOf(ctx *context.Context) *policy {
+	p, ok := ctx.Input.GetData(dataPolicy).(*policy)
+	if !ok {
+		p = &policy{}
+		ctx.Input.SetData(dataPolicy, p)
+	}
+	return p
+}
+
+// Purge removes the responses of rawurl, for all the values of the Vary headers.
+func (c *Cache) Purge(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	return c.tc.InvalidateTag(goctx.Background(), urlTag+normalise(u))
+}
+
+// PurgeTag removes the responses tagged with tags.
+func (c *Cache) PurgeTag(tags ...string) error {
+	return c.tc.InvalidateTag(goctx.Background(), tags...)
+}
+
+// Before serves the stored responses, and captures the other ones.
+// Insert it at izigo.BeforeRouter.
+func (c *Cache) Before(ttl time.Duration) izigo.FilterFunc {
+	return func(ctx *context.Context) {
+		method := ctx.Input.Method()
+		if (method != http.MethodGet && method != http.MethodHead) || ctx.Input.GetData(dataPending) != nil {
+			return
+		}
+		directives := parseCacheControl(ctx.Input.Header("Cache-Control"))
+		if _, ok := directives["no-store"]; ok {
+			return
+		}
+		u := normalise(ctx.Request.URL)
+		key := c.key(ctx, u)
+		credentials := c.credentials(ctx)
+		if _, ok := directives["no-cache"]; !ok {
+			if rec := c.load(ctx, key); rec != nil && fresh(rec, directives) && (rec.Shared || !credentials) {
+				serve(ctx, rec)
+				return
+			}
+		}
+		if _, ok := directives["only-if-cached"]; ok {
+			ctx.ResponseWriter.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		ctx.Output.Header(HeaderStatus, "MISS")
+		// the response written by Output.Body gets the ETag it is stored with
+		ctx.Output.EnableETag = true
+		if method == http.MethodGet {
+			ctx.Input.SetData(dataPending, &pending{key: key, url: u, ttl: ttl, credentials: credentials, capture: ctx.ResponseWriter.Capture()})
+		}
+	}
+}
+
+// After stores the captured response.
+// Insert it at izigo.FinishRouter with returnOnOutput set to false.
+func (c *Cache) After() izigo.FilterFunc {
+	return func(ctx *context.Context) {
+		p, ok := ctx.Input.GetData(dataPending).(*pending)
+		if !ok {
+			return
+		}
+		ttl := p.ttl
+		var tags []string
+		if pol, ok := ctx.Input.GetData(dataPolicy).(*policy); ok {
+			if pol.set {
+				ttl = pol.ttl
+			}
+			tags = pol.tags
+		}
+		status := p.capture.Status
+		if status == 0 {
+			status = ctx.Output.Status
+		}
+		if status == 0 {
+			status = http.StatusOK
+		}
+		header := ctx.ResponseWriter.Header()
+		if !cacheable[status] || header.Get("Set-Cookie") != "" || !c.varies(header) || nonce(header) {
+			return
+		}
+		directives := parseCacheControl(header.Get("Cache-Control"))
+		for _, d := range []string{"no-store", "no-cache", "private"} {
+			if _, ok := directives[d]; ok {
+				return
+			}
+		}
+		_, public := directives["public"]
+		_, shared := directives["s-maxage"]
+		shared = shared || public
+		if p.credentials && !shared {
+			return
+		}
+		for _, d := range []string{"s-maxage", "max-age"} {
+			if v, ok := directives[d]; ok {
+				if seconds, err := strconv.Atoi(v); err == nil {
+					ttl = time.Duration(seconds) * time.Second
+					break
+				}
+			}
+		}
+		if ttl <= 0 {
+			return
+		}
+		rec := &record{Status: status, Header: http.Header{}, Body: p.capture.Body.Bytes(), Stored: time.Now(), Shared: shared}
+		for k, v := range header {
+			if !c.skip[k] {
+				rec.Header[k] = v
+			}
+		}
+		if rec.Header.Get("ETag") == "" {
+			rec.Header.Set("ETag", context.WeakETag(rec.Body))
+		}
+		c.tc.Put(ctx.Request.Context(), p.key, *rec, ttl, append(tags, urlTag+p.url)...)
+	}
+}
+
+// nonce checks whether the Content-Security-Policy of the response has a
+// per-request nonce, which must not be served to other requests.
+func nonce(header http.Header) bool {
+	for _, h := range []string{"Content-Security-Policy", "Content-Security-Policy-Report-Only"} {
+		for _, v := range header[h] {
+			if strings.Contains(v, "'nonce-") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// varies checks that the response varies only on the headers of the key.
+func (c *Cache) varies(header http.Header) bool {
+	for _, v := range header["Vary"] {
+		for _, h := range strings.Split(v, ",") {
+			h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+			if h == "" {
+				continue
+			}
+			found := false
+			for _, vary := range c.opts.Vary {
+				found = found || vary == h
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// credentials checks whether the request carries an Authorization header or a session cookie.
+func (c *Cache) credentials(ctx *context.Context) bool {
+	if ctx.Input.Header("Authorization") != "" {
+		return true
+	}
+	name := c.opts.SessionCookie
+	if name == "" {
+		name = izigo.BConfig.WebConfig.Session.SessionName
+	}
+	return name != "" && ctx.Input.Cookie(name) != ""
+}
+
+func (c *Cache) key(ctx *context.Context, u string) string {
+	h := sha256.New()
+	io.WriteString(h, ctx.Input.Scheme()+"://"+ctx.Input.Host())
+	io.WriteString(h, u)
+	for _, vary := range c.opts.Vary {
+		h.Write([]byte{0})
+		io.WriteString(h, vary)
+		h.Write([]byte{'='})
+		io.WriteString(h, strings.TrimSpace(ctx.Input.Header(vary)))
+	}
+	return c.opts.Prefix + hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *Cache) load(ctx *context.Context, key string) *record {
+	v, err := c.tc.Get(ctx.Request.Context(), key)
+	if err != nil {
+		return nil
+	}
+	rec, ok := v.(record)
+	if !ok {
+		return nil
+	}
+	return &rec
+}
+
+// normalise returns the cleaned path of u with its sorted query.
+func normalise(u *url.URL) string {
+	p := path.Clean("/" + u.Path)
+	if query := u.Query().Encode(); query != "" {
+		p += "?" + query
+	}
+	return p
+}
+
+// fresh checks the max-age directive of the request.
+func fresh(rec *record, directives map[string]string) bool {
+	v, ok := directives["max-age"]
+	if !ok {
+		return true
+	}
+	seconds, err := strconv.Atoi(v)
+	return err == nil && time.Since(rec.Stored) <= time.Duration(seconds)*time.Second
+}
+
+func serve(ctx *context.Context, rec *record) {
+	header := ctx.ResponseWriter.Header()
+	for k, v := range rec.Header {
+		header[k] = v
+	}
+	header.Set(HeaderStatus, "HIT")
+	header.Set("Age", strconv.Itoa(int(time.Since(rec.Stored)/time.Second)))
+	if matchETag(ctx.Input.Header("If-None-Match"), rec.Header.Get("ETag")) {
+		header.Del("Content-Length")
+		ctx.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	ctx.ResponseWriter.WriteHeader(rec.Status)
+	if ctx.Input.Method() != http.MethodHead {
+		ctx.ResponseWriter.Write(rec.Body)
+	}
+}
+
+// matchETag checks If-None-Match with the weak comparison of RFC 7232.
+func matchETag(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" || etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCacheControl returns the directives of a Cache-Control header with their values.
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, d := range strings.Split(header, ",") {
+		d = strings.TrimSpace(d)
+		if d == "" {
+			continue
+		}
+		name, value := d, ""
+		if i := strings.IndexByte(d, '='); i >= 0 {
+			name, value = d[:i], strings.Trim(d[i+1:], `"`)
+		}
+		directives[strings.ToLower(name)] = value
+	}
+	return directives
+}
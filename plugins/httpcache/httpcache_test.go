@@ -0,0 +1,225 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpcache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/context"
+)
+
+func newHandler(t *testing.T, ttl time.Duration) (*izigo.ControllerRegister, *Cache, *int) {
+	bm, err := cache.NewCache("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := New(bm, &Options{Vary: []string{"Accept-Language"}})
+	handler := izigo.NewControllerRegister()
+	handler.InsertFilter("/*", izigo.BeforeRouter, hc.Before(ttl))
+	handler.InsertFilter("/*", izigo.FinishRouter, hc.After(), false)
+	calls := 0
+	handler.Get("/products/:id", func(ctx *context.Context) {
+		calls++
+		Tag(ctx, "product:"+ctx.Input.Param(":id"))
+		ctx.Output.Header("Vary", "Accept-Language")
+		ctx.Output.Body([]byte("product " + ctx.Input.Param(":id") + " " + ctx.Input.Header("Accept-Language") + " " + strconv.Itoa(calls)))
+	})
+	handler.Get("/opt-in", func(ctx *context.Context) {
+		calls++
+		Cacheable(ctx, time.Minute)
+		ctx.Output.Body([]byte(strconv.Itoa(calls)))
+	})
+	handler.Get("/private", func(ctx *context.Context) {
+		calls++
+		ctx.Output.Header("Cache-Control", "private")
+		ctx.Output.Body([]byte(strconv.Itoa(calls)))
+	})
+	handler.Get("/cookie", func(ctx *context.Context) {
+		calls++
+		ctx.SetCookie("name", "value")
+		ctx.Output.Body([]byte(strconv.Itoa(calls)))
+	})
+	handler.Get("/me", func(ctx *context.Context) {
+		calls++
+		user := ctx.Input.Header("Authorization") + ctx.Input.Cookie("izigosessionID")
+		ctx.Output.Body([]byte(ctx.Input.Host() + " " + user + " " + strconv.Itoa(calls)))
+	})
+	handler.Get("/nonce", func(ctx *context.Context) {
+		calls++
+		ctx.Output.Header("Content-Security-Policy", "script-src 'self' 'nonce-"+strconv.Itoa(calls)+"'")
+		ctx.Output.Body([]byte(strconv.Itoa(calls)))
+	})
+	handler.Get("/request-id", func(ctx *context.Context) {
+		calls++
+		ctx.Output.Header("X-Request-Id", strconv.Itoa(calls))
+		ctx.Output.Body([]byte(strconv.Itoa(calls)))
+	})
+	handler.Get("/public", func(ctx *context.Context) {
+		calls++
+		ctx.Output.Header("Cache-Control", "public")
+		ctx.Output.Body([]byte(strconv.Itoa(calls)))
+	})
+	return handler, hc, &calls
+}
+
+func get(handler http.Handler, url string, header ...string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", url, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		if header[i] == "Host" {
+			r.Host = header[i+1]
+		}
+		r.Header.Set(header[i], header[i+1])
+	}
+	handler.ServeHTTP(recorder, r)
+	return recorder
+}
+
+func TestCache(t *testing.T) {
+	handler, hc, calls := newHandler(t, time.Minute)
+
+	first := get(handler, "/products/42?b=2&a=1")
+	if first.Body.String() != "product 42  1" || first.HeaderMap.Get(HeaderStatus) != "MISS" {
+		t.Fatalf("first request is expected to run, found %s %s", first.Body.String(), first.HeaderMap.Get(HeaderStatus))
+	}
+	// the query is normalised
+	second := get(handler, "/products/42?a=1&b=2")
+	if *calls != 1 || second.Body.String() != "product 42  1" || second.HeaderMap.Get(HeaderStatus) != "HIT" {
+		t.Errorf("second request is expected to be served from the cache, found %s", second.Body.String())
+	}
+	etag := second.HeaderMap.Get("ETag")
+	if etag == "" || second.HeaderMap.Get("Age") == "" {
+		t.Error("cached response is expected to have an ETag and an Age")
+	}
+	if first.HeaderMap.Get("ETag") != etag {
+		t.Errorf("first response is expected to have the ETag %s, found %s", etag, first.HeaderMap.Get("ETag"))
+	}
+	if r := get(handler, "/products/42?a=1&b=2", "If-None-Match", etag); r.Code != http.StatusNotModified || r.Body.Len() != 0 {
+		t.Errorf("matching If-None-Match is expected to get 304, found %d", r.Code)
+	}
+
+	// Vary headers are part of the key
+	if r := get(handler, "/products/42?a=1&b=2", "Accept-Language", "vi"); r.Body.String() != "product 42 vi 2" {
+		t.Errorf("another language is expected to run the handler, found %s", r.Body.String())
+	}
+	// request directives
+	if r := get(handler, "/products/42?a=1&b=2", "Cache-Control", "no-cache"); r.Body.String() != "product 42  3" {
+		t.Errorf("no-cache is expected to run the handler, found %s", r.Body.String())
+	}
+	if r := get(handler, "/products/42?a=1&b=2"); r.Body.String() != "product 42  3" {
+		t.Errorf("no-cache is expected to store the new response, found %s", r.Body.String())
+	}
+	if r := get(handler, "/products/43", "Cache-Control", "only-if-cached"); r.Code != http.StatusGatewayTimeout {
+		t.Errorf("only-if-cached of a missing response is expected to get 504, found %d", r.Code)
+	}
+
+	// purge
+	get(handler, "/products/43")
+	hc.PurgeTag("product:42")
+	if r := get(handler, "/products/42?a=1&b=2", "Accept-Language", "vi"); r.HeaderMap.Get(HeaderStatus) != "MISS" {
+		t.Error("purged tag is expected to remove every variant")
+	}
+	if r := get(handler, "/products/43"); r.HeaderMap.Get(HeaderStatus) != "HIT" {
+		t.Error("other tags are expected to be kept")
+	}
+	hc.Purge("/products/43")
+	if r := get(handler, "/products/43"); r.HeaderMap.Get(HeaderStatus) != "MISS" {
+		t.Error("purged url is expected to run the handler")
+	}
+}
+
+func TestUncacheable(t *testing.T) {
+	handler, _, calls := newHandler(t, time.Minute)
+	for _, url := range []string{"/private", "/cookie", "/nonce"} {
+		*calls = 0
+		get(handler, url)
+		if r := get(handler, url); r.HeaderMap.Get(HeaderStatus) != "MISS" || *calls != 2 {
+			t.Errorf("%s is not expected to be stored", url)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/products/42", nil)
+	handler.ServeHTTP(recorder, r)
+	if recorder.HeaderMap.Get(HeaderStatus) != "" {
+		t.Error("POST is not expected to be cached")
+	}
+}
+
+func TestOptIn(t *testing.T) {
+	handler, _, calls := newHandler(t, 0)
+	get(handler, "/products/42")
+	if r := get(handler, "/products/42"); r.HeaderMap.Get(HeaderStatus) != "MISS" || *calls != 2 {
+		t.Error("routes with a 0 TTL are not expected to be stored")
+	}
+	get(handler, "/opt-in")
+	if r := get(handler, "/opt-in"); r.HeaderMap.Get(HeaderStatus) != "HIT" || r.Body.String() != "3" {
+		t.Errorf("Cacheable is expected to store the response, found %s", r.Body.String())
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	handler, _, calls := newHandler(t, time.Minute)
+	alice := get(handler, "/me", "Authorization", "Bearer alice")
+	bob := get(handler, "/me", "Authorization", "Bearer bob")
+	if bob.Body.String() == alice.Body.String() || bob.HeaderMap.Get(HeaderStatus) != "MISS" {
+		t.Errorf("a private page is not expected to be served to another user, found %s", bob.Body.String())
+	}
+	if r := get(handler, "/me", "Cookie", "izigosessionID=carol"); r.HeaderMap.Get(HeaderStatus) != "MISS" || *calls != 3 {
+		t.Errorf("a request with a session is not expected to be served from the cache, found %s", r.Body.String())
+	}
+	if r := get(handler, "/me"); r.HeaderMap.Get(HeaderStatus) != "MISS" || *calls != 4 {
+		t.Errorf("a response to a user is not expected to be stored, found %s", r.Body.String())
+	}
+	// the anonymous response is not served to the users
+	get(handler, "/me")
+	if r := get(handler, "/me", "Authorization", "Bearer alice"); r.HeaderMap.Get(HeaderStatus) != "MISS" {
+		t.Errorf("an anonymous response is not expected to be served to a user, found %s", r.Body.String())
+	}
+
+	// public responses are shared
+	get(handler, "/public", "Authorization", "Bearer alice")
+	if r := get(handler, "/public", "Authorization", "Bearer bob"); r.HeaderMap.Get(HeaderStatus) != "HIT" {
+		t.Errorf("a public response is expected to be shared, found %s", r.Body.String())
+	}
+}
+
+func TestSkipHeaders(t *testing.T) {
+	handler, _, _ := newHandler(t, time.Minute)
+	get(handler, "/request-id")
+	r := get(handler, "/request-id")
+	if r.HeaderMap.Get(HeaderStatus) != "HIT" || r.Body.String() != "1" {
+		t.Fatalf("response is expected to be served from the cache, found %s", r.Body.String())
+	}
+	if id := r.HeaderMap.Get("X-Request-Id"); id != "" {
+		t.Errorf("request id is not expected to be stored, found %s", id)
+	}
+}
+
+func TestHosts(t *testing.T) {
+	handler, _, _ := newHandler(t, time.Minute)
+	get(handler, "/me", "Host", "a.example.com")
+	if r := get(handler, "/me", "Host", "b.example.com"); r.HeaderMap.Get(HeaderStatus) != "MISS" || r.Body.String() != "b.example.com  2" {
+		t.Errorf("hosts are expected to have their own responses, found %s", r.Body.String())
+	}
+	if r := get(handler, "/me", "Host", "a.example.com"); r.HeaderMap.Get(HeaderStatus) != "HIT" || r.Body.String() != "a.example.com  1" {
+		t.Errorf("the response of the host is expected to be served, found %s", r.Body.String())
+	}
+}
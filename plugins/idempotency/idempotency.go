@@ -0,0 +1,358 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package idempotency provides filters honouring the Idempotency-Key header,
+// so that retried POST/PATCH requests are executed only once.
+// Usage:
+//	import(
+//		"github.com/izi-global/izigo"
+//		"github.com/izi-global/izigo/cache"
+//		"github.com/izi-global/izigo/plugins/idempotency"
+//	)
+//
+//	func main(){
+//		bm, _ := cache.NewCacheV2("redis", `{"conn":"127.0.0.1:6379"}`)
+//		idempotency.New(bm, nil).Register("/api/*")
+//		izigo.Run()
+//	}
+//
+// The first request with a key locks it with the atomic SetNX of the cache, so
+// that a cache shared by several nodes runs it once, and its status, headers
+// and body are stored for Options.TTL. While it runs, duplicates get 409 Conflict.
+// Later retries get the stored response with the header Idempotent-Replayed: true.
+// A retry whose method, url or body differs from the first request gets 422.
+//
+// Keys are scoped per principal, by default the session id, the Authorization
+// header or the client ip of anonymous requests, see Options.Principal.
+// The bodies larger than izigo.BConfig.MaxMemory get 413.
+//
+// The response is stored by a FinishRouter filter. If the handler panics,
+// for example through Controller.Redirect or StopRun, nothing is stored and
+// the key is released by the RecoverFunc installed by Register, so that the
+// client can retry.
+package idempotency
+
+import (
+	"bytes"
+	goctx "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/context"
+	"github.com/izi-global/izigo/utils"
+)
+
+const (
+	// HeaderKey is the request header carrying the idempotency key.
+	HeaderKey = "Idempotency-Key"
+	// HeaderReplayed is set on responses replayed from the cache.
+	HeaderReplayed = "Idempotent-Replayed"
+
+	dataKey   = "idempotency.key"
+	maxKeyLen = 255
+)
+
+// Options represents the idempotency settings.
+type Options struct {
+	// Methods which honour the header, default POST and PATCH.
+	Methods []string
+	// How long a finished response is kept, default 24 hours.
+	TTL time.Duration
+	// How long a key stays locked if the request never finishes, default 1 minute.
+	LockTimeout time.Duration
+	// Prefix of the cache keys, default "idempotency:".
+	Prefix string
+	// Principal returns the authenticated principal of the request.
+	// Default is the session id, the Authorization header, or the client ip.
+	Principal func(ctx *context.Context) string
+}
+
+// record is the value stored in the cache.
+type record struct {
+	Fingerprint string      `json:"fingerprint"`
+	Lock        string      `json:"lock,omitempty"`
+	Done        bool        `json:"done"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+type pending struct {
+	key         string
+	fingerprint string
+	// lock is the stored value of the lock, released if the request does not finish.
+	lock    string
+	done    bool
+	capture *context.CapturedResponse
+}
+
+// Idempotency stores responses in a cache.CacheV2 adapter.
+type Idempotency struct {
+	bm   cache.CacheV2
+	opts Options
+}
+
+// New returns an Idempotency storing responses in bm.
+// The keys are locked with bm.SetNX, which is atomic in the CacheV2 adapters
+// but not in the ones bridged by cache.FromV1.
+// opts may be nil to use the defaults.
+func New(bm cache.CacheV2, opts *Options) *Idempotency {
+	i := &Idempotency{bm: bm}
+	if opts != nil {
+		i.opts = *opts
+	}
+	if len(i.opts.Methods) == 0 {
+		i.opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if i.opts.TTL <= 0 {
+		i.opts.TTL = 24 * time.Hour
+	}
+	if i.opts.LockTimeout <= 0 {
+		i.opts.LockTimeout = time.Minute
+	}
+	if i.opts.Prefix == "" {
+		i.opts.Prefix = "idempotency:"
+	}
+	if i.opts.Principal == nil {
+		i.opts.Principal = defaultPrincipal
+	}
+	return i
+}
+
+// Register inserts the Before and After filters for pattern into izigo.IZIApp,
+// and wraps izigo.BConfig.RecoverFunc with RecoverFunc.
+func (i *Idempotency) Register(pattern string) {
+	izigo.InsertFilter(pattern, izigo.BeforeRouter, i.Before())
+	izigo.InsertFilter(pattern, izigo.FinishRouter, i.After(), false)
+	izigo.BConfig.RecoverFunc = i.RecoverFunc(izigo.BConfig.RecoverFunc)
+}
+
+// RecoverFunc returns a RecoverFunc releasing the key of a request which did
+// not reach After, such as a panicking one, before calling next with the panic.
+func (i *Idempotency) RecoverFunc(next func(*context.Context)) func(*context.Context) {
+	return func(ctx *context.Context) {
+		err := recover()
+		if p, ok := ctx.Input.GetData(dataKey).(*pending); ok && !p.done {
+			p.done = true
+			i.release(p)
+		}
+		if err == nil {
+			if next != nil {
+				next(ctx)
+			}
+			return
+		}
+		if next == nil {
+			panic(err)
+		}
+		// next recovers the panic itself, so it is deferred again
+		func() {
+			defer next(ctx)
+			panic(err)
+		}()
+	}
+}
+
+// Before checks the key, replays stored responses and locks new keys.
+// Insert it at izigo.BeforeRouter.
+func (i *Idempotency) Before() izigo.FilterFunc {
+	return func(ctx *context.Context) {
+		key := ctx.Input.Header(HeaderKey)
+		if key == "" || !i.honoured(ctx.Input.Method()) {
+			return
+		}
+		if len(key) > maxKeyLen {
+			abort(ctx, http.StatusBadRequest, "Idempotency-Key is too long")
+			return
+		}
+		cacheKey := i.cacheKey(i.opts.Principal(ctx), key)
+		fingerprint, ok := fingerprint(ctx)
+		if !ok {
+			abort(ctx, http.StatusRequestEntityTooLarge, "request body is too large")
+			return
+		}
+
+		lock, err := json.Marshal(&record{Fingerprint: fingerprint, Lock: string(utils.RandomCreateBytes(16))})
+		if err != nil {
+			abort(ctx, http.StatusServiceUnavailable, "can not lock Idempotency-Key")
+			return
+		}
+		locked, err := i.bm.SetNX(ctx.Request.Context(), cacheKey, string(lock), i.opts.LockTimeout)
+		if err != nil {
+			abort(ctx, http.StatusServiceUnavailable, "can not lock Idempotency-Key")
+			return
+		}
+		if locked {
+			ctx.Input.SetData(dataKey, &pending{
+				key:         cacheKey,
+				fingerprint: fingerprint,
+				lock:        string(lock),
+				capture:     ctx.ResponseWriter.Capture(),
+			})
+			return
+		}
+
+		rec := i.load(ctx, cacheKey)
+		switch {
+		case rec == nil:
+			// the lock was released since SetNX
+			abort(ctx, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+		case rec.Fingerprint != fingerprint:
+			abort(ctx, http.StatusUnprocessableEntity, "Idempotency-Key is already used by a different request")
+		case !rec.Done:
+			abort(ctx, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+		default:
+			replay(ctx, rec)
+		}
+	}
+}
+
+// After stores the response of a locked request.
+// Insert it at izigo.FinishRouter with returnOnOutput set to false.
+func (i *Idempotency) After() izigo.FilterFunc {
+	return func(ctx *context.Context) {
+		p, ok := ctx.Input.GetData(dataKey).(*pending)
+		if !ok || p.done {
+			return
+		}
+		p.done = true
+		status := p.capture.Status
+		if status == 0 {
+			status = ctx.Output.Status
+		}
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// server errors are not stored so the client can retry
+		if status >= 500 {
+			i.release(p)
+			return
+		}
+		header := http.Header{}
+		for k, v := range ctx.ResponseWriter.Header() {
+			if k != "Set-Cookie" {
+				header[k] = v
+			}
+		}
+		i.store(ctx, p.key, &record{
+			Fingerprint: p.fingerprint,
+			Done:        true,
+			Status:      status,
+			Header:      header,
+			Body:        p.capture.Body.Bytes(),
+		}, i.opts.TTL)
+	}
+}
+
+func (i *Idempotency) honoured(method string) bool {
+	for _, m := range i.opts.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Idempotency) cacheKey(principal, key string) string {
+	h := sha256.New()
+	io.WriteString(h, principal)
+	h.Write([]byte{0})
+	io.WriteString(h, key)
+	return i.opts.Prefix + hex.EncodeToString(h.Sum(nil))
+}
+
+func (i *Idempotency) load(ctx *context.Context, key string) *record {
+	v, err := i.bm.Get(ctx.Request.Context(), key)
+	if err != nil {
+		return nil
+	}
+	rec := &record{}
+	if err := json.Unmarshal([]byte(cache.GetString(v)), rec); err != nil {
+		return nil
+	}
+	return rec
+}
+
+func (i *Idempotency) store(ctx *context.Context, key string, rec *record, ttl time.Duration) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return i.bm.Put(ctx.Request.Context(), key, string(b), ttl)
+}
+
+// release deletes the lock of p, unless it expired and was taken by another request.
+func (i *Idempotency) release(p *pending) {
+	if cd, ok := i.bm.(cache.CompareAndDeleter); ok {
+		cd.CompareAndDelete(goctx.Background(), p.key, p.lock)
+		return
+	}
+	i.bm.Delete(goctx.Background(), p.key)
+}
+
+func replay(ctx *context.Context, rec *record) {
+	for k, v := range rec.Header {
+		ctx.ResponseWriter.Header()[k] = v
+	}
+	ctx.Output.Header(HeaderReplayed, "true")
+	ctx.ResponseWriter.WriteHeader(rec.Status)
+	ctx.ResponseWriter.Write(rec.Body)
+}
+
+func abort(ctx *context.Context, status int, msg string) {
+	ctx.ResponseWriter.WriteHeader(status)
+	ctx.WriteString(msg)
+}
+
+func defaultPrincipal(ctx *context.Context) string {
+	if ctx.Input.CruSession != nil {
+		return "sid:" + ctx.Input.CruSession.SessionID()
+	}
+	if auth := ctx.Input.Header("Authorization"); auth != "" {
+		return "auth:" + auth
+	}
+	return "ip:" + ctx.Input.IP()
+}
+
+// fingerprint hashes the method, url and body of the request, up to
+// izigo.BConfig.MaxMemory bytes of body, it reports false for larger bodies.
+// The body is restored so the handlers can read it again.
+func fingerprint(ctx *context.Context) (string, bool) {
+	h := sha256.New()
+	io.WriteString(h, ctx.Input.Method())
+	h.Write([]byte{0})
+	io.WriteString(h, ctx.Request.URL.RequestURI())
+	h.Write([]byte{0})
+	if len(ctx.Input.RequestBody) > 0 {
+		h.Write(ctx.Input.RequestBody)
+	} else if len(ctx.Request.PostForm) > 0 {
+		io.WriteString(h, ctx.Request.PostForm.Encode())
+	} else if ctx.Request.Body != nil {
+		body, _ := ioutil.ReadAll(io.LimitReader(ctx.Request.Body, izigo.BConfig.MaxMemory+1))
+		if int64(len(body)) > izigo.BConfig.MaxMemory {
+			return "", false
+		}
+		ctx.Request.Body.Close()
+		ctx.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), true
+}
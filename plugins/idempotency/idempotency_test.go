@@ -0,0 +1,208 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/context"
+)
+
+func newHandler(t *testing.T, block chan struct{}) (*izigo.ControllerRegister, *int) {
+	bm, err := cache.NewCacheV2("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newNode(bm, block)
+}
+
+// newNode returns the handler of a node sharing bm with the other nodes.
+func newNode(bm cache.CacheV2, block chan struct{}) (*izigo.ControllerRegister, *int) {
+	i := New(bm, &Options{TTL: time.Minute})
+	handler := izigo.NewControllerRegister()
+	handler.InsertFilter("/*", izigo.BeforeRouter, i.Before())
+	handler.InsertFilter("/*", izigo.FinishRouter, i.After(), false)
+	calls := 0
+	handler.Post("/panic", func(ctx *context.Context) {
+		calls++
+		panic("boom")
+	})
+	handler.Post("/orders", func(ctx *context.Context) {
+		if block != nil {
+			<-block
+		}
+		calls++
+		body, _ := ioutil.ReadAll(ctx.Request.Body)
+		ctx.Output.Header("X-Order", strconv.Itoa(calls))
+		ctx.Output.SetStatus(201)
+		ctx.Output.Body(body)
+	})
+	return handler, &calls
+}
+
+func post(handler http.Handler, key, body string) *httptest.ResponseRecorder {
+	return postAs(handler, "/orders", "Bearer alice", key, body)
+}
+
+func postAs(handler http.Handler, url, auth, key, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", url, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	if auth != "" {
+		r.Header.Set("Authorization", auth)
+	}
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set(HeaderKey, key)
+	handler.ServeHTTP(recorder, r)
+	return recorder
+}
+
+func TestReplay(t *testing.T) {
+	handler, calls := newHandler(t, nil)
+
+	first := post(handler, "k1", `{"item":1}`)
+	if first.Code != 201 || first.Body.String() != `{"item":1}` {
+		t.Fatalf("first request is expected to run, found %d %s", first.Code, first.Body.String())
+	}
+	retry := post(handler, "k1", `{"item":1}`)
+	if *calls != 1 {
+		t.Fatalf("retry should not execute the handler, calls %d", *calls)
+	}
+	if retry.Code != 201 || retry.Body.String() != `{"item":1}` || retry.HeaderMap.Get("X-Order") != "1" {
+		t.Errorf("retry is expected to get the stored response, found %d %s", retry.Code, retry.Body.String())
+	}
+	if retry.HeaderMap.Get(HeaderReplayed) != "true" {
+		t.Error("replayed response should be marked")
+	}
+
+	if r := post(handler, "k1", `{"item":2}`); r.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different payload is expected to get 422, found %d", r.Code)
+	}
+	if r := post(handler, "k2", `{"item":1}`); r.Code != 201 || *calls != 2 {
+		t.Errorf("new key is expected to run, found %d", r.Code)
+	}
+}
+
+func TestConcurrentDuplicate(t *testing.T) {
+	block := make(chan struct{})
+	handler, _ := newHandler(t, block)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- post(handler, "k1", `{}`)
+	}()
+	// wait until the first request holds the key
+	var dup *httptest.ResponseRecorder
+	for i := 0; i < 100; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if dup = post(handler, "k1", `{}`); dup.Code == http.StatusConflict {
+			break
+		}
+	}
+	if dup.Code != http.StatusConflict {
+		t.Errorf("in-flight duplicate is expected to get 409, found %d", dup.Code)
+	}
+	close(block)
+	if first := <-done; first.Code != 201 {
+		t.Errorf("first request is expected to succeed, found %d", first.Code)
+	}
+}
+
+func TestScopedPerPrincipal(t *testing.T) {
+	handler, calls := newHandler(t, nil)
+	post(handler, "k1", `{}`)
+
+	recorder := postAs(handler, "/orders", "Bearer bob", "k1", `{}`)
+	if *calls != 2 || recorder.HeaderMap.Get(HeaderReplayed) != "" {
+		t.Error("the same key of another principal should not be replayed")
+	}
+
+	// anonymous requests are scoped by client ip
+	postAs(handler, "/orders", "", "k1", `{}`)
+	recorder = httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{}`))
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Set(HeaderKey, "k1")
+	handler.ServeHTTP(recorder, r)
+	if *calls != 4 || recorder.HeaderMap.Get(HeaderReplayed) != "" {
+		t.Error("the same key of another anonymous client should not be replayed")
+	}
+}
+
+func TestSharedCache(t *testing.T) {
+	bm, _ := cache.NewCacheV2("memory", `{"interval":60}`)
+	block := make(chan struct{})
+	node1, _ := newNode(bm, block)
+	node2, calls2 := newNode(bm, nil)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- post(node1, "k1", `{}`)
+	}()
+	var dup *httptest.ResponseRecorder
+	for i := 0; i < 100; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if dup = post(node2, "k1", `{}`); dup.Code == http.StatusConflict {
+			break
+		}
+	}
+	close(block)
+	<-done
+	if dup.Code != http.StatusConflict || *calls2 != 0 {
+		t.Errorf("duplicate on another node is expected to get 409, found %d", dup.Code)
+	}
+	if r := post(node2, "k1", `{}`); r.HeaderMap.Get(HeaderReplayed) != "true" {
+		t.Error("response of another node is expected to be replayed")
+	}
+}
+
+func TestPanicReleasesKey(t *testing.T) {
+	bm, _ := cache.NewCacheV2("memory", `{"interval":60}`)
+	i := New(bm, nil)
+	old := izigo.BConfig.RecoverFunc
+	defer func() { izigo.BConfig.RecoverFunc = old }()
+	izigo.BConfig.RecoverFunc = i.RecoverFunc(old)
+
+	handler, calls := newNode(bm, nil)
+	if r := postAs(handler, "/panic", "Bearer alice", "k1", `{}`); r.Code != http.StatusInternalServerError {
+		t.Fatalf("panic is expected to get 500, found %d", r.Code)
+	}
+	if r := postAs(handler, "/panic", "Bearer alice", "k1", `{}`); r.Code != http.StatusInternalServerError || *calls != 2 {
+		t.Errorf("retry after a panic is expected to run, found %d", r.Code)
+	}
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	handler, calls := newHandler(t, nil)
+	old := izigo.BConfig.MaxMemory
+	defer func() { izigo.BConfig.MaxMemory = old }()
+	izigo.BConfig.MaxMemory = 8
+	recorder := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/orders", strings.NewReader(`{"item":"too large"}`))
+	r.Header.Set("Content-Type", "application/octet-stream")
+	r.Header.Set(HeaderKey, "k1")
+	handler.ServeHTTP(recorder, r)
+	if recorder.Code != http.StatusRequestEntityTooLarge || *calls != 0 {
+		t.Errorf("large body is expected to get 413, found %d", recorder.Code)
+	}
+}
@@ -0,0 +1,263 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ipfilter provides a filter restricting requests by client ip.
+// The client ip is resolved by context.IZIGoInput.IP, so the
+// izigo TrustedProxies setting applies.
+// Simple Usage:
+//	import(
+//		"github.com/izi-global/izigo"
+//		"github.com/izi-global/izigo/plugins/ipfilter"
+//	)
+//
+//	func main(){
+//		f, _ := ipfilter.New([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.0.0.66"})
+//		izigo.InsertFilter("/partner/*", izigo.BeforeRouter, f.FilterFunc())
+//		// guard the admin server too
+//		izigo.AdminMiddleWare(f.Handler)
+//		izigo.Run()
+//	}
+//
+// Runtime Updates:
+//
+// The lists can be loaded from a config file, which is reloaded when it changes:
+//
+//	// ipfilter.conf
+//	allow = 10.0.0.0/8;192.168.0.0/16
+//	deny = 10.0.0.66
+//
+//	f.WatchConfig("ini", "conf/ipfilter.conf", 10*time.Second)
+//
+// or from a cache, so that every node picks up the lists put by any of them:
+//
+//	bm.Put("ipfilter_allow", "10.0.0.0/8;192.168.0.0/16", 0)
+//	bm.Put("ipfilter_deny", "10.0.0.66", 0)
+//	f.WatchCache(bm, "ipfilter_allow", "ipfilter_deny", 10*time.Second)
+//
+// A missing key keeps the lists loaded before, "" is given for an unused list.
+package ipfilter
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/config"
+	"github.com/izi-global/izigo/context"
+	"github.com/izi-global/izigo/logs"
+)
+
+// Rules holds the parsed allow and deny lists.
+// An ip matching the deny list is always blocked.
+// If the allow list is not empty, an ip must match it.
+type Rules struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewRules parses allow and deny lists of CIDRs or single addresses.
+func NewRules(allow, deny []string) (*Rules, error) {
+	a, err := context.ParseCIDRs(allow)
+	if err != nil {
+		return nil, err
+	}
+	d, err := context.ParseCIDRs(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &Rules{allow: a, deny: d}, nil
+}
+
+// Allowed returns whether ip passes the rules.
+func (r *Rules) Allowed(ip string) bool {
+	if context.ContainsIP(r.deny, ip) {
+		return false
+	}
+	if len(r.allow) == 0 {
+		return true
+	}
+	return context.ContainsIP(r.allow, ip)
+}
+
+// Filter checks the client ip of requests against its rules.
+// The rules can be replaced at any time.
+type Filter struct {
+	lock  sync.RWMutex
+	rules *Rules
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// New returns a Filter with the given allow and deny lists.
+func New(allow, deny []string) (*Filter, error) {
+	rules, err := NewRules(allow, deny)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{rules: rules, stop: make(chan struct{})}, nil
+}
+
+// Update replaces the allow and deny lists.
+// The old lists are kept if any entry is invalid.
+func (f *Filter) Update(allow, deny []string) error {
+	rules, err := NewRules(allow, deny)
+	if err != nil {
+		return err
+	}
+	f.lock.Lock()
+	f.rules = rules
+	f.lock.Unlock()
+	return nil
+}
+
+// Allowed returns whether ip passes the current rules.
+func (f *Filter) Allowed(ip string) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.rules.Allowed(ip)
+}
+
+// FilterFunc returns the izigo filter, use it with InsertFilter or a namespace.
+func (f *Filter) FilterFunc() izigo.FilterFunc {
+	return func(ctx *context.Context) {
+		if ip := ctx.Input.IP(); !f.Allowed(ip) {
+			logs.Warn("ipfilter: blocked %s %s %s", ip, ctx.Input.Method(), ctx.Input.URI())
+			ctx.ResponseWriter.WriteHeader(http.StatusForbidden)
+			ctx.WriteString("403 Forbidden\n")
+		}
+	}
+}
+
+// Handler wraps an http.Handler, such as the handlers of the admin server.
+// It matches izigo.MiddleWare.
+func (f *Filter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ctx := context.NewContext()
+		ctx.Reset(rw, r)
+		if ip := ctx.Input.IP(); !f.Allowed(ip) {
+			logs.Warn("ipfilter: blocked %s %s %s", ip, r.Method, r.RequestURI)
+			http.Error(rw, "403 Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// WatchConfig loads the "allow" and "deny" keys of the config file
+// and reloads them every interval when the file is modified.
+func (f *Filter) WatchConfig(adapterName, filename string, interval time.Duration) error {
+	modTime, err := f.loadConfig(adapterName, filename)
+	if err != nil {
+		return err
+	}
+	go f.every(interval, func() {
+		fi, err := os.Stat(filename)
+		if err != nil {
+			logs.Error("ipfilter: stat %s: %v", filename, err)
+			return
+		}
+		if !fi.ModTime().After(modTime) {
+			return
+		}
+		if mt, err := f.loadConfig(adapterName, filename); err != nil {
+			logs.Error("ipfilter: reload %s: %v", filename, err)
+		} else {
+			modTime = mt
+			logs.Info("ipfilter: reloaded %s", filename)
+		}
+	})
+	return nil
+}
+
+func (f *Filter) loadConfig(adapterName, filename string) (time.Time, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	cnf, err := config.NewConfig(adapterName, filename)
+	if err != nil {
+		return time.Time{}, err
+	}
+	err = f.Update(cnf.DefaultStrings("allow", nil), cnf.DefaultStrings("deny", nil))
+	return fi.ModTime(), err
+}
+
+// WatchCache loads the lists stored in bm under allowKey and denyKey
+// and reloads them every interval, an empty key leaves its list empty.
+// A list is either a []string or a string separated by ";" or ",".
+// A missing or unreadable key is an error which keeps the previous lists,
+// so that a flush or an outage of the cache does not open the filter.
+func (f *Filter) WatchCache(bm cache.Cache, allowKey, denyKey string, interval time.Duration) error {
+	if err := f.loadCache(bm, allowKey, denyKey); err != nil {
+		return err
+	}
+	go f.every(interval, func() {
+		if err := f.loadCache(bm, allowKey, denyKey); err != nil {
+			logs.Error("ipfilter: reload from cache: %v", err)
+		}
+	})
+	return nil
+}
+
+func (f *Filter) loadCache(bm cache.Cache, allowKey, denyKey string) error {
+	allow, err := cacheList(bm, allowKey)
+	if err != nil {
+		return err
+	}
+	deny, err := cacheList(bm, denyKey)
+	if err != nil {
+		return err
+	}
+	return f.Update(allow, deny)
+}
+
+func cacheList(bm cache.Cache, key string) ([]string, error) {
+	if key == "" {
+		return nil, nil
+	}
+	v := bm.Get(key)
+	if v == nil {
+		return nil, fmt.Errorf("ipfilter: cache key %q is missing", key)
+	}
+	if list, ok := v.([]string); ok {
+		return list, nil
+	}
+	return strings.FieldsFunc(cache.GetString(v), func(r rune) bool {
+		return r == ';' || r == ','
+	}), nil
+}
+
+func (f *Filter) every(interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fn()
+		case <-f.stop:
+			return
+		}
+	}
+}
+
+// Close stops the config and cache watchers, it can be called more than once.
+func (f *Filter) Close() {
+	f.once.Do(func() { close(f.stop) })
+}
@@ -0,0 +1,165 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ipfilter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/context"
+)
+
+func serve(f *Filter, remoteAddr string) int {
+	recorder := httptest.NewRecorder()
+	handler := izigo.NewControllerRegister()
+	handler.InsertFilter("/admin/*", izigo.BeforeRouter, f.FilterFunc())
+	handler.Any("/admin/foo", func(ctx *context.Context) {
+		ctx.Output.SetStatus(200)
+	})
+	r, _ := http.NewRequest("GET", "/admin/foo", nil)
+	r.RemoteAddr = remoteAddr
+	handler.ServeHTTP(recorder, r)
+	return recorder.Code
+}
+
+func TestAllowDeny(t *testing.T) {
+	f, err := New([]string{"10.0.0.0/8", "2001:db8::/32"}, []string{"10.0.0.66"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]int{
+		"10.1.2.3:1234":       200,
+		"10.0.0.66:1234":      403,
+		"192.168.1.1:1234":    403,
+		"[2001:db8::1]:1234":  200,
+		"[2001:db9::1]:1234":  403,
+		"[::ffff:10.1.1.1]:1": 200,
+	}
+	for addr, code := range cases {
+		if got := serve(f, addr); got != code {
+			t.Errorf("%s: status code is expected to be %d, found %d", addr, code, got)
+		}
+	}
+
+	if err := f.Update(nil, []string{"10.1.2.3"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := serve(f, "192.168.1.1:1234"); got != 200 {
+		t.Errorf("empty allow list should allow every ip, found %d", got)
+	}
+	if got := serve(f, "10.1.2.3:1234"); got != 403 {
+		t.Errorf("updated deny list should block, found %d", got)
+	}
+	if err := f.Update([]string{"bad"}, nil); err == nil {
+		t.Error("invalid cidr should return error")
+	}
+}
+
+func TestHandler(t *testing.T) {
+	f, _ := New([]string{"127.0.0.1"}, nil)
+	h := f.Handler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(200)
+	}))
+	for addr, code := range map[string]int{"127.0.0.1:80": 200, "8.8.8.8:80": 403} {
+		recorder := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/qps", nil)
+		r.RemoteAddr = addr
+		h.ServeHTTP(recorder, r)
+		if recorder.Code != code {
+			t.Errorf("%s: status code is expected to be %d, found %d", addr, code, recorder.Code)
+		}
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ipfilter")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "ipfilter.conf")
+	ioutil.WriteFile(file, []byte("allow = 10.0.0.0/8\n"), 0644)
+
+	f, _ := New(nil, nil)
+	defer f.Close()
+	if err := f.WatchConfig("ini", file, 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if f.Allowed("192.168.1.1") {
+		t.Fatal("ip outside the allow list of the config should be blocked")
+	}
+
+	ioutil.WriteFile(file, []byte("allow = 10.0.0.0/8;192.168.0.0/16\n"), 0644)
+	os.Chtimes(file, time.Now().Add(time.Second), time.Now().Add(time.Second))
+	time.Sleep(100 * time.Millisecond)
+	if !f.Allowed("192.168.1.1") {
+		t.Fatal("reloaded allow list should be used")
+	}
+}
+
+func TestWatchCache(t *testing.T) {
+	bm, err := cache.NewCache("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm.Put("deny", "10.0.0.1,10.0.0.2", time.Minute)
+
+	f, _ := New(nil, nil)
+	defer f.Close()
+	if err := f.WatchCache(bm, "allow", "deny", 10*time.Millisecond); err == nil {
+		t.Fatal("a missing allow key should be an error")
+	}
+	if err := f.WatchCache(bm, "", "deny", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if f.Allowed("10.0.0.2") {
+		t.Fatal("ip of the cached deny list should be blocked")
+	}
+
+	bm.Put("deny", []string{"10.0.0.3"}, time.Minute)
+	time.Sleep(100 * time.Millisecond)
+	if !f.Allowed("10.0.0.2") || f.Allowed("10.0.0.3") {
+		t.Fatal("updated cached deny list should be used")
+	}
+}
+
+func TestWatchCacheMissing(t *testing.T) {
+	bm, err := cache.NewCache("memory", `{"interval":60}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm.Put("allow", "10.0.0.0/8", time.Minute)
+
+	f, _ := New(nil, nil)
+	defer f.Close()
+	if err := f.WatchCache(bm, "allow", "", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	bm.ClearAll()
+	time.Sleep(100 * time.Millisecond)
+	if f.Allowed("192.168.1.1") || !f.Allowed("10.0.0.1") {
+		t.Fatal("a flushed allow list should keep the previous rules")
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	f, _ := New(nil, nil)
+	f.Close()
+	f.Close()
+}
@@ -0,0 +1,207 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secure
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/context"
+	"github.com/izi-global/izigo/logs"
+)
+
+// Commonly used CSP directives.
+const (
+	DirectiveDefaultSrc     = "default-src"
+	DirectiveScriptSrc      = "script-src"
+	DirectiveStyleSrc       = "style-src"
+	DirectiveImgSrc         = "img-src"
+	DirectiveConnectSrc     = "connect-src"
+	DirectiveFontSrc        = "font-src"
+	DirectiveObjectSrc      = "object-src"
+	DirectiveFrameSrc       = "frame-src"
+	DirectiveFrameAncestors = "frame-ancestors"
+	DirectiveBaseURI        = "base-uri"
+	DirectiveFormAction     = "form-action"
+	DirectiveReportURI      = "report-uri"
+)
+
+// Commonly used CSP source expressions.
+const (
+	SourceSelf          = "'self'"
+	SourceNone          = "'none'"
+	SourceUnsafeInline  = "'unsafe-inline'"
+	SourceUnsafeEval    = "'unsafe-eval'"
+	SourceStrictDynamic = "'strict-dynamic'"
+)
+
+// CSP builds a Content-Security-Policy header value.
+// Directives are written in the order they were added.
+type CSP struct {
+	names   []string
+	sources map[string][]string
+	nonce   map[string]bool
+}
+
+// NewCSP returns an empty policy.
+func NewCSP() *CSP {
+	return &CSP{
+		sources: make(map[string][]string),
+		nonce:   make(map[string]bool),
+	}
+}
+
+// Add appends sources to the directive.
+func (c *CSP) Add(directive string, sources ...string) *CSP {
+	if _, ok := c.sources[directive]; !ok {
+		c.names = append(c.names, directive)
+	}
+	c.sources[directive] = append(c.sources[directive], sources...)
+	return c
+}
+
+// DefaultSrc appends sources to default-src.
+func (c *CSP) DefaultSrc(sources ...string) *CSP {
+	return c.Add(DirectiveDefaultSrc, sources...)
+}
+
+// ScriptSrc appends sources to script-src.
+func (c *CSP) ScriptSrc(sources ...string) *CSP {
+	return c.Add(DirectiveScriptSrc, sources...)
+}
+
+// StyleSrc appends sources to style-src.
+func (c *CSP) StyleSrc(sources ...string) *CSP {
+	return c.Add(DirectiveStyleSrc, sources...)
+}
+
+// ImgSrc appends sources to img-src.
+func (c *CSP) ImgSrc(sources ...string) *CSP {
+	return c.Add(DirectiveImgSrc, sources...)
+}
+
+// ConnectSrc appends sources to connect-src.
+func (c *CSP) ConnectSrc(sources ...string) *CSP {
+	return c.Add(DirectiveConnectSrc, sources...)
+}
+
+// FrameAncestors appends sources to frame-ancestors.
+func (c *CSP) FrameAncestors(sources ...string) *CSP {
+	return c.Add(DirectiveFrameAncestors, sources...)
+}
+
+// ReportURI sets the uri the browser posts violation reports to.
+func (c *CSP) ReportURI(uri string) *CSP {
+	if _, ok := c.sources[DirectiveReportURI]; ok {
+		c.sources[DirectiveReportURI] = []string{uri}
+		return c
+	}
+	return c.Add(DirectiveReportURI, uri)
+}
+
+// UseNonce adds the per-request nonce to the given directives,
+// such as script-src and style-src.
+func (c *CSP) UseNonce(directives ...string) *CSP {
+	for _, d := range directives {
+		if _, ok := c.sources[d]; !ok {
+			c.names = append(c.names, d)
+			c.sources[d] = nil
+		}
+		c.nonce[d] = true
+	}
+	return c
+}
+
+// HasNonce returns whether any directive uses the nonce.
+func (c *CSP) HasNonce() bool {
+	return len(c.nonce) > 0
+}
+
+// Build returns the header value with nonce substituted.
+func (c *CSP) Build(nonce string) string {
+	parts := make([]string, 0, len(c.names))
+	for _, name := range c.names {
+		values := c.sources[name]
+		if nonce != "" && c.nonce[name] {
+			values = append(values[:len(values):len(values)], "'nonce-"+nonce+"'")
+		}
+		if len(values) == 0 {
+			parts = append(parts, name)
+			continue
+		}
+		parts = append(parts, name+" "+strings.Join(values, " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Report is a CSP violation report sent by the browser.
+type Report struct {
+	DocumentURI        string `json:"document-uri"`
+	Referrer           string `json:"referrer"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	OriginalPolicy     string `json:"original-policy"`
+	Disposition        string `json:"disposition"`
+	BlockedURI         string `json:"blocked-uri"`
+	SourceFile         string `json:"source-file"`
+	LineNumber         int    `json:"line-number"`
+	ColumnNumber       int    `json:"column-number"`
+	StatusCode         int    `json:"status-code"`
+	ScriptSample       string `json:"script-sample"`
+}
+
+// MaxReportSize is the size in bytes of the largest report read by ReportCollector.
+var MaxReportSize int64 = 64 << 10
+
+// ReportHandler handles a decoded violation report.
+type ReportHandler func(ctx *context.Context, report *Report)
+
+// ReportCollector returns a handler for the report-uri endpoint.
+// Reports are decoded and passed to h, if h is nil they are logged as warnings.
+// A report larger than MaxReportSize is answered with 413.
+//	izigo.Post("/csp-report", secure.ReportCollector(nil))
+func ReportCollector(h ReportHandler) izigo.FilterFunc {
+	if h == nil {
+		h = logReport
+	}
+	return func(ctx *context.Context) {
+		body, err := ioutil.ReadAll(io.LimitReader(ctx.Request.Body, MaxReportSize+1))
+		if err != nil {
+			ctx.ResponseWriter.WriteHeader(400)
+			return
+		}
+		if int64(len(body)) > MaxReportSize {
+			ctx.ResponseWriter.WriteHeader(413)
+			return
+		}
+		var wrapper struct {
+			Report *Report `json:"csp-report"`
+		}
+		if err := json.Unmarshal(body, &wrapper); err != nil || wrapper.Report == nil {
+			ctx.ResponseWriter.WriteHeader(400)
+			return
+		}
+		h(ctx, wrapper.Report)
+		ctx.ResponseWriter.WriteHeader(204)
+	}
+}
+
+func logReport(ctx *context.Context, r *Report) {
+	logs.Warn("csp violation: document-uri=%s violated-directive=%s blocked-uri=%s source-file=%s:%d",
+		r.DocumentURI, r.ViolatedDirective, r.BlockedURI, r.SourceFile, r.LineNumber)
+}
@@ -0,0 +1,206 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package secure provides a filter that sets the common security headers
+// and a Content-Security-Policy with a per-request nonce.
+// Simple Usage:
+//	import(
+//		"github.com/izi-global/izigo"
+//		"github.com/izi-global/izigo/plugins/secure"
+//	)
+//
+//	func main(){
+//		// HSTS, X-Frame-Options, nosniff, Referrer-Policy, COOP ...
+//		izigo.InsertFilter("*", izigo.BeforeRouter, secure.Default())
+//		izigo.Run()
+//	}
+//
+// Content-Security-Policy Usage:
+//
+//	opts := secure.DefaultOptions()
+//	opts.CSP = secure.NewCSP().
+//		DefaultSrc(secure.SourceSelf).
+//		ScriptSrc(secure.SourceSelf).
+//		UseNonce(secure.DirectiveScriptSrc).
+//		ReportURI("/csp-report")
+//	opts.CSPReportOnly = true
+//	izigo.InsertFilter("*", izigo.BeforeRouter, secure.Allow(opts))
+//	izigo.Post("/csp-report", secure.ReportCollector(nil))
+//
+// In the templates rendered by Controller.Render the nonce of the
+// current request is available through the csp_nonce function:
+//
+//	<script nonce="{{csp_nonce .}}">...</script>
+package secure
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/context"
+)
+
+const (
+	headerHSTS                      = "Strict-Transport-Security"
+	headerFrameOptions              = "X-Frame-Options"
+	headerContentTypeOptions        = "X-Content-Type-Options"
+	headerReferrerPolicy            = "Referrer-Policy"
+	headerPermissionsPolicy         = "Permissions-Policy"
+	headerCrossOriginOpenerPolicy   = "Cross-Origin-Opener-Policy"
+	headerCrossOriginEmbedderPolicy = "Cross-Origin-Embedder-Policy"
+	headerCSP                       = "Content-Security-Policy"
+	headerCSPReportOnly             = "Content-Security-Policy-Report-Only"
+)
+
+// NonceKey is the key of the per-request CSP nonce in context.Input.Data().
+const NonceKey = "CSPNonce"
+
+func init() {
+	izigo.AddFuncMap("csp_nonce", TemplateNonce)
+}
+
+// Options represents the security headers set by the filter.
+// An empty value disables the corresponding header.
+type Options struct {
+	// Max age of the HSTS policy, sent only for https requests.
+	HSTSMaxAge time.Duration
+	// If set, the HSTS policy also applies to all subdomains.
+	HSTSIncludeSubdomains bool
+	// If set, the site asks to be included in the browsers HSTS preload list.
+	HSTSPreload bool
+	// Value of X-Frame-Options, such as DENY or SAMEORIGIN.
+	FrameOptions string
+	// If set, X-Content-Type-Options: nosniff is sent.
+	ContentTypeNosniff bool
+	// Value of Referrer-Policy.
+	ReferrerPolicy string
+	// Value of Permissions-Policy.
+	PermissionsPolicy string
+	// Value of Cross-Origin-Opener-Policy.
+	CrossOriginOpenerPolicy string
+	// Value of Cross-Origin-Embedder-Policy.
+	CrossOriginEmbedderPolicy string
+	// Content-Security-Policy of the responses.
+	CSP *CSP
+	// If set, the policy is sent as Content-Security-Policy-Report-Only.
+	CSPReportOnly bool
+}
+
+// DefaultOptions returns the options used by Default.
+// COEP is left empty because require-corp breaks most pages
+// that load cross origin resources.
+func DefaultOptions() *Options {
+	return &Options{
+		HSTSMaxAge:              365 * 24 * time.Hour,
+		HSTSIncludeSubdomains:   true,
+		FrameOptions:            "SAMEORIGIN",
+		ContentTypeNosniff:      true,
+		ReferrerPolicy:          "strict-origin-when-cross-origin",
+		PermissionsPolicy:       "camera=(), microphone=(), geolocation=()",
+		CrossOriginOpenerPolicy: "same-origin",
+	}
+}
+
+// Header converts options into the security headers for a request.
+// nonce is substituted into the CSP directives which use it.
+func (o *Options) Header(secure bool, nonce string) (headers map[string]string) {
+	headers = make(map[string]string)
+	if secure && o.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(int64(o.HSTSMaxAge/time.Second), 10)
+		if o.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if o.HSTSPreload {
+			hsts += "; preload"
+		}
+		headers[headerHSTS] = hsts
+	}
+	if o.FrameOptions != "" {
+		headers[headerFrameOptions] = o.FrameOptions
+	}
+	if o.ContentTypeNosniff {
+		headers[headerContentTypeOptions] = "nosniff"
+	}
+	if o.ReferrerPolicy != "" {
+		headers[headerReferrerPolicy] = o.ReferrerPolicy
+	}
+	if o.PermissionsPolicy != "" {
+		headers[headerPermissionsPolicy] = o.PermissionsPolicy
+	}
+	if o.CrossOriginOpenerPolicy != "" {
+		headers[headerCrossOriginOpenerPolicy] = o.CrossOriginOpenerPolicy
+	}
+	if o.CrossOriginEmbedderPolicy != "" {
+		headers[headerCrossOriginEmbedderPolicy] = o.CrossOriginEmbedderPolicy
+	}
+	if o.CSP != nil {
+		if policy := o.CSP.Build(nonce); policy != "" {
+			if o.CSPReportOnly {
+				headers[headerCSPReportOnly] = policy
+			} else {
+				headers[headerCSP] = policy
+			}
+		}
+	}
+	return
+}
+
+// Default sets the security headers of DefaultOptions.
+func Default() izigo.FilterFunc {
+	return Allow(DefaultOptions())
+}
+
+// Allow sets the security headers described by opts on every matched request.
+func Allow(opts *Options) izigo.FilterFunc {
+	return func(ctx *context.Context) {
+		var nonce string
+		if opts.CSP != nil && opts.CSP.HasNonce() {
+			nonce = newNonce()
+			ctx.Input.SetData(NonceKey, nonce)
+		}
+		for key, value := range opts.Header(ctx.Input.IsSecure(), nonce) {
+			ctx.Output.Header(key, value)
+		}
+	}
+}
+
+// Nonce returns the CSP nonce generated for this request.
+// if no nonce is used, return empty string.
+func Nonce(ctx *context.Context) string {
+	if v, ok := ctx.Input.GetData(NonceKey).(string); ok {
+		return v
+	}
+	return ""
+}
+
+// TemplateNonce returns the CSP nonce stored in the template data.
+// It is registered as the csp_nonce template function.
+func TemplateNonce(data map[interface{}]interface{}) string {
+	if v, ok := data[NonceKey].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("secure: can't read random bytes: " + err.Error())
+	}
+	return strings.TrimRight(base64.StdEncoding.EncodeToString(b), "=")
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package secure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/izi-global/izigo"
+	"github.com/izi-global/izigo/context"
+)
+
+func Test_Default(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := izigo.NewControllerRegister()
+	handler.InsertFilter("*", izigo.BeforeRouter, Default())
+	handler.Any("/foo", func(ctx *context.Context) {
+		ctx.Output.SetStatus(200)
+	})
+	r, _ := http.NewRequest("GET", "/foo", nil)
+	handler.ServeHTTP(recorder, r)
+
+	if v := recorder.HeaderMap.Get(headerFrameOptions); v != "SAMEORIGIN" {
+		t.Errorf("X-Frame-Options is expected to be SAMEORIGIN, found %v", v)
+	}
+	if v := recorder.HeaderMap.Get(headerContentTypeOptions); v != "nosniff" {
+		t.Errorf("X-Content-Type-Options is expected to be nosniff, found %v", v)
+	}
+	if v := recorder.HeaderMap.Get(headerCrossOriginOpenerPolicy); v != "same-origin" {
+		t.Errorf("Cross-Origin-Opener-Policy is expected to be same-origin, found %v", v)
+	}
+	if v := recorder.HeaderMap.Get(headerHSTS); v != "" {
+		t.Errorf("HSTS should not be sent over http, found %v", v)
+	}
+}
+
+func Test_HSTSOnSecure(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := izigo.NewControllerRegister()
+	handler.InsertFilter("*", izigo.BeforeRouter, Default())
+	handler.Any("/foo", func(ctx *context.Context) {
+		ctx.Output.SetStatus(200)
+	})
+	r, _ := http.NewRequest("GET", "https://example.com/foo", nil)
+	handler.ServeHTTP(recorder, r)
+
+	if v := recorder.HeaderMap.Get(headerHSTS); v != "max-age=31536000; includeSubDomains" {
+		t.Errorf("HSTS is expected to be max-age=31536000; includeSubDomains, found %v", v)
+	}
+}
+
+func Test_CSPNonce(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := izigo.NewControllerRegister()
+	opts := &Options{
+		CSP: NewCSP().DefaultSrc(SourceSelf).ScriptSrc(SourceSelf).UseNonce(DirectiveScriptSrc),
+	}
+	handler.InsertFilter("*", izigo.BeforeRouter, Allow(opts))
+	var nonce string
+	handler.Any("/foo", func(ctx *context.Context) {
+		nonce = TemplateNonce(ctx.Input.Data())
+		ctx.Output.SetStatus(200)
+	})
+	r, _ := http.NewRequest("GET", "/foo", nil)
+	handler.ServeHTTP(recorder, r)
+
+	if nonce == "" {
+		t.Fatal("nonce is expected in the context data")
+	}
+	expected := "default-src 'self'; script-src 'self' 'nonce-" + nonce + "'"
+	if v := recorder.HeaderMap.Get(headerCSP); v != expected {
+		t.Errorf("Content-Security-Policy is expected to be %v, found %v", expected, v)
+	}
+}
+
+func Test_CSPReportOnly(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handler := izigo.NewControllerRegister()
+	handler.InsertFilter("*", izigo.BeforeRouter, Allow(&Options{
+		CSP:           NewCSP().DefaultSrc(SourceNone).ReportURI("/csp-report"),
+		CSPReportOnly: true,
+	}))
+	var got *Report
+	handler.Post("/csp-report", ReportCollector(func(ctx *context.Context, report *Report) {
+		got = report
+	}))
+	handler.Any("/foo", func(ctx *context.Context) {
+		ctx.Output.SetStatus(200)
+	})
+	r, _ := http.NewRequest("GET", "/foo", nil)
+	handler.ServeHTTP(recorder, r)
+
+	if v := recorder.HeaderMap.Get(headerCSPReportOnly); v != "default-src 'none'; report-uri /csp-report" {
+		t.Errorf("Content-Security-Policy-Report-Only is unexpected, found %v", v)
+	}
+	if v := recorder.HeaderMap.Get(headerCSP); v != "" {
+		t.Errorf("Content-Security-Policy should not be sent, found %v", v)
+	}
+
+	recorder = httptest.NewRecorder()
+	body := `{"csp-report":{"document-uri":"http://example.com/foo","violated-directive":"default-src 'none'","blocked-uri":"inline"}}`
+	r, _ = http.NewRequest("POST", "/csp-report", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/csp-report")
+	handler.ServeHTTP(recorder, r)
+
+	if recorder.Code != http.StatusNoContent {
+		t.Errorf("Status code is expected to be 204, found %d", recorder.Code)
+	}
+	if got == nil || got.BlockedURI != "inline" {
+		t.Errorf("report is not collected, found %v", got)
+	}
+
+	got = nil
+	recorder = httptest.NewRecorder()
+	body = `{"csp-report":{"blocked-uri":"` + strings.Repeat("a", int(MaxReportSize)) + `"}}`
+	r, _ = http.NewRequest("POST", "/csp-report", strings.NewReader(body))
+	handler.ServeHTTP(recorder, r)
+	if recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Status code is expected to be 413, found %d", recorder.Code)
+	}
+	if got != nil {
+		t.Errorf("report larger than MaxReportSize is not expected to be collected, found %v", got)
+	}
+}
@@ -74,7 +74,8 @@ var (
 		"ServeYAML", "ServeXML", "Input", "ParseForm", "GetString", "GetStrings", "GetInt", "GetBool",
 		"GetFloat", "GetFile", "SaveToFile", "StartSession", "SetSession", "GetSession",
 		"DelSession", "SessionRegenerateID", "DestroySession", "IsAjax", "GetSecureCookie",
-		"SetSecureCookie", "XsrfToken", "CheckXsrfCookie", "XsrfFormHtml",
+		"SetSecureCookie", "GetSignedCookie", "SetSignedCookie", "GetEncryptedCookie",
+		"SetEncryptedCookie", "XsrfToken", "CheckXsrfCookie", "XsrfFormHtml",
 		"GetControllerAndAction", "ServeFormatted"}
 
 	urlPlaceholder = "{{placeholder}}"
@@ -672,6 +673,7 @@ func (p *ControllerRegister) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 	}
 
 	context.Output.EnableGzip = BConfig.EnableGzip
+	context.Output.EnableETag = BConfig.EnableETag
 
 	if BConfig.RunMode == DEV {
 		context.Output.Header("Server", BConfig.ServerName)
@@ -711,7 +713,8 @@ func (p *ControllerRegister) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 	// session init
 	if BConfig.WebConfig.Session.SessionOn {
 		var err error
-		context.Input.CruSession, err = GlobalSessions.SessionStart(rw, r)
+		// the stores sending the session in a header are issued before the response is written
+		context.Input.CruSession, err = GlobalSessions.SessionStart(context.ResponseWriter, r)
 		if err != nil {
 			logs.Error(err)
 			exception("503", context)
@@ -719,7 +722,7 @@ func (p *ControllerRegister) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 		}
 		defer func() {
 			if context.Input.CruSession != nil {
-				context.Input.CruSession.SessionRelease(rw)
+				context.Input.CruSession.SessionRelease(context.ResponseWriter)
 			}
 		}()
 	}
@@ -999,7 +1002,7 @@ func logAccess(ctx *izicontext.Context, startTime *time.Time, statusCode int) {
 		RequestMethod:  r.Method,
 		Request:        fmt.Sprintf("%s %s %s", r.Method, r.RequestURI, r.Proto),
 		ServerProtocol: r.Proto,
-		Host:           r.Host,
+		Host:           ctx.Input.Host(),
 		Status:         statusCode,
 		ElapsedTime:    elapsedTime,
 		HTTPReferrer:   r.Header.Get("Referer"),
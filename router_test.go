@@ -15,6 +15,7 @@
 package izigo
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -22,6 +23,8 @@ import (
 
 	"github.com/izi-global/izigo/context"
 	"github.com/izi-global/izigo/logs"
+	"github.com/izi-global/izigo/session"
+	_ "github.com/izi-global/izigo/session/token"
 )
 
 type TestController struct {
@@ -722,3 +725,78 @@ func TestYAMLPrepare(t *testing.T) {
 		t.Errorf(w.Body.String())
 	}
 }
+
+type ETagController struct {
+	Controller
+}
+
+func (jc *ETagController) Get() {
+	jc.Data["json"] = map[string]string{"name": "diepdt"}
+	jc.ServeJSON()
+}
+
+func TestEnableETag(t *testing.T) {
+	BConfig.EnableETag = true
+	defer func() { BConfig.EnableETag = false }()
+	handler := NewControllerRegister()
+	handler.Add("/etag", &ETagController{})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/etag", nil)
+	handler.ServeHTTP(w, r)
+	etag := w.HeaderMap.Get("ETag")
+	if etag == "" || w.Code != http.StatusOK {
+		t.Fatalf("JSON response is expected to get an ETag, found %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/etag", nil)
+	r.Header.Set("If-None-Match", etag)
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("matching If-None-Match is expected to get 304, found %d %s", w.Code, w.Body.String())
+	}
+}
+
+// the token of a session is issued before the handler writes the body
+func TestSessionTokenHeader(t *testing.T) {
+	oldSessions, oldConf := GlobalSessions, BConfig.WebConfig
+	defer func() { GlobalSessions, BConfig.WebConfig = oldSessions, oldConf }()
+	var err error
+	GlobalSessions, err = session.NewManager("token", &session.ManagerConfig{
+		CookieName:              "token",
+		Gclifetime:              3600,
+		Maxlifetime:             3600,
+		EnableSidInHTTPHeader:   true,
+		SessionNameInHTTPHeader: "Authorization",
+		ProviderConfig:          `{"transport":"header","secretKeys":["secret"]}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	BConfig.WebConfig.Session.SessionOn = true
+
+	handler := NewControllerRegister()
+	handler.Get("/login", func(ctx *context.Context) {
+		ctx.Input.CruSession.Set("username", "diepdt")
+		ctx.Output.Body([]byte("welcome"))
+	})
+	handler.Get("/me", func(ctx *context.Context) {
+		ctx.Output.Body([]byte(fmt.Sprint(ctx.Input.CruSession.Get("username"))))
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+	token := w.Result().Header.Get("X-Session-Token")
+	if token == "" {
+		t.Fatal("token is expected to be sent with the response")
+	}
+
+	r := httptest.NewRequest("GET", "/me", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if body := w.Body.String(); body != "diepdt" {
+		t.Errorf("session of the token is expected to hold diepdt, found %s", body)
+	}
+}
@@ -36,6 +36,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/izi-global/izigo/session"
 
@@ -102,6 +103,11 @@ func (rs *SessionStore) SessionRelease(w http.ResponseWriter) {
 	client.Set(&item)
 }
 
+// SessionTouch refreshes the expiry of an unmodified session without writing it
+func (rs *SessionStore) SessionTouch(w http.ResponseWriter) {
+	client.Touch(rs.sid, int32(rs.maxlifetime))
+}
+
 // MemProvider memcache session provider
 type MemProvider struct {
 	maxlifetime int64
@@ -208,6 +214,60 @@ func (rp *MemProvider) SessionDestroy(sid string) error {
 	return client.Delete(sid)
 }
 
+// lockReleased is the value of a released lock, memcache can not delete a key
+// only if it holds a token, so the lock is swapped to it and can be taken again.
+const lockReleased = "released"
+
+// SessionLock locks the session sid across processes with ADD,
+// which only succeeds if the lock key does not exist, or with CAS
+// on a lock released by an other process.
+func (rp *MemProvider) SessionLock(sid string, timeout, ttl time.Duration) (func(), error) {
+	if client == nil {
+		if err := rp.connectInit(); err != nil {
+			return nil, err
+		}
+	}
+	key := sid + ":lock"
+	token := session.NewLockToken()
+	expiration := int32(ttl / time.Second)
+	if ttl%time.Second != 0 || expiration < 1 {
+		expiration++
+	}
+	err := session.WaitLock(timeout, func() (bool, error) {
+		err := client.Add(&memcache.Item{Key: key, Value: []byte(token), Expiration: expiration})
+		if err != memcache.ErrNotStored {
+			return err == nil, err
+		}
+		return swapLock(key, lockReleased, token, expiration)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		swapLock(key, token, lockReleased, 1)
+	}, nil
+}
+
+// swapLock sets the lock key to val if it holds old, with gets and cas.
+func swapLock(key, old, val string, expiration int32) (bool, error) {
+	item, err := client.Get(key)
+	if err == memcache.ErrCacheMiss {
+		return false, nil
+	}
+	if err != nil || string(item.Value) != old {
+		return false, err
+	}
+	item.Value = []byte(val)
+	item.Expiration = expiration
+	switch err = client.CompareAndSwap(item); err {
+	case nil:
+		return true, nil
+	case memcache.ErrCASConflict, memcache.ErrNotStored:
+		return false, nil
+	}
+	return false, err
+}
+
 func (rp *MemProvider) connectInit() error {
 	client = memcache.New(rp.conninfo...)
 	return nil
@@ -26,6 +26,18 @@
 //	PRIMARY KEY (`session_key`)
 //	) ENGINE=MyISAM DEFAULT CHARSET=utf8;
 //
+// listing and revoking the sessions of a user (session.IndexedProvider) needs:
+//	CREATE TABLE `session_info` (
+//	`session_key` char(64) NOT NULL,
+//	`principal` varchar(255) NOT NULL DEFAULT '',
+//	`created` int(11) unsigned NOT NULL,
+//	`last_seen` int(11) unsigned NOT NULL,
+//	`ip` varchar(64) NOT NULL DEFAULT '',
+//	`user_agent` varchar(255) NOT NULL DEFAULT '',
+//	PRIMARY KEY (`session_key`),
+//	KEY `principal` (`principal`)
+//	) ENGINE=MyISAM DEFAULT CHARSET=utf8;
+//
 // Usage:
 // import(
 //   _ "github.com/izi-global/izigo/session/mysql"
@@ -41,7 +53,11 @@
 package mysql
 
 import (
+	"context"
+	"crypto/sha1"
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -54,9 +70,13 @@ import (
 var (
 	// TableName store the session in MySQL
 	TableName = "session"
-	mysqlpder = &Provider{}
+	// InfoTableName store the session info in MySQL
+	InfoTableName = "session_info"
+	mysqlpder     = &Provider{}
 )
 
+var errConnect = errors.New("mysql session: can not connect")
+
 // SessionStore mysql session store
 type SessionStore struct {
 	c      *sql.DB
@@ -117,6 +137,13 @@ func (st *SessionStore) SessionRelease(w http.ResponseWriter) {
 		b, time.Now().Unix(), st.sid)
 }
 
+// SessionTouch refreshes the expiry of an unmodified session without writing its values.
+func (st *SessionStore) SessionTouch(w http.ResponseWriter) {
+	defer st.c.Close()
+	st.c.Exec("UPDATE "+TableName+" set `session_expiry`=? where session_key=?",
+		time.Now().Unix(), st.sid)
+}
+
 // Provider mysql session provider
 type Provider struct {
 	maxlifetime int64
@@ -183,6 +210,7 @@ func (mp *Provider) SessionRegenerate(oldsid, sid string) (session.Store, error)
 		c.Exec("insert into "+TableName+"(`session_key`,`session_data`,`session_expiry`) values(?,?,?)", oldsid, "", time.Now().Unix())
 	}
 	c.Exec("update "+TableName+" set `session_key`=? where session_key=?", sid, oldsid)
+	c.Exec("update "+InfoTableName+" set `session_key`=? where session_key=?", sid, oldsid)
 	var kv map[interface{}]interface{}
 	if len(sessiondata) == 0 {
 		kv = make(map[interface{}]interface{})
@@ -200,14 +228,137 @@ func (mp *Provider) SessionRegenerate(oldsid, sid string) (session.Store, error)
 func (mp *Provider) SessionDestroy(sid string) error {
 	c := mp.connectInit()
 	c.Exec("DELETE FROM "+TableName+" where session_key=?", sid)
+	c.Exec("DELETE FROM "+InfoTableName+" where session_key=?", sid)
 	c.Close()
 	return nil
 }
 
+// SessionSeen records a request in the info of the session sid
+func (mp *Provider) SessionSeen(sid, ip, userAgent string, at time.Time) error {
+	c := mp.connectInit()
+	if c == nil {
+		return errConnect
+	}
+	defer c.Close()
+	_, err := c.Exec("INSERT INTO "+InfoTableName+" (`session_key`,`created`,`last_seen`,`ip`,`user_agent`) values(?,?,?,?,?)"+
+		" ON DUPLICATE KEY UPDATE `last_seen`=VALUES(`last_seen`), `ip`=VALUES(`ip`), `user_agent`=VALUES(`user_agent`)",
+		sid, at.Unix(), at.Unix(), ip, userAgent)
+	return err
+}
+
+// SessionBind associates the session sid with principal
+func (mp *Provider) SessionBind(sid, principal string) error {
+	c := mp.connectInit()
+	if c == nil {
+		return errConnect
+	}
+	defer c.Close()
+	_, err := c.Exec("UPDATE "+InfoTableName+" set `principal`=? where session_key=?", principal, sid)
+	return err
+}
+
+func (mp *Provider) queryInfos(c *sql.DB, where string, arg string) ([]*session.SessionInfo, error) {
+	rows, err := c.Query("SELECT `session_key`,`principal`,`created`,`last_seen`,`ip`,`user_agent` FROM "+InfoTableName+" where "+where, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var infos []*session.SessionInfo
+	for rows.Next() {
+		var created, lastSeen int64
+		info := &session.SessionInfo{}
+		if err := rows.Scan(&info.SID, &info.Principal, &created, &lastSeen, &info.IP, &info.UserAgent); err != nil {
+			return nil, err
+		}
+		info.Created, info.LastSeen = time.Unix(created, 0), time.Unix(lastSeen, 0)
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+// SessionInfo returns the info of the session sid
+func (mp *Provider) SessionInfo(sid string) (*session.SessionInfo, error) {
+	c := mp.connectInit()
+	if c == nil {
+		return nil, errConnect
+	}
+	defer c.Close()
+	infos, err := mp.queryInfos(c, "session_key=?", sid)
+	if err != nil || len(infos) == 0 {
+		return nil, err
+	}
+	return infos[0], nil
+}
+
+// SessionsOf returns the sessions bound to principal
+func (mp *Provider) SessionsOf(principal string) ([]*session.SessionInfo, error) {
+	c := mp.connectInit()
+	if c == nil {
+		return nil, errConnect
+	}
+	defer c.Close()
+	return mp.queryInfos(c, "principal=? and principal<>''", principal)
+}
+
+// SessionDestroyAll deletes the sessions bound to principal
+func (mp *Provider) SessionDestroyAll(principal string) (int, error) {
+	if principal == "" {
+		return 0, nil
+	}
+	c := mp.connectInit()
+	if c == nil {
+		return 0, errConnect
+	}
+	defer c.Close()
+	_, err := c.Exec("DELETE FROM "+TableName+" where session_key in (SELECT session_key FROM "+InfoTableName+" where principal=?)", principal)
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.Exec("DELETE FROM "+InfoTableName+" where principal=?", principal)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// SessionLock locks the session sid across processes with GET_LOCK.
+// The lock is held by a dedicated connection, MySQL releases it when
+// the connection is lost, so ttl is not used.
+func (mp *Provider) SessionLock(sid string, timeout, ttl time.Duration) (func(), error) {
+	db := mp.connectInit()
+	if db == nil {
+		return nil, errConnect
+	}
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	name := fmt.Sprintf("session:%x", sha1.Sum([]byte(sid)))
+	var ok sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int64(timeout/time.Second)).Scan(&ok)
+	if err == nil && ok.Int64 != 1 {
+		err = session.ErrLockTimeout
+	}
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+		conn.Close()
+		db.Close()
+	}, nil
+}
+
 // SessionGC delete expired values in mysql session
 func (mp *Provider) SessionGC() {
 	c := mp.connectInit()
 	c.Exec("DELETE from "+TableName+" where session_expiry < ?", time.Now().Unix()-mp.maxlifetime)
+	c.Exec("DELETE from "+InfoTableName+" where last_seen < ?", time.Now().Unix()-mp.maxlifetime)
 	c.Close()
 }
 
@@ -28,6 +28,19 @@
 // CONSTRAINT session_key PRIMARY KEY(session_key)
 // );
 //
+// listing and revoking the sessions of a user (session.IndexedProvider) needs:
+//
+// CREATE TABLE session_info (
+// session_key	char(64) NOT NULL,
+// principal	varchar(255) NOT NULL DEFAULT '',
+// created	timestamp NOT NULL,
+// last_seen	timestamp NOT NULL,
+// ip	varchar(64) NOT NULL DEFAULT '',
+// user_agent	varchar(255) NOT NULL DEFAULT '',
+// CONSTRAINT session_info_key PRIMARY KEY(session_key)
+// );
+// CREATE INDEX session_info_principal ON session_info(principal);
+//
 // will be activated with these settings in app.conf:
 //
 // SessionOn = true
@@ -51,8 +64,12 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"hash/fnv"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -124,6 +141,15 @@ func (st *SessionStore) SessionRelease(w http.ResponseWriter) {
 
 }
 
+// SessionTouch refreshes the expiry of an unmodified session without writing its values.
+func (st *SessionStore) SessionTouch(w http.ResponseWriter) {
+	defer st.c.Close()
+	st.c.Exec("UPDATE session set session_expiry=$1 where session_key=$2",
+		time.Now().Format(time.RFC3339), st.sid)
+}
+
+var errConnect = errors.New("postgresql session: can not connect")
+
 // Provider postgresql session provider
 type Provider struct {
 	maxlifetime int64
@@ -198,6 +224,7 @@ func (mp *Provider) SessionRegenerate(oldsid, sid string) (session.Store, error)
 			oldsid, "", time.Now().Format(time.RFC3339))
 	}
 	c.Exec("update session set session_key=$1 where session_key=$2", sid, oldsid)
+	c.Exec("update session_info set session_key=$1 where session_key=$2", sid, oldsid)
 	var kv map[interface{}]interface{}
 	if len(sessiondata) == 0 {
 		kv = make(map[interface{}]interface{})
@@ -215,14 +242,138 @@ func (mp *Provider) SessionRegenerate(oldsid, sid string) (session.Store, error)
 func (mp *Provider) SessionDestroy(sid string) error {
 	c := mp.connectInit()
 	c.Exec("DELETE FROM session where session_key=$1", sid)
+	c.Exec("DELETE FROM session_info where session_key=$1", sid)
 	c.Close()
 	return nil
 }
 
+// SessionSeen records a request in the info of the session sid
+func (mp *Provider) SessionSeen(sid, ip, userAgent string, at time.Time) error {
+	c := mp.connectInit()
+	if c == nil {
+		return errConnect
+	}
+	defer c.Close()
+	_, err := c.Exec("INSERT INTO session_info(session_key,created,last_seen,ip,user_agent) values($1,$2,$2,$3,$4)"+
+		" ON CONFLICT (session_key) DO UPDATE SET last_seen=EXCLUDED.last_seen, ip=EXCLUDED.ip, user_agent=EXCLUDED.user_agent",
+		sid, at.Format(time.RFC3339), ip, userAgent)
+	return err
+}
+
+// SessionBind associates the session sid with principal
+func (mp *Provider) SessionBind(sid, principal string) error {
+	c := mp.connectInit()
+	if c == nil {
+		return errConnect
+	}
+	defer c.Close()
+	_, err := c.Exec("UPDATE session_info set principal=$1 where session_key=$2", principal, sid)
+	return err
+}
+
+func (mp *Provider) queryInfos(c *sql.DB, where string, arg string) ([]*session.SessionInfo, error) {
+	rows, err := c.Query("SELECT session_key,principal,created,last_seen,ip,user_agent FROM session_info where "+where, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var infos []*session.SessionInfo
+	for rows.Next() {
+		info := &session.SessionInfo{}
+		if err := rows.Scan(&info.SID, &info.Principal, &info.Created, &info.LastSeen, &info.IP, &info.UserAgent); err != nil {
+			return nil, err
+		}
+		info.SID = strings.TrimSpace(info.SID)
+		infos = append(infos, info)
+	}
+	return infos, rows.Err()
+}
+
+// SessionInfo returns the info of the session sid
+func (mp *Provider) SessionInfo(sid string) (*session.SessionInfo, error) {
+	c := mp.connectInit()
+	if c == nil {
+		return nil, errConnect
+	}
+	defer c.Close()
+	infos, err := mp.queryInfos(c, "session_key=$1", sid)
+	if err != nil || len(infos) == 0 {
+		return nil, err
+	}
+	return infos[0], nil
+}
+
+// SessionsOf returns the sessions bound to principal
+func (mp *Provider) SessionsOf(principal string) ([]*session.SessionInfo, error) {
+	c := mp.connectInit()
+	if c == nil {
+		return nil, errConnect
+	}
+	defer c.Close()
+	return mp.queryInfos(c, "principal=$1 and principal<>''", principal)
+}
+
+// SessionDestroyAll deletes the sessions bound to principal
+func (mp *Provider) SessionDestroyAll(principal string) (int, error) {
+	if principal == "" {
+		return 0, nil
+	}
+	c := mp.connectInit()
+	if c == nil {
+		return 0, errConnect
+	}
+	defer c.Close()
+	_, err := c.Exec("DELETE FROM session where session_key in (SELECT session_key FROM session_info where principal=$1)", principal)
+	if err != nil {
+		return 0, err
+	}
+	res, err := c.Exec("DELETE FROM session_info where principal=$1", principal)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// SessionLock locks the session sid across processes with an advisory lock.
+// The lock is held by a dedicated connection, PostgreSQL releases it when
+// the connection is lost, so ttl is not used.
+func (mp *Provider) SessionLock(sid string, timeout, ttl time.Duration) (func(), error) {
+	db := mp.connectInit()
+	if db == nil {
+		return nil, errConnect
+	}
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	h := fnv.New64a()
+	h.Write([]byte(sid))
+	key := int64(h.Sum64())
+	err = session.WaitLock(timeout, func() (bool, error) {
+		var ok bool
+		err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&ok)
+		return ok, err
+	})
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key)
+		conn.Close()
+		db.Close()
+	}, nil
+}
+
 // SessionGC delete expired values in postgresql session
 func (mp *Provider) SessionGC() {
 	c := mp.connectInit()
 	c.Exec("DELETE from session where EXTRACT(EPOCH FROM (current_timestamp - session_expiry)) > $1", mp.maxlifetime)
+	c.Exec("DELETE from session_info where EXTRACT(EPOCH FROM (current_timestamp - last_seen)) > $1", mp.maxlifetime)
 	c.Close()
 }
 
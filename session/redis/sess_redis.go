@@ -108,6 +108,13 @@ func (rs *SessionStore) SessionRelease(w http.ResponseWriter) {
 	c.Do("SETEX", rs.sid, rs.maxlifetime, string(b))
 }
 
+// SessionTouch refreshes the expiry of an unmodified session without writing it
+func (rs *SessionStore) SessionTouch(w http.ResponseWriter) {
+	c := rs.p.Get()
+	defer c.Close()
+	c.Do("EXPIRE", rs.sid, rs.maxlifetime)
+}
+
 // Provider redis session provider
 type Provider struct {
 	maxlifetime int64
@@ -234,6 +241,13 @@ func (rp *Provider) SessionRegenerate(oldsid, sid string) (session.Store, error)
 	} else {
 		c.Do("RENAME", oldsid, sid)
 		c.Do("EXPIRE", sid, rp.maxlifetime)
+		if existed, _ := redis.Int(c.Do("EXISTS", infoKey(oldsid))); existed == 1 {
+			c.Do("RENAME", infoKey(oldsid), infoKey(sid))
+			if principal, _ := redis.String(c.Do("HGET", infoKey(sid), "principal")); principal != "" {
+				c.Do("SREM", principalKey(principal), oldsid)
+				c.Do("SADD", principalKey(principal), sid)
+			}
+		}
 	}
 	return rp.SessionRead(sid)
 }
@@ -243,10 +257,156 @@ func (rp *Provider) SessionDestroy(sid string) error {
 	c := rp.poollist.Get()
 	defer c.Close()
 
-	c.Do("DEL", sid)
+	if principal, _ := redis.String(c.Do("HGET", infoKey(sid), "principal")); principal != "" {
+		c.Do("SREM", principalKey(principal), sid)
+	}
+	c.Do("DEL", sid, infoKey(sid))
 	return nil
 }
 
+func infoKey(sid string) string {
+	return sid + ":info"
+}
+
+func principalKey(principal string) string {
+	return "session:principal:" + principal
+}
+
+// SessionSeen records a request in the info hash of the session sid,
+// and keeps the set of its principal as long as the session
+func (rp *Provider) SessionSeen(sid, ip, userAgent string, at time.Time) error {
+	c := rp.poollist.Get()
+	defer c.Close()
+	key := infoKey(sid)
+	c.Send("MULTI")
+	c.Send("HSETNX", key, "created", at.Unix())
+	c.Send("HMSET", key, "lastSeen", at.Unix(), "ip", ip, "userAgent", userAgent)
+	c.Send("EXPIRE", key, rp.maxlifetime)
+	c.Send("HGET", key, "principal")
+	replies, err := redis.Values(c.Do("EXEC"))
+	if err != nil {
+		return err
+	}
+	if principal, _ := redis.String(replies[3], nil); principal != "" {
+		_, err = c.Do("EXPIRE", principalKey(principal), rp.maxlifetime)
+	}
+	return err
+}
+
+// SessionBind associates the session sid with principal, in a set per principal
+func (rp *Provider) SessionBind(sid, principal string) error {
+	c := rp.poollist.Get()
+	defer c.Close()
+	key := infoKey(sid)
+	old, err := redis.String(c.Do("HGET", key, "principal"))
+	if err != nil && err != redis.ErrNil {
+		return err
+	}
+	if old != "" {
+		c.Do("SREM", principalKey(old), sid)
+	}
+	if _, err = c.Do("HSET", key, "principal", principal); err != nil {
+		return err
+	}
+	c.Do("EXPIRE", key, rp.maxlifetime)
+	if principal == "" {
+		return nil
+	}
+	if _, err = c.Do("SADD", principalKey(principal), sid); err != nil {
+		return err
+	}
+	_, err = c.Do("EXPIRE", principalKey(principal), rp.maxlifetime)
+	return err
+}
+
+func (rp *Provider) sessionInfo(c redis.Conn, sid string) (*session.SessionInfo, error) {
+	m, err := redis.StringMap(c.Do("HGETALL", infoKey(sid)))
+	if err != nil || len(m) == 0 {
+		return nil, err
+	}
+	created, _ := strconv.ParseInt(m["created"], 10, 64)
+	lastSeen, _ := strconv.ParseInt(m["lastSeen"], 10, 64)
+	return &session.SessionInfo{
+		SID:       sid,
+		Principal: m["principal"],
+		Created:   time.Unix(created, 0),
+		LastSeen:  time.Unix(lastSeen, 0),
+		IP:        m["ip"],
+		UserAgent: m["userAgent"],
+	}, nil
+}
+
+// SessionInfo returns the info of the session sid
+func (rp *Provider) SessionInfo(sid string) (*session.SessionInfo, error) {
+	c := rp.poollist.Get()
+	defer c.Close()
+	return rp.sessionInfo(c, sid)
+}
+
+// SessionsOf returns the sessions bound to principal, expired ones are removed from its set
+func (rp *Provider) SessionsOf(principal string) ([]*session.SessionInfo, error) {
+	c := rp.poollist.Get()
+	defer c.Close()
+	sids, err := redis.Strings(c.Do("SMEMBERS", principalKey(principal)))
+	if err != nil {
+		return nil, err
+	}
+	var infos []*session.SessionInfo
+	for _, sid := range sids {
+		info, err := rp.sessionInfo(c, sid)
+		if err != nil {
+			return nil, err
+		}
+		if info == nil || info.Principal != principal {
+			c.Do("SREM", principalKey(principal), sid)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// SessionDestroyAll deletes the sessions bound to principal
+func (rp *Provider) SessionDestroyAll(principal string) (int, error) {
+	infos, err := rp.SessionsOf(principal)
+	if err != nil {
+		return 0, err
+	}
+	c := rp.poollist.Get()
+	defer c.Close()
+	for _, info := range infos {
+		c.Do("DEL", info.SID, infoKey(info.SID))
+	}
+	_, err = c.Do("DEL", principalKey(principal))
+	return len(infos), err
+}
+
+// unlockScript deletes the lock only if it is still owned by the caller
+var unlockScript = redis.NewScript(1, `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// SessionLock locks the session sid across processes with SET NX
+func (rp *Provider) SessionLock(sid string, timeout, ttl time.Duration) (func(), error) {
+	key := sid + ":lock"
+	token := session.NewLockToken()
+	err := session.WaitLock(timeout, func() (bool, error) {
+		c := rp.poollist.Get()
+		defer c.Close()
+		_, err := redis.String(c.Do("SET", key, token, "NX", "PX", int64(ttl/time.Millisecond)))
+		if err == redis.ErrNil {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		c := rp.poollist.Get()
+		defer c.Close()
+		unlockScript.Do(c, key, token)
+	}, nil
+}
+
 // SessionGC Impelment method, no used.
 func (rp *Provider) SessionGC() {
 }
@@ -104,6 +104,11 @@ func (rs *SessionStore) SessionRelease(w http.ResponseWriter) {
 	c.Set(rs.sid, string(b), time.Duration(rs.maxlifetime) * time.Second)
 }
 
+// SessionTouch refreshes the expiry of an unmodified session without writing it
+func (rs *SessionStore) SessionTouch(w http.ResponseWriter) {
+	rs.p.Expire(rs.sid, time.Duration(rs.maxlifetime)*time.Second)
+}
+
 // Provider redis_cluster session provider
 type Provider struct {
 	maxlifetime int64
@@ -206,6 +211,24 @@ func (rp *Provider) SessionDestroy(sid string) error {
 	return nil
 }
 
+// unlockScript deletes the lock only if it is still owned by the caller
+const unlockScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+// SessionLock locks the session sid across processes with SETNX
+func (rp *Provider) SessionLock(sid string, timeout, ttl time.Duration) (func(), error) {
+	key := sid + ":lock"
+	token := session.NewLockToken()
+	err := session.WaitLock(timeout, func() (bool, error) {
+		return rp.poollist.SetNX(key, token, ttl).Result()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		rp.poollist.Eval(unlockScript, []string{key}, token)
+	}, nil
+}
+
 // SessionGC Impelment method, no used.
 func (rp *Provider) SessionGC() {
 }
@@ -21,6 +21,10 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+
+	"github.com/izi-global/izigo/config"
+	"github.com/izi-global/izigo/utils/cookie"
+	"github.com/izi-global/izigo/utils/keyring"
 )
 
 var cookiepder = &CookieProvider{}
@@ -74,25 +78,35 @@ func (st *CookieSessionStore) SessionID() string {
 
 // SessionRelease Write cookie session to http response cookie
 func (st *CookieSessionStore) SessionRelease(w http.ResponseWriter) {
-	encodedCookie, err := encodeCookie(cookiepder.block, cookiepder.config.SecurityKey, cookiepder.config.SecurityName, st.values)
+	var encodedCookie string
+	var err error
+	if cookiepder.keyring != nil {
+		encodedCookie, err = encodeKeyringCookie(cookiepder.keyring, cookiepder.config.CookieName, st.values)
+	} else {
+		encodedCookie, err = encodeCookie(cookiepder.block, cookiepder.config.SecurityKey, cookiepder.config.SecurityName, st.values)
+	}
 	if err == nil {
-		cookie := &http.Cookie{Name: cookiepder.config.CookieName,
-			Value:    url.QueryEscape(encodedCookie),
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   cookiepder.config.Secure,
-			MaxAge:   cookiepder.config.Maxage}
-		http.SetCookie(w, cookie)
+		sameSite, _ := cookie.ParseSameSite(cookiepder.config.SameSite)
+		cookie.Set(w, cookiepder.config.CookieName, url.QueryEscape(encodedCookie), &cookie.Options{
+			MaxAge:      int64(cookiepder.config.Maxage),
+			HTTPOnly:    true,
+			Secure:      cookiepder.config.Secure,
+			SameSite:    sameSite,
+			Partitioned: cookiepder.config.Partitioned,
+		})
 	}
 }
 
 type cookieConfig struct {
-	SecurityKey  string `json:"securityKey"`
-	BlockKey     string `json:"blockKey"`
-	SecurityName string `json:"securityName"`
-	CookieName   string `json:"cookieName"`
-	Secure       bool   `json:"secure"`
-	Maxage       int    `json:"maxage"`
+	SecurityKey  string   `json:"securityKey"`
+	BlockKey     string   `json:"blockKey"`
+	SecurityName string   `json:"securityName"`
+	CookieName   string   `json:"cookieName"`
+	Secure       bool     `json:"secure"`
+	Maxage       int      `json:"maxage"`
+	SecretKeys   []string `json:"secretKeys"`
+	SameSite     string   `json:"sameSite"`
+	Partitioned  bool     `json:"partitioned"`
 }
 
 // CookieProvider Cookie session provider
@@ -100,6 +114,13 @@ type CookieProvider struct {
 	maxlifetime int64
 	config      *cookieConfig
 	block       cipher.Block
+	keyring     *keyring.Keyring
+}
+
+// SetKeyring sets the keyring encrypting the cookies, it implements KeyringProvider.
+// The secretKeys of the provider config take precedence.
+func (pder *CookieProvider) SetKeyring(kr *keyring.Keyring) {
+	pder.keyring = kr
 }
 
 // SessionInit Init cookie session provider with max lifetime and config json.
@@ -110,6 +131,11 @@ type CookieProvider struct {
 // 	securityName - recognized name in encoded cookie string
 // 	cookieName - cookie name
 // 	maxage - cookie max life time.
+// 	secretKeys - secrets of the keyring encrypting the cookie with AES-GCM, the first one is the primary key.
+// 	  ${ENV} values are expanded. Cookies of securityKey and blockKey are still read when securityKey is set,
+// 	  so the keyring can be introduced without logging users out.
+// 	sameSite - Lax, Strict or None, None requires secure.
+// 	partitioned - set the Partitioned attribute, requires secure.
 func (pder *CookieProvider) SessionInit(maxlifetime int64, config string) error {
 	pder.config = &cookieConfig{}
 	err := json.Unmarshal([]byte(config), pder.config)
@@ -126,17 +152,44 @@ func (pder *CookieProvider) SessionInit(maxlifetime int64, config string) error
 	if err != nil {
 		return err
 	}
+	sameSite, err := cookie.ParseSameSite(pder.config.SameSite)
+	if err != nil {
+		return err
+	}
+	opts := &cookie.Options{Secure: pder.config.Secure, SameSite: sameSite, Partitioned: pder.config.Partitioned}
+	if err = opts.Validate(pder.config.CookieName); err != nil {
+		return err
+	}
+	if len(pder.config.SecretKeys) > 0 {
+		if pder.keyring, err = keyring.New(expandSecrets(pder.config.SecretKeys)...); err != nil {
+			return err
+		}
+	}
 	pder.maxlifetime = maxlifetime
 	return nil
 }
 
+func expandSecrets(secrets []string) []string {
+	expanded := make([]string, len(secrets))
+	for i, s := range secrets {
+		expanded[i] = config.ExpandValueEnv(s)
+	}
+	return expanded
+}
+
 // SessionRead Get SessionStore in cooke.
 // decode cooke string to map and put into SessionStore with sid.
 func (pder *CookieProvider) SessionRead(sid string) (Store, error) {
-	maps, _ := decodeCookie(pder.block,
-		pder.config.SecurityKey,
-		pder.config.SecurityName,
-		sid, pder.maxlifetime)
+	var maps map[interface{}]interface{}
+	if pder.keyring != nil {
+		maps, _ = decodeKeyringCookie(pder.keyring, pder.config.CookieName, sid, pder.maxlifetime)
+	}
+	if maps == nil && (pder.keyring == nil || pder.config.SecurityKey != "") {
+		maps, _ = decodeCookie(pder.block,
+			pder.config.SecurityKey,
+			pder.config.SecurityName,
+			sid, pder.maxlifetime)
+	}
 	if maps == nil {
 		maps = make(map[interface{}]interface{})
 	}
@@ -103,3 +103,74 @@ func TestDestorySessionCookie(t *testing.T) {
 		t.Fatal("after destroy session and reqeust again ,get cookie session id is same.")
 	}
 }
+
+func TestCookieKeyRotation(t *testing.T) {
+	newManager := func(secretKeys string) *Manager {
+		conf := &ManagerConfig{
+			CookieName:     "gosessionid",
+			Gclifetime:     3600,
+			ProviderConfig: `{"cookieName":"gosessionid","secretKeys":[` + secretKeys + `]}`,
+		}
+		manager, err := NewManager("cookie", conf)
+		if err != nil {
+			t.Fatal("init cookie session err", err)
+		}
+		return manager
+	}
+	read := func(manager *Manager, cookie string) interface{} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.Header.Set("Cookie", cookie)
+		sess, err := manager.SessionStart(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatal("session start err,", err)
+		}
+		return sess.Get("username")
+	}
+
+	manager := newManager(`"old"`)
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, _ := manager.SessionStart(w, r)
+	sess.Set("username", "diepdt")
+	sess.SessionRelease(w)
+	cookie := strings.Split(w.Header().Get("Set-Cookie"), ";")[0]
+
+	if username := read(newManager(`"new","old"`), cookie); username != "diepdt" {
+		t.Errorf("cookie of the old key is expected to be read after rotation, found %v", username)
+	}
+	if username := read(newManager(`"new"`), cookie); username != nil {
+		t.Errorf("cookie of a removed key should not be read, found %v", username)
+	}
+}
+
+func TestSessionCookieAttributes(t *testing.T) {
+	conf := &ManagerConfig{
+		CookieName:      "__Host-sid",
+		EnableSetCookie: true,
+		Gclifetime:      3600,
+		Secure:          true,
+		SameSite:        "lax",
+	}
+	manager, err := NewManager("memory", conf)
+	if err != nil {
+		t.Fatal("init session err", err)
+	}
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	if _, err := manager.SessionStart(w, r); err != nil {
+		t.Fatal("session start err,", err)
+	}
+	// secure is required by the prefix even on plain http
+	if sc := w.Header().Get("Set-Cookie"); !strings.Contains(sc, "; Secure; HttpOnly; SameSite=Lax") {
+		t.Errorf("session cookie is expected to be Secure and SameSite=Lax, found %q", sc)
+	}
+
+	conf = &ManagerConfig{CookieName: "__Host-sid", Gclifetime: 3600, Domain: "izi.asia", Secure: true}
+	if _, err := NewManager("memory", conf); err == nil {
+		t.Error("__Host- cookie with a domain should be rejected")
+	}
+	conf = &ManagerConfig{CookieName: "sid", Gclifetime: 3600, SameSite: "none"}
+	if _, err := NewManager("memory", conf); err == nil {
+		t.Error("SameSite=None without secure should be rejected")
+	}
+}
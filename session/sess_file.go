@@ -15,12 +15,14 @@
 package session
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -76,6 +78,10 @@ func (fs *FileSessionStore) SessionID() string {
 	return fs.sid
 }
 
+// SessionTouch releases an unmodified session, SessionRead already refreshed the file times.
+func (fs *FileSessionStore) SessionTouch(w http.ResponseWriter) {
+}
+
 // SessionRelease Write file session to local file with Gob string
 func (fs *FileSessionStore) SessionRelease(w http.ResponseWriter) {
 	filepder.lock.Lock()
@@ -180,6 +186,7 @@ func (fp *FileProvider) SessionDestroy(sid string) error {
 	filepder.lock.Lock()
 	defer filepder.lock.Unlock()
 	os.Remove(path.Join(fp.savePath, string(sid[0]), string(sid[1]), sid))
+	os.Remove(fp.infoPath(sid))
 	return nil
 }
 
@@ -253,6 +260,7 @@ func (fp *FileProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 		ioutil.WriteFile(newSidFile, b, 0777)
 		os.Remove(oldSidFile)
 		os.Chtimes(newSidFile, time.Now(), time.Now())
+		os.Rename(fp.infoPath(oldsid), fp.infoPath(sid))
 		ss := &FileSessionStore{sid: sid, values: kv}
 		return ss, nil
 	}
@@ -267,6 +275,114 @@ func (fp *FileProvider) SessionRegenerate(oldsid, sid string) (Store, error) {
 	return ss, nil
 }
 
+// infoSuffix is the suffix of the files holding the SessionInfo of a session,
+// next to its session file.
+const infoSuffix = ".info"
+
+func (fp *FileProvider) infoPath(sid string) string {
+	return path.Join(fp.savePath, string(sid[0]), string(sid[1]), sid+infoSuffix)
+}
+
+func (fp *FileProvider) readInfo(file string) (*SessionInfo, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	info := &SessionInfo{}
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, err
+	}
+	info.SID = strings.TrimSuffix(filepath.Base(file), infoSuffix)
+	return info, nil
+}
+
+func (fp *FileProvider) updateInfo(sid string, update func(info *SessionInfo)) error {
+	filepder.lock.Lock()
+	defer filepder.lock.Unlock()
+	if _, err := os.Stat(path.Join(fp.savePath, string(sid[0]), string(sid[1]), sid)); err != nil {
+		return nil
+	}
+	info, err := fp.readInfo(fp.infoPath(sid))
+	if os.IsNotExist(err) {
+		info, err = &SessionInfo{}, nil
+	}
+	if err != nil {
+		return err
+	}
+	update(info)
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp.infoPath(sid), b, 0666)
+}
+
+// SessionSeen records a request in the info file of the session sid.
+// Writing the file also keeps it from being collected by SessionGC.
+func (fp *FileProvider) SessionSeen(sid, ip, userAgent string, at time.Time) error {
+	return fp.updateInfo(sid, func(info *SessionInfo) {
+		info.Seen(ip, userAgent, at)
+	})
+}
+
+// SessionBind associates the session sid with principal.
+func (fp *FileProvider) SessionBind(sid, principal string) error {
+	return fp.updateInfo(sid, func(info *SessionInfo) {
+		info.Principal = principal
+	})
+}
+
+// SessionInfo returns the info of the session sid.
+func (fp *FileProvider) SessionInfo(sid string) (*SessionInfo, error) {
+	filepder.lock.RLock()
+	defer filepder.lock.RUnlock()
+	info, err := fp.readInfo(fp.infoPath(sid))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return info, err
+}
+
+// SessionsOf returns the sessions bound to principal.
+// It reads every info file, so it is meant for a moderate number of sessions.
+func (fp *FileProvider) SessionsOf(principal string) ([]*SessionInfo, error) {
+	filepder.lock.RLock()
+	defer filepder.lock.RUnlock()
+	return fp.sessionsOf(principal)
+}
+
+func (fp *FileProvider) sessionsOf(principal string) ([]*SessionInfo, error) {
+	var infos []*SessionInfo
+	if principal == "" {
+		return infos, nil
+	}
+	err := filepath.Walk(fp.savePath, func(file string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() || !strings.HasSuffix(file, infoSuffix) {
+			return err
+		}
+		if info, err := fp.readInfo(file); err == nil && info.Principal == principal {
+			infos = append(infos, info)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return infos, err
+}
+
+// SessionDestroyAll removes the files of the sessions bound to principal.
+func (fp *FileProvider) SessionDestroyAll(principal string) (int, error) {
+	filepder.lock.Lock()
+	defer filepder.lock.Unlock()
+	infos, err := fp.sessionsOf(principal)
+	for _, info := range infos {
+		os.Remove(path.Join(fp.savePath, string(info.SID[0]), string(info.SID[1]), info.SID))
+		os.Remove(fp.infoPath(info.SID))
+	}
+	return len(infos), err
+}
+
 // remove file in save path if expired
 func gcpath(path string, info os.FileInfo, err error) error {
 	if err != nil {
@@ -289,7 +405,7 @@ func (as *activeSession) visit(paths string, f os.FileInfo, err error) error {
 	if err != nil {
 		return err
 	}
-	if f.IsDir() {
+	if f.IsDir() || strings.HasSuffix(paths, infoSuffix) {
 		return nil
 	}
 	as.total = as.total + 1
@@ -0,0 +1,100 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotIndexed is returned by the Manager when ManagerConfig.EnableIndex is not set
+// or its provider does not implement IndexedProvider.
+var ErrNotIndexed = errors.New("session: provider does not index sessions")
+
+// maxUserAgent is the length the user agent is truncated to.
+const maxUserAgent = 255
+
+// SessionInfo describes an active session, so that a user can list
+// their devices and revoke them.
+type SessionInfo struct {
+	SID       string    `json:"sid"`
+	Principal string    `json:"principal"` // id of the user, empty until bound
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"lastSeen"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+}
+
+// Seen records a request made at, from ip with userAgent.
+func (info *SessionInfo) Seen(ip, userAgent string, at time.Time) {
+	if info.Created.IsZero() {
+		info.Created = at
+	}
+	info.LastSeen = at
+	info.IP = ip
+	info.UserAgent = userAgent
+}
+
+// IndexedProvider is implemented by providers which keep the info of each
+// session and index the sessions by principal, such as the memory, file,
+// redis, mysql and postgres providers. The Manager uses it with
+// ManagerConfig.EnableIndex only.
+// Their SessionRegenerate keeps the info of the old sid, their SessionDestroy
+// and SessionGC remove it.
+type IndexedProvider interface {
+	// SessionSeen records a request of sid, its info is created by the first one.
+	SessionSeen(sid, ip, userAgent string, at time.Time) error
+	// SessionBind associates sid with principal, an empty principal unbinds it.
+	SessionBind(sid, principal string) error
+	// SessionInfo returns the info of sid, or nil if it is unknown.
+	SessionInfo(sid string) (*SessionInfo, error)
+	// SessionsOf returns the sessions bound to principal.
+	SessionsOf(principal string) ([]*SessionInfo, error)
+	// SessionDestroyAll destroys the sessions bound to principal and returns their number.
+	SessionDestroyAll(principal string) (int, error)
+}
+
+// seenTimes keeps the last time the info of each session was written,
+// the sessions not seen for an interval are dropped.
+type seenTimes struct {
+	sync.Mutex
+	at    map[string]time.Time
+	swept time.Time
+}
+
+func newSeenTimes() *seenTimes {
+	return &seenTimes{at: make(map[string]time.Time)}
+}
+
+// due reports whether the info of sid was not written for interval,
+// and records now as its last write if so.
+func (st *seenTimes) due(sid string, now time.Time, interval time.Duration) bool {
+	st.Lock()
+	defer st.Unlock()
+	if now.Sub(st.swept) >= interval {
+		for id, at := range st.at {
+			if now.Sub(at) >= interval {
+				delete(st.at, id)
+			}
+		}
+		st.swept = now
+	}
+	if at, ok := st.at[sid]; ok && now.Sub(at) < interval {
+		return false
+	}
+	st.at[sid] = now
+	return true
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func testIndexedProvider(t *testing.T, provider, savePath string) {
+	m, err := NewManager(provider, &ManagerConfig{CookieName: "gosessionid", Gclifetime: 3600, EnableSetCookie: true, EnableIndex: true, ProviderConfig: savePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := func(cookie string) Store {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("User-Agent", "test-agent")
+		if cookie != "" {
+			r.Header.Set("Cookie", cookie)
+		}
+		w := httptest.NewRecorder()
+		sess, err := m.SessionStart(w, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sess.SessionRelease(w)
+		return sess
+	}
+	phone, laptop, other := start(""), start(""), start("")
+	for _, sess := range []Store{phone, laptop} {
+		if err := m.SessionBind(sess.SessionID(), provider+"-user"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.SessionBind(other.SessionID(), provider+"-other")
+
+	info, err := m.SessionInfo(phone.SessionID())
+	if err != nil || info == nil {
+		t.Fatalf("info of a session is expected, found %v %v", info, err)
+	}
+	if info.IP != "10.0.0.1" || info.UserAgent != "test-agent" || info.Created.IsZero() || info.Principal != provider+"-user" {
+		t.Errorf("info is expected to hold the request, found %+v", info)
+	}
+
+	infos, err := m.SessionsOf(provider + "-user")
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("2 sessions are expected, found %d %v", len(infos), err)
+	}
+	if n, err := m.SessionDestroyAll(provider + "-user"); err != nil || n != 2 {
+		t.Fatalf("2 sessions are expected to be destroyed, found %d %v", n, err)
+	}
+	if m.provider.SessionExist(phone.SessionID()) || m.provider.SessionExist(laptop.SessionID()) {
+		t.Error("sessions of the principal are expected to be destroyed")
+	}
+	if !m.provider.SessionExist(other.SessionID()) {
+		t.Error("sessions of another principal are expected to be kept")
+	}
+	if infos, _ := m.SessionsOf(provider + "-user"); len(infos) != 0 {
+		t.Errorf("no session is expected after destroy, found %d", len(infos))
+	}
+
+	// the principal follows a regenerated id
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", "gosessionid="+other.SessionID())
+	regenerated := m.SessionRegenerateID(httptest.NewRecorder(), r)
+	regenerated.SessionRelease(httptest.NewRecorder())
+	infos, _ = m.SessionsOf(provider + "-other")
+	if len(infos) != 1 || infos[0].SID != regenerated.SessionID() {
+		t.Errorf("regenerated session is expected to keep its principal, found %+v", infos)
+	}
+}
+
+func TestIndexedMemory(t *testing.T) {
+	testIndexedProvider(t, "memory", "")
+}
+
+func TestIndexedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "izigo-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testIndexedProvider(t, "file", dir)
+	if n := filepder.SessionAll(); n != 1 {
+		t.Errorf("info files are not expected to be counted, found %d sessions", n)
+	}
+}
+
+func TestNotIndexed(t *testing.T) {
+	m, cp := newCountingManager(t, &ManagerConfig{})
+	w := httptest.NewRecorder()
+	sess, _ := m.SessionStart(w, httptest.NewRequest("GET", "/", nil))
+	sess.SessionRelease(w)
+	if cp.seen != 0 {
+		t.Errorf("sessions are not expected to be indexed without EnableIndex, found %d writes", cp.seen)
+	}
+	if _, err := m.SessionsOf("user"); err != ErrNotIndexed {
+		t.Errorf("ErrNotIndexed is expected without EnableIndex, found %v", err)
+	}
+
+	m, _ = newCountingManager(t, &ManagerConfig{EnableIndex: true})
+	m.provider = &CookieProvider{}
+	if _, err := m.SessionsOf("user"); err != ErrNotIndexed {
+		t.Errorf("ErrNotIndexed is expected, found %v", err)
+	}
+}
+
+func TestSeenInterval(t *testing.T) {
+	m, cp := newCountingManager(t, &ManagerConfig{EnableIndex: true})
+	w := httptest.NewRecorder()
+	sess, _ := m.SessionStart(w, httptest.NewRequest("GET", "/", nil))
+	sess.SessionRelease(w)
+	for i := 0; i < 3; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+		sess, _ = m.SessionStart(httptest.NewRecorder(), r)
+		sess.SessionRelease(httptest.NewRecorder())
+	}
+	if cp.seen != 1 {
+		t.Errorf("info is expected to be written once per interval, found %d writes", cp.seen)
+	}
+	if !m.seenAt.due(sess.SessionID(), time.Now().Add(time.Minute), time.Minute) {
+		t.Error("info is expected to be written again after the interval")
+	}
+}
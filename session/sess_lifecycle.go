@@ -0,0 +1,138 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Keys of the timestamps kept in the values of a session when
+// IdleTimeout or AbsoluteTimeout is set, so that every provider stores them.
+const (
+	createdKey  = "_session_created"
+	lastSeenKey = "_session_last_seen"
+)
+
+// ErrRegenerate is returned by ChangePrivilege when a new session id can not be generated.
+var ErrRegenerate = errors.New("session: can not regenerate the session id")
+
+// EventFunc is called on the lifecycle events of a session, such as for an
+// audit log. r is nil when the event is not caused by a request.
+type EventFunc func(sid string, r *http.Request)
+
+// hooks holds the EventFuncs of a Manager.
+type hooks struct {
+	lock      sync.RWMutex
+	onCreate  []EventFunc
+	onDestroy []EventFunc
+	onExpire  []EventFunc
+}
+
+func (h *hooks) add(list *[]EventFunc, f EventFunc) {
+	h.lock.Lock()
+	*list = append(*list, f)
+	h.lock.Unlock()
+}
+
+func (h *hooks) fire(list *[]EventFunc, sid string, r *http.Request) {
+	h.lock.RLock()
+	fs := *list
+	h.lock.RUnlock()
+	for _, f := range fs {
+		f(sid, r)
+	}
+}
+
+// OnCreate registers f to be called when a session is created.
+func (manager *Manager) OnCreate(f EventFunc) {
+	manager.hooks.add(&manager.hooks.onCreate, f)
+}
+
+// OnDestroy registers f to be called when a session is destroyed by
+// SessionDestroy, SessionDestroyByID or SessionDestroyAll.
+func (manager *Manager) OnDestroy(f EventFunc) {
+	manager.hooks.add(&manager.hooks.onDestroy, f)
+}
+
+// OnExpire registers f to be called when a request presents a session which
+// exceeded IdleTimeout or AbsoluteTimeout. Sessions removed by the GC of the
+// provider are not reported.
+func (manager *Manager) OnExpire(f EventFunc) {
+	manager.hooks.add(&manager.hooks.onExpire, f)
+}
+
+// timeouts returns whether the timestamps of the sessions are tracked.
+func (manager *Manager) timeouts() bool {
+	return manager.config.IdleTimeout > 0 || manager.config.AbsoluteTimeout > 0
+}
+
+func unix(v interface{}) int64 {
+	n, _ := v.(int64)
+	return n
+}
+
+// expired returns whether st exceeded the idle or the absolute timeout.
+// Sessions created before the timeouts were enabled have no timestamps,
+// they are stamped as new.
+func (manager *Manager) expired(st Store, now int64) bool {
+	created, lastSeen := unix(st.Get(createdKey)), unix(st.Get(lastSeenKey))
+	if manager.config.AbsoluteTimeout > 0 && created > 0 && now-created >= manager.config.AbsoluteTimeout {
+		return true
+	}
+	return manager.config.IdleTimeout > 0 && lastSeen > 0 && now-lastSeen >= manager.config.IdleTimeout
+}
+
+// stamp records the activity of st. The last seen time is only written
+// after a tenth of IdleTimeout, so that reading a session does not
+// always write it back with EnableDirtyTracking.
+func (manager *Manager) stamp(st Store, now int64) {
+	if unix(st.Get(createdKey)) == 0 {
+		st.Set(createdKey, now)
+	}
+	step := manager.config.IdleTimeout / 10
+	if step < 1 {
+		step = 1
+	}
+	if now-unix(st.Get(lastSeenKey)) >= step {
+		st.Set(lastSeenKey, now)
+	}
+}
+
+// SessionCreated returns the creation time of st, zero when no timeout is set.
+func SessionCreated(st Store) time.Time {
+	if created := unix(st.Get(createdKey)); created > 0 {
+		return time.Unix(created, 0)
+	}
+	return time.Time{}
+}
+
+// ChangePrivilege regenerates the session id of r, as required when the
+// privileges of the session change, such as a login, a logout or a new role,
+// so that an id known before the change can not be used after it.
+// The session keeps its values and creation time. With an IndexedProvider,
+// the new id is bound to principal, an empty principal unbinds it.
+func (manager *Manager) ChangePrivilege(w http.ResponseWriter, r *http.Request, principal string) (Store, error) {
+	st := manager.SessionRegenerateID(w, r)
+	if st == nil {
+		return nil, ErrRegenerate
+	}
+	if err := manager.SessionBind(st.SessionID(), principal); err != nil && err != ErrNotIndexed {
+		return st, err
+	}
+	return st, nil
+}
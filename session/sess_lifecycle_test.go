@@ -0,0 +1,134 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newLifecycleManager(t *testing.T, conf *ManagerConfig) (*Manager, *[]string) {
+	conf.CookieName = "gosessionid"
+	conf.Gclifetime = 3600
+	conf.EnableSetCookie = true
+	m, err := NewManager("memory", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := &[]string{}
+	m.OnCreate(func(sid string, r *http.Request) { *events = append(*events, "create") })
+	m.OnDestroy(func(sid string, r *http.Request) { *events = append(*events, "destroy") })
+	m.OnExpire(func(sid string, r *http.Request) { *events = append(*events, "expire") })
+	return m, events
+}
+
+func requestWith(sid string) *http.Request {
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", "gosessionid="+sid)
+	return r
+}
+
+func TestIdleTimeout(t *testing.T) {
+	m, events := newLifecycleManager(t, &ManagerConfig{IdleTimeout: 900, AbsoluteTimeout: 8 * 3600})
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, _ := m.SessionStart(httptest.NewRecorder(), r)
+	sess.Set("username", "diepdt")
+	sid := sess.SessionID()
+	if SessionCreated(sess).IsZero() {
+		t.Error("creation time is expected to be recorded")
+	}
+	sess.Flush()
+	if SessionCreated(sess).IsZero() {
+		t.Error("creation time is expected to survive Flush")
+	}
+	sess.Set("username", "diepdt")
+	sess.SessionRelease(httptest.NewRecorder())
+
+	sess, _ = m.SessionStart(httptest.NewRecorder(), requestWith(sid))
+	if sess.SessionID() != sid || sess.Get("username") != "diepdt" {
+		t.Fatal("active session is expected to be kept")
+	}
+	sess.Set(lastSeenKey, time.Now().Unix()-901)
+	sess.SessionRelease(httptest.NewRecorder())
+
+	sess, _ = m.SessionStart(httptest.NewRecorder(), requestWith(sid))
+	if sess.SessionID() == sid || sess.Get("username") != nil {
+		t.Error("idle session is expected to be replaced")
+	}
+	if m.provider.SessionExist(sid) {
+		t.Error("idle session is expected to be destroyed")
+	}
+	if strings.Join(*events, ",") != "create,expire,create" {
+		t.Errorf("events are expected to be create,expire,create, found %v", *events)
+	}
+}
+
+func TestAbsoluteTimeout(t *testing.T) {
+	m, events := newLifecycleManager(t, &ManagerConfig{AbsoluteTimeout: 3600})
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, _ := m.SessionStart(httptest.NewRecorder(), r)
+	sid := sess.SessionID()
+	// activity does not extend the absolute timeout
+	sess.Set(createdKey, time.Now().Unix()-3600)
+	sess.Set(lastSeenKey, time.Now().Unix())
+	sess.SessionRelease(httptest.NewRecorder())
+
+	sess, _ = m.SessionStart(httptest.NewRecorder(), requestWith(sid))
+	if sess.SessionID() == sid {
+		t.Error("session older than the absolute timeout is expected to be replaced")
+	}
+
+	m.SessionDestroy(httptest.NewRecorder(), requestWith(sess.SessionID()))
+	if strings.Join(*events, ",") != "create,expire,create,destroy" {
+		t.Errorf("events are expected to be create,expire,create,destroy, found %v", *events)
+	}
+}
+
+func TestRollingCookie(t *testing.T) {
+	m, _ := newLifecycleManager(t, &ManagerConfig{RollingCookie: true, CookieLifeTime: 900})
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, _ := m.SessionStart(httptest.NewRecorder(), r)
+
+	w := httptest.NewRecorder()
+	m.SessionStart(w, requestWith(sess.SessionID()))
+	if c := w.Header().Get("Set-Cookie"); !strings.Contains(c, "Max-Age=900") {
+		t.Errorf("cookie expiry is expected to be refreshed, found %q", c)
+	}
+}
+
+func TestChangePrivilege(t *testing.T) {
+	m, _ := newLifecycleManager(t, &ManagerConfig{AbsoluteTimeout: 3600, EnableIndex: true})
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, _ := m.SessionStart(httptest.NewRecorder(), r)
+	sess.Set("cart", 3)
+	created, sid := SessionCreated(sess), sess.SessionID()
+
+	st, err := m.ChangePrivilege(httptest.NewRecorder(), requestWith(sid), "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.SessionID() == sid || st.Get("cart") != 3 {
+		t.Error("session is expected to keep its values under a new id")
+	}
+	if !SessionCreated(st).Equal(created) {
+		t.Error("session is expected to keep its creation time")
+	}
+	if info, _ := m.SessionInfo(st.SessionID()); info == nil || info.Principal != "user-1" {
+		t.Errorf("session is expected to be bound to the principal, found %+v", info)
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrLockTimeout is returned when the lock of a session is not acquired in time.
+var ErrLockTimeout = errors.New("session: lock timeout")
+
+// LockProvider is implemented by providers which can lock a session
+// across processes, such as the redis and sql providers.
+// Other providers are locked within the process only.
+type LockProvider interface {
+	// SessionLock blocks until the lock of sid is acquired, or returns
+	// ErrLockTimeout after timeout. The lock expires after ttl so that
+	// a crashed process can not hold it forever.
+	SessionLock(sid string, timeout, ttl time.Duration) (unlock func(), err error)
+}
+
+// TouchStore is implemented by stores which can release a session that
+// was not modified without writing its values back, for example by only
+// refreshing its expiry. Stores without it are always written back.
+type TouchStore interface {
+	SessionTouch(w http.ResponseWriter)
+}
+
+// WaitLock calls try until it acquires a lock, with an increasing delay,
+// and returns ErrLockTimeout after timeout. It helps providers implementing
+// LockProvider with a non blocking primitive such as redis SET NX.
+func WaitLock(timeout time.Duration, try func() (bool, error)) error {
+	deadline := time.Now().Add(timeout)
+	delay := 5 * time.Millisecond
+	for {
+		ok, err := try()
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return ErrLockTimeout
+		}
+		time.Sleep(delay)
+		if delay < 100*time.Millisecond {
+			delay *= 2
+		}
+	}
+}
+
+// NewLockToken returns a random value identifying the owner of a
+// distributed lock, so that a lock which expired and was acquired by
+// another process is not released by the former owner.
+func NewLockToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().String()
+	}
+	return hex.EncodeToString(b)
+}
+
+// localLocks holds a mutex per session id, with a timeout.
+type localLocks struct {
+	lock  sync.Mutex
+	locks map[string]*localLock
+}
+
+type localLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+func newLocalLocks() *localLocks {
+	return &localLocks{locks: make(map[string]*localLock)}
+}
+
+func (l *localLocks) Lock(sid string, timeout time.Duration) (func(), error) {
+	l.lock.Lock()
+	ll, ok := l.locks[sid]
+	if !ok {
+		ll = &localLock{ch: make(chan struct{}, 1)}
+		l.locks[sid] = ll
+	}
+	ll.refs++
+	l.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ll.ch <- struct{}{}:
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				<-ll.ch
+				l.release(sid, ll)
+			})
+		}, nil
+	case <-timer.C:
+		l.release(sid, ll)
+		return nil, ErrLockTimeout
+	}
+}
+
+func (l *localLocks) release(sid string, ll *localLock) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if ll.refs--; ll.refs == 0 {
+		delete(l.locks, sid)
+	}
+}
+
+// managedStore wraps the Store of a provider when the Manager
+// locks sessions, tracks modifications or timeouts.
+type managedStore struct {
+	Store
+	lock        sync.Mutex
+	dirty       bool
+	trackDirty  bool
+	unlock      func()
+	releaseOnce sync.Once
+	keep        []interface{} // keys which survive Flush, such as the timestamps
+}
+
+// Set marks the session as modified.
+func (ms *managedStore) Set(key, value interface{}) error {
+	ms.markDirty()
+	return ms.Store.Set(key, value)
+}
+
+// Delete marks the session as modified.
+func (ms *managedStore) Delete(key interface{}) error {
+	ms.markDirty()
+	return ms.Store.Delete(key)
+}
+
+// Flush marks the session as modified, the keys to keep are set again.
+func (ms *managedStore) Flush() error {
+	ms.markDirty()
+	kept := make([]interface{}, len(ms.keep))
+	for i, k := range ms.keep {
+		kept[i] = ms.Store.Get(k)
+	}
+	if err := ms.Store.Flush(); err != nil {
+		return err
+	}
+	for i, k := range ms.keep {
+		if kept[i] != nil {
+			ms.Store.Set(k, kept[i])
+		}
+	}
+	return nil
+}
+
+func (ms *managedStore) markDirty() {
+	ms.lock.Lock()
+	ms.dirty = true
+	ms.lock.Unlock()
+}
+
+// Dirty returns whether the session was modified by Set, Delete or Flush.
+func (ms *managedStore) Dirty() bool {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	return ms.dirty
+}
+
+// SessionRelease writes the session back if it was modified,
+// and releases its lock. Later calls do nothing.
+func (ms *managedStore) SessionRelease(w http.ResponseWriter) {
+	ms.releaseOnce.Do(func() {
+		if ms.unlock != nil {
+			defer ms.unlock()
+		}
+		if ts, ok := ms.Store.(TouchStore); ok && ms.trackDirty && !ms.Dirty() {
+			ts.SessionTouch(w)
+			return
+		}
+		ms.Store.SessionRelease(w)
+	})
+}
+
+// Discard releases the lock of a store without writing it back,
+// once its session is destroyed. It does nothing on other stores.
+func Discard(st Store) {
+	if ms, ok := st.(*managedStore); ok {
+		ms.releaseOnce.Do(func() {
+			if ms.unlock != nil {
+				ms.unlock()
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package session
+
+import (
+	"container/list"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLocalLock(t *testing.T) {
+	locks := newLocalLocks()
+	unlock, err := locks.Lock("sid", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := locks.Lock("sid", 20*time.Millisecond); err != ErrLockTimeout {
+		t.Fatalf("second lock is expected to time out, found %v", err)
+	}
+	if _, err := locks.Lock("other", 20*time.Millisecond); err != nil {
+		t.Fatalf("lock of another session is expected to succeed, found %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		u, err := locks.Lock("sid", time.Second)
+		if err == nil {
+			u()
+		}
+		close(acquired)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	unlock()
+	unlock() // calling unlock twice is harmless
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("waiting lock is expected to be acquired after unlock")
+	}
+	if len(locks.locks) != 1 {
+		t.Errorf("unused locks are expected to be removed, found %d", len(locks.locks))
+	}
+}
+
+// countingProvider counts the writes, touches and seen requests of the memory provider
+type countingProvider struct {
+	*MemProvider
+	mu                      sync.Mutex
+	released, touched, seen int
+}
+
+func (cp *countingProvider) SessionSeen(sid, ip, userAgent string, at time.Time) error {
+	cp.mu.Lock()
+	cp.seen++
+	cp.mu.Unlock()
+	return cp.MemProvider.SessionSeen(sid, ip, userAgent, at)
+}
+
+type countingStore struct {
+	Store
+	p *countingProvider
+}
+
+func (cs *countingStore) SessionRelease(w http.ResponseWriter) {
+	cs.p.mu.Lock()
+	cs.p.released++
+	cs.p.mu.Unlock()
+}
+
+func (cs *countingStore) SessionTouch(w http.ResponseWriter) {
+	cs.p.mu.Lock()
+	cs.p.touched++
+	cs.p.mu.Unlock()
+}
+
+func (cp *countingProvider) SessionRead(sid string) (Store, error) {
+	st, err := cp.MemProvider.SessionRead(sid)
+	if err != nil {
+		return nil, err
+	}
+	return &countingStore{Store: st, p: cp}, nil
+}
+
+func newCountingManager(t *testing.T, conf *ManagerConfig) (*Manager, *countingProvider) {
+	cp := &countingProvider{MemProvider: &MemProvider{list: list.New(), sessions: make(map[string]*list.Element)}}
+	provides["counting"] = cp
+	defer delete(provides, "counting")
+	conf.CookieName = "gosessionid"
+	conf.Gclifetime = 10
+	conf.EnableSetCookie = true
+	m, err := NewManager("counting", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, cp
+}
+
+func TestDirtyTracking(t *testing.T) {
+	m, cp := newCountingManager(t, &ManagerConfig{EnableDirtyTracking: true})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, err := m.SessionStart(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.SessionRelease(w)
+	if cp.released != 1 {
+		t.Fatalf("new session is expected to be written, found %d writes", cp.released)
+	}
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	sess, err = m.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Get("username")
+	sess.SessionRelease(w)
+	if cp.released != 1 || cp.touched != 1 {
+		t.Errorf("read only session is expected to be touched, found %d writes %d touches", cp.released, cp.touched)
+	}
+
+	sess, _ = m.SessionStart(httptest.NewRecorder(), r)
+	sess.Set("username", "diepdt")
+	sess.SessionRelease(w)
+	sess.SessionRelease(w)
+	if cp.released != 2 {
+		t.Errorf("modified session is expected to be written once, found %d writes", cp.released-1)
+	}
+}
+
+func TestSessionLock(t *testing.T) {
+	m, _ := newCountingManager(t, &ManagerConfig{EnableLock: true, LockTimeout: 1})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, _ := m.SessionStart(w, r)
+	sess.SessionRelease(w)
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+
+	first, err := m.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan Store)
+	go func() {
+		second, err := m.SessionStart(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Error(err)
+		}
+		started <- second
+	}()
+	select {
+	case <-started:
+		t.Fatal("second request is expected to wait for the first one")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.SessionRelease(w)
+	select {
+	case second := <-started:
+		if second != nil {
+			Discard(second)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second request is expected to start after the release of the first one")
+	}
+}
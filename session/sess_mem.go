@@ -30,6 +30,7 @@ type MemSessionStore struct {
 	timeAccessed time.Time                   //last access time
 	value        map[interface{}]interface{} //session store
 	lock         sync.RWMutex
+	info         SessionInfo // guarded by the lock of the provider
 }
 
 // Set value to memory session
@@ -179,6 +180,70 @@ func (pder *MemProvider) SessionAll() int {
 	return pder.list.Len()
 }
 
+// SessionSeen records a request in the info of the session sid
+func (pder *MemProvider) SessionSeen(sid, ip, userAgent string, at time.Time) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	if element, ok := pder.sessions[sid]; ok {
+		element.Value.(*MemSessionStore).info.Seen(ip, userAgent, at)
+	}
+	return nil
+}
+
+// SessionBind associates the session sid with principal
+func (pder *MemProvider) SessionBind(sid, principal string) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	if element, ok := pder.sessions[sid]; ok {
+		element.Value.(*MemSessionStore).info.Principal = principal
+	}
+	return nil
+}
+
+// SessionInfo returns the info of the session sid
+func (pder *MemProvider) SessionInfo(sid string) (*SessionInfo, error) {
+	pder.lock.RLock()
+	defer pder.lock.RUnlock()
+	if element, ok := pder.sessions[sid]; ok {
+		return element.Value.(*MemSessionStore).sessionInfo(), nil
+	}
+	return nil, nil
+}
+
+// SessionsOf returns the sessions bound to principal, it scans every session
+func (pder *MemProvider) SessionsOf(principal string) ([]*SessionInfo, error) {
+	pder.lock.RLock()
+	defer pder.lock.RUnlock()
+	var infos []*SessionInfo
+	for _, element := range pder.sessions {
+		if st := element.Value.(*MemSessionStore); principal != "" && st.info.Principal == principal {
+			infos = append(infos, st.sessionInfo())
+		}
+	}
+	return infos, nil
+}
+
+// SessionDestroyAll destroys the sessions bound to principal
+func (pder *MemProvider) SessionDestroyAll(principal string) (int, error) {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	n := 0
+	for sid, element := range pder.sessions {
+		if principal != "" && element.Value.(*MemSessionStore).info.Principal == principal {
+			delete(pder.sessions, sid)
+			pder.list.Remove(element)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (st *MemSessionStore) sessionInfo() *SessionInfo {
+	info := st.info
+	info.SID = st.sid
+	return &info
+}
+
 // SessionUpdate expand time of session store by id in memory session
 func (pder *MemProvider) SessionUpdate(sid string) error {
 	pder.lock.Lock()
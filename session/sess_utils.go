@@ -30,6 +30,7 @@ import (
 	"time"
 
 	"github.com/izi-global/izigo/utils"
+	"github.com/izi-global/izigo/utils/keyring"
 )
 
 func init() {
@@ -187,6 +188,24 @@ func decodeCookie(block cipher.Block, hashKey, name, value string, gcmaxlifetime
 	return dst, nil
 }
 
+// encodeKeyringCookie encrypts the gob of value with the primary key of kr.
+func encodeKeyringCookie(kr *keyring.Keyring, name string, value map[interface{}]interface{}) (string, error) {
+	b, err := EncodeGob(value)
+	if err != nil {
+		return "", err
+	}
+	return kr.EncodeValue(name, string(b)), nil
+}
+
+// decodeKeyringCookie decrypts a value of encodeKeyringCookie with any key of kr.
+func decodeKeyringCookie(kr *keyring.Keyring, name, value string, gcmaxlifetime int64) (map[interface{}]interface{}, error) {
+	b, err := kr.DecodeValue(name, value, gcmaxlifetime)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeGob([]byte(b))
+}
+
 // Encoding -------------------------------------------------------------------
 
 // encode encodes a value using base64.
@@ -34,11 +34,16 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/textproto"
 	"net/url"
 	"os"
+	"strings"
 	"time"
+
+	"github.com/izi-global/izigo/utils/cookie"
+	"github.com/izi-global/izigo/utils/keyring"
 )
 
 // Store contains all data for one session process with specific id.
@@ -63,6 +68,27 @@ type Provider interface {
 	SessionGC()
 }
 
+// KeyringProvider is implemented by providers which encrypt the session data
+// on the client, such as the cookie provider.
+// NewManager passes ManagerConfig.Keyring to it before SessionInit.
+type KeyringProvider interface {
+	SetKeyring(kr *keyring.Keyring)
+}
+
+// IssueStore is implemented by stores which send the session to the client
+// in a response header or cookie, such as the token store. SessionIssue sets
+// it, the Manager calls it before the response is written when the
+// ResponseWriter implements BeforeWriter.
+type IssueStore interface {
+	SessionIssue(w http.ResponseWriter)
+}
+
+// BeforeWriter is implemented by ResponseWriters which call the registered
+// functions once, before the status or the body of the response is written.
+type BeforeWriter interface {
+	BeforeWrite(fn func())
+}
+
 var provides = make(map[string]Provider)
 
 // SLogger a helpful variable to log information about session
@@ -96,12 +122,40 @@ type ManagerConfig struct {
 	EnableSidInHTTPHeader   bool   `json:"EnableSidInHTTPHeader"`
 	SessionNameInHTTPHeader string `json:"SessionNameInHTTPHeader"`
 	EnableSidInURLQuery     bool   `json:"EnableSidInURLQuery"`
+	SameSite                string `json:"sameSite"`    // Lax, Strict, None or empty
+	Partitioned             bool   `json:"partitioned"` // CHIPS, requires secure
+	EnableLock              bool   `json:"enableLock"`  // serialize the requests of a session
+	LockTimeout             int64  `json:"lockTimeout"` // seconds to wait for the lock, default 10
+	LockTTL                 int64  `json:"lockTTL"`     // seconds before a distributed lock expires, default 30
+	EnableDirtyTracking     bool   `json:"enableDirtyTracking"`
+	IdleTimeout             int64  `json:"idleTimeout"`     // seconds of inactivity after which a session expires
+	AbsoluteTimeout         int64  `json:"absoluteTimeout"` // seconds after its creation a session expires, whatever its activity
+	RollingCookie           bool   `json:"rollingCookie"`   // refresh the expiry of the cookie on every request
+	EnableIndex             bool   `json:"enableIndex"`     // record the info of the sessions to list and revoke them, see IndexedProvider
+	SeenInterval            int64  `json:"seenInterval"`    // seconds between two writes of the info of a session, default 60
+	// Keyring encrypts the data of client side sessions, see KeyringProvider.
+	Keyring *keyring.Keyring `json:"-"`
+	// ClientIP returns the address recorded in SessionInfo, default the remote address.
+	ClientIP func(r *http.Request) string `json:"-"`
 }
 
 // Manager contains Provider and its configuration.
+//
+// With EnableLock, the requests of a session are serialized from SessionStart
+// to SessionRelease, so that concurrent requests do not overwrite each other.
+// Providers implementing LockProvider are locked across processes, the others
+// within the process. Starting the same session twice in one request waits
+// for LockTimeout and fails.
+//
+// With EnableDirtyTracking, a session which was not modified by Set, Delete
+// or Flush is not written back. Values changed in place, such as a map read
+// from the session, must be Set again to be saved.
 type Manager struct {
 	provider Provider
 	config   *ManagerConfig
+	locks    *localLocks
+	hooks    *hooks
+	seenAt   *seenTimes
 }
 
 // NewManager Create new Manager with provider name and json config string.
@@ -138,7 +192,20 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 		}
 	}
 
-	err := provider.SessionInit(cf.Maxlifetime, cf.ProviderConfig)
+	sameSite, err := cookie.ParseSameSite(cf.SameSite)
+	if err != nil {
+		return nil, err
+	}
+	opts := &cookie.Options{Domain: cf.Domain, Secure: cf.Secure, SameSite: sameSite, Partitioned: cf.Partitioned}
+	if err := opts.Validate(cf.CookieName); err != nil {
+		return nil, fmt.Errorf("session: cookie %q: %v", cf.CookieName, err)
+	}
+
+	if p, ok := provider.(KeyringProvider); ok {
+		p.SetKeyring(cf.Keyring)
+	}
+
+	err = provider.SessionInit(cf.Maxlifetime, cf.ProviderConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -146,13 +213,72 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 	if cf.SessionIDLength == 0 {
 		cf.SessionIDLength = 16
 	}
+	if cf.LockTimeout <= 0 {
+		cf.LockTimeout = 10
+	}
+	if cf.LockTTL <= 0 {
+		cf.LockTTL = 30
+	}
+	if cf.SeenInterval <= 0 {
+		cf.SeenInterval = 60
+	}
 
 	return &Manager{
 		provider,
 		cf,
+		newLocalLocks(),
+		&hooks{},
+		newSeenTimes(),
 	}, nil
 }
 
+// lock acquires the lock of sid, see ManagerConfig.EnableLock.
+func (manager *Manager) lock(sid string) (func(), error) {
+	timeout := time.Duration(manager.config.LockTimeout) * time.Second
+	if lp, ok := manager.provider.(LockProvider); ok {
+		return lp.SessionLock(sid, timeout, time.Duration(manager.config.LockTTL)*time.Second)
+	}
+	return manager.locks.Lock(sid, timeout)
+}
+
+// manage wraps the store for the lock and the dirty tracking.
+func (manager *Manager) manage(st Store, unlock func(), dirty bool) Store {
+	if st == nil || (!manager.config.EnableLock && !manager.config.EnableDirtyTracking && !manager.timeouts()) {
+		return st
+	}
+	ms := &managedStore{
+		Store:      st,
+		dirty:      dirty,
+		trackDirty: manager.config.EnableDirtyTracking,
+		unlock:     unlock,
+	}
+	if manager.timeouts() {
+		ms.keep = []interface{}{createdKey, lastSeenKey}
+	}
+	return ms
+}
+
+// readLocked reads the existing session sid under its lock.
+func (manager *Manager) readLocked(sid string) (Store, error) {
+	if !manager.config.EnableLock {
+		st, err := manager.provider.SessionRead(sid)
+		if err != nil {
+			return nil, err
+		}
+		return manager.manage(st, nil, false), nil
+	}
+	unlock, err := manager.lock(sid)
+	if err != nil {
+		return nil, err
+	}
+	st, err := manager.provider.SessionRead(sid)
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	return manager.manage(st, unlock, false), nil
+}
+
 // getSid retrieves session identifier from HTTP Request.
 // First try to retrieve id by reading from cookie, session cookie name is configurable,
 // if not exist, then retrieve id from querying parameters.
@@ -177,6 +303,10 @@ func (manager *Manager) getSid(r *http.Request) (string, error) {
 		if manager.config.EnableSidInHTTPHeader && sid == "" {
 			sids, isFound := r.Header[manager.config.SessionNameInHTTPHeader]
 			if isFound && len(sids) != 0 {
+				// the Authorization header carries the sid as a bearer token
+				if len(sids[0]) > 7 && strings.EqualFold(sids[0][:7], "Bearer ") {
+					return sids[0][7:], nil
+				}
 				return sids[0], nil
 			}
 		}
@@ -197,7 +327,26 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 	}
 
 	if sid != "" && manager.provider.SessionExist(sid) {
-		return manager.provider.SessionRead(sid)
+		session, err = manager.readLocked(sid)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().Unix()
+		if !manager.timeouts() || !manager.expired(session, now) {
+			if manager.timeouts() {
+				manager.stamp(session, now)
+			}
+			manager.seen(sid, r)
+			manager.issue(w, session)
+			if manager.config.RollingCookie && manager.config.EnableSetCookie && manager.config.CookieLifeTime > 0 {
+				manager.setCookie(w, r, url.QueryEscape(sid), manager.config.CookieLifeTime)
+			}
+			return
+		}
+		// the expired session is replaced by a new one
+		Discard(session)
+		manager.provider.SessionDestroy(sid)
+		manager.hooks.fire(&manager.hooks.onExpire, sid, r)
 	}
 
 	// Generate a new session
@@ -210,6 +359,14 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 	if err != nil {
 		return nil, err
 	}
+	// a new session is always written, nobody else knows its id yet
+	session = manager.manage(session, nil, true)
+	if manager.timeouts() {
+		manager.stamp(session, time.Now().Unix())
+	}
+	manager.seen(sid, r)
+	manager.issue(w, session)
+	manager.hooks.fire(&manager.hooks.onCreate, sid, r)
 	cookie := &http.Cookie{
 		Name:     manager.config.CookieName,
 		Value:    url.QueryEscape(sid),
@@ -223,7 +380,7 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 		cookie.Expires = time.Now().Add(time.Duration(manager.config.CookieLifeTime) * time.Second)
 	}
 	if manager.config.EnableSetCookie {
-		http.SetCookie(w, cookie)
+		manager.setCookie(w, r, cookie.Value, cookie.MaxAge)
 	}
 	r.AddCookie(cookie)
 
@@ -237,34 +394,160 @@ func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (se
 
 // SessionDestroy Destroy session by its id in http request cookie.
 func (manager *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
+	// the sid is read like in SessionStart, it may come from the header
+	sid, _ := manager.getSid(r)
 	if manager.config.EnableSidInHTTPHeader {
 		r.Header.Del(manager.config.SessionNameInHTTPHeader)
 		w.Header().Del(manager.config.SessionNameInHTTPHeader)
 	}
-
-	cookie, err := r.Cookie(manager.config.CookieName)
-	if err != nil || cookie.Value == "" {
+	if sid == "" {
 		return
 	}
 
-	sid, _ := url.QueryUnescape(cookie.Value)
 	manager.provider.SessionDestroy(sid)
+	manager.hooks.fire(&manager.hooks.onDestroy, sid, r)
 	if manager.config.EnableSetCookie {
-		expiration := time.Now()
-		cookie = &http.Cookie{Name: manager.config.CookieName,
-			Path:     "/",
-			HttpOnly: !manager.config.DisableHTTPOnly,
-			Expires:  expiration,
-			MaxAge:   -1}
+		manager.setCookie(w, r, "", -1)
+	}
+}
 
-		http.SetCookie(w, cookie)
+// setCookie writes the session cookie with the attributes of the config.
+// The cookie is Secure on https requests, and always when its name prefix,
+// SameSite=None or Partitioned requires it.
+func (manager *Manager) setCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	sameSite, _ := cookie.ParseSameSite(manager.config.SameSite)
+	opts := &cookie.Options{
+		MaxAge:      int64(maxAge),
+		Domain:      manager.config.Domain,
+		Secure:      manager.isSecure(r),
+		HTTPOnly:    !manager.config.DisableHTTPOnly,
+		SameSite:    sameSite,
+		Partitioned: manager.config.Partitioned,
 	}
+	if cookie.RequiresSecure(manager.config.CookieName, opts) {
+		opts.Secure = true
+	}
+	if err := cookie.Set(w, manager.config.CookieName, value, opts); err != nil {
+		SLogger.Println(err)
+	}
+}
+
+// seen records the request in the info of sid, see IndexedProvider.
+// The info of a session is written at most once per SeenInterval.
+func (manager *Manager) seen(sid string, r *http.Request) {
+	ix, err := manager.indexed()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	if !manager.seenAt.due(sid, now, time.Duration(manager.config.SeenInterval)*time.Second) {
+		return
+	}
+	var addr string
+	if manager.config.ClientIP != nil {
+		addr = manager.config.ClientIP(r)
+	} else if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		addr = host
+	} else {
+		addr = r.RemoteAddr
+	}
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	if err := ix.SessionSeen(sid, addr, ua, now); err != nil {
+		SLogger.Println("session info:", err)
+	}
+}
+
+// issue calls SessionIssue of st before w is written, see IssueStore.
+func (manager *Manager) issue(w http.ResponseWriter, st Store) {
+	if ms, ok := st.(*managedStore); ok {
+		st = ms.Store
+	}
+	is, ok := st.(IssueStore)
+	if !ok {
+		return
+	}
+	if bw, ok := w.(BeforeWriter); ok {
+		bw.BeforeWrite(func() { is.SessionIssue(w) })
+	}
+}
+
+// indexed returns the IndexedProvider of the manager, ErrNotIndexed if
+// EnableIndex is not set or the provider does not index the sessions.
+func (manager *Manager) indexed() (IndexedProvider, error) {
+	if !manager.config.EnableIndex {
+		return nil, ErrNotIndexed
+	}
+	if ix, ok := manager.provider.(IndexedProvider); ok {
+		return ix, nil
+	}
+	return nil, ErrNotIndexed
+}
+
+// SessionBind associates the session sid with principal, typically the id
+// of the user after a login, so that the user can list and revoke their sessions.
+// Regenerate the session id before binding it.
+func (manager *Manager) SessionBind(sid, principal string) error {
+	ix, err := manager.indexed()
+	if err != nil {
+		return err
+	}
+	return ix.SessionBind(sid, principal)
+}
+
+// SessionInfo returns the info of the session sid, or nil if it is unknown.
+func (manager *Manager) SessionInfo(sid string) (*SessionInfo, error) {
+	ix, err := manager.indexed()
+	if err != nil {
+		return nil, err
+	}
+	return ix.SessionInfo(sid)
+}
+
+// SessionsOf returns the sessions bound to principal, such as the devices of a user.
+func (manager *Manager) SessionsOf(principal string) ([]*SessionInfo, error) {
+	ix, err := manager.indexed()
+	if err != nil {
+		return nil, err
+	}
+	return ix.SessionsOf(principal)
+}
+
+// SessionDestroyAll destroys the sessions bound to principal, to log a user
+// out of all devices. It returns the number of destroyed sessions.
+func (manager *Manager) SessionDestroyAll(principal string) (int, error) {
+	ix, err := manager.indexed()
+	if err != nil {
+		return 0, err
+	}
+	infos, err := ix.SessionsOf(principal)
+	if err != nil {
+		return 0, err
+	}
+	n, err := ix.SessionDestroyAll(principal)
+	for _, info := range infos {
+		manager.hooks.fire(&manager.hooks.onDestroy, info.SID, nil)
+	}
+	return n, err
+}
+
+// SessionDestroyByID destroys the session sid, such as a device revoked by its user.
+// Unlike SessionDestroy it does not touch the cookie of the current request.
+func (manager *Manager) SessionDestroyByID(sid string) error {
+	if sid == "" {
+		return nil
+	}
+	err := manager.provider.SessionDestroy(sid)
+	manager.hooks.fire(&manager.hooks.onDestroy, sid, nil)
+	return err
 }
 
 // GetSessionStore Get SessionStore by its id.
+// The session is locked like in SessionStart, the store must be released.
 func (manager *Manager) GetSessionStore(sid string) (sessions Store, err error) {
-	sessions, err = manager.provider.SessionRead(sid)
-	return
+	return manager.readLocked(sid)
 }
 
 // GC Start session gc process.
@@ -298,12 +581,19 @@ func (manager *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Reque
 		cookie.HttpOnly = true
 		cookie.Path = "/"
 	}
+	// the new id is unknown to other requests, it needs no lock
+	session = manager.manage(session, nil, true)
+	if session != nil && manager.timeouts() {
+		manager.stamp(session, time.Now().Unix())
+	}
+	manager.seen(sid, r)
+	manager.issue(w, session)
 	if manager.config.CookieLifeTime > 0 {
 		cookie.MaxAge = manager.config.CookieLifeTime
 		cookie.Expires = time.Now().Add(time.Duration(manager.config.CookieLifeTime) * time.Second)
 	}
 	if manager.config.EnableSetCookie {
-		http.SetCookie(w, cookie)
+		manager.setCookie(w, r, cookie.Value, cookie.MaxAge)
 	}
 	r.AddCookie(cookie)
 
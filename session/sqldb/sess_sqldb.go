@@ -0,0 +1,297 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqldb for session provider
+//
+// It stores the sessions through a database alias registered in the orm,
+// so that they share its pooled connections. MySQL, TiDB, PostgreSQL,
+// SQLite and Oracle are supported, the table and its index on the expiry
+// are created when the provider starts.
+//
+// Usage:
+// import(
+//   "github.com/izi-global/izigo/orm"
+//   _ "github.com/izi-global/izigo/session/sqldb"
+//   "github.com/izi-global/izigo/session"
+// )
+//
+//	func init() {
+//		orm.RegisterDataBase("default", "mysql", "root:root@/orm_test?charset=utf8")
+//		globalSessions, _ = session.NewManager("sqldb", ``{"cookieName":"gosessionid","gclifetime":3600,"ProviderConfig":"default,session"}``)
+//		go globalSessions.GC()
+//	}
+//
+// ProviderConfig is the alias of the database and the name of the table,
+// default "default,session".
+//
+// more docs: http://go.izi.asia/docs/module/session.md
+package sqldb
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/izi-global/izigo/orm"
+	"github.com/izi-global/izigo/session"
+)
+
+// GCBatchSize is the number of expired sessions deleted per statement by SessionGC,
+// so that a large backlog does not lock the table for long.
+var GCBatchSize = 1000
+
+var sqlpder = &Provider{}
+
+// SessionStore sqldb session store
+type SessionStore struct {
+	p      *Provider
+	sid    string
+	lock   sync.RWMutex
+	values map[interface{}]interface{}
+}
+
+// Set value in sqldb session
+func (st *SessionStore) Set(key, value interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values[key] = value
+	return nil
+}
+
+// Get value from sqldb session
+func (st *SessionStore) Get(key interface{}) interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	if v, ok := st.values[key]; ok {
+		return v
+	}
+	return nil
+}
+
+// Delete value in sqldb session
+func (st *SessionStore) Delete(key interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	delete(st.values, key)
+	return nil
+}
+
+// Flush clear all values in sqldb session
+func (st *SessionStore) Flush() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values = make(map[interface{}]interface{})
+	return nil
+}
+
+// SessionID get session id of this sqldb session store
+func (st *SessionStore) SessionID() string {
+	return st.sid
+}
+
+// SessionRelease save the session values to the database
+func (st *SessionStore) SessionRelease(w http.ResponseWriter) {
+	st.lock.RLock()
+	b, err := session.EncodeGob(st.values)
+	st.lock.RUnlock()
+	if err != nil {
+		session.SLogger.Println(err)
+		return
+	}
+	if err = st.p.upsert(st.sid, base64.StdEncoding.EncodeToString(b)); err != nil {
+		session.SLogger.Println(err)
+	}
+}
+
+// SessionTouch refreshes the expiry of an unmodified session without writing its values
+func (st *SessionStore) SessionTouch(w http.ResponseWriter) {
+	st.p.exec("UPDATE %[1]s SET %[3]s=? WHERE %[2]s=?", st.p.expiry(), st.sid)
+}
+
+// Provider sqldb session provider
+type Provider struct {
+	maxlifetime int64
+	alias       string
+	table       string
+	db          *sql.DB
+	dialect     *orm.Dialect
+}
+
+// SessionInit init sqldb session.
+// savePath is the alias of the database and the name of the table, e.g. default,session
+func (p *Provider) SessionInit(maxlifetime int64, savePath string) error {
+	p.maxlifetime = maxlifetime
+	p.alias, p.table = "default", "session"
+	configs := strings.Split(savePath, ",")
+	if len(configs) > 0 && strings.TrimSpace(configs[0]) != "" {
+		p.alias = strings.TrimSpace(configs[0])
+	}
+	if len(configs) > 1 && strings.TrimSpace(configs[1]) != "" {
+		p.table = strings.TrimSpace(configs[1])
+	}
+	var err error
+	if p.db, err = orm.GetDB(p.alias); err != nil {
+		return err
+	}
+	if p.dialect, err = orm.GetDialect(p.alias); err != nil {
+		return err
+	}
+	return p.createTable()
+}
+
+// createTable creates the table and the index on the expiry if they do not exist
+func (p *Provider) createTable() error {
+	exists, err := p.dialect.TableExists(p.db, p.table)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		text := p.dialect.ColumnType("string-text", 4000)
+		_, err = p.db.Exec(fmt.Sprintf("CREATE TABLE %s (%s %s NOT NULL PRIMARY KEY, %s %s, %s %s NOT NULL)",
+			p.dialect.Quote(p.table),
+			p.dialect.Quote("session_key"), p.dialect.ColumnType("string", 128),
+			p.dialect.Quote("session_data"), text,
+			p.dialect.Quote("session_expiry"), p.dialect.ColumnType("int64")))
+		if err != nil {
+			return err
+		}
+	}
+	index := p.table + "_expiry"
+	if !p.dialect.IndexExists(p.db, p.table, index) {
+		_, err = p.db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)",
+			p.dialect.Quote(index), p.dialect.Quote(p.table), p.dialect.Quote("session_expiry")))
+	}
+	return err
+}
+
+// query formats the table and the columns into query, as %[1]s, %[2]s, %[3]s and %[4]s,
+// and replaces its placeholders
+func (p *Provider) query(query string) string {
+	query = fmt.Sprintf(query, p.dialect.Quote(p.table), p.dialect.Quote("session_key"),
+		p.dialect.Quote("session_expiry"), p.dialect.Quote("session_data"))
+	return p.dialect.ReplaceMarks(query)
+}
+
+func (p *Provider) exec(query string, args ...interface{}) (sql.Result, error) {
+	return p.db.Exec(p.query(query), args...)
+}
+
+func (p *Provider) expiry() int64 {
+	return time.Now().Unix() + p.maxlifetime
+}
+
+// upsert writes the data of sid in one statement where the dialect supports it
+func (p *Provider) upsert(sid, data string) error {
+	var err error
+	switch p.dialect.Driver {
+	case orm.DRMySQL, orm.DRTiDB:
+		_, err = p.exec("INSERT INTO %[1]s (%[2]s, %[4]s, %[3]s) VALUES (?, ?, ?) "+
+			"ON DUPLICATE KEY UPDATE %[4]s=VALUES(%[4]s), %[3]s=VALUES(%[3]s)", sid, data, p.expiry())
+	case orm.DRPostgres, orm.DRSqlite:
+		_, err = p.exec("INSERT INTO %[1]s (%[2]s, %[4]s, %[3]s) VALUES (?, ?, ?) "+
+			"ON CONFLICT (%[2]s) DO UPDATE SET %[4]s=excluded.%[4]s, %[3]s=excluded.%[3]s", sid, data, p.expiry())
+	default:
+		var res sql.Result
+		res, err = p.exec("UPDATE %[1]s SET %[4]s=?, %[3]s=? WHERE %[2]s=?", data, p.expiry(), sid)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			_, err = p.exec("INSERT INTO %[1]s (%[2]s, %[4]s, %[3]s) VALUES (?, ?, ?)", sid, data, p.expiry())
+		}
+	}
+	return err
+}
+
+// SessionRead get sqldb session by sid, a new session is stored by its release
+func (p *Provider) SessionRead(sid string) (session.Store, error) {
+	var data sql.NullString
+	err := p.db.QueryRow(p.query("SELECT %[4]s FROM %[1]s WHERE %[2]s=? AND %[3]s>=?"), sid, time.Now().Unix()).Scan(&data)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	kv := make(map[interface{}]interface{})
+	if data.String != "" {
+		b, err := base64.StdEncoding.DecodeString(data.String)
+		if err != nil {
+			return nil, err
+		}
+		if kv, err = session.DecodeGob(b); err != nil {
+			return nil, err
+		}
+	}
+	return &SessionStore{p: p, sid: sid, values: kv}, nil
+}
+
+// SessionExist check sqldb session exist
+func (p *Provider) SessionExist(sid string) bool {
+	var n int
+	err := p.db.QueryRow(p.query("SELECT COUNT(*) FROM %[1]s WHERE %[2]s=? AND %[3]s>=?"), sid, time.Now().Unix()).Scan(&n)
+	return err == nil && n > 0
+}
+
+// SessionRegenerate generate new sid for sqldb session
+func (p *Provider) SessionRegenerate(oldsid, sid string) (session.Store, error) {
+	if _, err := p.exec("UPDATE %[1]s SET %[2]s=? WHERE %[2]s=?", sid, oldsid); err != nil {
+		return nil, err
+	}
+	return p.SessionRead(sid)
+}
+
+// SessionDestroy delete sqldb session by sid
+func (p *Provider) SessionDestroy(sid string) error {
+	_, err := p.exec("DELETE FROM %[1]s WHERE %[2]s=?", sid)
+	return err
+}
+
+// SessionGC delete expired sessions, by batches of GCBatchSize
+func (p *Provider) SessionGC() {
+	var query string
+	switch p.dialect.Driver {
+	case orm.DRMySQL, orm.DRTiDB:
+		query = "DELETE FROM %[1]s WHERE %[3]s<? LIMIT " + fmt.Sprint(GCBatchSize)
+	case orm.DROracle:
+		query = "DELETE FROM %[1]s WHERE %[3]s<? AND ROWNUM<=" + fmt.Sprint(GCBatchSize)
+	default:
+		query = "DELETE FROM %[1]s WHERE %[2]s IN (SELECT %[2]s FROM %[1]s WHERE %[3]s<? LIMIT " + fmt.Sprint(GCBatchSize) + ")"
+	}
+	now := time.Now().Unix()
+	for {
+		res, err := p.exec(query, now)
+		if err != nil {
+			session.SLogger.Println(err)
+			return
+		}
+		if n, err := res.RowsAffected(); err != nil || n < int64(GCBatchSize) {
+			return
+		}
+	}
+}
+
+// SessionAll count the active sessions
+func (p *Provider) SessionAll() int {
+	var n int
+	if err := p.db.QueryRow(p.query("SELECT COUNT(*) FROM %[1]s WHERE %[3]s>=?"), time.Now().Unix()).Scan(&n); err != nil {
+		return 0
+	}
+	return n
+}
+
+func init() {
+	session.Register("sqldb", sqlpder)
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqldb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/izi-global/izigo/orm"
+	"github.com/izi-global/izigo/session"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSqlDB(t *testing.T) {
+	if err := orm.RegisterDataBase("sessions", "sqlite3", "file:sessions_test?mode=memory&cache=shared"); err != nil {
+		t.Fatal(err)
+	}
+	globalSessions, err := session.NewManager("sqldb", &session.ManagerConfig{
+		CookieName: "gosessionid", Gclifetime: 3600, EnableSetCookie: true, ProviderConfig: "sessions,http_session",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the table is only created once
+	if err = sqlpder.SessionInit(3600, "sessions,http_session"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, err := globalSessions.SessionStart(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Set("username", "diepdt")
+	sess.SessionRelease(w)
+	// the second release updates the row
+	sess.Set("username", "izigo")
+	sess.SessionRelease(w)
+
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	sess, err = globalSessions.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if username := sess.Get("username"); username != "izigo" {
+		t.Errorf("username is expected to be izigo, found %v", username)
+	}
+	if n := globalSessions.GetActiveSession(); n != 1 {
+		t.Errorf("1 active session is expected, found %d", n)
+	}
+
+	GCBatchSize = 1
+	defer func() { GCBatchSize = 1000 }()
+	for i := 0; i < 3; i++ {
+		sqlpder.exec("INSERT INTO %[1]s (%[2]s, %[4]s, %[3]s) VALUES (?, '', 1)", string('a'+rune(i)))
+	}
+	sqlpder.SessionGC()
+	var n int
+	sqlpder.db.QueryRow("SELECT COUNT(*) FROM http_session").Scan(&n)
+	if n != 1 {
+		t.Errorf("expired sessions are expected to be collected, found %d rows", n)
+	}
+
+	globalSessions.SessionDestroy(httptest.NewRecorder(), r)
+	if globalSessions.GetActiveSession() != 0 {
+		t.Error("destroyed session is not expected to be active")
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package token for session provider
+//
+// The session values are stored in a signed token, optionally encrypted,
+// which carries its id, issue time and expiry. The token is sent in a cookie
+// or, for mobile clients, in a response header and read back from the
+// Authorization header. Destroyed sessions are kept in a revocation list in
+// a cache adapter until their tokens expire.
+//
+// Usage:
+// import(
+//   _ "github.com/izi-global/izigo/session/token"
+//   "github.com/izi-global/izigo/session"
+// )
+//
+//	func init() {
+//		globalSessions, _ = session.NewManager("token", &session.ManagerConfig{
+//			CookieName:              "token",
+//			Gclifetime:              3600,
+//			EnableSidInHTTPHeader:   true,
+//			SessionNameInHTTPHeader: "Authorization",
+//			ProviderConfig:          `{"transport":"header","secretKeys":["${SESSION_KEY}"],"encrypt":true,"refresh":600}`,
+//		})
+//	}
+//
+// The client sends the token of the X-Session-Token response header back as
+// "Authorization: Bearer <token>". With the cookie transport, set
+// enableSetCookie to false and use the same cookie name as the manager.
+//
+// more docs: http://go.izi.asia/docs/module/session.md
+package token
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/config"
+	"github.com/izi-global/izigo/session"
+	"github.com/izi-global/izigo/utils/cookie"
+	"github.com/izi-global/izigo/utils/keyring"
+)
+
+// Token transports
+const (
+	TransportCookie = "cookie"
+	TransportHeader = "header"
+)
+
+const (
+	signedPrefix    = "s1."
+	encryptedPrefix = "e1."
+	revokedPrefix   = "session_revoked_"
+)
+
+var (
+	// ErrNoKeys is returned when neither secretKeys nor the keyring of the manager are set.
+	ErrNoKeys = errors.New("token session: no secret keys")
+	// ErrInvalid is returned for malformed, tampered or expired tokens.
+	ErrInvalid = errors.New("token session: invalid token")
+
+	tokenpder = &Provider{}
+)
+
+// claims is the content of a token.
+type claims struct {
+	ID       string
+	IssuedAt int64
+	Expires  int64
+	Values   []byte
+}
+
+// SessionStore token session store
+type SessionStore struct {
+	p        *Provider
+	claims   claims
+	values   map[interface{}]interface{}
+	lock     sync.RWMutex
+	modified bool
+}
+
+// Set value in token session
+func (st *SessionStore) Set(key, value interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values[key] = value
+	st.modified = true
+	return nil
+}
+
+// Get value from token session
+func (st *SessionStore) Get(key interface{}) interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	if v, ok := st.values[key]; ok {
+		return v
+	}
+	return nil
+}
+
+// Delete value in token session
+func (st *SessionStore) Delete(key interface{}) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	delete(st.values, key)
+	st.modified = true
+	return nil
+}
+
+// Flush clear all values in token session
+func (st *SessionStore) Flush() error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.values = make(map[interface{}]interface{})
+	st.modified = true
+	return nil
+}
+
+// SessionID returns the id of the token, which stays the same when it is refreshed
+func (st *SessionStore) SessionID() string {
+	return st.claims.ID
+}
+
+// SessionRelease issues the token like SessionIssue. The Manager calls
+// SessionIssue before the response is written, the token of a session
+// modified later can not reach the client.
+func (st *SessionStore) SessionRelease(w http.ResponseWriter) {
+	st.SessionIssue(w)
+}
+
+// SessionIssue issues a new token when the session is new or modified,
+// or when the refresh interval of its token elapsed.
+func (st *SessionStore) SessionIssue(w http.ResponseWriter) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	now := time.Now().Unix()
+	if !st.modified && st.claims.IssuedAt != 0 && (st.p.config.Refresh <= 0 || now-st.claims.IssuedAt < st.p.config.Refresh) {
+		return
+	}
+	b, err := session.EncodeGob(st.values)
+	if err != nil {
+		session.SLogger.Println(err)
+		return
+	}
+	st.claims.IssuedAt = now
+	st.claims.Expires = now + st.p.maxlifetime
+	st.claims.Values = b
+	token, err := st.p.encode(&st.claims)
+	if err != nil {
+		session.SLogger.Println(err)
+		return
+	}
+	st.modified = false
+	if st.p.config.Transport == TransportHeader {
+		w.Header().Set(st.p.config.HeaderName, token)
+		return
+	}
+	sameSite, _ := cookie.ParseSameSite(st.p.config.SameSite)
+	cookie.Set(w, st.p.config.CookieName, url.QueryEscape(token), &cookie.Options{
+		MaxAge:   st.p.maxlifetime,
+		Secure:   st.p.config.Secure,
+		HTTPOnly: true,
+		SameSite: sameSite,
+	})
+}
+
+type tokenConfig struct {
+	Transport         string   `json:"transport"`
+	CookieName        string   `json:"cookieName"`
+	HeaderName        string   `json:"headerName"`
+	Secure            bool     `json:"secure"`
+	SameSite          string   `json:"sameSite"`
+	SecretKeys        []string `json:"secretKeys"`
+	Encrypt           bool     `json:"encrypt"`
+	Refresh           int64    `json:"refresh"`
+	RevocationAdapter string   `json:"revocationAdapter"`
+	RevocationConfig  string   `json:"revocationConfig"`
+}
+
+// Provider token session provider
+type Provider struct {
+	maxlifetime int64
+	config      *tokenConfig
+	keyring     *keyring.Keyring
+	revoked     cache.CacheV2
+}
+
+// SetKeyring sets the keyring signing the tokens, it implements session.KeyringProvider.
+// The secretKeys of the provider config take precedence.
+func (p *Provider) SetKeyring(kr *keyring.Keyring) {
+	p.keyring = kr
+}
+
+// SessionInit init token session provider with max lifetime and config json.
+// maxlifetime is the lifetime of a token.
+// json config:
+// 	transport - cookie (default) or header.
+// 	cookieName - cookie name of the cookie transport, the cookie name of the manager.
+// 	headerName - response header of the header transport, default X-Session-Token.
+// 	secure, sameSite - attributes of the cookie.
+// 	secretKeys - secrets signing the tokens, the first one is the primary key.
+// 	  ${ENV} values are expanded. Default the SecretKeys of the application.
+// 	encrypt - encrypt the values with AES-GCM instead of only signing them.
+// 	refresh - seconds after which a token is reissued with a new expiry, 0 disables the refresh.
+// 	revocationAdapter - cache adapter of the revocation list, default memory.
+// 	  The memory adapter only revokes within the process.
+// 	revocationConfig - config of the cache adapter.
+func (p *Provider) SessionInit(maxlifetime int64, cfg string) error {
+	p.config = &tokenConfig{}
+	if cfg != "" {
+		if err := json.Unmarshal([]byte(cfg), p.config); err != nil {
+			return err
+		}
+	}
+	if p.config.Transport == "" {
+		p.config.Transport = TransportCookie
+	}
+	if p.config.HeaderName == "" {
+		p.config.HeaderName = "X-Session-Token"
+	}
+	if p.config.RevocationAdapter == "" {
+		p.config.RevocationAdapter = "memory"
+	}
+	if p.config.Transport != TransportCookie && p.config.Transport != TransportHeader {
+		return errors.New("token session: unknown transport " + p.config.Transport)
+	}
+	if p.config.Transport == TransportCookie {
+		sameSite, err := cookie.ParseSameSite(p.config.SameSite)
+		if err != nil {
+			return err
+		}
+		opts := &cookie.Options{Secure: p.config.Secure, SameSite: sameSite}
+		if err = opts.Validate(p.config.CookieName); err != nil {
+			return err
+		}
+	}
+	if len(p.config.SecretKeys) > 0 {
+		secrets := make([]string, len(p.config.SecretKeys))
+		for i, s := range p.config.SecretKeys {
+			secrets[i] = config.ExpandValueEnv(s)
+		}
+		kr, err := keyring.New(secrets...)
+		if err != nil {
+			return err
+		}
+		p.keyring = kr
+	}
+	if p.keyring == nil {
+		return ErrNoKeys
+	}
+	revoked, err := cache.NewCacheV2(p.config.RevocationAdapter, p.config.RevocationConfig)
+	if err != nil {
+		return err
+	}
+	p.revoked = revoked
+	p.maxlifetime = maxlifetime
+	return nil
+}
+
+// encode returns the token of c.
+func (p *Provider) encode(c *claims) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(c); err != nil {
+		return "", err
+	}
+	if p.config.Encrypt {
+		b, err := p.keyring.Encrypt(buf.Bytes(), []byte(encryptedPrefix))
+		if err != nil {
+			return "", err
+		}
+		return encryptedPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+	}
+	body := base64.RawURLEncoding.EncodeToString(buf.Bytes())
+	sig := p.keyring.Sign([]byte(signedPrefix + body))
+	return signedPrefix + body + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// decode verifies token and returns its claims, expired tokens are accepted
+// when allowExpired is true.
+func (p *Provider) decode(token string, allowExpired bool) (*claims, error) {
+	var b []byte
+	switch {
+	case strings.HasPrefix(token, encryptedPrefix):
+		data, err := base64.RawURLEncoding.DecodeString(token[len(encryptedPrefix):])
+		if err != nil {
+			return nil, ErrInvalid
+		}
+		if b, err = p.keyring.Decrypt(data, []byte(encryptedPrefix)); err != nil {
+			return nil, ErrInvalid
+		}
+	case strings.HasPrefix(token, signedPrefix):
+		i := strings.LastIndexByte(token, '.')
+		sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+		if err != nil || !p.keyring.Verify([]byte(token[:i]), sig) {
+			return nil, ErrInvalid
+		}
+		if b, err = base64.RawURLEncoding.DecodeString(token[len(signedPrefix):i]); err != nil {
+			return nil, ErrInvalid
+		}
+	default:
+		return nil, ErrInvalid
+	}
+	c := &claims{}
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(c); err != nil || c.ID == "" {
+		return nil, ErrInvalid
+	}
+	if !allowExpired && c.Expires < time.Now().Unix() {
+		return nil, ErrInvalid
+	}
+	return c, nil
+}
+
+// valid returns the claims of a valid token which was not revoked.
+// A token is rejected when the revocation list can not be read.
+func (p *Provider) valid(token string) (*claims, error) {
+	c, err := p.decode(token, false)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := p.revoked.IsExist(context.Background(), revokedPrefix+c.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalid
+	}
+	return c, nil
+}
+
+// revoke adds the id of sid to the revocation list for the lifetime of the tokens,
+// sid being a token or the id of its session as returned by SessionID.
+// The tokens of a session are refreshed with the same id, so all of them are revoked.
+func (p *Provider) revoke(sid string) error {
+	id := sid
+	if strings.HasPrefix(sid, signedPrefix) || strings.HasPrefix(sid, encryptedPrefix) {
+		c, err := p.decode(sid, true)
+		if err != nil {
+			return nil
+		}
+		id = c.ID
+	}
+	if id == "" {
+		return nil
+	}
+	return p.revoked.Put(context.Background(), revokedPrefix+id, true, time.Duration(p.maxlifetime)*time.Second)
+}
+
+// SessionRead returns the session of a valid token.
+// Any other sid, such as a new id generated by the manager, starts a new session.
+func (p *Provider) SessionRead(sid string) (session.Store, error) {
+	if c, err := p.valid(sid); err == nil {
+		values, err := session.DecodeGob(c.Values)
+		if err != nil {
+			return nil, err
+		}
+		return &SessionStore{p: p, claims: *c, values: values}, nil
+	}
+	return &SessionStore{p: p, claims: claims{ID: sid}, values: make(map[interface{}]interface{})}, nil
+}
+
+// SessionExist returns whether sid is a valid token which was not revoked
+func (p *Provider) SessionExist(sid string) bool {
+	_, err := p.valid(sid)
+	return err == nil
+}
+
+// SessionRegenerate revokes the old token and moves its values to a token with the id sid
+func (p *Provider) SessionRegenerate(oldsid, sid string) (session.Store, error) {
+	st, err := p.SessionRead(oldsid)
+	if err != nil {
+		return nil, err
+	}
+	p.revoke(oldsid)
+	ts := st.(*SessionStore)
+	ts.claims = claims{ID: sid}
+	ts.modified = true
+	return ts, nil
+}
+
+// SessionDestroy revokes the token sid, or the tokens of the session id sid,
+// they are rejected until they expire
+func (p *Provider) SessionDestroy(sid string) error {
+	return p.revoke(sid)
+}
+
+// SessionGC Implement method, the revocation list expires with the cache.
+func (p *Provider) SessionGC() {
+}
+
+// SessionAll Implement method, return 0.
+func (p *Provider) SessionAll() int {
+	return 0
+}
+
+func init() {
+	session.Register("token", tokenpder)
+}
@@ -0,0 +1,177 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package token
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/izi-global/izigo/cache"
+	"github.com/izi-global/izigo/session"
+)
+
+// brokenCache is a revocation list which can not be read
+type brokenCache struct {
+	cache.CacheV2
+}
+
+func (c *brokenCache) IsExist(ctx context.Context, key string) (bool, error) {
+	return false, errors.New("broken cache")
+}
+
+func newManager(t *testing.T, conf *session.ManagerConfig) *session.Manager {
+	conf.Gclifetime = 3600
+	m, err := session.NewManager("token", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestTokenCookie(t *testing.T) {
+	m := newManager(t, &session.ManagerConfig{
+		CookieName:     "token",
+		ProviderConfig: `{"cookieName":"token","secretKeys":["secret"]}`,
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, err := m.SessionStart(w, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess.Set("username", "diepdt")
+	sess.SessionRelease(w)
+	cookie := w.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(cookie, "token="+signedPrefix) {
+		t.Fatalf("signed token cookie is expected, found %q", cookie)
+	}
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	w = httptest.NewRecorder()
+	sess, _ = m.SessionStart(w, r)
+	if username := sess.Get("username"); username != "diepdt" {
+		t.Errorf("username is expected to be diepdt, found %v", username)
+	}
+	sess.SessionRelease(w)
+	if w.Header().Get("Set-Cookie") != "" {
+		t.Error("unmodified token is not expected to be reissued before its refresh")
+	}
+
+	// a tampered token starts a new session
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", strings.Replace(cookie, signedPrefix, signedPrefix+"A", 1))
+	sess, _ = m.SessionStart(httptest.NewRecorder(), r)
+	if sess.Get("username") != nil {
+		t.Error("tampered token is expected to be rejected")
+	}
+
+	// a destroyed token is revoked
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	m.SessionDestroy(httptest.NewRecorder(), r)
+	sess, _ = m.SessionStart(httptest.NewRecorder(), r)
+	if sess.Get("username") != nil {
+		t.Error("destroyed token is expected to be revoked")
+	}
+}
+
+func TestTokenHeader(t *testing.T) {
+	m := newManager(t, &session.ManagerConfig{
+		CookieName:              "token",
+		EnableSidInHTTPHeader:   true,
+		SessionNameInHTTPHeader: "Authorization",
+		ProviderConfig:          `{"transport":"header","secretKeys":["new","old"],"encrypt":true,"refresh":-1}`,
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, _ := m.SessionStart(w, r)
+	id := sess.SessionID()
+	sess.Set("username", "diepdt")
+	sess.SessionRelease(w)
+	token := w.Header().Get("X-Session-Token")
+	if !strings.HasPrefix(token, encryptedPrefix) {
+		t.Fatalf("encrypted token is expected in the header, found %q", token)
+	}
+
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	sess, _ = m.SessionStart(httptest.NewRecorder(), r)
+	if username := sess.Get("username"); username != "diepdt" || sess.SessionID() != id {
+		t.Errorf("session is expected to be read from the bearer token, found %v %s", username, sess.SessionID())
+	}
+
+	// the token is reissued with a new expiry, keeping its id
+	tokenpder.config.Refresh = 1
+	sess.(*SessionStore).claims.IssuedAt -= 2
+	w = httptest.NewRecorder()
+	sess.SessionRelease(w)
+	refreshed, err := tokenpder.decode(w.Header().Get("X-Session-Token"), false)
+	if err != nil || refreshed.ID != id {
+		t.Errorf("refreshed token is expected to keep its id, found %v %v", refreshed, err)
+	}
+}
+
+func TestTokenRevocationError(t *testing.T) {
+	m := newManager(t, &session.ManagerConfig{
+		CookieName:     "token",
+		ProviderConfig: `{"cookieName":"token","secretKeys":["secret"]}`,
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, _ := m.SessionStart(w, r)
+	sess.Set("username", "diepdt")
+	sess.SessionRelease(w)
+	cookie := w.Header().Get("Set-Cookie")
+
+	p := tokenpder
+	revoked := p.revoked
+	p.revoked = &brokenCache{revoked}
+	defer func() { p.revoked = revoked }()
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	sess, _ = m.SessionStart(httptest.NewRecorder(), r)
+	if sess.Get("username") != nil {
+		t.Error("token is expected to be rejected when the revocation list fails")
+	}
+}
+
+func TestTokenDestroyByID(t *testing.T) {
+	m := newManager(t, &session.ManagerConfig{
+		CookieName:     "token",
+		Maxlifetime:    3600,
+		ProviderConfig: `{"cookieName":"token","secretKeys":["secret"]}`,
+	})
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, _ := m.SessionStart(w, r)
+	sess.Set("username", "diepdt")
+	sess.SessionRelease(w)
+	cookie := w.Header().Get("Set-Cookie")
+
+	if err := m.SessionDestroyByID(sess.SessionID()); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	sess, _ = m.SessionStart(httptest.NewRecorder(), r)
+	if sess.Get("username") != nil {
+		t.Error("token is expected to be revoked by the id of its session")
+	}
+}
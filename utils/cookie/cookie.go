@@ -0,0 +1,179 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cookie builds Set-Cookie headers from typed options.
+// It is shared by the context, the controller and the session manager.
+// Usage:
+//	import "github.com/izi-global/izigo/utils/cookie"
+//
+//	ctx.Output.Cookie("theme", "dark", &cookie.Options{
+//		MaxAge:   3600,
+//		Secure:   true,
+//		HTTPOnly: true,
+//		SameSite: cookie.SameSiteLax,
+//	})
+//
+// Names starting with "__Secure-" must be Secure, names starting with
+// "__Host-" must also have the path "/" and no domain, as browsers
+// ignore such cookies otherwise. SameSite=None and Partitioned require Secure too.
+package cookie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SameSite is the SameSite attribute of a cookie.
+type SameSite string
+
+// SameSite values, SameSiteDefault omits the attribute.
+const (
+	SameSiteDefault SameSite = ""
+	SameSiteLax     SameSite = "Lax"
+	SameSiteStrict  SameSite = "Strict"
+	SameSiteNone    SameSite = "None"
+)
+
+// Cookie name prefixes with restrictions enforced by browsers.
+const (
+	PrefixSecure = "__Secure-"
+	PrefixHost   = "__Host-"
+)
+
+var (
+	// ErrSecureRequired is returned when a prefixed, SameSite=None or
+	// Partitioned cookie is not Secure.
+	ErrSecureRequired = errors.New("cookie: Secure attribute is required")
+	// ErrHostPrefix is returned when a __Host- cookie has a domain or a path other than "/".
+	ErrHostPrefix = errors.New("cookie: __Host- cookie requires path \"/\" and no domain")
+	// ErrSameSite is returned for unknown SameSite values.
+	ErrSameSite = errors.New("cookie: invalid SameSite value")
+)
+
+// Options represents the attributes of a cookie.
+type Options struct {
+	// MaxAge in seconds. It is sent with a matching Expires for old browsers.
+	// A negative MaxAge deletes the cookie, 0 uses Expires.
+	MaxAge int64
+	// Expires is used when MaxAge is 0, the zero time makes a session cookie.
+	Expires time.Time
+	// Path of the cookie, default "/".
+	Path        string
+	Domain      string
+	Secure      bool
+	HTTPOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// ParseSameSite parses a config value such as "lax", "strict" or "none".
+func ParseSameSite(s string) (SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return SameSiteDefault, nil
+	case "lax":
+		return SameSiteLax, nil
+	case "strict":
+		return SameSiteStrict, nil
+	case "none":
+		return SameSiteNone, nil
+	}
+	return SameSiteDefault, ErrSameSite
+}
+
+// RequiresSecure returns whether a cookie named name with opts must be Secure.
+func RequiresSecure(name string, opts *Options) bool {
+	return strings.HasPrefix(name, PrefixSecure) || strings.HasPrefix(name, PrefixHost) ||
+		opts.SameSite == SameSiteNone || opts.Partitioned
+}
+
+// Validate checks the prefix rules of name and the attributes which require Secure.
+func (opts *Options) Validate(name string) error {
+	if _, err := ParseSameSite(string(opts.SameSite)); err != nil {
+		return err
+	}
+	if RequiresSecure(name, opts) && !opts.Secure {
+		return ErrSecureRequired
+	}
+	if strings.HasPrefix(name, PrefixHost) && (opts.Domain != "" || (opts.Path != "" && opts.Path != "/")) {
+		return ErrHostPrefix
+	}
+	return nil
+}
+
+// String returns the Set-Cookie header value, without validation.
+func (opts *Options) String(name, value string) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s=%s", SanitizeName(name), SanitizeValue(value))
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+	fmt.Fprintf(&b, "; Path=%s", SanitizeValue(path))
+	if opts.Domain != "" {
+		fmt.Fprintf(&b, "; Domain=%s", SanitizeValue(opts.Domain))
+	}
+	switch {
+	case opts.MaxAge > 0:
+		expires := time.Now().Add(time.Duration(opts.MaxAge) * time.Second)
+		fmt.Fprintf(&b, "; Expires=%s; Max-Age=%d", expires.UTC().Format(http.TimeFormat), opts.MaxAge)
+	case opts.MaxAge < 0:
+		fmt.Fprintf(&b, "; Expires=%s; Max-Age=0", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+	case !opts.Expires.IsZero():
+		fmt.Fprintf(&b, "; Expires=%s", opts.Expires.UTC().Format(http.TimeFormat))
+	}
+	if opts.Secure {
+		b.WriteString("; Secure")
+	}
+	if opts.HTTPOnly {
+		b.WriteString("; HttpOnly")
+	}
+	if opts.SameSite != SameSiteDefault {
+		fmt.Fprintf(&b, "; SameSite=%s", opts.SameSite)
+	}
+	if opts.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+	return b.String()
+}
+
+// Set validates opts and adds the cookie to the response header.
+func Set(w http.ResponseWriter, name, value string, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if err := opts.Validate(name); err != nil {
+		return err
+	}
+	w.Header().Add("Set-Cookie", opts.String(name, value))
+	return nil
+}
+
+var cookieNameSanitizer = strings.NewReplacer("\n", "-", "\r", "-")
+
+// SanitizeName replaces the line breaks of a cookie name.
+func SanitizeName(n string) string {
+	return cookieNameSanitizer.Replace(n)
+}
+
+var cookieValueSanitizer = strings.NewReplacer("\n", " ", "\r", " ", ";", " ")
+
+// SanitizeValue replaces the line breaks and semicolons of a cookie value.
+func SanitizeValue(v string) string {
+	return cookieValueSanitizer.Replace(v)
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cookie
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestString(t *testing.T) {
+	opts := &Options{
+		MaxAge:      60,
+		Domain:      "izi.asia",
+		Secure:      true,
+		HTTPOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	v := opts.String("name", "va;lue")
+	for _, want := range []string{"name=va lue; Path=/; Domain=izi.asia; Expires=", "; Max-Age=60; Secure; HttpOnly; SameSite=None; Partitioned"} {
+		if !strings.Contains(v, want) {
+			t.Errorf("cookie is expected to contain %q, found %q", want, v)
+		}
+	}
+
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if v := (&Options{Path: "/app", Expires: expires}).String("n", "v"); v != "n=v; Path=/app; Expires=Wed, 02 Jan 2030 03:04:05 GMT" {
+		t.Errorf("unexpected cookie %q", v)
+	}
+	if v := (&Options{MaxAge: -1}).String("n", ""); !strings.HasSuffix(v, "; Max-Age=0") {
+		t.Errorf("deleted cookie is expected to have Max-Age=0, found %q", v)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		opts Options
+		err  error
+	}{
+		{"__Secure-id", Options{}, ErrSecureRequired},
+		{"__Secure-id", Options{Secure: true, Domain: "izi.asia"}, nil},
+		{"__Host-id", Options{Secure: true}, nil},
+		{"__Host-id", Options{Secure: true, Domain: "izi.asia"}, ErrHostPrefix},
+		{"__Host-id", Options{Secure: true, Path: "/app"}, ErrHostPrefix},
+		{"id", Options{SameSite: SameSiteNone}, ErrSecureRequired},
+		{"id", Options{Partitioned: true}, ErrSecureRequired},
+		{"id", Options{SameSite: "Loose"}, ErrSameSite},
+		{"id", Options{SameSite: SameSiteStrict}, nil},
+	}
+	for _, c := range cases {
+		if err := c.opts.Validate(c.name); err != c.err {
+			t.Errorf("%s %+v: error is expected to be %v, found %v", c.name, c.opts, c.err, err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	if err := Set(w, "__Host-id", "v", nil); err != ErrSecureRequired || w.Header().Get("Set-Cookie") != "" {
+		t.Error("invalid cookie should not be set")
+	}
+}
@@ -0,0 +1,260 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keyring signs and encrypts values with a list of rotating secrets.
+// The first secret is the primary one, it is used to sign and encrypt.
+// The other secrets are only used to verify and decrypt, so that values
+// produced before a rotation stay valid.
+// Usage:
+//	import "github.com/izi-global/izigo/utils/keyring"
+//
+//	kr, err := keyring.New("new secret", "old secret")
+//	cookie := kr.EncodeValue("remember", "user:42")
+//	value, err := kr.DecodeValue("remember", cookie, 3600)
+//
+// Rotating a secret means prepending a new one and keeping the old one
+// until every value it produced has expired:
+//
+//	// app.conf
+//	SecretKeys = ${IZIGO_SECRET_KEYS}
+//
+//	IZIGO_SECRET_KEYS="new secret;old secret"
+//
+// Values are encrypted with AES-256-GCM. The AES and HMAC keys are derived
+// from each secret, and every output starts with the id of the key which
+// produced it.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/izi-global/izigo/config"
+)
+
+const idLen = 4
+
+var (
+	// ErrNoKeys is returned when a keyring is created without secrets.
+	ErrNoKeys = errors.New("keyring: no secret keys")
+	// ErrInvalid is returned when a value is malformed, tampered or
+	// produced by an unknown key.
+	ErrInvalid = errors.New("keyring: invalid value")
+	// ErrExpired is returned when a value is older than the allowed max age.
+	ErrExpired = errors.New("keyring: value expired")
+)
+
+type key struct {
+	id   []byte
+	aead cipher.AEAD
+	mac  []byte
+}
+
+// Keyring holds the primary key and the older keys, it is safe for concurrent use.
+type Keyring struct {
+	keys    []*key
+	secrets []string
+}
+
+// New returns a Keyring from secrets, the first one is the primary key.
+// Empty secrets are skipped.
+func New(secrets ...string) (*Keyring, error) {
+	kr := &Keyring{}
+	for _, s := range secrets {
+		if s == "" {
+			continue
+		}
+		k, err := newKey(s)
+		if err != nil {
+			return nil, err
+		}
+		kr.keys = append(kr.keys, k)
+		kr.secrets = append(kr.secrets, s)
+	}
+	if len(kr.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	return kr, nil
+}
+
+// FromEnv returns a Keyring from the environment variable name,
+// the secrets are separated by ";".
+func FromEnv(name string) (*Keyring, error) {
+	return New(split(os.Getenv(name))...)
+}
+
+// FromConfig returns a Keyring from the config key, the secrets are separated by ";".
+// Environment variables such as ${IZIGO_SECRET_KEYS} are expanded by the config adapters.
+func FromConfig(cnf config.Configer, key string) (*Keyring, error) {
+	return New(cnf.Strings(key)...)
+}
+
+func split(s string) []string {
+	var secrets []string
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+	return secrets
+}
+
+func newKey(secret string) (*key, error) {
+	block, err := aes.NewCipher(derive(secret, "encrypt"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &key{
+		id:   derive(secret, "id")[:idLen],
+		aead: aead,
+		mac:  derive(secret, "sign"),
+	}, nil
+}
+
+// derive returns a 32 bytes key for purpose, so that the same secret
+// never serves as the key of two algorithms.
+func derive(secret, purpose string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(h, "izigo keyring "+purpose)
+	return h.Sum(nil)
+}
+
+// Rotate returns a new Keyring whose primary key is secret,
+// the current keys are kept to verify and decrypt.
+func (kr *Keyring) Rotate(secret string) (*Keyring, error) {
+	return New(append([]string{secret}, kr.secrets...)...)
+}
+
+// Len returns the number of keys.
+func (kr *Keyring) Len() int {
+	return len(kr.keys)
+}
+
+func (kr *Keyring) find(id []byte) *key {
+	for _, k := range kr.keys {
+		if hmac.Equal(k.id, id) {
+			return k
+		}
+	}
+	return nil
+}
+
+// Encrypt encrypts and authenticates plaintext with the primary key.
+// additional is authenticated but not encrypted, such as the cookie name,
+// and must be given again to Decrypt.
+func (kr *Keyring) Encrypt(plaintext, additional []byte) ([]byte, error) {
+	k := kr.keys[0]
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, idLen+len(nonce)+len(plaintext)+k.aead.Overhead())
+	out = append(out, k.id...)
+	out = append(out, nonce...)
+	return k.aead.Seal(out, nonce, plaintext, k.aad(additional)), nil
+}
+
+// Decrypt decrypts ciphertext produced by Encrypt with any key of the keyring.
+func (kr *Keyring) Decrypt(ciphertext, additional []byte) ([]byte, error) {
+	if len(ciphertext) < idLen {
+		return nil, ErrInvalid
+	}
+	k := kr.find(ciphertext[:idLen])
+	if k == nil {
+		return nil, ErrInvalid
+	}
+	ns := k.aead.NonceSize()
+	if len(ciphertext) < idLen+ns {
+		return nil, ErrInvalid
+	}
+	nonce := ciphertext[idLen : idLen+ns]
+	plaintext, err := k.aead.Open(nil, nonce, ciphertext[idLen+ns:], k.aad(additional))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return plaintext, nil
+}
+
+// Sign returns the HMAC-SHA256 signature of data made with the primary key.
+func (kr *Keyring) Sign(data []byte) []byte {
+	k := kr.keys[0]
+	return append(append([]byte{}, k.id...), k.sign(data)...)
+}
+
+// Verify returns whether sig is the signature of data made with any key of the keyring.
+func (kr *Keyring) Verify(data, sig []byte) bool {
+	if len(sig) < idLen {
+		return false
+	}
+	k := kr.find(sig[:idLen])
+	return k != nil && hmac.Equal(sig[idLen:], k.sign(data))
+}
+
+func (k *key) aad(additional []byte) []byte {
+	return append(append(make([]byte, 0, idLen+len(additional)), k.id...), additional...)
+}
+
+func (k *key) sign(data []byte) []byte {
+	h := hmac.New(sha256.New, k.mac)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// EncodeValue encrypts value with its creation time, for use in a cookie named name.
+// The result is URL safe base64.
+func (kr *Keyring) EncodeValue(name, value string) string {
+	plaintext := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(plaintext, uint64(time.Now().Unix()))
+	plaintext = append(plaintext, value...)
+	b, err := kr.Encrypt(plaintext, []byte(name))
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeValue returns the value encoded by EncodeValue for the same name.
+// If maxAge is greater than 0, values older than maxAge seconds are rejected.
+func (kr *Keyring) DecodeValue(name, encoded string, maxAge int64) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	plaintext, err := kr.Decrypt(b, []byte(name))
+	if err != nil {
+		return "", err
+	}
+	if len(plaintext) < 8 {
+		return "", ErrInvalid
+	}
+	created := int64(binary.BigEndian.Uint64(plaintext))
+	if maxAge > 0 && created+maxAge < time.Now().Unix() {
+		return "", ErrExpired
+	}
+	return string(plaintext[8:]), nil
+}
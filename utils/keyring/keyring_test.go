@@ -0,0 +1,99 @@
+// Copyright 2018 IZI Global. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyring
+
+import (
+	"encoding/base64"
+	"os"
+	"testing"
+)
+
+func TestRotation(t *testing.T) {
+	old, err := New("old secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := old.EncodeValue("session", "user:42")
+	sig := old.Sign([]byte("token"))
+
+	kr, err := old.Rotate("new secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kr.Len() != 2 {
+		t.Fatalf("rotated keyring is expected to have 2 keys, found %d", kr.Len())
+	}
+	if v, err := kr.DecodeValue("session", encoded, 0); err != nil || v != "user:42" {
+		t.Errorf("value of the old key is expected to decode, found %q %v", v, err)
+	}
+	if !kr.Verify([]byte("token"), sig) {
+		t.Error("signature of the old key is expected to verify")
+	}
+
+	// values of the new primary key are unknown to the old keyring
+	if _, err := old.DecodeValue("session", kr.EncodeValue("session", "user:42"), 0); err != ErrInvalid {
+		t.Errorf("value of an unknown key is expected to be invalid, found %v", err)
+	}
+	if old.Verify([]byte("token"), kr.Sign([]byte("token"))) {
+		t.Error("signature of an unknown key should not verify")
+	}
+}
+
+func TestTamper(t *testing.T) {
+	kr, _ := New("secret")
+	encoded := kr.EncodeValue("session", "user:42")
+	if _, err := kr.DecodeValue("other", encoded, 0); err != ErrInvalid {
+		t.Errorf("value of another name is expected to be invalid, found %v", err)
+	}
+	b := []byte(encoded)
+	b[len(b)-2] ^= 1
+	if _, err := kr.DecodeValue("session", string(b), 0); err != ErrInvalid {
+		t.Errorf("tampered value is expected to be invalid, found %v", err)
+	}
+	if kr.Verify([]byte("token2"), kr.Sign([]byte("token"))) {
+		t.Error("signature of other data should not verify")
+	}
+	if _, err := New("", ""); err != ErrNoKeys {
+		t.Errorf("empty secrets are expected to return ErrNoKeys, found %v", err)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	kr, _ := New("secret")
+	b, _ := kr.Encrypt([]byte{0, 0, 0, 0, 0, 0, 0, 1, 'v'}, []byte("session"))
+	encoded := base64.RawURLEncoding.EncodeToString(b)
+	if _, err := kr.DecodeValue("session", encoded, 60); err != ErrExpired {
+		t.Errorf("old value is expected to be expired, found %v", err)
+	}
+	if v, err := kr.DecodeValue("session", encoded, 0); err != nil || v != "v" {
+		t.Errorf("value without max age is expected to decode, found %q %v", v, err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	os.Setenv("IZIGO_TEST_SECRET_KEYS", "new; old")
+	defer os.Unsetenv("IZIGO_TEST_SECRET_KEYS")
+	kr, err := FromEnv("IZIGO_TEST_SECRET_KEYS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := New("old")
+	if v, err := kr.DecodeValue("n", old.EncodeValue("n", "v"), 0); err != nil || v != "v" {
+		t.Errorf("keyring from env is expected to hold the old key, found %q %v", v, err)
+	}
+	if _, err := FromEnv("IZIGO_TEST_SECRET_KEYS_MISSING"); err != ErrNoKeys {
+		t.Errorf("missing env is expected to return ErrNoKeys, found %v", err)
+	}
+}